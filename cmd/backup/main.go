@@ -1,4 +1,4 @@
-// This package is the service that deletes old exposure keys; it is intended to be invoked over HTTP by Cloud Scheduler.
+// This package is the service that backs up the database; it is intended to be invoked over HTTP by Cloud Scheduler, or to run on its own schedule.
 package main
 
 import (
@@ -54,7 +54,7 @@ func realMain(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("server.New: %w", err)
 	}
-	slog.Info("listening on: ", config.Port)
+	slog.Info("listening", "port", config.Port)
 
 	return srv.ServeHTTPHandler(ctx, backupServer.Run(ctx))
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+	"github.com/urfave/cli/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/paveletto99/microservice-blueprint/internal/client"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+// exitRPCBase is added to the gRPC status code of failed calls to make the
+// exit code of commands, so that scripts can tell e.g. NOT_FOUND (69) from
+// UNAVAILABLE (78). Other errors exit with 1.
+const exitRPCBase = 64
+
+// clientFlags are the connection flags of the commands calling our services.
+// Unset flags fall back to the PAYMENT_* environment variables of
+// client.Config.
+var clientFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "target",
+		Usage: "gRPC target of the service, e.g. dns:///payment:50051",
+	},
+	&cli.BoolFlag{
+		Name:  "insecure",
+		Usage: "connect without TLS",
+	},
+	&cli.StringFlag{
+		Name:  "ca-file",
+		Usage: "PEM bundle of the CAs trusted to sign the certificate of the service",
+	},
+	&cli.StringFlag{
+		Name:  "server-name",
+		Usage: "name the certificate of the service is checked against",
+	},
+	&cli.StringFlag{
+		Name:  "cert-file",
+		Usage: "client certificate presented for mTLS",
+	},
+	&cli.StringFlag{
+		Name:  "key-file",
+		Usage: "key of the client certificate",
+	},
+	&cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "deadline of each unary call",
+	},
+}
+
+// outputFlag returns the --output flag, defaulting to format.
+func outputFlag(format string) cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "output format: table, json or yaml",
+		Value:   format,
+	}
+}
+
+// clientConfig returns the client configuration of the environment, overridden
+// by the flags of c.
+func clientConfig(c *cli.Context) (*client.Config, error) {
+	var config client.Config
+	if err := envconfig.Process(c.Context, &config); err != nil {
+		return nil, fmt.Errorf("failed to process client env: %w", err)
+	}
+
+	for name, dst := range map[string]*string{
+		"target":      &config.Target,
+		"ca-file":     &config.CAFile,
+		"server-name": &config.ServerName,
+		"cert-file":   &config.CertFile,
+		"key-file":    &config.KeyFile,
+	} {
+		if c.IsSet(name) {
+			*dst = c.String(name)
+		}
+	}
+	if c.IsSet("insecure") {
+		config.Insecure = c.Bool("insecure")
+	}
+	if c.IsSet("timeout") {
+		config.Timeout = c.Duration("timeout")
+	}
+	return &config, nil
+}
+
+// newPaymentClient creates a payment client configured by the flags of c. The
+// caller must close it.
+func newPaymentClient(c *cli.Context) (*client.Client, error) {
+	config, err := clientConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewClient(c.Context, config, nil)
+}
+
+// exitError returns err as a cli.ExitCoder whose code reflects the gRPC status
+// of err.
+func exitError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var exit cli.ExitCoder
+	if errors.As(err, &exit) {
+		return err
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			st = status.FromContextError(err)
+		} else {
+			return cli.Exit(err, 1)
+		}
+	}
+	msg := st.Message()
+	if e, ok := apperrors.FromError(err); ok {
+		msg = e.Error()
+	}
+	return cli.Exit(fmt.Sprintf("%s: %s", st.Code(), msg), exitRPCBase+int(st.Code()))
+}
+
+// isCanceled reports whether err is the end of a call canceled by ctx, e.g. by
+// an interrupt.
+func isCanceled(ctx context.Context, err error) bool {
+	return ctx.Err() != nil && status.Code(err) == codes.Canceled
+}
+
+// parseTime parses a flag value in RFC 3339 format, e.g. 2024-01-02T15:04:05Z.
+func parseTime(name, value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--%s must be in RFC 3339 format: %w", name, err)
+	}
+	return t, nil
+}
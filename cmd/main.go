@@ -28,7 +28,7 @@ type AppOptions struct {
 
 func main() {
 	// setup context
-	_, done := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	ctx, done := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
@@ -61,7 +61,9 @@ func main() {
 		UsageText: `service <options> <flags>
 A longer sentence, about how exactly to use this program`,
 		Commands: []*cli.Command{
-			{},
+			migrateCommand,
+			paymentCommand,
+			rpcCommand,
 		},
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
@@ -106,7 +108,7 @@ A longer sentence, about how exactly to use this program`,
 	Preloader()
 
 	// Runtime
-	err = app.Run(os.Args)
+	err = app.RunContext(ctx, os.Args)
 	if err != nil {
 		slog.Error("error running app", "error", err)
 		os.Exit(-1)
@@ -138,7 +140,7 @@ func realMain(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("server.New: %w", err)
 	}
-	slog.Info("listening on: ", config.Port)
+	slog.Info("listening", "port", config.Port)
 
 	return srv.ServeHTTPHandler(ctx, backupServer.Run(ctx))
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/paveletto99/microservice-blueprint/internal/scylla"
+	"github.com/paveletto99/microservice-blueprint/internal/setup"
+	"github.com/paveletto99/microservice-blueprint/migrations"
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+	"github.com/paveletto99/microservice-blueprint/pkg/secrets"
+	"github.com/urfave/cli/v2"
+)
+
+// migrateScyllaConfig is the configuration of `migrate scylla`.
+type migrateScyllaConfig struct {
+	Scylla  scylla.Config
+	Secrets secrets.Config
+}
+
+func (c *migrateScyllaConfig) ScyllaConfig() *scylla.Config {
+	return &c.Scylla
+}
+
+func (c *migrateScyllaConfig) SecretManagerConfig() *secrets.Config {
+	return &c.Secrets
+}
+
+// migrateCommand applies the embedded schema migrations. Connection settings
+// are read from the same environment variables as the servers.
+var migrateCommand = &cli.Command{
+	Name:  "migrate",
+	Usage: "Apply pending schema migrations.",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "sql",
+			Usage: "Apply SQL migrations to the database named by DB_*.",
+			Action: func(c *cli.Context) error {
+				ctx := c.Context
+
+				var config database.Config
+				env, err := setup.Setup(ctx, &config)
+				if err != nil {
+					return fmt.Errorf("setup.Setup: %w", err)
+				}
+				defer env.Close(ctx)
+
+				if err := env.Database().Migrate(ctx, migrations.FS); err != nil {
+					return fmt.Errorf("migrating database: %w", err)
+				}
+				slog.Info("database is up to date")
+				return nil
+			},
+		},
+		{
+			Name:  "scylla",
+			Usage: "Apply CQL migrations to the keyspace named by SCYLLA_KEYSPACE.",
+			Action: func(c *cli.Context) error {
+				ctx := c.Context
+
+				var config migrateScyllaConfig
+				env, err := setup.Setup(ctx, &config)
+				if err != nil {
+					return fmt.Errorf("setup.Setup: %w", err)
+				}
+				defer env.Close(ctx)
+
+				if config.Scylla.Keyspace == "" {
+					return fmt.Errorf("SCYLLA_KEYSPACE is required")
+				}
+				if err := env.Scylla().Migrate(ctx, migrations.ScyllaFS); err != nil {
+					return fmt.Errorf("migrating scylla: %w", err)
+				}
+				slog.Info("scylla keyspace is up to date", "keyspace", config.Scylla.Keyspace)
+				return nil
+			},
+		},
+	},
+}
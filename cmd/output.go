@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of commands.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// output writes the results of commands in one of the output formats. JSON
+// and YAML are the protojson encoding of the messages, so that scripts see the
+// field names of the API. Tables only show the main fields.
+type output struct {
+	w      io.Writer
+	format string
+
+	// streamed is the number of messages written by stream.
+	streamed int
+}
+
+func newOutput(w io.Writer, format string) (*output, error) {
+	switch format {
+	case formatTable, formatJSON, formatYAML:
+		return &output{w: w, format: format}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, want table, json or yaml", format)
+	}
+}
+
+// write writes msg, as the table of header and rows in table format.
+func (o *output) write(msg proto.Message, header []string, rows [][]string) error {
+	switch o.format {
+	case formatJSON:
+		b, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", msg.ProtoReflect().Descriptor().FullName(), err)
+		}
+		_, err = fmt.Fprintf(o.w, "%s\n", b)
+		return err
+	case formatYAML:
+		b, err := toYAML(msg)
+		if err != nil {
+			return err
+		}
+		_, err = o.w.Write(b)
+		return err
+	default:
+		tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// stream writes one of a stream of messages as soon as it arrives: a line of
+// JSON, a YAML document or a table row of fixed-width columns.
+func (o *output) stream(msg proto.Message, header, row []string) error {
+	defer func() { o.streamed++ }()
+
+	switch o.format {
+	case formatJSON:
+		b, err := protojson.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", msg.ProtoReflect().Descriptor().FullName(), err)
+		}
+		_, err = fmt.Fprintf(o.w, "%s\n", b)
+		return err
+	case formatYAML:
+		b, err := toYAML(msg)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(o.w, "---\n%s", b)
+		return err
+	default:
+		if o.streamed == 0 {
+			if _, err := fmt.Fprintln(o.w, fixedWidth(header)); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintln(o.w, fixedWidth(row))
+		return err
+	}
+}
+
+// toYAML encodes msg as YAML, going through protojson for the field names.
+func toYAML(msg proto.Message) ([]byte, error) {
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", msg.ProtoReflect().Descriptor().FullName(), err)
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", msg.ProtoReflect().Descriptor().FullName(), err)
+	}
+	return yaml.Marshal(v)
+}
+
+// fixedWidth joins columns padded to 20 characters, for tables whose rows
+// are written before the widest is known.
+func fixedWidth(columns []string) string {
+	var b strings.Builder
+	for i, c := range columns {
+		if i < len(columns)-1 {
+			fmt.Fprintf(&b, "%-20s  ", c)
+		} else {
+			b.WriteString(c)
+		}
+	}
+	return b.String()
+}
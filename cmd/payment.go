@@ -0,0 +1,445 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/paveletto99/microservice-blueprint/internal/client"
+	"github.com/paveletto99/microservice-blueprint/internal/payment/model"
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
+)
+
+// paymentCommand calls the payment service on behalf of operators. Failed
+// calls exit with 64 plus their gRPC status code.
+var paymentCommand = &cli.Command{
+	Name:  "payment",
+	Usage: "Create, inspect, refund and watch payments.",
+	Description: `Calls the payment service through the client SDK, with its retries and
+deadlines. Connection settings default to the PAYMENT_* environment
+variables of the client. Failed calls exit with 64 plus their gRPC status
+code, e.g. 69 for NOT_FOUND and 78 for UNAVAILABLE; other errors with 1.`,
+	Subcommands: []*cli.Command{
+		{
+			Name:      "create",
+			Usage:     "Create a payment.",
+			UsageText: "pobo payment create --amount 9.99 --currency EUR [--merchant ID] [--idempotency-key KEY]",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:     "amount",
+					Usage:    "amount in major units of the currency, e.g. 9.99",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "currency",
+					Usage:    "ISO-4217 code of the currency, e.g. EUR",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "merchant",
+					Usage: "ID of the merchant being paid",
+				},
+				&cli.StringFlag{
+					Name:  "idempotency-key",
+					Usage: "key making retries of the command safe, random if unset",
+				},
+			}, paymentFlags...),
+			Action: withPaymentClient(paymentCreate),
+		},
+		{
+			Name:      "get",
+			Usage:     "Show a payment and its transitions.",
+			UsageText: "pobo payment get [flags] BILL_ID",
+			Flags:     paymentFlags,
+			Action:    withPaymentClient(paymentGet),
+		},
+		{
+			Name:      "list",
+			Usage:     "List payments, newest first.",
+			UsageText: "pobo payment list [--merchant ID] [--status STATUS]... [--currency EUR] [--all]",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:  "merchant",
+					Usage: "only list payments of this merchant",
+				},
+				&cli.StringSliceFlag{
+					Name:  "status",
+					Usage: "only list payments in this status, e.g. captured; may be repeated",
+				},
+				&cli.StringFlag{
+					Name:  "currency",
+					Usage: "only list payments in this currency",
+				},
+				&cli.StringFlag{
+					Name:  "created-after",
+					Usage: "only list payments created after this RFC 3339 time",
+				},
+				&cli.StringFlag{
+					Name:  "created-before",
+					Usage: "only list payments created before this RFC 3339 time",
+				},
+				&cli.IntFlag{
+					Name:  "page-size",
+					Usage: "maximum number of payments per page, capped by the service",
+				},
+				&cli.StringFlag{
+					Name:  "page-token",
+					Usage: "token of the page to list, as printed by a previous list",
+				},
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "list every page",
+				},
+			}, paymentFlags...),
+			Action: withPaymentClient(paymentList),
+		},
+		{
+			Name:      "refund",
+			Usage:     "Refund a captured payment, in full unless --amount is set.",
+			UsageText: "pobo payment refund [--amount 1.50] [--reason TEXT] [--idempotency-key KEY] BILL_ID",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:  "amount",
+					Usage: "amount to refund in major units of the currency of the payment",
+				},
+				&cli.StringFlag{
+					Name:  "reason",
+					Usage: "reason of the refund, kept with the transition",
+				},
+				&cli.StringFlag{
+					Name:  "idempotency-key",
+					Usage: "key making retries of the command safe, random if unset",
+				},
+			}, paymentFlags...),
+			Action: withPaymentClient(paymentRefund),
+		},
+		{
+			Name:      "watch",
+			Usage:     "Stream the transitions of a payment, or of every payment of a merchant, until interrupted.",
+			UsageText: "pobo payment watch [--cursor CURSOR] (BILL_ID | --merchant ID)",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:  "merchant",
+					Usage: "watch every payment of this merchant instead of a single one",
+				},
+				&cli.StringFlag{
+					Name:  "cursor",
+					Usage: "resume a previous watch after the event carrying this cursor",
+				},
+				&cli.StringFlag{
+					Name:  "overflow",
+					Usage: "what to do when the output falls behind: coalesce or drop",
+					Value: "coalesce",
+				},
+			}, paymentFlags...),
+			Action: withPaymentClient(paymentWatch),
+		},
+	},
+}
+
+// paymentFlags are the flags of every payment subcommand.
+var paymentFlags = append([]cli.Flag{outputFlag(formatTable)}, clientFlags...)
+
+// paymentAction is the action of a payment subcommand.
+type paymentAction func(c *cli.Context, pc *client.Client, out *output) error
+
+// withPaymentClient runs action with a payment client and an output
+// configured by the flags, and exits with the gRPC status of its error.
+func withPaymentClient(action paymentAction) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		out, err := newOutput(c.App.Writer, c.String("output"))
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		pc, err := newPaymentClient(c)
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		defer pc.Close()
+
+		return exitError(action(c, pc, out))
+	}
+}
+
+func paymentCreate(c *cli.Context, pc *client.Client, out *output) error {
+	currency, err := model.LookupCurrency(strings.ToUpper(c.String("currency")))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	amount, err := model.ParseMoney(c.String("amount"), currency)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	resp, err := pc.Create(c.Context, &paymentv1.CreatePaymentRequest{
+		Amount:         toMoney(amount),
+		MerchantId:     c.String("merchant"),
+		IdempotencyKey: c.String("idempotency-key"),
+	})
+	if err != nil {
+		return err
+	}
+	return out.write(resp,
+		[]string{"BILL ID", "AMOUNT"},
+		[][]string{{strconv.FormatInt(resp.GetBillId(), 10), formatMoney(resp.GetAmount())}})
+}
+
+func paymentGet(c *cli.Context, pc *client.Client, out *output) error {
+	billID, err := billIDArg(c)
+	if err != nil {
+		return err
+	}
+
+	p, err := pc.Get(c.Context, &paymentv1.GetPaymentRequest{BillId: billID})
+	if err != nil {
+		return err
+	}
+	if err := out.write(p, paymentHeader, [][]string{paymentRow(p)}); err != nil {
+		return err
+	}
+	if out.format != formatTable || len(p.GetTransitions()) == 0 {
+		return nil
+	}
+
+	// The transitions follow the payment, as a table of their own.
+	rows := make([][]string, 0, len(p.GetTransitions()))
+	for _, t := range p.GetTransitions() {
+		rows = append(rows, transitionRow(t))
+	}
+	fmt.Fprintln(out.w)
+	return out.write(p, transitionHeader, rows)
+}
+
+func paymentList(c *cli.Context, pc *client.Client, out *output) error {
+	req := &paymentv1.ListPaymentsRequest{
+		MerchantId:   c.String("merchant"),
+		CurrencyCode: strings.ToUpper(c.String("currency")),
+		PageSize:     int32(c.Int("page-size")),
+		PageToken:    c.String("page-token"),
+	}
+	for _, s := range c.StringSlice("status") {
+		v, ok := paymentv1.PaymentStatus_value["PAYMENT_STATUS_"+strings.ToUpper(s)]
+		if !ok || v == 0 {
+			return cli.Exit(fmt.Sprintf("unknown payment status %q", s), 1)
+		}
+		req.Statuses = append(req.Statuses, paymentv1.PaymentStatus(v))
+	}
+	for name, dst := range map[string]**timestamppb.Timestamp{
+		"created-after":  &req.CreatedAfter,
+		"created-before": &req.CreatedBefore,
+	} {
+		if c.IsSet(name) {
+			t, err := parseTime(name, c.String(name))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			*dst = timestamppb.New(t)
+		}
+	}
+
+	// With --all, the pages are gathered into one response, so that every
+	// format sees a single list.
+	resp := &paymentv1.ListPaymentsResponse{}
+	for {
+		page, err := pc.List(c.Context, req)
+		if err != nil {
+			return err
+		}
+		resp.Payments = append(resp.Payments, page.GetPayments()...)
+		resp.NextPageToken = page.GetNextPageToken()
+		if !c.Bool("all") || resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+
+	rows := make([][]string, 0, len(resp.GetPayments()))
+	for _, p := range resp.GetPayments() {
+		rows = append(rows, paymentRow(p))
+	}
+	if err := out.write(resp, paymentHeader, rows); err != nil {
+		return err
+	}
+	if out.format == formatTable && resp.GetNextPageToken() != "" {
+		fmt.Fprintf(c.App.ErrWriter, "next page: --page-token %s\n", resp.GetNextPageToken())
+	}
+	return nil
+}
+
+func paymentRefund(c *cli.Context, pc *client.Client, out *output) error {
+	billID, err := billIDArg(c)
+	if err != nil {
+		return err
+	}
+	req := &paymentv1.RefundPaymentRequest{
+		BillId:         billID,
+		Reason:         c.String("reason"),
+		IdempotencyKey: c.String("idempotency-key"),
+	}
+
+	// Amounts are in the currency of the payment, which is looked up.
+	if c.IsSet("amount") {
+		p, err := pc.Get(c.Context, &paymentv1.GetPaymentRequest{BillId: billID})
+		if err != nil {
+			return err
+		}
+		currency, err := model.LookupCurrency(p.GetAmount().GetCurrencyCode())
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		amount, err := model.ParseMoney(c.String("amount"), currency)
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		req.Amount = toMoney(amount)
+	}
+
+	p, err := pc.Refund(c.Context, req)
+	if err != nil {
+		return err
+	}
+	return out.write(p, paymentHeader, [][]string{paymentRow(p)})
+}
+
+func paymentWatch(c *cli.Context, pc *client.Client, out *output) error {
+	policy, ok := paymentv1.OverflowPolicy_value["OVERFLOW_POLICY_"+strings.ToUpper(c.String("overflow"))]
+	if !ok {
+		return cli.Exit(fmt.Sprintf("unknown overflow policy %q", c.String("overflow")), 1)
+	}
+
+	var (
+		stream interface {
+			Recv() (*paymentv1.WatchEvent, error)
+		}
+		err error
+	)
+	if merchant := c.String("merchant"); merchant != "" {
+		if c.Args().Present() {
+			return cli.Exit("a bill ID and --merchant are mutually exclusive", 1)
+		}
+		stream, err = pc.WatchPayments(c.Context, &paymentv1.WatchPaymentsRequest{
+			MerchantId:     merchant,
+			Cursor:         c.String("cursor"),
+			OverflowPolicy: paymentv1.OverflowPolicy(policy),
+		})
+	} else {
+		billID, argErr := billIDArg(c)
+		if argErr != nil {
+			return argErr
+		}
+		stream, err = pc.WatchPayment(c.Context, &paymentv1.WatchPaymentRequest{
+			BillId:         billID,
+			Cursor:         c.String("cursor"),
+			OverflowPolicy: paymentv1.OverflowPolicy(policy),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			// An interrupt is the normal end of a watch.
+			if isCanceled(c.Context, err) {
+				return nil
+			}
+			return err
+		}
+		// Heartbeats only matter to scripts, for their cursor.
+		if ev.GetHeartbeat() && out.format == formatTable {
+			continue
+		}
+		if err := out.stream(ev, watchHeader, watchRow(ev)); err != nil {
+			return err
+		}
+		if ev.GetDropped() > 0 && out.format == formatTable {
+			fmt.Fprintf(c.App.ErrWriter, "%d updates were dropped or coalesced\n", ev.GetDropped())
+		}
+	}
+}
+
+// billIDArg returns the bill ID given as the argument of c.
+func billIDArg(c *cli.Context) (int64, error) {
+	if c.NArg() != 1 {
+		return 0, cli.Exit("expected a single bill ID argument", 1)
+	}
+	id, err := strconv.ParseInt(c.Args().First(), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, cli.Exit(fmt.Sprintf("invalid bill ID %q", c.Args().First()), 1)
+	}
+	return id, nil
+}
+
+var (
+	paymentHeader    = []string{"BILL ID", "MERCHANT", "AMOUNT", "REFUNDED", "STATUS", "CREATED", "UPDATED"}
+	transitionHeader = []string{"ID", "FROM", "TO", "AMOUNT", "ACTOR", "REASON", "TIME"}
+	watchHeader      = []string{"BILL ID", "FROM", "TO", "AMOUNT", "TIME", "CURSOR"}
+)
+
+func paymentRow(p *paymentv1.Payment) []string {
+	return []string{
+		strconv.FormatInt(p.GetBillId(), 10),
+		p.GetMerchantId(),
+		formatMoney(p.GetAmount()),
+		formatMoney(p.GetRefundedAmount()),
+		formatStatus(p.GetStatus()),
+		formatTime(p.GetCreateTime()),
+		formatTime(p.GetUpdateTime()),
+	}
+}
+
+func transitionRow(t *paymentv1.PaymentTransition) []string {
+	return []string{
+		strconv.FormatInt(t.GetId(), 10),
+		formatStatus(t.GetFromStatus()),
+		formatStatus(t.GetToStatus()),
+		formatMoney(t.GetAmount()),
+		t.GetActor(),
+		t.GetReason(),
+		formatTime(t.GetCreateTime()),
+	}
+}
+
+func watchRow(ev *paymentv1.WatchEvent) []string {
+	t := ev.GetTransition()
+	return []string{
+		strconv.FormatInt(ev.GetBillId(), 10),
+		formatStatus(t.GetFromStatus()),
+		formatStatus(t.GetToStatus()),
+		formatMoney(t.GetAmount()),
+		formatTime(t.GetCreateTime()),
+		ev.GetCursor(),
+	}
+}
+
+func toMoney(m model.Money) *paymentv1.Money {
+	return &paymentv1.Money{CurrencyCode: m.Currency, AmountMinor: m.AmountMinor}
+}
+
+// formatMoney formats m in major units, e.g. "9.99 EUR".
+func formatMoney(m *paymentv1.Money) string {
+	if m == nil {
+		return ""
+	}
+	return model.Money{Currency: m.GetCurrencyCode(), AmountMinor: m.GetAmountMinor()}.String()
+}
+
+// formatStatus formats s without its prefix, e.g. "CAPTURED".
+func formatStatus(s paymentv1.PaymentStatus) string {
+	if s == paymentv1.PaymentStatus_PAYMENT_STATUS_UNSPECIFIED {
+		return ""
+	}
+	return strings.TrimPrefix(s.String(), "PAYMENT_STATUS_")
+}
+
+func formatTime(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.AsTime().Format(time.RFC3339)
+}
@@ -10,12 +10,21 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
 
-	"go.opencensus.io/plugin/ocgrpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 
+	"github.com/paveletto99/microservice-blueprint/internal/grpcmiddleware"
+	"github.com/paveletto99/microservice-blueprint/internal/metrics"
 	payment "github.com/paveletto99/microservice-blueprint/internal/payment"
 	p "github.com/paveletto99/microservice-blueprint/internal/pb/payment"
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
 	"github.com/paveletto99/microservice-blueprint/internal/setup"
+	"github.com/paveletto99/microservice-blueprint/internal/validation"
+	"github.com/paveletto99/microservice-blueprint/pkg/database/outbox"
+	"github.com/paveletto99/microservice-blueprint/pkg/observability"
+	"github.com/paveletto99/microservice-blueprint/pkg/ratelimit"
 	"github.com/paveletto99/microservice-blueprint/pkg/server"
 )
 
@@ -54,7 +63,46 @@ func realMain(ctx context.Context) error {
 	}
 	defer env.Close(ctx)
 
-	payserver := payment.NewServer(env, &config)
+	payserver, err := payment.NewServer(env, &config)
+	if err != nil {
+		return fmt.Errorf("payment.NewServer: %w", err)
+	}
+	// Watch streams only end when the server closes them, which lets the
+	// graceful stop below complete.
+	go func() {
+		<-ctx.Done()
+		payserver.Close()
+	}()
+
+	// Events written by the server are published by a relay running next to
+	// it. It is stopped before the database closes.
+	publisher, err := outbox.PublisherFor(ctx, &config.Outbox)
+	if err != nil {
+		return fmt.Errorf("outbox.PublisherFor: %w", err)
+	}
+	relay, err := outbox.NewRelay(env.Database(), publisher, &config.Outbox)
+	if err != nil {
+		return fmt.Errorf("outbox.NewRelay: %w", err)
+	}
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		if err := relay.Run(relayCtx); err != nil {
+			slog.Error("outbox relay stopped", "error", err)
+		}
+	}()
+	env.RegisterCloser(func(context.Context) error {
+		stopRelay()
+		<-relayDone
+		return nil
+	})
+
+	limiterStore, err := ratelimit.RateLimiterFor(ctx, &config.RateLimit, env.Database())
+	if err != nil {
+		return fmt.Errorf("ratelimit.RateLimiterFor: %w", err)
+	}
+	defer limiterStore.Close(context.Background())
 
 	var sopts []grpc.ServerOption
 
@@ -70,9 +118,42 @@ func realMain(ctx context.Context) error {
 	// sopts = append(sopts, grpc.UnaryInterceptor(federationServer.(*federationout.Server).AuthInterceptor))
 	// }
 
-	sopts = append(sopts, grpc.StatsHandler(&ocgrpc.ServerHandler{}))
+	// Requests are limited and validated inside the standard interceptors, so
+	// that rejected ones are logged and counted too. Limiting comes first:
+	// invalid requests still take a token.
+	interceptors := &grpcmiddleware.Config{
+		Metrics:        metrics.New(prometheus.DefaultRegisterer),
+		DefaultTimeout: config.Timeout,
+	}
+	// Traces and metrics go to the exporter installed by setup, incoming W3C
+	// trace contexts are continued.
+	sopts = append(sopts, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	sopts = append(sopts,
+		grpcmiddleware.UnaryChain(interceptors,
+			ratelimit.UnaryServerInterceptor(limiterStore, &config.RateLimit),
+			validation.UnaryServerInterceptor()),
+		grpcmiddleware.StreamChain(interceptors,
+			ratelimit.StreamServerInterceptor(limiterStore, &config.RateLimit),
+			validation.StreamServerInterceptor()),
+	)
 	grpcServer := grpc.NewServer(sopts...)
-	p.RegisterPaymentServer(grpcServer, payserver)
+	paymentv1.RegisterPaymentServiceServer(grpcServer, payserver)
+	p.RegisterPaymentServer(grpcServer, payment.NewLegacyServer(payserver))
+	if config.Reflection {
+		reflection.Register(grpcServer)
+	}
+
+	metricsDone, err := observability.ServeMetricsIfPrometheus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	if metricsDone != nil {
+		defer func() {
+			if err := metricsDone(); err != nil {
+				slog.Error("failed to close metrics exporter", "error", err)
+			}
+		}()
+	}
 
 	srv, err := server.New(config.Port)
 	if err != nil {
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/paveletto99/microservice-blueprint/internal/client"
+	"github.com/paveletto99/microservice-blueprint/pkg/grpcdynamic"
+)
+
+// rpcFlags are the flags of every rpc subcommand.
+var rpcFlags = append([]cli.Flag{
+	&cli.StringSliceFlag{
+		Name:  "proto",
+		Usage: "describe services with this .proto file instead of reflection; may be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "import-path",
+		Usage: "directory the imports of --proto files are found in; may be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "protoset",
+		Usage: "describe services with this descriptor set instead of reflection; may be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:    "header",
+		Aliases: []string{"H"},
+		Usage:   `metadata sent with the calls, as "name: value"; may be repeated`,
+	},
+}, clientFlags...)
+
+// rpcCommand calls any of our gRPC services, with the descriptors of the
+// server reflection service or of local files.
+var rpcCommand = &cli.Command{
+	Name:  "rpc",
+	Usage: "List, describe and call the methods of any gRPC service.",
+	Description: `Discovers services through gRPC server reflection, or through local
+.proto files (--proto, --import-path) and descriptor sets (--protoset).
+Connection settings are those of the payment CLI. Failed calls exit with 64
+plus their gRPC status code; other errors with 1.`,
+	Subcommands: []*cli.Command{
+		{
+			Name:      "list",
+			Usage:     "List the services, or the methods of a service.",
+			UsageText: "pobo rpc list [flags] [SERVICE]",
+			Flags:     rpcFlags,
+			Action:    withSource(rpcList),
+		},
+		{
+			Name:      "describe",
+			Usage:     "Describe a service, method, message or enum in the .proto syntax.",
+			UsageText: "pobo rpc describe [flags] SYMBOL",
+			Flags:     rpcFlags,
+			Action:    withSource(rpcDescribe),
+		},
+		{
+			Name:  "call",
+			Usage: "Call a method with requests in JSON, printing the responses in JSON or YAML.",
+			UsageText: `pobo rpc call [flags] package.Service/Method
+   pobo rpc call -d '{"bill_id": "42"}' payment.v1.PaymentService/Get
+   pobo rpc call -d @requests.json payment.v1.PaymentService/WatchPayment`,
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:    "data",
+					Aliases: []string{"d"},
+					Usage:   "requests as JSON objects, @FILE to read them from a file or @- from stdin; empty requests by default",
+				},
+				outputFlag(formatJSON),
+			}, rpcFlags...),
+			Action: withSource(rpcCall),
+		},
+	},
+}
+
+// rpcAction is the action of an rpc subcommand. conn connects on first use,
+// so that actions on local files need no server.
+type rpcAction func(c *cli.Context, src grpcdynamic.Source, conn func() (*grpc.ClientConn, error)) error
+
+// withSource runs action with the descriptor source chosen by the flags, and
+// exits with the gRPC status of its error.
+func withSource(action rpcAction) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		headers, err := parseHeaders(c.StringSlice("header"))
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		c.Context = metadata.NewOutgoingContext(c.Context, headers)
+
+		// The connection is made once, if the source or the action needs it.
+		var cc *grpc.ClientConn
+		conn := func() (*grpc.ClientConn, error) {
+			if cc != nil {
+				return cc, nil
+			}
+			config, err := clientConfig(c)
+			if err != nil {
+				return nil, err
+			}
+			if cc, err = client.Dial(config); err != nil {
+				return nil, err
+			}
+			return cc, nil
+		}
+		defer func() {
+			if cc != nil {
+				cc.Close()
+			}
+		}()
+
+		var src grpcdynamic.Source
+		if c.IsSet("proto") || c.IsSet("protoset") {
+			src, err = grpcdynamic.NewFileSource(c.Context,
+				c.StringSlice("import-path"), c.StringSlice("proto"), c.StringSlice("protoset"))
+		} else {
+			var reflected *grpc.ClientConn
+			if reflected, err = conn(); err == nil {
+				src = grpcdynamic.NewReflectionSource(reflected)
+			}
+		}
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		defer src.Close()
+
+		return exitError(action(c, src, conn))
+	}
+}
+
+func rpcList(c *cli.Context, src grpcdynamic.Source, _ func() (*grpc.ClientConn, error)) error {
+	if c.NArg() > 1 {
+		return cli.Exit("expected at most one service", 1)
+	}
+	if !c.Args().Present() {
+		services, err := src.ListServices(c.Context)
+		if err != nil {
+			return err
+		}
+		for _, s := range services {
+			fmt.Fprintln(c.App.Writer, s)
+		}
+		return nil
+	}
+
+	d, err := src.FindSymbol(c.Context, c.Args().First())
+	if err != nil {
+		return err
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return cli.Exit(fmt.Sprintf("%s is not a service", d.FullName()), 1)
+	}
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		fmt.Fprintln(c.App.Writer, methods.Get(i).FullName())
+	}
+	return nil
+}
+
+func rpcDescribe(c *cli.Context, src grpcdynamic.Source, _ func() (*grpc.ClientConn, error)) error {
+	if c.NArg() != 1 {
+		return cli.Exit("expected a single symbol", 1)
+	}
+	d, err := src.FindSymbol(c.Context, strings.TrimPrefix(c.Args().First(), "."))
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(c.App.Writer, grpcdynamic.Describe(d))
+	return nil
+}
+
+func rpcCall(c *cli.Context, src grpcdynamic.Source, conn func() (*grpc.ClientConn, error)) error {
+	if c.NArg() != 1 {
+		return cli.Exit("expected a single method", 1)
+	}
+	out, err := newOutput(c.App.Writer, c.String("output"))
+	if err != nil || out.format == formatTable {
+		return cli.Exit(fmt.Sprintf("unsupported output format %q, want json or yaml", c.String("output")), 1)
+	}
+	in, err := requestInput(c.String("data"))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	defer in.Close()
+
+	md, err := grpcdynamic.FindMethod(c.Context, src, c.Args().First())
+	if err != nil {
+		return err
+	}
+	cc, err := conn()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	err = grpcdynamic.Invoke(c.Context, cc, md, in, func(resp proto.Message) error {
+		if md.IsStreamingServer() {
+			return out.stream(resp, nil, nil)
+		}
+		return out.write(resp, nil, nil)
+	})
+	// An interrupt is the normal end of a stream.
+	if md.IsStreamingServer() && isCanceled(c.Context, err) {
+		return nil
+	}
+	return err
+}
+
+// requestInput returns the reader of the --data flag.
+func requestInput(data string) (io.ReadCloser, error) {
+	switch {
+	case data == "@-":
+		return io.NopCloser(os.Stdin), nil
+	case strings.HasPrefix(data, "@"):
+		f, err := os.Open(data[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to open requests: %w", err)
+		}
+		return f, nil
+	default:
+		return io.NopCloser(strings.NewReader(data)), nil
+	}
+}
+
+// parseHeaders parses "name: value" flags into metadata.
+func parseHeaders(headers []string) (metadata.MD, error) {
+	md := metadata.MD{}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("header %q is not in the name: value format", h)
+		}
+		md.Append(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return md, nil
+}
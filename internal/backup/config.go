@@ -5,20 +5,24 @@ import (
 
 	"github.com/paveletto99/microservice-blueprint/internal/setup"
 	"github.com/paveletto99/microservice-blueprint/pkg/database"
+	"github.com/paveletto99/microservice-blueprint/pkg/observability"
+	"github.com/paveletto99/microservice-blueprint/pkg/storage"
 )
 
 // Compile-time check to assert this config matches requirements.
 var (
-	_ setup.DatabaseConfigProvider = (*Config)(nil)
-	// _ setup.ObservabilityExporterConfigProvider = (*Config)(nil)
+	_ setup.DatabaseConfigProvider              = (*Config)(nil)
+	_ setup.ObservabilityExporterConfigProvider = (*Config)(nil)
+	_ setup.BlobstoreConfigProvider             = (*Config)(nil)
 	// _ setup.SecretManagerConfigProvider         = (*Config)(nil)
 )
 
 // Config represents the configuration and associated environment variables for
 // the cleanup components.
 type Config struct {
-	Database database.Config
-	// ObservabilityExporter observability.Config
+	Database              database.Config
+	ObservabilityExporter observability.Config
+	Blobstore             storage.Config
 	// SecretManager         secrets.Config
 
 	Port string `env:"PORT, default=8080"`
@@ -33,8 +37,16 @@ type Config struct {
 	// complete.
 	Timeout time.Duration `env:"BACKUP_TIMEOUT, default=10m"`
 
-	// Bucket is the name of the Cloud Storage bucket where backups should be
-	// stored.
+	// Interval enables the scheduled mode: a backup is attempted every
+	// Interval, in addition to the ones requested on /backup. Zero disables it.
+	Interval time.Duration `env:"BACKUP_INTERVAL"`
+
+	// ChunkRows is the maximum number of rows of a table in each object of a
+	// backup.
+	ChunkRows int `env:"BACKUP_CHUNK_ROWS, default=50000"`
+
+	// Bucket is the name of the bucket of the blobstore where backups should
+	// be stored.
 	Bucket string `env:"BACKUP_BUCKET, default=sql-backups"`
 
 	// DatabaseInstanceURL is the full self-link of the URL to the SQL instance.
@@ -48,9 +60,13 @@ func (c *Config) DatabaseConfig() *database.Config {
 	return &c.Database
 }
 
-// func (c *Config) ObservabilityExporterConfig() *observability.Config {
-// 	return &c.ObservabilityExporter
-// }
+func (c *Config) ObservabilityExporterConfig() *observability.Config {
+	return &c.ObservabilityExporter
+}
+
+func (c *Config) BlobstoreConfig() *storage.Config {
+	return &c.Blobstore
+}
 
 // func (c *Config) SecretManagerConfig() *secrets.Config {
 // 	return &c.SecretManager
@@ -0,0 +1,321 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/storage"
+)
+
+// Manifest describes a backup. It is written last, as manifest.json, so that
+// a backup without one is incomplete.
+type Manifest struct {
+	Database   string    `json:"database"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Tables     []*Table  `json:"tables"`
+}
+
+// Table describes the dump of a table. Its rows are split into chunks, gzipped
+// files with one JSON array of column values per line. Values are strings in
+// the MySQL literal format, except for binary columns, which are base64
+// encoded, and NULL, which is null.
+type Table struct {
+	Name    string   `json:"name"`
+	Schema  string   `json:"schema"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+	Chunks  []string `json:"chunks"`
+}
+
+// timeFormat renders DATETIME and TIMESTAMP values as MySQL does.
+const timeFormat = "2006-01-02 15:04:05.999999"
+
+// binaryTypes are the database types of the columns dumped as bytes.
+var binaryTypes = map[string]bool{
+	"BINARY":     true,
+	"VARBINARY":  true,
+	"TINYBLOB":   true,
+	"BLOB":       true,
+	"MEDIUMBLOB": true,
+	"LONGBLOB":   true,
+	"BIT":        true,
+	"GEOMETRY":   true,
+}
+
+// dumper writes the logical dump of a database under prefix.
+type dumper struct {
+	blobstore storage.Blobstore
+	bucket    string
+	prefix    string
+	chunkRows int
+
+	// bytes is the compressed size of the objects written so far.
+	bytes int64
+}
+
+// dump writes every table of database, as of a single snapshot, and then the
+// manifest. Objects already written are left behind if it fails.
+func (d *dumper) dump(ctx context.Context, db *sql.DB, database string) (*Manifest, error) {
+	m := &Manifest{Database: database, StartedAt: time.Now().UTC()}
+
+	// A dedicated connection keeps the snapshot for every table.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return nil, fmt.Errorf("failed to set isolation level: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY"); err != nil {
+		return nil, fmt.Errorf("failed to start snapshot: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK")
+
+	tables, err := listTables(ctx, conn, database)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range tables {
+		t, err := d.dumpTable(ctx, conn, database, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump table %s: %w", name, err)
+		}
+		m.Tables = append(m.Tables, t)
+	}
+
+	m.FinishedAt = time.Now().UTC()
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	w := d.create(ctx, path.Join(d.prefix, "manifest.json"))
+	if _, err := w.Write(b); err != nil {
+		w.abort(err)
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return m, nil
+}
+
+// dumpTable writes the rows of a table in chunks of at most chunkRows rows.
+func (d *dumper) dumpTable(ctx context.Context, conn *sql.Conn, database, name string) (*Table, error) {
+	t := &Table{Name: name, Chunks: []string{}}
+
+	var ignored string
+	if err := conn.QueryRowContext(ctx, "SHOW CREATE TABLE "+quote(database)+"."+quote(name)).Scan(&ignored, &t.Schema); err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT * FROM "+quote(database)+"."+quote(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	binary := make([]bool, len(types))
+	for i, ct := range types {
+		t.Columns = append(t.Columns, ct.Name())
+		binary[i] = binaryTypes[strings.ToUpper(ct.DatabaseTypeName())]
+	}
+
+	values := make([]any, len(types))
+	dest := make([]any, len(types))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	row := make([]any, len(types))
+
+	var (
+		w   *chunkWriter
+		enc *json.Encoder
+		n   int
+	)
+	// A chunk still open on return is incomplete.
+	defer func() {
+		if w != nil {
+			w.abort(fmt.Errorf("dump of %s failed", name))
+		}
+	}()
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		for i, v := range values {
+			row[i] = dumpValue(v, binary[i])
+		}
+
+		if w == nil {
+			object := path.Join(d.prefix, name, fmt.Sprintf("%06d.jsonl.gz", len(t.Chunks)))
+			w = d.create(ctx, object)
+			enc = json.NewEncoder(w)
+			t.Chunks = append(t.Chunks, object)
+		}
+		if err := enc.Encode(row); err != nil {
+			return nil, fmt.Errorf("failed to write row: %w", err)
+		}
+		t.Rows++
+
+		if n++; n == d.chunkRows {
+			err := w.Close()
+			w, n = nil, 0
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	if w != nil {
+		err := w.Close()
+		w = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// dumpValue returns the JSON value of a column: v as a MySQL literal, or bytes
+// if the column is binary.
+func dumpValue(v any, binary bool) any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		if binary {
+			return v
+		}
+		return string(v)
+	case time.Time:
+		return v.Format(timeFormat)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// listTables returns the base tables of database.
+func listTables(ctx context.Context, conn *sql.Conn, database string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = ? AND table_type = 'BASE TABLE'
+		ORDER BY table_name`, database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	return tables, nil
+}
+
+// chunkWriter streams what is written to it into an object, gzipped if its
+// name ends with .gz.
+type chunkWriter struct {
+	name string
+	w    io.Writer
+	buf  *bufio.Writer
+	zw   *gzip.Writer
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// create starts the upload of the object name, which ends when the returned
+// writer is closed or aborted.
+func (d *dumper) create(ctx context.Context, name string) *chunkWriter {
+	pr, pw := io.Pipe()
+	cw := &chunkWriter{name: name, pw: pw, done: make(chan error, 1)}
+	cw.buf = bufio.NewWriterSize(&countingWriter{w: pw, n: &d.bytes}, 64<<10)
+	cw.w = cw.buf
+	opts := &storage.CreateOptions{ContentType: "application/json"}
+	if strings.HasSuffix(name, ".gz") {
+		cw.zw = gzip.NewWriter(cw.buf)
+		cw.w = cw.zw
+		opts.ContentType = "application/gzip"
+	}
+
+	go func() {
+		_, err := d.blobstore.CreateObject(ctx, d.bucket, name, pr, opts)
+		// Unblock the writer if the upload ended early.
+		if err != nil {
+			pr.CloseWithError(err)
+		} else {
+			pr.Close()
+		}
+		cw.done <- err
+	}()
+	return cw
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	return cw.w.Write(p)
+}
+
+// Close flushes the object and waits for its upload.
+func (cw *chunkWriter) Close() error {
+	var err error
+	if cw.zw != nil {
+		err = cw.zw.Close()
+	}
+	if err == nil {
+		err = cw.buf.Flush()
+	}
+	if err != nil {
+		cw.abort(err)
+		return fmt.Errorf("failed to write %s: %w", cw.name, err)
+	}
+	cw.pw.Close()
+	if err := <-cw.done; err != nil {
+		return fmt.Errorf("failed to upload %s: %w", cw.name, err)
+	}
+	return nil
+}
+
+// abort fails the upload with err and waits for it to end.
+func (cw *chunkWriter) abort(err error) {
+	cw.pw.CloseWithError(err)
+	<-cw.done
+}
+
+// countingWriter adds the number of bytes written to n.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+func quote(ident string) string {
+	return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
+}
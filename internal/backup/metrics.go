@@ -0,0 +1,32 @@
+package backup
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	backupRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "backup_runs_total",
+		Help: "total number of backups attempted by result: succeeded, failed or skipped",
+	}, []string{"result"})
+
+	backupDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "backup_duration_seconds",
+		Help:    "duration of the backups that ran",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	backupLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "backup_last_success_timestamp_seconds",
+		Help: "start time of the last successful backup made by this replica",
+	})
+
+	backupBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "backup_last_success_bytes",
+		Help: "compressed size of the last successful backup made by this replica",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(backupRuns, backupDuration, backupLastSuccess, backupBytes)
+}
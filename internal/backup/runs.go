@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"vitess.io/vitess/go/mysql/sqlerror"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+// InProgress is the code of the error of a backup requested while another one
+// of the same database runs.
+const InProgress apperrors.Code = "BACKUP_IN_PROGRESS"
+
+func init() {
+	apperrors.Register(InProgress, apperrors.Definition{
+		GRPCCode:   codes.Aborted,
+		HTTPStatus: http.StatusConflict,
+		Title:      "A backup is already in progress.",
+	})
+}
+
+// Statuses of a run.
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Run is a row of the backup_runs table, the outcome of a backup.
+type Run struct {
+	ID         int64     `json:"id"`
+	Database   string    `json:"database"`
+	Status     string    `json:"status"`
+	Location   string    `json:"location"`
+	Tables     int       `json:"tables"`
+	Rows       int64     `json:"rows"`
+	Bytes      int64     `json:"bytes"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// startRun records the start of run, unless a backup of its database started
+// less than minTTL before it succeeded or one is still running. Runs older
+// than timeout that never finished are recorded as failed.
+func startRun(ctx context.Context, db *database.DB, run *Run, minTTL, timeout time.Duration) error {
+	err := db.InTx(ctx, nil, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE backup_runs SET status = ?, error = ?, finished_at = ?
+			WHERE database_name = ? AND status = ? AND started_at <= ?`,
+			StatusFailed, "abandoned", run.StartedAt,
+			run.Database, StatusRunning, run.StartedAt.Add(-timeout)); err != nil {
+			return fmt.Errorf("failed to fail abandoned runs: %w", err)
+		}
+
+		// The locks of the reads serialize concurrent starts.
+		var running int64
+		err := tx.QueryRowContext(ctx, `
+			SELECT id FROM backup_runs
+			WHERE database_name = ? AND status = ?
+			LIMIT 1 FOR UPDATE`, run.Database, StatusRunning).Scan(&running)
+		if err == nil {
+			return apperrors.New(InProgress, "backup %d of %s is in progress", running, run.Database)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to read running backups: %w", err)
+		}
+
+		var last sql.NullTime
+		if err := tx.QueryRowContext(ctx, `
+			SELECT MAX(started_at) FROM backup_runs
+			WHERE database_name = ? AND status = ?
+			FOR UPDATE`, run.Database, StatusSucceeded).Scan(&last); err != nil {
+			return fmt.Errorf("failed to read last backup: %w", err)
+		}
+		if age := run.StartedAt.Sub(last.Time); last.Valid && age < minTTL {
+			return apperrors.New(apperrors.RateLimited,
+				"last backup of %s is %s old, less than %s", run.Database, age.Round(time.Second), minTTL).
+				WithRetryAfter(minTTL - age)
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO backup_runs (database_name, status, location, started_at)
+			VALUES (?, ?, ?, ?)`, run.Database, StatusRunning, run.Location, run.StartedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert run: %w", err)
+		}
+		if run.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to read run id: %w", err)
+		}
+		run.Status = StatusRunning
+		return nil
+	})
+
+	// A deadlock is the error of a concurrent start of a run.
+	if database.ErrorNumber(err) == sqlerror.ERLockDeadlock {
+		return apperrors.Wrap(err, InProgress, "a backup of %s is starting", run.Database)
+	}
+	return err
+}
+
+// finishRun records the outcome of run.
+func finishRun(ctx context.Context, db *database.DB, run *Run) error {
+	var runErr *string
+	if run.Error != "" {
+		runErr = &run.Error
+	}
+	if _, err := db.Pool.ExecContext(ctx, `
+		UPDATE backup_runs
+		SET status = ?, table_count = ?, row_count = ?, byte_count = ?, error = ?, finished_at = ?
+		WHERE id = ?`,
+		run.Status, run.Tables, run.Rows, run.Bytes, runErr, run.FinishedAt, run.ID); err != nil {
+		return fmt.Errorf("failed to record run %d: %w", run.ID, err)
+	}
+	return nil
+}
+
+// LastRuns returns the last runs of the backups of database, most recent
+// first.
+func LastRuns(ctx context.Context, db *database.DB, database string, limit int) ([]*Run, error) {
+	rows, err := db.Pool.QueryContext(ctx, `
+		SELECT id, database_name, status, location, table_count, row_count, byte_count,
+			error, started_at, finished_at
+		FROM backup_runs
+		WHERE database_name = ?
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?`, database, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*Run
+	for rows.Next() {
+		var (
+			r          Run
+			runErr     sql.NullString
+			finishedAt sql.NullTime
+		)
+		if err := rows.Scan(&r.ID, &r.Database, &r.Status, &r.Location, &r.Tables, &r.Rows, &r.Bytes,
+			&runErr, &r.StartedAt, &finishedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan run: %w", err)
+		}
+		r.Error, r.FinishedAt = runErr.String, finishedAt.Time
+		runs = append(runs, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return runs, nil
+}
@@ -2,21 +2,39 @@ package backup
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"path"
+	"time"
 
 	"github.com/paveletto99/microservice-blueprint/internal/middleware"
 	"github.com/paveletto99/microservice-blueprint/internal/serverenv"
 	"github.com/paveletto99/microservice-blueprint/pkg/database"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
 	"github.com/paveletto99/microservice-blueprint/pkg/server"
+	"github.com/paveletto99/microservice-blueprint/pkg/storage"
 )
 
+// recordTimeout bounds the recording of the outcome of a run, which happens
+// even if the run timed out.
+const recordTimeout = 30 * time.Second
+
+// lastRuns is the number of runs listed by GET /backup.
+const lastRuns = 20
+
 type Server struct {
 	config *Config
 	env    *serverenv.ServerEnv
 	db     *database.DB
 	// h      *render.Renderer
 
+	// blobstore is where backups are written.
+	blobstore storage.Blobstore
+
+	now func() time.Time
+
 	// overrideAuthToken is for testing to bypass API calls to get authentication
 	// information.
 	// overrideAuthToken string
@@ -26,13 +44,24 @@ func NewServer(config *Config, env *serverenv.ServerEnv) (*Server, error) {
 	if env.Database() == nil {
 		return nil, fmt.Errorf("missing database in server environment")
 	}
+	if env.Blobstore() == nil {
+		return nil, fmt.Errorf("missing blobstore in server environment")
+	}
+	if config.Timeout <= 0 {
+		return nil, fmt.Errorf("backup timeout must be positive")
+	}
+	if config.ChunkRows <= 0 {
+		return nil, fmt.Errorf("backup chunk rows must be positive")
+	}
 
 	db := env.Database()
 
 	return &Server{
-		config: config,
-		env:    env,
-		db:     db,
+		config:    config,
+		env:       env,
+		db:        db,
+		blobstore: env.Blobstore(),
+		now:       func() time.Time { return time.Now().UTC() },
 	}, nil
 }
 
@@ -44,14 +73,133 @@ func someMiddleware(handler http.Handler) http.Handler {
 }
 
 func (s *Server) addRoutes(mux *http.ServeMux) *http.ServeMux {
-	// mux.Handle("/", HandleBackup())
+	mux.Handle("POST /backup", s.HandleBackup())
+	mux.Handle("GET /backup", s.HandleRuns())
 	mux.Handle("/healthz", server.HandleHealthz(s.db))
 	return mux
 }
 
+// Run returns the handler of the server. In the scheduled mode, it also
+// starts backing up every Interval until ctx is done.
 func (s *Server) Run(ctx context.Context) http.Handler {
 	mux := http.NewServeMux()
 	s.addRoutes(mux)
-	someMiddleware(mux)
-	return mux
+	if s.config.Interval > 0 {
+		go s.schedule(ctx)
+	}
+	return someMiddleware(mux)
+}
+
+// HandleBackup backs up the database and responds with the run. A backup
+// that is refused, because the last one is younger than MinTTL or another one
+// is running, is a problem with a 429 or 409 status. A backup that fails is
+// recorded, and responded to with a 500.
+func (s *Server) HandleBackup() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The backup goes on, up to Timeout, if the caller gives up.
+		run, err := s.backup(context.WithoutCancel(r.Context()))
+		if err != nil {
+			apperrors.WriteProblem(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(run); err != nil {
+			slog.ErrorContext(r.Context(), "failed to write run", "error", err)
+		}
+	})
+}
+
+// HandleRuns responds with the last runs, most recent first.
+func (s *Server) HandleRuns() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs, err := LastRuns(r.Context(), s.db, s.config.DatabaseName, lastRuns)
+		if err != nil {
+			apperrors.WriteProblem(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(runs); err != nil {
+			slog.ErrorContext(r.Context(), "failed to write runs", "error", err)
+		}
+	})
+}
+
+// schedule backs up now and then every Interval, until ctx is done.
+func (s *Server) schedule(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		run, err := s.backup(ctx)
+		switch {
+		case err == nil:
+			slog.InfoContext(ctx, "scheduled backup succeeded", "location", run.Location, "bytes", run.Bytes)
+		case apperrors.HasCode(err, apperrors.RateLimited), apperrors.HasCode(err, InProgress):
+			slog.InfoContext(ctx, "scheduled backup skipped", "reason", err)
+		default:
+			slog.ErrorContext(ctx, "scheduled backup failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backup dumps the database to the blobstore within Timeout, and records the
+// outcome. It returns the run, and its error if it failed or was refused.
+func (s *Server) backup(ctx context.Context) (*Run, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	startedAt := s.now()
+	prefix := path.Join(s.config.DatabaseName, startedAt.Format("20060102T150405.000000Z"))
+	run := &Run{
+		Database:  s.config.DatabaseName,
+		Location:  s.config.Bucket + "/" + prefix,
+		StartedAt: startedAt,
+	}
+	if err := startRun(ctx, s.db, run, s.config.MinTTL, s.config.Timeout); err != nil {
+		backupRuns.WithLabelValues("skipped").Inc()
+		return nil, err
+	}
+
+	d := &dumper{
+		blobstore: s.blobstore,
+		bucket:    s.config.Bucket,
+		prefix:    prefix,
+		chunkRows: s.config.ChunkRows,
+	}
+	m, dumpErr := d.dump(ctx, s.db.Pool, s.config.DatabaseName)
+
+	run.Bytes = d.bytes
+	run.FinishedAt = s.now()
+	if dumpErr != nil {
+		run.Status, run.Error = StatusFailed, dumpErr.Error()
+	} else {
+		run.Status, run.Tables = StatusSucceeded, len(m.Tables)
+		for _, t := range m.Tables {
+			run.Rows += t.Rows
+		}
+	}
+
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+	if err := finishRun(recordCtx, s.db, run); err != nil {
+		// A run that stays running is failed by the next one after Timeout.
+		slog.ErrorContext(ctx, "failed to record backup", "id", run.ID, "error", err)
+	}
+
+	backupRuns.WithLabelValues(run.Status).Inc()
+	backupDuration.Observe(run.FinishedAt.Sub(run.StartedAt).Seconds())
+	if dumpErr != nil {
+		return run, fmt.Errorf("backup %d failed: %w", run.ID, dumpErr)
+	}
+	backupLastSuccess.Set(float64(run.StartedAt.Unix()))
+	backupBytes.Set(float64(run.Bytes))
+	return run, nil
 }
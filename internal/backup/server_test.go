@@ -0,0 +1,281 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paveletto99/microservice-blueprint/internal/serverenv"
+	"github.com/paveletto99/microservice-blueprint/pkg/database/dbtest"
+	"github.com/paveletto99/microservice-blueprint/pkg/storage"
+)
+
+var testDatabaseInstance *dbtest.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = dbtest.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+// failingBlobstore fails the creation of objects with err.
+type failingBlobstore struct {
+	storage.Blobstore
+	err error
+}
+
+func (b *failingBlobstore) CreateObject(context.Context, string, string, io.Reader, *storage.CreateOptions) (*storage.Object, error) {
+	return nil, b.err
+}
+
+func newBlobstore(t *testing.T) storage.Blobstore {
+	t.Helper()
+
+	store, err := storage.NewInMemory(context.Background(), &storage.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// object returns the contents of the object name of bucket.
+func object(t *testing.T, store storage.Blobstore, bucket, name string) []byte {
+	t.Helper()
+
+	rc, _, err := store.GetObject(context.Background(), bucket, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// lines returns the lines of a gzipped chunk.
+func lines(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	s := bufio.NewScanner(zr)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestChunkWriter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := newBlobstore(t)
+	d := &dumper{blobstore: store, bucket: "bucket", prefix: "db/1"}
+
+	w := d.create(ctx, "db/1/t/000000.jsonl.gz")
+	for _, row := range [][]any{{"1", nil}, {"2", []byte{0xff}}} {
+		if err := json.NewEncoder(w).Encode(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := object(t, store, "bucket", "db/1/t/000000.jsonl.gz")
+	if want := []string{`["1",null]`, `["2","/w=="]`}; strings.Join(lines(t, data), "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected %q, got %q", want, lines(t, data))
+	}
+	if d.bytes != int64(len(data)) {
+		t.Errorf("expected %d bytes, got %d", len(data), d.bytes)
+	}
+	if o, err := store.StatObject(ctx, "bucket", "db/1/t/000000.jsonl.gz"); err != nil || o.ContentType != "application/gzip" {
+		t.Errorf("expected a gzip object, got %+v, %v", o, err)
+	}
+
+	// Failed uploads fail the writer.
+	errUpload := errors.New("upload failed")
+	d.blobstore = &failingBlobstore{Blobstore: store, err: errUpload}
+	w = d.create(ctx, "db/1/t/000001.jsonl.gz")
+	if err := w.Close(); !errors.Is(err, errUpload) {
+		t.Errorf("expected the upload error, got %v", err)
+	}
+}
+
+func TestDumpValue(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		value  any
+		binary bool
+		want   any
+	}{
+		{"null", nil, false, nil},
+		{"text", []byte("abc"), false, "abc"},
+		{"binary", []byte("abc"), true, []byte("abc")},
+		{"integer", int64(42), false, "42"},
+		{"time", time.Date(2026, 10, 19, 12, 30, 0, 500000000, time.UTC), false, "2026-10-19 12:30:00.5"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, _ := json.Marshal(dumpValue(tc.value, tc.binary))
+			want, _ := json.Marshal(tc.want)
+			if !bytes.Equal(got, want) {
+				t.Errorf("expected %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+// newTestServer returns a server backing up a new test database to store.
+func newTestServer(t *testing.T, store storage.Blobstore) *Server {
+	t.Helper()
+
+	env := testDatabaseInstance.NewServerEnv(t, serverenv.WithBlobStorage(store))
+	db := env.Database()
+
+	if _, err := db.Pool.Exec(`
+		INSERT INTO rate_limits (bucket_key, tokens, remaining, interval_ns, reset_at, updated_at)
+		VALUES ('a', 10, 9, 1000, NOW(6), NOW(6)), ('b', 10, 8, 1000, NOW(6), NOW(6)),
+			('c', 10, 7, 1000, NOW(6), NOW(6))`); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err := db.Pool.QueryRow("SELECT DATABASE()").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer(&Config{
+		MinTTL:       time.Hour,
+		Timeout:      time.Minute,
+		ChunkRows:    2,
+		Bucket:       "backups",
+		DatabaseName: name,
+	}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestHandleBackup(t *testing.T) {
+	t.Parallel()
+
+	store := newBlobstore(t)
+	s := newTestServer(t, store)
+	handler := s.Run(context.Background())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/backup", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var run Run
+	if err := json.NewDecoder(w.Body).Decode(&run); err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != StatusSucceeded || run.Rows < 3 || run.Bytes == 0 {
+		t.Errorf("unexpected run %+v", run)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(object(t, store, "backups", strings.TrimPrefix(run.Location, "backups/")+"/manifest.json"), &m); err != nil {
+		t.Fatal(err)
+	}
+	var limits *Table
+	for _, table := range m.Tables {
+		if table.Name == "rate_limits" {
+			limits = table
+		}
+	}
+	if limits == nil {
+		t.Fatalf("expected rate_limits in %+v", m.Tables)
+	}
+	if limits.Rows != 3 || len(limits.Chunks) != 2 || !strings.Contains(limits.Schema, "CREATE TABLE") {
+		t.Errorf("unexpected table %+v", limits)
+	}
+	var got []string
+	for _, chunk := range limits.Chunks {
+		got = append(got, lines(t, object(t, store, "backups", chunk))...)
+	}
+	if len(got) != 3 || !strings.HasPrefix(got[0], `["a","10","9","1000",`) {
+		t.Errorf("unexpected rows %q", got)
+	}
+
+	// The next backup is refused until MinTTL elapsed.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/backup", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After, got %d: %s", w.Code, w.Body)
+	}
+
+	s.now = func() time.Time { return time.Now().UTC().Add(2 * time.Hour) }
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/backup", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 after MinTTL, got %d: %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	var runs []*Run
+	if err := json.NewDecoder(w.Body).Decode(&runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].StartedAt.Before(runs[1].StartedAt) {
+		t.Errorf("expected the 2 runs, most recent first, got %+v", runs)
+	}
+}
+
+func TestHandleBackup_Failed(t *testing.T) {
+	t.Parallel()
+
+	store := newBlobstore(t)
+	s := newTestServer(t, &failingBlobstore{Blobstore: store, err: errors.New("bucket is gone")})
+	handler := s.Run(context.Background())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/backup", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d: %s", w.Code, w.Body)
+	}
+
+	runs, err := LastRuns(context.Background(), s.db, s.config.DatabaseName, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Status != StatusFailed || !strings.Contains(runs[0].Error, "bucket is gone") {
+		t.Errorf("expected a failed run, got %+v", runs)
+	}
+
+	// Failed backups don't count for MinTTL.
+	s.blobstore = store
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/backup", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+}
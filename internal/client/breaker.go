@@ -0,0 +1,255 @@
+package client
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through.
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen lets a few probe calls through, to find out whether the
+	// target recovered.
+	BreakerHalfOpen
+	// BreakerOpen fails every call fast.
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrCircuitOpen is the error of the calls failed fast by an open circuit
+// breaker. Its code is Unavailable, but unlike other Unavailable errors it is
+// never retried.
+var ErrCircuitOpen = status.Error(codes.Unavailable, "circuit breaker is open")
+
+// CircuitBreaker fails calls fast while their target is failing, instead of
+// piling more load on it. It keeps a breaker per target of the connections it
+// intercepts.
+//
+// A breaker opens after BreakerFailures consecutive failures, that is calls
+// ending with Unavailable, DeadlineExceeded, Internal or Unknown. Other errors
+// are answers of a healthy service and count as successes. After
+// BreakerOpenTimeout the breaker is half-open and lets BreakerHalfOpenCalls
+// probes through: it closes again once they all succeed, and opens again as
+// soon as one fails.
+type CircuitBreaker struct {
+	config *Config
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// NewCircuitBreaker creates a circuit breaker configured by config. It lets
+// every call through if config.BreakerFailures is not positive.
+func NewCircuitBreaker(config *Config) *CircuitBreaker {
+	return &CircuitBreaker{
+		config:   config,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+// State returns the state of the breaker of target.
+func (cb *CircuitBreaker) State(target string) BreakerState {
+	b := cb.breaker(target)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// UnaryClientInterceptor returns the interceptor breaking unary calls.
+func (cb *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if cb.config.BreakerFailures <= 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		done, err := cb.breaker(cc.Target()).allow(ctx)
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(ctx, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns the interceptor breaking streams. The
+// outcome of a stream is that of its first message, since streams may be
+// meant to last.
+func (cb *CircuitBreaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if cb.config.BreakerFailures <= 0 {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		done, err := cb.breaker(cc.Target()).allow(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			done(ctx, err)
+			return nil, err
+		}
+		return &breakerStream{ClientStream: stream, ctx: ctx, done: done}, nil
+	}
+}
+
+func (cb *CircuitBreaker) breaker(target string) *breaker {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.breakers[target]
+	if !ok {
+		b = &breaker{target: target, config: cb.config, now: time.Now}
+		breakerState.WithLabelValues(target).Set(float64(BreakerClosed))
+		cb.breakers[target] = b
+	}
+	return b
+}
+
+// breakerStream reports the outcome of its first message to the breaker.
+type breakerStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	once sync.Once
+	done func(context.Context, error)
+}
+
+func (s *breakerStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	s.once.Do(func() {
+		if err == io.EOF {
+			s.done(s.ctx, nil)
+		} else {
+			s.done(s.ctx, err)
+		}
+	})
+	return err
+}
+
+// breaker is the circuit breaker of a target.
+type breaker struct {
+	target string
+	config *Config
+	now    func() time.Time
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int       // consecutive failures, while closed
+	openedAt  time.Time // while open
+	probes    int       // calls in flight, while half-open
+	successes int       // successful probes, while half-open
+}
+
+// allow admits a call, or returns ErrCircuitOpen. The returned function must
+// be called with the outcome of the admitted call.
+func (b *breaker) allow(ctx context.Context) (func(context.Context, error), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		if b.now().Sub(b.openedAt) < b.config.BreakerOpenTimeout {
+			breakerRejections.WithLabelValues(b.target).Inc()
+			return nil, ErrCircuitOpen
+		}
+		b.transition(ctx, BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.halfOpenCalls() {
+			breakerRejections.WithLabelValues(b.target).Inc()
+			return nil, ErrCircuitOpen
+		}
+		b.probes++
+	}
+
+	// The state may change before the call ends. Its outcome only counts in
+	// the state it was admitted in.
+	admitted := b.state
+	return func(ctx context.Context, err error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if admitted == BreakerHalfOpen && b.state == BreakerHalfOpen {
+			b.probes--
+		}
+		if admitted != b.state || status.Code(err) == codes.Canceled {
+			return
+		}
+
+		failed := isFailure(err)
+		switch b.state {
+		case BreakerClosed:
+			if !failed {
+				b.failures = 0
+				return
+			}
+			if b.failures++; b.failures >= b.config.BreakerFailures {
+				b.transition(ctx, BreakerOpen)
+			}
+		case BreakerHalfOpen:
+			if failed {
+				b.transition(ctx, BreakerOpen)
+				return
+			}
+			if b.successes++; b.successes >= b.halfOpenCalls() {
+				b.transition(ctx, BreakerClosed)
+			}
+		}
+	}, nil
+}
+
+func (b *breaker) halfOpenCalls() int {
+	if b.config.BreakerHalfOpenCalls > 0 {
+		return b.config.BreakerHalfOpenCalls
+	}
+	return 1
+}
+
+// transition moves the breaker to state. b.mu must be held.
+func (b *breaker) transition(ctx context.Context, state BreakerState) {
+	from := b.state
+	b.state = state
+	b.failures, b.probes, b.successes = 0, 0, 0
+	if state == BreakerOpen {
+		b.openedAt = b.now()
+	}
+
+	breakerState.WithLabelValues(b.target).Set(float64(state))
+	breakerTransitions.WithLabelValues(b.target, from.String(), state.String()).Inc()
+	slog.WarnContext(ctx, "circuit breaker changed state",
+		"target", b.target,
+		"from", from.String(),
+		"to", state.String())
+}
+
+// isFailure reports whether err is a sign of a failing target.
+func isFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	b := &breaker{
+		target: t.Name(),
+		config: &Config{BreakerFailures: 3, BreakerOpenTimeout: time.Minute, BreakerHalfOpenCalls: 2},
+		now:    func() time.Time { return now },
+	}
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	call := func(err error) error {
+		t.Helper()
+		done, allowErr := b.allow(ctx)
+		if allowErr != nil {
+			return allowErr
+		}
+		done(ctx, err)
+		return nil
+	}
+
+	// Answers of a healthy service reset the failures.
+	call(unavailable)
+	call(unavailable)
+	call(apperrors.New(apperrors.PaymentNotFound, "no such payment"))
+	call(unavailable)
+	call(unavailable)
+	if b.state != BreakerClosed {
+		t.Fatalf("expected %v, got %v", BreakerClosed, b.state)
+	}
+
+	call(unavailable)
+	if b.state != BreakerOpen {
+		t.Fatalf("expected %v, got %v", BreakerOpen, b.state)
+	}
+	if err := call(nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected calls to fail fast, got %v", err)
+	}
+
+	// Half-open, the breaker lets only the configured probes through.
+	now = now.Add(time.Minute)
+	done1, err := b.allow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done2, err := b.allow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.allow(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected a third probe to be rejected, got %v", err)
+	}
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("expected %v, got %v", BreakerHalfOpen, b.state)
+	}
+
+	// A failed probe opens the breaker again, and the other probe no longer
+	// counts.
+	done1(ctx, unavailable)
+	done2(ctx, nil)
+	if b.state != BreakerOpen {
+		t.Fatalf("expected %v, got %v", BreakerOpen, b.state)
+	}
+
+	now = now.Add(time.Minute)
+	call(nil)
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("expected %v, got %v", BreakerHalfOpen, b.state)
+	}
+	call(status.Error(codes.Canceled, "gave up"))
+	call(nil)
+	if b.state != BreakerClosed {
+		t.Fatalf("expected %v, got %v", BreakerClosed, b.state)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	t.Parallel()
+
+	b := NewRetryBudget(0.5, 2)
+	for i := 0; i < 2; i++ {
+		if !b.withdraw() {
+			t.Fatalf("expected the burst to allow retry %d", i)
+		}
+	}
+	if b.withdraw() {
+		t.Fatal("expected the budget to be exhausted")
+	}
+
+	b.deposit()
+	if b.withdraw() {
+		t.Fatal("expected half a token not to allow a retry")
+	}
+	b.deposit()
+	b.deposit()
+	if !b.withdraw() {
+		t.Fatal("expected two calls to earn a retry")
+	}
+
+	var unlimited *RetryBudget = NewRetryBudget(0, 0)
+	if !unlimited.withdraw() {
+		t.Error("expected a zero ratio not to limit retries")
+	}
+}
+
+func TestLatencies(t *testing.T) {
+	t.Parallel()
+
+	var l latencies
+	for i := 1; i < minLatencySamples; i++ {
+		l.observe(time.Duration(i) * time.Millisecond)
+	}
+	if _, ok := l.percentile(0.5); ok {
+		t.Error("expected too few samples")
+	}
+
+	for i := 0; i < 2*latencyWindow; i++ {
+		l.observe(time.Duration(i%100) * time.Millisecond)
+	}
+	if got, _ := l.percentile(0.9); got < 85*time.Millisecond || got > 95*time.Millisecond {
+		t.Errorf("expected a p90 around 90ms, got %v", got)
+	}
+	if len(l.samples) != latencyWindow {
+		t.Errorf("expected %d samples, got %d", latencyWindow, len(l.samples))
+	}
+}
@@ -2,45 +2,258 @@
 
 \*===========================================================================*/
 
-package service
+// Package client is the Go client of the payment service.
+package client
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
 
-	"github.com/paveletto99/microservice-blueprint/internal/serverenv"
-	"github.com/paveletto99/microservice-blueprint/pkg/logging"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 
-	p "github.com/paveletto99/microservice-blueprint/internal/pb/payment"
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
+	"github.com/paveletto99/microservice-blueprint/internal/serverenv"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
 )
 
-// Server is the admin server.
+// IdempotencyKeyHeader is the metadata entry carrying the idempotency key of
+// Create and Refund, as read by the payment service.
+const IdempotencyKeyHeader = "idempotency-key"
+
+// maxAttempts is the most attempts made of a call.
+const maxAttempts = 5
+
+var (
+	// retried are the methods retried on failure. Get and List only read,
+	// Create and Refund are made safe by their idempotency key. The other
+	// transitions are not retried: a retry of an applied transition would
+	// fail.
+	retried = map[string]bool{
+		fullMethod("Get"):    true,
+		fullMethod("List"):   true,
+		fullMethod("Create"): true,
+		fullMethod("Refund"): true,
+	}
+
+	// hedged are the methods hedged when slow, those that only read.
+	hedged = map[string]bool{
+		fullMethod("Get"):  true,
+		fullMethod("List"): true,
+	}
+)
+
+// Client is a client of the payment service. It is safe for concurrent use.
+//
+// Calls are balanced round-robin over the addresses of the target, and unary
+// calls without a deadline get the configured one. Calls that are safe to
+// retry are retried with backoff while the service is unavailable, and slow
+// reads are hedged, both within a retry budget. A circuit breaker fails calls
+// fast while the service keeps failing. Create and Refund requests without an
+// idempotency key get a random one, which stays the same across the retries.
+// Errors of the service are returned as *apperrors.Error.
 type Client struct {
-}
+	paymentv1.PaymentServiceClient
 
-type Config struct {
+	conn      *grpc.ClientConn
+	closeOnce sync.Once
+	closeErr  error
 }
 
-// NewServer makes a new admin console server.
+// NewClient creates a client of the payment service. Connections are made
+// lazily, on the first call. If env is not nil, the client is closed with it.
 func NewClient(ctx context.Context, config *Config, env *serverenv.ServerEnv) (*Client, error) {
-	// if env.Database() == nil {
-	// 	return nil, fmt.Errorf("missing Database in server env")
-	// }
-	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	conn, err := grpc.NewClient("http:/localhost:8080", opts...)
+	if err := validateRetries(config); err != nil {
+		return nil, err
+	}
+
+	budget := NewRetryBudget(config.RetryBudgetRatio, config.RetryBudgetBurst)
+	conn, err := dial(config,
+		idempotencyKeys(),
+		UnaryRetry(config, budget),
+		UnaryHedging(config, budget))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment client: %w", err)
+	}
+
+	c := &Client{
+		PaymentServiceClient: paymentv1.NewPaymentServiceClient(conn),
+		conn:                 conn,
+	}
+	if env != nil {
+		env.RegisterCloser(func(context.Context) error {
+			return c.Close()
+		})
+	}
+	return c, nil
+}
+
+// Close closes the connections of the client. It may be called more than
+// once.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.conn.Close()
+	})
+	return c.closeErr
+}
+
+// Dial connects to any of our gRPC services with the connection settings of
+// config: TLS or mTLS, the resolvers, round-robin balancing and the circuit
+// breaker. Unary calls without a deadline get config.Timeout, and errors of
+// our services are decoded into *apperrors.Error. Calls are not retried nor
+// hedged, since Dial does not know which methods are safe to repeat. The
+// caller must close the connection.
+func Dial(config *Config) (*grpc.ClientConn, error) {
+	return dial(config)
+}
+
+// dial is Dial, running the given interceptors inside the deadline and outside
+// the circuit breaker, so that the breaker sees every attempt of a call.
+func dial(config *Config, interceptors ...grpc.UnaryClientInterceptor) (*grpc.ClientConn, error) {
+	creds, err := transportCredentials(config)
 	if err != nil {
-		logging.Info(ctx, "It is fine, this is not a complete example.")
+		return nil, err
+	}
+	sc, err := serviceConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	defer conn.Close()
+	breaker := NewCircuitBreaker(config)
+	unary := []grpc.UnaryClientInterceptor{defaultDeadline(config.Timeout)}
+	unary = append(unary, interceptors...)
+	unary = append(unary,
+		breaker.UnaryClientInterceptor(),
+		// Errors of our services are decoded into *apperrors.Error.
+		apperrors.UnaryClientInterceptor())
 
-	paymentClient := p.NewPaymentClient(conn)
-	_, err = paymentClient.Create(ctx, &p.CreatePaymentRequest{Price: 23})
+	conn, err := grpc.NewClient(config.Target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithResolvers(staticBuilder{}),
+		grpc.WithDefaultServiceConfig(sc),
+		grpc.WithDisableRetry(),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithChainUnaryInterceptor(unary...),
+		grpc.WithChainStreamInterceptor(
+			breaker.StreamClientInterceptor(),
+			apperrors.StreamClientInterceptor()))
 	if err != nil {
-		logging.Info(ctx, "Don't worry, we don't expect to see it is working.")
+		return nil, fmt.Errorf("failed to connect to %q: %w", config.Target, err)
 	}
+	return conn, nil
+}
 
-	return &Client{}, nil
+// transportCredentials returns the credentials of the connections: TLS,
+// with a client certificate for mTLS if configured, unless disabled.
+func transportCredentials(config *Config) (credentials.TransportCredentials, error) {
+	if config.Insecure {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.ServerName,
+	}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("the client certificate and key must be set together")
+	}
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// fullMethod returns the full name of a method of the payment service.
+func fullMethod(name string) string {
+	return "/" + paymentv1.PaymentService_ServiceDesc.ServiceName + "/" + name
+}
+
+// validateRetries checks the retry settings of config.
+func validateRetries(config *Config) error {
+	if config.MaxAttempts <= 1 {
+		return nil
+	}
+	if config.MaxAttempts > maxAttempts {
+		return fmt.Errorf("at most %d attempts are supported, got %d", maxAttempts, config.MaxAttempts)
+	}
+	if config.InitialBackoff <= 0 || config.MaxBackoff < config.InitialBackoff {
+		return fmt.Errorf("backoffs must be positive, with the maximum at least the initial one")
+	}
+	return nil
+}
+
+// serviceConfig returns the gRPC service config of the client, see
+// https://github.com/grpc/grpc/blob/master/doc/service_config.md. Retries are
+// not part of it: they are made by UnaryRetry, within the retry budget.
+func serviceConfig() (string, error) {
+	sc := struct {
+		LoadBalancingConfig []map[string]any `json:"loadBalancingConfig"`
+	}{
+		LoadBalancingConfig: []map[string]any{{"round_robin": map[string]any{}}},
+	}
+
+	b, err := json.Marshal(sc)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode service config: %w", err)
+	}
+	return string(b), nil
+}
+
+// defaultDeadline gives calls without a deadline one of timeout. The deadline
+// covers the retries as well.
+func defaultDeadline(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// idempotencyKeys sets a random idempotency key on the Create and Refund
+// requests that have none, in their field or in the metadata. The key is set
+// on the request itself, so that callers retrying it on their own reuse it.
+func idempotencyKeys() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(IdempotencyKeyHeader)) == 0 {
+			switch r := req.(type) {
+			case *paymentv1.CreatePaymentRequest:
+				if r.GetIdempotencyKey() == "" {
+					r.IdempotencyKey = rand.Text()
+				}
+			case *paymentv1.RefundPaymentRequest:
+				if r.GetIdempotencyKey() == "" {
+					r.IdempotencyKey = rand.Text()
+				}
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
 }
@@ -0,0 +1,344 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
+	"github.com/paveletto99/microservice-blueprint/internal/serverenv"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+// fakeServer fails the first failures calls of every method with
+// Unavailable, delays the calls of Get by getDelay if set, and records the
+// calls it gets.
+type fakeServer struct {
+	paymentv1.UnimplementedPaymentServiceServer
+	failures int
+	getDelay func(call int) time.Duration
+
+	mu    sync.Mutex
+	calls map[string]int
+	keys  []string
+}
+
+func (f *fakeServer) call(ctx context.Context, method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[method]++
+	if _, ok := ctx.Deadline(); !ok {
+		return status.Error(codes.FailedPrecondition, "no deadline")
+	}
+	if f.calls[method] <= f.failures {
+		return status.Error(codes.Unavailable, "try again")
+	}
+	return nil
+}
+
+func (f *fakeServer) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+func (f *fakeServer) Get(ctx context.Context, req *paymentv1.GetPaymentRequest) (*paymentv1.Payment, error) {
+	if err := f.call(ctx, "Get"); err != nil {
+		return nil, err
+	}
+	if f.getDelay != nil {
+		select {
+		case <-time.After(f.getDelay(f.count("Get"))):
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return &paymentv1.Payment{BillId: req.GetBillId()}, nil
+}
+
+func (f *fakeServer) Create(ctx context.Context, req *paymentv1.CreatePaymentRequest) (*paymentv1.CreatePaymentResponse, error) {
+	f.mu.Lock()
+	f.keys = append(f.keys, req.GetIdempotencyKey())
+	f.mu.Unlock()
+
+	if err := f.call(ctx, "Create"); err != nil {
+		return nil, err
+	}
+	return &paymentv1.CreatePaymentResponse{BillId: 1, Amount: req.GetAmount()}, nil
+}
+
+func (f *fakeServer) Capture(ctx context.Context, req *paymentv1.CapturePaymentRequest) (*paymentv1.Payment, error) {
+	if err := f.call(ctx, "Capture"); err != nil {
+		return nil, err
+	}
+	return &paymentv1.Payment{BillId: req.GetBillId()}, nil
+}
+
+func (f *fakeServer) Cancel(ctx context.Context, req *paymentv1.CancelPaymentRequest) (*paymentv1.Payment, error) {
+	return nil, apperrors.New(apperrors.IllegalTransition, "already captured")
+}
+
+// serve starts a server of srv and returns its address.
+func serve(t *testing.T, srv paymentv1.PaymentServiceServer) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	paymentv1.RegisterPaymentServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func testConfig(target string) *Config {
+	return &Config{
+		Target:         target,
+		Insecure:       true,
+		Timeout:        5 * time.Second,
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+	}
+}
+
+func newTestClient(t *testing.T, config *Config) *Client {
+	t.Helper()
+
+	c, err := NewClient(context.Background(), config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient_RoundRobin(t *testing.T) {
+	t.Parallel()
+
+	a, b := &fakeServer{}, &fakeServer{}
+	c := newTestClient(t, testConfig("static:///"+serve(t, a)+","+serve(t, b)))
+
+	for i := 0; i < 10; i++ {
+		if _, err := c.Get(context.Background(), &paymentv1.GetPaymentRequest{BillId: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.count("Get") == 0 || b.count("Get") == 0 {
+		t.Errorf("expected calls on both servers, got %d and %d", a.count("Get"), b.count("Get"))
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	t.Parallel()
+
+	srv := &fakeServer{failures: 2}
+	c := newTestClient(t, testConfig("static:///"+serve(t, srv)))
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, &paymentv1.GetPaymentRequest{BillId: 1}); err != nil {
+		t.Errorf("expected Get to succeed after retries, got %v", err)
+	}
+	if got := srv.count("Get"); got != 3 {
+		t.Errorf("expected 3 attempts of Get, got %d", got)
+	}
+
+	req := &paymentv1.CreatePaymentRequest{Amount: &paymentv1.Money{CurrencyCode: "EUR", AmountMinor: 100}}
+	if _, err := c.Create(ctx, req); err != nil {
+		t.Errorf("expected Create to succeed after retries, got %v", err)
+	}
+	if req.GetIdempotencyKey() == "" {
+		t.Errorf("expected an idempotency key to be set")
+	}
+	for _, k := range srv.keys {
+		if k != req.GetIdempotencyKey() {
+			t.Errorf("expected every attempt to carry %q, got %q", req.GetIdempotencyKey(), srv.keys)
+			break
+		}
+	}
+
+	_, err := c.Capture(ctx, &paymentv1.CapturePaymentRequest{BillId: 1})
+	if got := status.Code(err); got != codes.Unavailable {
+		t.Errorf("expected Capture to fail with Unavailable, got %v", err)
+	}
+	if got := srv.count("Capture"); got != 1 {
+		t.Errorf("expected Capture not to be retried, got %d attempts", got)
+	}
+
+	_, err = c.Cancel(ctx, &paymentv1.CancelPaymentRequest{BillId: 1})
+	if !apperrors.HasCode(err, apperrors.IllegalTransition) {
+		t.Errorf("expected ILLEGAL_STATUS_TRANSITION, got %v", err)
+	}
+}
+
+func TestClient_Hedging(t *testing.T) {
+	t.Parallel()
+
+	// Every call after the first samples is slow, but hedges are not.
+	srv := &fakeServer{getDelay: func(call int) time.Duration {
+		if call > minLatencySamples && call%2 == 1 {
+			return time.Minute
+		}
+		return 0
+	}}
+	config := testConfig("static:///" + serve(t, srv))
+	config.HedgePercentile = 0.9
+	config.HedgeMinDelay = 10 * time.Millisecond
+	c := newTestClient(t, config)
+	ctx := context.Background()
+
+	for i := 0; i < minLatencySamples; i++ {
+		if _, err := c.Get(ctx, &paymentv1.GetPaymentRequest{BillId: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	p, err := c.Get(ctx, &paymentv1.GetPaymentRequest{BillId: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetBillId(); got != 42 {
+		t.Errorf("expected the reply of the hedge, got bill %d", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the hedge to answer quickly, took %v", elapsed)
+	}
+	if got := srv.count("Get"); got != minLatencySamples+2 {
+		t.Errorf("expected %d calls, got %d", minLatencySamples+2, got)
+	}
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	srv := &fakeServer{failures: 100}
+	config := testConfig("static:///" + serve(t, srv))
+	config.MaxAttempts = 1
+	config.BreakerFailures = 2
+	config.BreakerOpenTimeout = time.Hour
+	c := newTestClient(t, config)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Capture(ctx, &paymentv1.CapturePaymentRequest{BillId: 1}); status.Code(err) != codes.Unavailable {
+			t.Fatalf("expected Unavailable, got %v", err)
+		}
+	}
+	_, err := c.Get(ctx, &paymentv1.GetPaymentRequest{BillId: 1})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected the breaker to be open, got %v", err)
+	}
+	if got := srv.count("Get"); got != 0 {
+		t.Errorf("expected no call to reach the service, got %d", got)
+	}
+}
+
+func TestClient_RetryBudget(t *testing.T) {
+	t.Parallel()
+
+	srv := &fakeServer{failures: 100}
+	config := testConfig("static:///" + serve(t, srv))
+	config.RetryBudgetRatio = 0.1
+	config.RetryBudgetBurst = 3
+	c := newTestClient(t, config)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		c.Get(ctx, &paymentv1.GetPaymentRequest{BillId: 1})
+	}
+	// 5 calls, 3 retries of the burst, none earned yet.
+	if got := srv.count("Get"); got != 8 {
+		t.Errorf("expected 8 attempts, got %d", got)
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := serverenv.New(ctx)
+	c, err := NewClient(ctx, testConfig("static:///"+serve(t, &fakeServer{})), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, &paymentv1.GetPaymentRequest{BillId: 1}); status.Code(err) != codes.Canceled {
+		t.Errorf("expected calls to fail once the env is closed, got %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("expected closing again to succeed, got %v", err)
+	}
+}
+
+func TestNewClient_Config(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		config *Config
+		err    string
+	}{
+		{
+			name:   "cert without key",
+			config: &Config{Target: "dns:///localhost:50051", CertFile: "client.pem"},
+			err:    "must be set together",
+		},
+		{
+			name:   "missing CA",
+			config: &Config{Target: "dns:///localhost:50051", CAFile: "does-not-exist.pem"},
+			err:    "failed to read CA file",
+		},
+		{
+			name:   "too many attempts",
+			config: &Config{Target: "dns:///localhost:50051", Insecure: true, MaxAttempts: 6, InitialBackoff: time.Second, MaxBackoff: time.Second},
+			err:    "at most 5 attempts",
+		},
+		{
+			name:   "no backoff",
+			config: &Config{Target: "dns:///localhost:50051", Insecure: true, MaxAttempts: 2},
+			err:    "backoffs must be positive",
+		},
+		{
+			name:   "tls",
+			config: &Config{Target: "dns:///localhost:50051", MaxAttempts: 1},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := NewClient(context.Background(), tc.config, nil)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
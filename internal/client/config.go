@@ -0,0 +1,64 @@
+package client
+
+import (
+	"time"
+)
+
+// Config represents the configuration and associated environment variables for
+// clients of the payment service.
+type Config struct {
+	// Target is the gRPC target of the payment service. Use dns:///host:port to
+	// balance over the addresses of a name, or static:///host1:port,host2:port
+	// for a fixed list of addresses.
+	Target string `env:"PAYMENT_TARGET, default=dns:///localhost:50051"`
+
+	// Insecure disables TLS. In practice, this is only useful in local testing.
+	Insecure bool `env:"PAYMENT_INSECURE"`
+
+	// CAFile is the PEM bundle of the CAs trusted to sign the certificate of the
+	// service, the system pool if empty. ServerName overrides the name the
+	// certificate is checked against, which defaults to the host of Target.
+	CAFile     string `env:"PAYMENT_TLS_CA_FILE"`
+	ServerName string `env:"PAYMENT_TLS_SERVER_NAME"`
+
+	// CertFile and KeyFile are the client certificate and key presented for
+	// mTLS. They must be set together.
+	CertFile string `env:"PAYMENT_TLS_CERT_FILE"`
+	KeyFile  string `env:"PAYMENT_TLS_KEY_FILE"`
+
+	// Timeout is the deadline of unary calls whose context has none. Streams
+	// are never given one.
+	Timeout time.Duration `env:"PAYMENT_CALL_TIMEOUT, default=10s"`
+
+	// MaxAttempts is the number of attempts of calls that are safe to retry,
+	// including the first one. Retries wait between InitialBackoff and
+	// MaxBackoff, growing exponentially with jitter.
+	MaxAttempts    int           `env:"PAYMENT_MAX_ATTEMPTS, default=4"`
+	InitialBackoff time.Duration `env:"PAYMENT_INITIAL_BACKOFF, default=100ms"`
+	MaxBackoff     time.Duration `env:"PAYMENT_MAX_BACKOFF, default=2s"`
+
+	// RetryBudgetRatio is the share of calls that may be retried or hedged,
+	// with RetryBudgetBurst retries allowed on top of it. If zero, retries are
+	// not budgeted.
+	RetryBudgetRatio float64 `env:"PAYMENT_RETRY_BUDGET_RATIO, default=0.1"`
+	RetryBudgetBurst int     `env:"PAYMENT_RETRY_BUDGET_BURST, default=10"`
+
+	// BreakerFailures is the number of consecutive failures opening the
+	// circuit breaker, which then fails calls fast for BreakerOpenTimeout
+	// before letting BreakerHalfOpenCalls probes through. If zero, there is no
+	// circuit breaker.
+	BreakerFailures      int           `env:"PAYMENT_BREAKER_FAILURES, default=5"`
+	BreakerOpenTimeout   time.Duration `env:"PAYMENT_BREAKER_OPEN_TIMEOUT, default=30s"`
+	BreakerHalfOpenCalls int           `env:"PAYMENT_BREAKER_HALF_OPEN_CALLS, default=2"`
+
+	// HedgePercentile is the percentile of the recent latencies of a read
+	// after which a hedged request is sent, between 0 and 1, but no earlier
+	// than HedgeMinDelay. If zero, requests are not hedged.
+	HedgePercentile float64       `env:"PAYMENT_HEDGE_PERCENTILE, default=0.95"`
+	HedgeMinDelay   time.Duration `env:"PAYMENT_HEDGE_MIN_DELAY, default=5ms"`
+}
+
+// PaymentClientConfig returns the payment client configuration.
+func (c *Config) PaymentClientConfig() *Config {
+	return c
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// latencyWindow is the number of recent latencies of a method the hedging
+	// delay is computed from.
+	latencyWindow = 256
+
+	// minLatencySamples is the number of latencies of a method needed before
+	// its calls are hedged.
+	minLatencySamples = 32
+)
+
+// UnaryHedging hedges the calls of the methods that only read: when a call
+// takes longer than the config.HedgePercentile of the recent latencies of its
+// method, and at least config.HedgeMinDelay, a second attempt is sent. The
+// first answer of the service wins and the other attempt is canceled. Hedges
+// are subject to budget, which may be nil.
+//
+// Calls are not hedged until enough latencies of their method are known, nor
+// at all if config.HedgePercentile is not positive. Call options are shared by
+// both attempts, so options writing back, like grpc.Header, see the last one.
+func UnaryHedging(config *Config, budget *RetryBudget) grpc.UnaryClientInterceptor {
+	var (
+		mu      sync.Mutex
+		windows = make(map[string]*latencies)
+	)
+	latenciesOf := func(method string) *latencies {
+		mu.Lock()
+		defer mu.Unlock()
+
+		l, ok := windows[method]
+		if !ok {
+			l = &latencies{}
+			windows[method] = l
+		}
+		return l
+	}
+
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !hedged[method] || config.HedgePercentile <= 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		l := latenciesOf(method)
+		delay, ok := l.percentile(config.HedgePercentile)
+		if !ok {
+			start := time.Now()
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil {
+				l.observe(time.Since(start))
+			}
+			return err
+		}
+		delay = max(delay, config.HedgeMinDelay)
+		msg, ok := reply.(proto.Message)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Both attempts decode into their own reply, since the loser may still
+		// be writing to it when the call returns.
+		type result struct {
+			reply  proto.Message
+			err    error
+			hedged bool
+		}
+		results := make(chan result, 2)
+		attempt := func(hedged bool) {
+			reply := msg.ProtoReflect().New().Interface()
+			start := time.Now()
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil {
+				l.observe(time.Since(start))
+			}
+			results <- result{reply: reply, err: err, hedged: hedged}
+		}
+		go attempt(false)
+
+		var r result
+		t := time.NewTimer(delay)
+		select {
+		case r = <-results:
+			t.Stop()
+		case <-t.C:
+			if !budget.withdraw() {
+				budgetExhausted.WithLabelValues(method, "hedge").Inc()
+				r = <-results
+				break
+			}
+			go attempt(true)
+
+			// The first answer wins, unless it is a failure and the other
+			// attempt may still do better.
+			if r = <-results; isFailure(r.err) {
+				r = <-results
+			}
+			if r.hedged {
+				hedges.WithLabelValues(method, "won").Inc()
+			} else {
+				hedges.WithLabelValues(method, "lost").Inc()
+			}
+		}
+
+		if r.err != nil {
+			return r.err
+		}
+		proto.Reset(msg)
+		proto.Merge(msg, r.reply)
+		return nil
+	}
+}
+
+// latencies are the recent latencies of the successful calls of a method.
+type latencies struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencies) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.samples) < latencyWindow {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencyWindow
+}
+
+// percentile returns the p quantile of the latencies, p between 0 and 1, or
+// false if there are too few of them.
+func (l *latencies) percentile(p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	sorted := slices.Clone(l.samples)
+	l.mu.Unlock()
+
+	if len(sorted) < minLatencySamples {
+		return 0, false
+	}
+	slices.Sort(sorted)
+	i := min(int(p*float64(len(sorted))), len(sorted)-1)
+	return sorted[i], true
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "payment_client_circuit_breaker_state",
+		Help: "state of the circuit breaker of each target: 0 closed, 1 half-open, 2 open",
+	}, []string{"target"})
+
+	breakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_client_circuit_breaker_transitions_total",
+		Help: "total number of state changes of the circuit breaker of each target",
+	}, []string{"target", "from", "to"})
+
+	breakerRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_client_circuit_breaker_rejections_total",
+		Help: "total number of calls failed fast by the circuit breaker of each target",
+	}, []string{"target"})
+
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_client_retries_total",
+		Help: "total number of retries of calls by method",
+	}, []string{"method"})
+
+	hedges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_client_hedges_total",
+		Help: "total number of hedged attempts of calls by method and whether they won",
+	}, []string{"method", "result"})
+
+	budgetExhausted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_client_retry_budget_exhausted_total",
+		Help: "total number of retries and hedges not made for lack of retry budget by method",
+	}, []string{"method", "kind"})
+)
+
+func init() {
+	prometheus.MustRegister(breakerState, breakerTransitions, breakerRejections, retries, hedges, budgetExhausted)
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// staticScheme is the scheme of targets listing their addresses, e.g.
+// static:///10.0.0.1:50051,10.0.0.2:50051.
+const staticScheme = "static"
+
+// staticBuilder resolves static targets to their list of addresses. It is
+// installed per connection rather than globally, not to clash with other
+// packages.
+type staticBuilder struct{}
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	var addrs []resolver.Address
+	for _, addr := range strings.Split(target.Endpoint(), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, resolver.Address{Addr: addr})
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("static target %q has no addresses", target.URL.String())
+	}
+	if err := cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		return nil, fmt.Errorf("failed to update addresses: %w", err)
+	}
+	return staticResolver{}, nil
+}
+
+func (staticBuilder) Scheme() string {
+	return staticScheme
+}
+
+// staticResolver has nothing to resolve again.
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (staticResolver) Close() {}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryBudget caps the retries and hedges of calls to a share of the calls,
+// so that a degraded service does not get several times its usual load.
+//
+// Every call earns the budget ratio tokens, up to burst, and every retry or
+// hedge spends one. The budget starts full, so that the first failures of a
+// quiet client can be retried too.
+type RetryBudget struct {
+	ratio float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// NewRetryBudget creates a retry budget. It returns nil, the budget allowing
+// every retry, if ratio is not positive.
+func NewRetryBudget(ratio float64, burst int) *RetryBudget {
+	if ratio <= 0 {
+		return nil
+	}
+	return &RetryBudget{
+		ratio:  ratio,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// deposit earns the tokens of a call.
+func (b *RetryBudget) deposit() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.burst)
+}
+
+// withdraw spends the token of a retry or hedge, and reports whether there
+// was one.
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// UnaryRetry retries the calls of the methods that are safe to retry while
+// they fail with Unavailable, up to config.MaxAttempts attempts in all. Retries
+// wait a random backoff, whose cap grows exponentially from
+// config.InitialBackoff to config.MaxBackoff, and are subject to budget, which
+// may be nil.
+func UnaryRetry(config *Config, budget *RetryBudget) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		budget.deposit()
+		if !retried[method] || config.MaxAttempts <= 1 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		backoff := config.InitialBackoff
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if status.Code(err) != codes.Unavailable || errors.Is(err, ErrCircuitOpen) || attempt >= config.MaxAttempts {
+				return err
+			}
+			if !budget.withdraw() {
+				budgetExhausted.WithLabelValues(method, "retry").Inc()
+				return err
+			}
+
+			t := time.NewTimer(jitter(backoff))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return err
+			case <-t.C:
+			}
+			backoff = min(2*backoff, config.MaxBackoff)
+			retries.WithLabelValues(method).Inc()
+		}
+	}
+}
+
+// jitter returns a random duration below d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
@@ -0,0 +1,50 @@
+// Package grpcmiddleware provides the interceptors every gRPC server should
+// run: access logging, panic recovery, RED metrics and default deadlines. It
+// is the gRPC counterpart to package middleware.
+package grpcmiddleware
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/paveletto99/microservice-blueprint/internal/metrics"
+)
+
+// Config configures the standard interceptors.
+type Config struct {
+	// Metrics receives the request metrics. If nil, no metrics are recorded.
+	Metrics *metrics.Metrics
+
+	// DefaultTimeout is the deadline of unary calls whose client did not set
+	// one. If zero, such calls have no deadline.
+	DefaultTimeout time.Duration
+}
+
+// UnaryChain returns a server option that runs the standard unary
+// interceptors, outermost first logging, metrics, recovery and deadline, and
+// then the given ones.
+func UnaryChain(config *Config, interceptors ...grpc.UnaryServerInterceptor) grpc.ServerOption {
+	chain := []grpc.UnaryServerInterceptor{UnaryLogging()}
+	if config.Metrics != nil {
+		chain = append(chain, UnaryMetrics(config.Metrics))
+	}
+	chain = append(chain, UnaryRecovery())
+	if config.DefaultTimeout > 0 {
+		chain = append(chain, UnaryDeadline(config.DefaultTimeout))
+	}
+	return grpc.ChainUnaryInterceptor(append(chain, interceptors...)...)
+}
+
+// StreamChain returns a server option that runs the standard stream
+// interceptors, outermost first logging, metrics and recovery, and then the
+// given ones. Streams get no default deadline, since they may be meant to
+// last.
+func StreamChain(config *Config, interceptors ...grpc.StreamServerInterceptor) grpc.ServerOption {
+	chain := []grpc.StreamServerInterceptor{StreamLogging()}
+	if config.Metrics != nil {
+		chain = append(chain, StreamMetrics(config.Metrics))
+	}
+	chain = append(chain, StreamRecovery())
+	return grpc.ChainStreamInterceptor(append(chain, interceptors...)...)
+}
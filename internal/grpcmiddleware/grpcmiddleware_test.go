@@ -0,0 +1,152 @@
+package grpcmiddleware_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/paveletto99/microservice-blueprint/internal/grpcmiddleware"
+	"github.com/paveletto99/microservice-blueprint/internal/metrics"
+)
+
+const checkMethod = "/grpc.health.v1.Health/Check"
+
+// newHealthClient serves the health service with opts and returns a client.
+func newHealthClient(t *testing.T, opts ...grpc.ServerOption) healthpb.HealthClient {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func metricValue(t *testing.T, c prometheus.Collector) float64 {
+	t.Helper()
+
+	m, ok := c.(prometheus.Metric)
+	if !ok {
+		t.Fatalf("%T is not a metric", c)
+	}
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case pb.Counter != nil:
+		return pb.Counter.GetValue()
+	case pb.Gauge != nil:
+		return pb.Gauge.GetValue()
+	case pb.Histogram != nil:
+		return float64(pb.Histogram.GetSampleCount())
+	}
+	t.Fatalf("unexpected metric %v", &pb)
+	return 0
+}
+
+func TestUnaryChain(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New(prometheus.NewRegistry())
+	config := &grpcmiddleware.Config{Metrics: m, DefaultTimeout: time.Minute}
+
+	var deadline time.Time
+	inner := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		deadline, _ = ctx.Deadline()
+		if req.(*healthpb.HealthCheckRequest).GetService() == "panic" {
+			panic("oops")
+		}
+		return handler(ctx, req)
+	}
+
+	client := newHealthClient(t, grpcmiddleware.UnaryChain(config, inner))
+	ctx := context.Background()
+
+	// Calls without a deadline get the default one.
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(deadline); d <= 0 || d > time.Minute {
+		t.Errorf("expected a deadline within a minute, got %v", d)
+	}
+
+	// Client deadlines are kept.
+	shortCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if _, err := client.Check(shortCtx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(deadline); d > 10*time.Second {
+		t.Errorf("expected the client deadline, got %v", d)
+	}
+
+	// Panics become Internal errors, which are counted.
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "panic"}); status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal, got %v", err)
+	}
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "panic"}); status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal after a panic, got %v", err)
+	}
+
+	if got := metricValue(t, m.ApiTotal.WithLabelValues(checkMethod, "grpc", "OK")); got != 2 {
+		t.Errorf("expected 2 successful calls, got %v", got)
+	}
+	if got := metricValue(t, m.ApiTotal.WithLabelValues(checkMethod, "grpc", "Internal")); got != 2 {
+		t.Errorf("expected 2 failed calls, got %v", got)
+	}
+	if got := metricValue(t, m.ApiDuration.WithLabelValues(checkMethod, "grpc").(prometheus.Histogram)); got != 4 {
+		t.Errorf("expected 4 observed durations, got %v", got)
+	}
+	if got := metricValue(t, m.ApiInFlight.WithLabelValues(checkMethod, "grpc")); got != 0 {
+		t.Errorf("expected no calls in flight, got %v", got)
+	}
+}
+
+func TestStreamChain(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New(prometheus.NewRegistry())
+	config := &grpcmiddleware.Config{Metrics: m, DefaultTimeout: time.Nanosecond}
+
+	inner := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if _, ok := ss.Context().Deadline(); ok {
+			return status.Error(codes.FailedPrecondition, "streams should have no default deadline")
+		}
+		panic("oops")
+	}
+
+	client := newHealthClient(t, grpcmiddleware.StreamChain(config, inner))
+
+	stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal, got %v", err)
+	}
+
+	if got := metricValue(t, m.ApiTotal.WithLabelValues("/grpc.health.v1.Health/Watch", "grpc", "Internal")); got != 1 {
+		t.Errorf("expected 1 failed stream, got %v", got)
+	}
+}
@@ -0,0 +1,62 @@
+package grpcmiddleware
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryLogging logs every unary call once it completes.
+func UnaryLogging() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, info.FullMethod, "unary", start, err)
+		return resp, err
+	}
+}
+
+// StreamLogging logs every stream once it ends.
+func StreamLogging() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), info.FullMethod, "stream", start, err)
+		return err
+	}
+}
+
+// logCall logs a completed call at a level matching its status code: server
+// faults are errors, client faults warnings.
+func logCall(ctx context.Context, method, kind string, start time.Time, err error) {
+	st := status.Convert(err)
+
+	attrs := []any{
+		"grpc.method", method,
+		"grpc.kind", kind,
+		"grpc.code", st.Code().String(),
+		"duration", time.Since(start),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		attrs = append(attrs, "peer", p.Addr.String())
+	}
+	if err != nil {
+		attrs = append(attrs, "error", st.Message())
+	}
+
+	level := slog.LevelInfo
+	switch st.Code() {
+	case codes.OK, codes.Canceled:
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal,
+		codes.Unavailable, codes.DataLoss:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+	slog.Log(ctx, level, "finished call", attrs...)
+}
@@ -0,0 +1,50 @@
+package grpcmiddleware
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/paveletto99/microservice-blueprint/internal/metrics"
+)
+
+// protocol is the value of the protocol label of gRPC requests.
+const protocol = "grpc"
+
+// UnaryMetrics records the rate, errors and duration of unary calls in the
+// ApiTotal, ApiInFlight and ApiDuration metrics, labelled with the method.
+func UnaryMetrics(m *metrics.Metrics) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		done := observe(m, info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+}
+
+// StreamMetrics is UnaryMetrics for streams. Their duration is the lifetime
+// of the stream.
+func StreamMetrics(m *metrics.Metrics) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := observe(m, info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+}
+
+// observe records the start of a call and returns the function recording its
+// end.
+func observe(m *metrics.Metrics, method string) func(error) {
+	start := time.Now()
+	inFlight := m.ApiInFlight.WithLabelValues(method, protocol)
+	inFlight.Inc()
+
+	return func(err error) {
+		inFlight.Dec()
+		m.ApiDuration.WithLabelValues(method, protocol).Observe(time.Since(start).Seconds())
+		m.ApiTotal.WithLabelValues(method, protocol, status.Code(err).String()).Inc()
+	}
+}
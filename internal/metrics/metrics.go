@@ -1,7 +1,5 @@
 package metrics
 
-package metrics
-
 import "github.com/prometheus/client_golang/prometheus"
 
 type Metrics struct {
@@ -12,6 +10,7 @@ type Metrics struct {
 	AioConnection      *prometheus.GaugeVec
 	ApiTotal           *prometheus.CounterVec
 	ApiInFlight        *prometheus.GaugeVec
+	ApiDuration        *prometheus.HistogramVec
 	CoroutinesTotal    *prometheus.CounterVec
 	CoroutinesInFlight *prometheus.GaugeVec
 }
@@ -46,6 +45,11 @@ func New(reg prometheus.Registerer) *Metrics {
 			Name: "api_in_flight_requests",
 			Help: "number of in flight api requests",
 		}, []string{"type", "protocol"}),
+		ApiDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "api_request_duration_seconds",
+			Help:    "duration of api requests",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"type", "protocol"}),
 		CoroutinesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "coroutines_total",
 			Help: "total number of coroutines",
@@ -68,6 +72,7 @@ func (m *Metrics) Enable(reg prometheus.Registerer) {
 	reg.MustRegister(m.AioConnection)
 	reg.MustRegister(m.ApiTotal)
 	reg.MustRegister(m.ApiInFlight)
+	reg.MustRegister(m.ApiDuration)
 	reg.MustRegister(m.CoroutinesTotal)
 	reg.MustRegister(m.CoroutinesInFlight)
 }
@@ -80,6 +85,7 @@ func (m *Metrics) Disable(reg prometheus.Registerer) {
 	reg.Unregister(m.AioConnection)
 	reg.Unregister(m.ApiTotal)
 	reg.Unregister(m.ApiInFlight)
+	reg.Unregister(m.ApiDuration)
 	reg.Unregister(m.CoroutinesTotal)
 	reg.Unregister(m.CoroutinesInFlight)
 }
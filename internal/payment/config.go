@@ -2,26 +2,69 @@ package payment
 
 import (
 	"time"
+
+	"github.com/paveletto99/microservice-blueprint/internal/setup"
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+	"github.com/paveletto99/microservice-blueprint/pkg/database/idempotency"
+	"github.com/paveletto99/microservice-blueprint/pkg/database/outbox"
+	"github.com/paveletto99/microservice-blueprint/pkg/observability"
+	"github.com/paveletto99/microservice-blueprint/pkg/pagetoken"
+	"github.com/paveletto99/microservice-blueprint/pkg/ratelimit"
 )
 
-// // Compile-time check to assert this config matches requirements.
-// var (
-// 	_ setup.DatabaseConfigProvider              = (*Config)(nil)
-// 	_ setup.SecretManagerConfigProvider         = (*Config)(nil)
-// 	_ setup.ObservabilityExporterConfigProvider = (*Config)(nil)
-// )
+// Compile-time check to assert this config matches requirements.
+var (
+	_ setup.DatabaseConfigProvider              = (*Config)(nil)
+	_ setup.ObservabilityExporterConfigProvider = (*Config)(nil)
+	// _ setup.SecretManagerConfigProvider         = (*Config)(nil)
+)
 
 // Config is the configuration for the federation components (data sent to other servers).
 type Config struct {
-	// Database              database.Config
+	Database    database.Config
+	Idempotency idempotency.Config
+	Outbox      outbox.Config
+	PageToken   pagetoken.Config
+	RateLimit   ratelimit.Config
+
+	ObservabilityExporter observability.Config
 	// SecretManager         secrets.Config
-	// ObservabilityExporter observability.Config
 
 	Port           string        `env:"PORT, default=50051"`
 	MaxRecords     uint32        `env:"MAX_RECORDS, default=500"`
 	Timeout        time.Duration `env:"RPC_TIMEOUT, default=5m"`
 	TruncateWindow time.Duration `env:"TRUNCATE_WINDOW, default=1h"`
 
+	// NodeID distinguishes the replicas generating bill IDs and must be unique
+	// among them, between 0 and 1023. It is usually derived from the ordinal of
+	// a StatefulSet pod. It has no default: replicas sharing one would generate
+	// the same IDs.
+	NodeID int64 `env:"NODE_ID, required"`
+
+	// WatchPollInterval is how often new transitions are looked for on behalf
+	// of watch streams, WatchHeartbeatInterval how often idle streams get a
+	// heartbeat, and WatchBufferSize how many updates are queued per stream
+	// before its overflow policy applies.
+	WatchPollInterval      time.Duration `env:"WATCH_POLL_INTERVAL, default=500ms"`
+	WatchHeartbeatInterval time.Duration `env:"WATCH_HEARTBEAT_INTERVAL, default=15s"`
+	WatchBufferSize        int           `env:"WATCH_BUFFER_SIZE, default=64"`
+
+	// WatchGapTimeout is how long a missing transition ID holds back watch
+	// cursors before it is assumed to belong to a rolled back transaction.
+	// Transitions committing later than that after their ID was allocated are
+	// not delivered to live watch streams, only to later resumes.
+	WatchGapTimeout time.Duration `env:"WATCH_GAP_TIMEOUT, default=10s"`
+
+	// LegacyCurrency is the ISO-4217 currency of the float prices sent to the
+	// legacy payment API.
+	LegacyCurrency string `env:"LEGACY_CURRENCY, default=EUR"`
+
+	// Reflection serves gRPC server reflection, which lets tools like
+	// `pobo rpc` discover and call the service without its .proto files. It
+	// exposes the whole API to unauthenticated callers, so it is off unless
+	// enabled, e.g. in development.
+	Reflection bool `env:"GRPC_REFLECTION"`
+
 	// AllowAnyClient, if true, removes authentication requirements on the
 	// federation endpoint. In practice, this is only useful in local testing.
 	AllowAnyClient bool `env:"ALLOW_ANY_CLIENT"`
@@ -34,14 +77,14 @@ type Config struct {
 	TLSKeyFile  string `env:"TLS_KEY_FILE"`
 }
 
-// func (c *Config) DatabaseConfig() *database.Config {
-// 	return &c.Database
-// }
+func (c *Config) DatabaseConfig() *database.Config {
+	return &c.Database
+}
 
 // func (c *Config) SecretManagerConfig() *secrets.Config {
 // 	return &c.SecretManager
 // }
 
-// func (c *Config) ObservabilityExporterConfig() *observability.Config {
-// 	return &c.ObservabilityExporter
-// }
+func (c *Config) ObservabilityExporterConfig() *observability.Config {
+	return &c.ObservabilityExporter
+}
@@ -0,0 +1,300 @@
+// Package database is a database interface to payments.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/paveletto99/microservice-blueprint/internal/payment/model"
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+)
+
+// ErrNotFound is returned when a payment does not exist.
+var ErrNotFound = errors.New("payment not found")
+
+// PaymentDB wraps a database connection and provides functions for
+// interacting with payments.
+type PaymentDB struct {
+	db *database.DB
+}
+
+// New creates a new PaymentDB that wraps a raw database connection.
+func New(db *database.DB) *PaymentDB {
+	return &PaymentDB{
+		db: db,
+	}
+}
+
+// InTx runs f in a transaction. See database.DB.InTx.
+func (db *PaymentDB) InTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	return db.db.InTx(ctx, nil, f)
+}
+
+const paymentColumns = `bill_id, merchant_id, currency, amount_minor, refunded_minor, status, created_at, updated_at`
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// InsertPayment inserts p within tx.
+func (db *PaymentDB) InsertPayment(ctx context.Context, tx *sql.Tx, p *model.Payment) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO payments (`+paymentColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.BillID, p.MerchantID, p.Currency, p.AmountMinor, p.RefundedMinor, string(p.Status),
+		p.CreatedAt.UTC(), p.UpdatedAt.UTC()); err != nil {
+		return fmt.Errorf("inserting payment: %w", err)
+	}
+	return nil
+}
+
+// UpdatePayment writes the status and refunded amount of p within tx.
+func (db *PaymentDB) UpdatePayment(ctx context.Context, tx *sql.Tx, p *model.Payment) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE payments SET status = ?, refunded_minor = ?, updated_at = ?
+		WHERE bill_id = ?`,
+		string(p.Status), p.RefundedMinor, p.UpdatedAt.UTC(), p.BillID); err != nil {
+		return fmt.Errorf("updating payment: %w", err)
+	}
+	return nil
+}
+
+// GetPayment returns the payment with billID, or ErrNotFound.
+func (db *PaymentDB) GetPayment(ctx context.Context, billID int64) (*model.Payment, error) {
+	return getPayment(ctx, db.db.Pool, billID, "")
+}
+
+// LockPayment returns the payment with billID, or ErrNotFound, and locks it
+// for the rest of tx.
+func (db *PaymentDB) LockPayment(ctx context.Context, tx *sql.Tx, billID int64) (*model.Payment, error) {
+	return getPayment(ctx, tx, billID, "FOR UPDATE")
+}
+
+func getPayment(ctx context.Context, q queryer, billID int64, lock string) (*model.Payment, error) {
+	p, err := scanPayment(q.QueryRowContext(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments WHERE bill_id = ? `+lock, billID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("reading payment: %w", err)
+	}
+	return p, nil
+}
+
+// ListFilter selects payments. Zero fields match everything.
+type ListFilter struct {
+	MerchantID    string
+	Statuses      []model.Status
+	Currency      string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// BeforeBillID resumes a listing after the payment with this ID.
+	BeforeBillID int64
+}
+
+// ListPayments returns up to limit payments matching f, newest first.
+func (db *PaymentDB) ListPayments(ctx context.Context, f *ListFilter, limit int) ([]*model.Payment, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if f.MerchantID != "" {
+		where = append(where, "merchant_id = ?")
+		args = append(args, f.MerchantID)
+	}
+	if len(f.Statuses) > 0 {
+		where = append(where, "status IN (?"+strings.Repeat(", ?", len(f.Statuses)-1)+")")
+		for _, s := range f.Statuses {
+			args = append(args, string(s))
+		}
+	}
+	if f.Currency != "" {
+		where = append(where, "currency = ?")
+		args = append(args, f.Currency)
+	}
+	if !f.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.CreatedAfter.UTC())
+	}
+	if !f.CreatedBefore.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.CreatedBefore.UTC())
+	}
+	if f.BeforeBillID > 0 {
+		where = append(where, "bill_id < ?")
+		args = append(args, f.BeforeBillID)
+	}
+
+	query := `SELECT ` + paymentColumns + ` FROM payments`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY bill_id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.db.Pool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []*model.Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("reading payment: %w", err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing payments: %w", err)
+	}
+	return payments, nil
+}
+
+func scanPayment(row interface{ Scan(...any) error }) (*model.Payment, error) {
+	var (
+		p         model.Payment
+		status    string
+		updatedAt sql.NullTime
+	)
+	if err := row.Scan(&p.BillID, &p.MerchantID, &p.Currency, &p.AmountMinor, &p.RefundedMinor,
+		&status, &p.CreatedAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	p.Status = model.Status(status)
+	p.UpdatedAt = p.CreatedAt
+	if updatedAt.Valid {
+		p.UpdatedAt = updatedAt.Time
+	}
+	return &p, nil
+}
+
+// InsertTransition records t within tx and sets its ID.
+func (db *PaymentDB) InsertTransition(ctx context.Context, tx *sql.Tx, t *model.Transition) error {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO payment_transitions
+			(bill_id, from_status, to_status, amount_minor, actor, reason, created_at)
+		VALUES
+			(?, ?, ?, ?, ?, ?, ?)`,
+		t.BillID, string(t.From), string(t.To), t.AmountMinor, t.Actor, t.Reason, t.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("inserting payment transition: %w", err)
+	}
+	if t.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("reading payment transition id: %w", err)
+	}
+	return nil
+}
+
+// ListTransitions returns the transitions of the payment with billID, oldest
+// first.
+func (db *PaymentDB) ListTransitions(ctx context.Context, billID int64) ([]*model.Transition, error) {
+	rows, err := db.db.Pool.QueryContext(ctx, `
+		SELECT id, bill_id, from_status, to_status, amount_minor, actor, reason, created_at
+		FROM payment_transitions
+		WHERE bill_id = ?
+		ORDER BY id`, billID)
+	if err != nil {
+		return nil, fmt.Errorf("listing payment transitions: %w", err)
+	}
+	defer rows.Close()
+
+	var transitions []*model.Transition
+	for rows.Next() {
+		var (
+			t        model.Transition
+			from, to string
+		)
+		if err := rows.Scan(&t.ID, &t.BillID, &from, &to, &t.AmountMinor, &t.Actor, &t.Reason, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("reading payment transition: %w", err)
+		}
+		t.From, t.To = model.Status(from), model.Status(to)
+		transitions = append(transitions, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing payment transitions: %w", err)
+	}
+	return transitions, nil
+}
+
+// TransitionFilter selects transition events. Zero fields match everything.
+type TransitionFilter struct {
+	BillID     int64
+	MerchantID string
+
+	// AfterID and UpToID bound the transition IDs, exclusive and inclusive.
+	// A zero UpToID is unbounded.
+	AfterID int64
+	UpToID  int64
+}
+
+// ListTransitionEvents returns up to limit transitions matching f, in ID
+// order.
+func (db *PaymentDB) ListTransitionEvents(ctx context.Context, f *TransitionFilter, limit int) ([]*model.TransitionEvent, error) {
+	where := []string{"t.id > ?"}
+	args := []any{f.AfterID}
+	if f.UpToID > 0 {
+		where = append(where, "t.id <= ?")
+		args = append(args, f.UpToID)
+	}
+	if f.BillID != 0 {
+		where = append(where, "t.bill_id = ?")
+		args = append(args, f.BillID)
+	}
+	if f.MerchantID != "" {
+		where = append(where, "p.merchant_id = ?")
+		args = append(args, f.MerchantID)
+	}
+	args = append(args, limit)
+
+	rows, err := db.db.Pool.QueryContext(ctx, `
+		SELECT t.id, t.bill_id, t.from_status, t.to_status, t.amount_minor, t.actor, t.reason, t.created_at,
+			p.merchant_id, p.currency
+		FROM payment_transitions t
+		JOIN payments p ON p.bill_id = t.bill_id
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY t.id
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing payment transitions: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.TransitionEvent
+	for rows.Next() {
+		var (
+			e        model.TransitionEvent
+			from, to string
+		)
+		if err := rows.Scan(&e.ID, &e.BillID, &from, &to, &e.AmountMinor, &e.Actor, &e.Reason, &e.CreatedAt,
+			&e.MerchantID, &e.Currency); err != nil {
+			return nil, fmt.Errorf("reading payment transition: %w", err)
+		}
+		e.From, e.To = model.Status(from), model.Status(to)
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing payment transitions: %w", err)
+	}
+	return events, nil
+}
+
+// MaxTransitionID returns the highest transition ID, or zero if there are
+// none.
+func (db *PaymentDB) MaxTransitionID(ctx context.Context) (int64, error) {
+	var id sql.NullInt64
+	if err := db.db.Pool.QueryRowContext(ctx,
+		`SELECT MAX(id) FROM payment_transitions`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("reading last payment transition: %w", err)
+	}
+	return id.Int64, nil
+}
@@ -0,0 +1,55 @@
+package payment
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/paveletto99/microservice-blueprint/internal/payment/model"
+	p "github.com/paveletto99/microservice-blueprint/internal/pb/payment"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+// Compile time assert that this server implements the required grpc interface.
+var _ p.PaymentServer = (*LegacyServer)(nil)
+
+// LegacyServer serves the deprecated payment API from a payment.v1 Server
+// while clients migrate. Float prices are converted to minor units of the
+// configured LEGACY_CURRENCY and must be exact in that currency.
+type LegacyServer struct {
+	p.UnimplementedPaymentServer
+	server *Server
+}
+
+// NewLegacyServer builds the legacy PaymentServer on top of s.
+func NewLegacyServer(s *Server) *LegacyServer {
+	return &LegacyServer{server: s}
+}
+
+// Create implements the legacy PaymentServer Create endpoint.
+func (l *LegacyServer) Create(ctx context.Context, req *p.CreatePaymentRequest) (*p.CreatePaymentResponse, error) {
+	s := l.server
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	amount, err := model.MoneyFromPrice(req.GetPrice(), s.legacyCurrency)
+	if err != nil {
+		return nil, apperrors.New(apperrors.InvalidAmount, "invalid price: %s", err)
+	}
+
+	key, err := idempotencyKey(ctx, req.GetIdempotencyKey())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	unkeyed := proto.Clone(req).(*p.CreatePaymentRequest)
+	unkeyed.IdempotencyKey = ""
+	resp, err := s.createPayment(ctx, legacyCreateScope, key, unkeyed, "", amount)
+	if err != nil {
+		return nil, err
+	}
+	return &p.CreatePaymentResponse{BillId: resp.GetBillId()}, nil
+}
@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	paymentdb "github.com/paveletto99/microservice-blueprint/internal/payment/database"
+	p "github.com/paveletto99/microservice-blueprint/internal/pb/payment"
+)
+
+func TestLegacyCreate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testDatabaseInstance.NewServerEnv(t)
+	config := testConfig(0)
+	config.LegacyCurrency = "JPY"
+	srv, err := NewServer(env, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := NewLegacyServer(srv)
+
+	resp, err := legacy.Create(ctx, &p.CreatePaymentRequest{Price: 1500, IdempotencyKey: "legacy-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := paymentdb.New(env.Database()).GetPayment(ctx, resp.BillId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Currency != "JPY" || got.AmountMinor != 1500 {
+		t.Errorf("unexpected payment %+v", got)
+	}
+
+	replay, err := legacy.Create(ctx, &p.CreatePaymentRequest{Price: 1500, IdempotencyKey: "legacy-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.BillId != resp.BillId {
+		t.Errorf("expected replayed bill ID %d, got %d", resp.BillId, replay.BillId)
+	}
+
+	for _, price := range []float32{0, -5, 0.5} {
+		if _, err := legacy.Create(ctx, &p.CreatePaymentRequest{Price: price}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("price %v: expected InvalidArgument, got %v", price, err)
+		}
+	}
+}
+
+func TestNewServer_invalidLegacyCurrency(t *testing.T) {
+	t.Parallel()
+
+	env := testDatabaseInstance.NewServerEnv(t)
+	config := testConfig(0)
+	config.LegacyCurrency = "euro"
+	if _, err := NewServer(env, config); err == nil {
+		t.Error("expected error for invalid legacy currency")
+	}
+}
@@ -0,0 +1,369 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/paveletto99/microservice-blueprint/internal/payment/database"
+	"github.com/paveletto99/microservice-blueprint/internal/payment/model"
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+	"github.com/paveletto99/microservice-blueprint/pkg/pagetoken"
+	"github.com/paveletto99/microservice-blueprint/pkg/ratelimit"
+)
+
+// Idempotency scope of Refund calls.
+const refundScope = "payment.v1.Refund"
+
+// defaultPageSize is the page size of List when the request sets none.
+const defaultPageSize = 50
+
+// Get implements the PaymentService Get endpoint. It returns the payment with
+// its full transition history.
+func (s *Server) Get(ctx context.Context, req *paymentv1.GetPaymentRequest) (*paymentv1.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	payment, err := s.db.GetPayment(ctx, req.GetBillId())
+	if err != nil {
+		return nil, statusFromError(err, "failed to read payment")
+	}
+	transitions, err := s.db.ListTransitions(ctx, payment.BillID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to read payment transitions", "bill_id", payment.BillID, "error", err)
+		return nil, statusFromError(err, "failed to read payment")
+	}
+
+	resp := paymentToProto(payment)
+	for _, t := range transitions {
+		resp.Transitions = append(resp.Transitions, transitionToProto(t, payment.Currency))
+	}
+	return resp, nil
+}
+
+// List implements the PaymentService List endpoint. Payments are returned
+// newest first; next_page_token resumes the listing and is only valid with the
+// same filters. Expired tokens are reported apart from invalid ones, as the
+// listing has to be restarted from its first page.
+func (s *Server) List(ctx context.Context, req *paymentv1.ListPaymentsRequest) (*paymentv1.ListPaymentsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	filter := &database.ListFilter{
+		MerchantID:    req.GetMerchantId(),
+		Currency:      req.GetCurrencyCode(),
+		CreatedAfter:  timeFromProto(req.GetCreatedAfter()),
+		CreatedBefore: timeFromProto(req.GetCreatedBefore()),
+	}
+	for _, st := range req.GetStatuses() {
+		ms, ok := statusFromProto[st]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid status %v", st)
+		}
+		filter.Statuses = append(filter.Statuses, ms)
+	}
+
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case s.config.MaxRecords > 0 && pageSize > int(s.config.MaxRecords):
+		pageSize = int(s.config.MaxRecords)
+	}
+
+	scope, err := listScope(req)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list payments")
+	}
+	if token := req.GetPageToken(); token != "" {
+		state, err := s.pages.Decode(scope, token)
+		if errors.Is(err, pagetoken.ErrExpiredToken) {
+			return nil, status.Error(codes.InvalidArgument, "page_token expired, restart the listing")
+		}
+		if err != nil || len(state) != 8 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		filter.BeforeBillID = int64(binary.BigEndian.Uint64(state))
+	}
+
+	// Read one more than requested to learn whether there is a next page.
+	payments, err := s.db.ListPayments(ctx, filter, pageSize+1)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list payments", "error", err)
+		return nil, statusFromError(err, "failed to list payments")
+	}
+
+	resp := &paymentv1.ListPaymentsResponse{}
+	if len(payments) > pageSize {
+		payments = payments[:pageSize]
+		resp.NextPageToken = s.pages.Encode(scope,
+			binary.BigEndian.AppendUint64(nil, uint64(payments[len(payments)-1].BillID)))
+	}
+	for _, p := range payments {
+		resp.Payments = append(resp.Payments, paymentToProto(p))
+	}
+	return resp, nil
+}
+
+// Authorize implements the PaymentService Authorize endpoint.
+func (s *Server) Authorize(ctx context.Context, req *paymentv1.AuthorizePaymentRequest) (*paymentv1.Payment, error) {
+	return s.transition(ctx, req.GetBillId(), func(p *model.Payment, at time.Time, actor string) (*model.Transition, error) {
+		return p.Authorize(at, actor)
+	})
+}
+
+// Capture implements the PaymentService Capture endpoint.
+func (s *Server) Capture(ctx context.Context, req *paymentv1.CapturePaymentRequest) (*paymentv1.Payment, error) {
+	return s.transition(ctx, req.GetBillId(), func(p *model.Payment, at time.Time, actor string) (*model.Transition, error) {
+		return p.Capture(at, actor)
+	})
+}
+
+// Cancel implements the PaymentService Cancel endpoint.
+func (s *Server) Cancel(ctx context.Context, req *paymentv1.CancelPaymentRequest) (*paymentv1.Payment, error) {
+	return s.transition(ctx, req.GetBillId(), func(p *model.Payment, at time.Time, actor string) (*model.Transition, error) {
+		return p.Cancel(at, actor, req.GetReason())
+	})
+}
+
+// Refund implements the PaymentService Refund endpoint. Like Create, it
+// accepts an idempotency key so that retried partial refunds are applied once.
+func (s *Server) Refund(ctx context.Context, req *paymentv1.RefundPaymentRequest) (*paymentv1.Payment, error) {
+	var amountMinor int64
+	if m := req.GetAmount(); m != nil {
+		amount, err := moneyFromProto(m)
+		if err != nil {
+			return nil, apperrors.New(apperrors.InvalidAmount, "invalid amount: %s", err)
+		}
+		amountMinor = amount.AmountMinor
+	}
+
+	apply := func(p *model.Payment, at time.Time, actor string) (*model.Transition, error) {
+		if m := req.GetAmount(); m != nil && m.GetCurrencyCode() != p.Currency {
+			return nil, apperrors.New(apperrors.CurrencyMismatch, "refund currency %s does not match payment currency %s",
+				m.GetCurrencyCode(), p.Currency).
+				WithMetadata("currency_code", p.Currency)
+		}
+		return p.Refund(amountMinor, at, actor, req.GetReason())
+	}
+
+	key, err := idempotencyKey(ctx, req.GetIdempotencyKey())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if key == "" {
+		return s.transition(ctx, req.GetBillId(), apply)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	unkeyed := proto.Clone(req).(*paymentv1.RefundPaymentRequest)
+	unkeyed.IdempotencyKey = ""
+	hash, err := requestHash(unkeyed)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to hash request")
+	}
+
+	b, replayed, err := s.keys.Do(ctx, refundScope, key, hash, func(tx *sql.Tx) ([]byte, error) {
+		p, err := s.applyTransition(ctx, tx, req.GetBillId(), apply)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(paymentToProto(p))
+	})
+	if err != nil {
+		return nil, s.transitionError(ctx, req.GetBillId(), err)
+	}
+
+	var resp paymentv1.Payment
+	if err := proto.Unmarshal(b, &resp); err != nil {
+		slog.ErrorContext(ctx, "failed to decode stored response", "error", err)
+		return nil, status.Error(codes.Internal, "failed to update payment")
+	}
+	if !replayed {
+		s.watcher.notify()
+	}
+	return &resp, nil
+}
+
+// transitionFunc applies a state machine transition to p.
+type transitionFunc func(p *model.Payment, at time.Time, actor string) (*model.Transition, error)
+
+// transition applies f to the payment with billID in a transaction.
+func (s *Server) transition(ctx context.Context, billID int64, f transitionFunc) (*paymentv1.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	var payment *model.Payment
+	if err := s.db.InTx(ctx, func(tx *sql.Tx) (err error) {
+		payment, err = s.applyTransition(ctx, tx, billID, f)
+		return err
+	}); err != nil {
+		return nil, s.transitionError(ctx, billID, err)
+	}
+	s.watcher.notify()
+	return paymentToProto(payment), nil
+}
+
+// applyTransition locks the payment with billID, applies f and stores the
+// result, the transition and a payment.updated event in tx.
+func (s *Server) applyTransition(ctx context.Context, tx *sql.Tx, billID int64, f transitionFunc) (*model.Payment, error) {
+	payment, err := s.db.LockPayment(ctx, tx, billID)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := f(payment, time.Now().UTC(), actorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.UpdatePayment(ctx, tx, payment); err != nil {
+		return nil, err
+	}
+	if err := s.db.InsertTransition(ctx, tx, t); err != nil {
+		return nil, err
+	}
+	if err := enqueuePaymentEvent(ctx, tx, TopicPaymentUpdated, payment); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// transitionError converts an error of a transition to a gRPC status, logging
+// unexpected ones.
+func (s *Server) transitionError(ctx context.Context, billID int64, err error) error {
+	code := status.Code(statusFromError(err, ""))
+	if code == codes.Internal || code == codes.Unknown {
+		slog.ErrorContext(ctx, "failed to update payment", "bill_id", billID, "error", err)
+	}
+	return statusFromError(err, "failed to update payment")
+}
+
+// actorFromContext identifies the caller for the audit trail of transitions:
+// the principal of its verified mTLS certificate, else its address. Nothing
+// the caller merely claims, such as metadata, is trusted.
+func actorFromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		if principal := ratelimit.Principal(&info.State); principal != "" {
+			return truncate("principal:"+principal, 255)
+		}
+	}
+	if p.Addr != nil {
+		return "peer:" + p.Addr.String()
+	}
+	return "unknown"
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// listScope binds page tokens to the filters of req, so that a token cannot
+// be replayed with different filters.
+func listScope(req *paymentv1.ListPaymentsRequest) (string, error) {
+	filters := proto.Clone(req).(*paymentv1.ListPaymentsRequest)
+	filters.PageSize = 0
+	filters.PageToken = ""
+
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(filters)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return "payment.v1.List:" + hex.EncodeToString(sum[:]), nil
+}
+
+// newPageTokenCodec builds the page token codec. Without configured keys it
+// falls back to a random key, which only works with a single replica.
+func newPageTokenCodec(config *pagetoken.Config) (*pagetoken.Codec, error) {
+	if len(config.Keys) > 0 {
+		codec, err := pagetoken.NewFromConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PAGE_TOKEN_KEYS: %w", err)
+		}
+		return codec, nil
+	}
+
+	slog.Warn("PAGE_TOKEN_KEYS is not set, page tokens are only valid on this replica")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generating page token key: %w", err)
+	}
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return pagetoken.New(ttl, key)
+}
+
+var statusToProto = map[model.Status]paymentv1.PaymentStatus{
+	model.StatusPending:           paymentv1.PaymentStatus_PAYMENT_STATUS_PENDING,
+	model.StatusAuthorized:        paymentv1.PaymentStatus_PAYMENT_STATUS_AUTHORIZED,
+	model.StatusCaptured:          paymentv1.PaymentStatus_PAYMENT_STATUS_CAPTURED,
+	model.StatusPartiallyRefunded: paymentv1.PaymentStatus_PAYMENT_STATUS_PARTIALLY_REFUNDED,
+	model.StatusRefunded:          paymentv1.PaymentStatus_PAYMENT_STATUS_REFUNDED,
+	model.StatusCancelled:         paymentv1.PaymentStatus_PAYMENT_STATUS_CANCELLED,
+}
+
+var statusFromProto = func() map[paymentv1.PaymentStatus]model.Status {
+	m := make(map[paymentv1.PaymentStatus]model.Status, len(statusToProto))
+	for k, v := range statusToProto {
+		m[v] = k
+	}
+	return m
+}()
+
+func paymentToProto(p *model.Payment) *paymentv1.Payment {
+	return &paymentv1.Payment{
+		BillId:         p.BillID,
+		MerchantId:     p.MerchantID,
+		Amount:         moneyToProto(model.Money{Currency: p.Currency, AmountMinor: p.AmountMinor}),
+		RefundedAmount: moneyToProto(model.Money{Currency: p.Currency, AmountMinor: p.RefundedMinor}),
+		Status:         statusToProto[p.Status],
+		CreateTime:     timestamppb.New(p.CreatedAt),
+		UpdateTime:     timestamppb.New(p.UpdatedAt),
+	}
+}
+
+func transitionToProto(t *model.Transition, currency string) *paymentv1.PaymentTransition {
+	return &paymentv1.PaymentTransition{
+		Id:         t.ID,
+		FromStatus: statusToProto[t.From],
+		ToStatus:   statusToProto[t.To],
+		Amount:     moneyToProto(model.Money{Currency: currency, AmountMinor: t.AmountMinor}),
+		Actor:      t.Actor,
+		Reason:     t.Reason,
+		CreateTime: timestamppb.New(t.CreatedAt),
+	}
+}
+
+func timeFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
@@ -0,0 +1,292 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+	"github.com/paveletto99/microservice-blueprint/pkg/pagetoken"
+)
+
+func TestLifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := peerContext(verifiedAs("alice"))
+	env := testDatabaseInstance.NewServerEnv(t)
+	srv, err := NewServer(env, testConfig(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := srv.Create(ctx, &paymentv1.CreatePaymentRequest{Amount: eur(1000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := created.BillId
+
+	expectStatus := func(t *testing.T, p *paymentv1.Payment, err error, want paymentv1.PaymentStatus) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Status != want {
+			t.Fatalf("expected %v, got %v", want, p.Status)
+		}
+	}
+
+	// Illegal transitions are rejected and leave the payment untouched.
+	if _, err := srv.Capture(ctx, &paymentv1.CapturePaymentRequest{BillId: id}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("capture of pending payment: expected FailedPrecondition, got %v", err)
+	}
+
+	p, err := srv.Authorize(ctx, &paymentv1.AuthorizePaymentRequest{BillId: id})
+	expectStatus(t, p, err, paymentv1.PaymentStatus_PAYMENT_STATUS_AUTHORIZED)
+
+	p, err = srv.Capture(ctx, &paymentv1.CapturePaymentRequest{BillId: id})
+	expectStatus(t, p, err, paymentv1.PaymentStatus_PAYMENT_STATUS_CAPTURED)
+
+	if _, err := srv.Cancel(ctx, &paymentv1.CancelPaymentRequest{BillId: id}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("cancel of captured payment: expected FailedPrecondition, got %v", err)
+	}
+
+	// A keyed partial refund is applied once.
+	refund := &paymentv1.RefundPaymentRequest{BillId: id, Amount: eur(300), Reason: "damaged", IdempotencyKey: "refund-1"}
+	for i := 0; i < 2; i++ {
+		p, err = srv.Refund(ctx, refund)
+		expectStatus(t, p, err, paymentv1.PaymentStatus_PAYMENT_STATUS_PARTIALLY_REFUNDED)
+		if p.RefundedAmount.GetAmountMinor() != 300 {
+			t.Errorf("expected 300 refunded, got %v", p.RefundedAmount)
+		}
+	}
+
+	_, err = srv.Refund(ctx, &paymentv1.RefundPaymentRequest{BillId: id, Amount: eur(701)})
+	if status.Code(err) != codes.FailedPrecondition || !apperrors.HasCode(err, apperrors.IllegalTransition) {
+		t.Errorf("over-refund: expected FailedPrecondition %s, got %v", apperrors.IllegalTransition, err)
+	}
+	_, err = srv.Refund(ctx, &paymentv1.RefundPaymentRequest{
+		BillId: id, Amount: &paymentv1.Money{CurrencyCode: "USD", AmountMinor: 1},
+	})
+	if status.Code(err) != codes.InvalidArgument || !apperrors.HasCode(err, apperrors.CurrencyMismatch) {
+		t.Errorf("refund in another currency: expected InvalidArgument %s, got %v", apperrors.CurrencyMismatch, err)
+	}
+
+	p, err = srv.Refund(ctx, &paymentv1.RefundPaymentRequest{BillId: id})
+	expectStatus(t, p, err, paymentv1.PaymentStatus_PAYMENT_STATUS_REFUNDED)
+
+	got, err := srv.Get(ctx, &paymentv1.GetPaymentRequest{BillId: id})
+	expectStatus(t, got, err, paymentv1.PaymentStatus_PAYMENT_STATUS_REFUNDED)
+	if got.RefundedAmount.GetAmountMinor() != 1000 {
+		t.Errorf("expected everything refunded, got %v", got.RefundedAmount)
+	}
+
+	wantTransitions := []paymentv1.PaymentStatus{
+		paymentv1.PaymentStatus_PAYMENT_STATUS_PENDING,
+		paymentv1.PaymentStatus_PAYMENT_STATUS_AUTHORIZED,
+		paymentv1.PaymentStatus_PAYMENT_STATUS_CAPTURED,
+		paymentv1.PaymentStatus_PAYMENT_STATUS_PARTIALLY_REFUNDED,
+		paymentv1.PaymentStatus_PAYMENT_STATUS_REFUNDED,
+	}
+	if len(got.Transitions) != len(wantTransitions) {
+		t.Fatalf("expected %d transitions, got %v", len(wantTransitions), got.Transitions)
+	}
+	for i, tr := range got.Transitions {
+		if tr.ToStatus != wantTransitions[i] || tr.Actor != "principal:alice" || tr.CreateTime == nil {
+			t.Errorf("transition %d: unexpected %v", i, tr)
+		}
+	}
+	if last := got.Transitions[4]; last.Amount.GetAmountMinor() != 700 {
+		t.Errorf("expected final refund of 700, got %v", last.Amount)
+	}
+
+	_, err = srv.Get(ctx, &paymentv1.GetPaymentRequest{BillId: id + 1})
+	if status.Code(err) != codes.NotFound || !apperrors.HasCode(err, apperrors.PaymentNotFound) {
+		t.Errorf("expected NotFound %s, got %v", apperrors.PaymentNotFound, err)
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testDatabaseInstance.NewServerEnv(t)
+	srv, err := NewServer(env, testConfig(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		merchant := "m1"
+		if i%2 == 1 {
+			merchant = "m2"
+		}
+		resp, err := srv.Create(ctx, &paymentv1.CreatePaymentRequest{Amount: eur(int64(100 + i)), MerchantId: merchant})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, resp.BillId)
+	}
+	if _, err := srv.Cancel(ctx, &paymentv1.CancelPaymentRequest{BillId: ids[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(req *paymentv1.ListPaymentsRequest) []int64 {
+		t.Helper()
+
+		var got []int64
+		for {
+			resp, err := srv.List(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Payments) > int(req.PageSize) {
+				t.Fatalf("page of %d exceeds page size %d", len(resp.Payments), req.PageSize)
+			}
+			for _, p := range resp.Payments {
+				got = append(got, p.BillId)
+			}
+			if resp.NextPageToken == "" {
+				return got
+			}
+			req.PageToken = resp.NextPageToken
+		}
+	}
+
+	cases := []struct {
+		name string
+		req  *paymentv1.ListPaymentsRequest
+		want []int64
+	}{
+		{
+			name: "all",
+			req:  &paymentv1.ListPaymentsRequest{PageSize: 2},
+			want: []int64{ids[4], ids[3], ids[2], ids[1], ids[0]},
+		},
+		{
+			name: "merchant",
+			req:  &paymentv1.ListPaymentsRequest{PageSize: 1, MerchantId: "m1"},
+			want: []int64{ids[4], ids[2], ids[0]},
+		},
+		{
+			name: "status",
+			req: &paymentv1.ListPaymentsRequest{PageSize: 10, Statuses: []paymentv1.PaymentStatus{
+				paymentv1.PaymentStatus_PAYMENT_STATUS_CANCELLED,
+			}},
+			want: []int64{ids[0]},
+		},
+		{
+			name: "currency",
+			req:  &paymentv1.ListPaymentsRequest{PageSize: 10, CurrencyCode: "JPY"},
+			want: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		got := list(tc.req)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+				break
+			}
+		}
+	}
+
+	// A page token is bound to the filters it was issued for.
+	resp, err := srv.List(ctx, &paymentv1.ListPaymentsRequest{PageSize: 1, MerchantId: "m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.List(ctx, &paymentv1.ListPaymentsRequest{
+		PageSize: 1, MerchantId: "m2", PageToken: resp.NextPageToken,
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a token of other filters, got %v", err)
+	}
+}
+
+func TestList_pageToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	req := &paymentv1.ListPaymentsRequest{PageSize: 1, MerchantId: "m1"}
+	scope, err := listScope(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens are checked before the database is queried.
+	expired, err := pagetoken.New(time.Nanosecond, bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{pages: expired, config: &Config{Timeout: time.Minute}}
+
+	cases := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"expired", expired.Encode(scope, make([]byte, 8)), "page_token expired, restart the listing"},
+		{"invalid", "not a token", "invalid page_token"},
+	}
+	for _, tc := range cases {
+		req := proto.Clone(req).(*paymentv1.ListPaymentsRequest)
+		req.PageToken = tc.token
+		_, err := srv.List(ctx, req)
+		if st, _ := status.FromError(err); st.Code() != codes.InvalidArgument || st.Message() != tc.want {
+			t.Errorf("%s: expected InvalidArgument %q, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+// peerContext returns the context of a call from 192.0.2.1 with the TLS state.
+func peerContext(state *tls.ConnectionState) context.Context {
+	p := &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4321}}
+	if state != nil {
+		p.AuthInfo = credentials.TLSInfo{State: *state}
+	}
+	return peer.NewContext(context.Background(), p)
+}
+
+func verifiedAs(cn string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestActorFromContext(t *testing.T) {
+	t.Parallel()
+
+	claimed := metadata.Pairs("x-actor", "mallory")
+	cases := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"verified", peerContext(verifiedAs("alice")), "principal:alice"},
+		{"unverified", peerContext(&tls.ConnectionState{PeerCertificates: verifiedAs("alice").PeerCertificates}), "peer:192.0.2.1:4321"},
+		{"claimed", metadata.NewIncomingContext(peerContext(nil), claimed), "peer:192.0.2.1:4321"},
+		{"no_peer", metadata.NewIncomingContext(context.Background(), claimed), "unknown"},
+	}
+	for _, tc := range cases {
+		if got := actorFromContext(tc.ctx); got != tc.want {
+			t.Errorf("%s: expected actor %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
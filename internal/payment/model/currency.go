@@ -0,0 +1,142 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency describes an ISO-4217 currency accepted for payments.
+type Currency struct {
+	// Code is the three-letter ISO-4217 code.
+	Code string
+
+	// Exponent is the number of decimal places of the minor unit, e.g. 2 for
+	// EUR (cents), 0 for JPY and 3 for KWD.
+	Exponent int
+
+	// MaxAmountMinor is the largest accepted payment, in minor units.
+	MaxAmountMinor int64
+}
+
+// currencies are the currencies payments may be made in. Limits are the
+// equivalent of roughly one million euros.
+var currencies = map[string]Currency{
+	"AUD": {Code: "AUD", Exponent: 2, MaxAmountMinor: 150_000_000},
+	"BHD": {Code: "BHD", Exponent: 3, MaxAmountMinor: 400_000_000},
+	"CAD": {Code: "CAD", Exponent: 2, MaxAmountMinor: 150_000_000},
+	"CHF": {Code: "CHF", Exponent: 2, MaxAmountMinor: 100_000_000},
+	"CZK": {Code: "CZK", Exponent: 2, MaxAmountMinor: 2_500_000_000},
+	"DKK": {Code: "DKK", Exponent: 2, MaxAmountMinor: 750_000_000},
+	"EUR": {Code: "EUR", Exponent: 2, MaxAmountMinor: 100_000_000},
+	"GBP": {Code: "GBP", Exponent: 2, MaxAmountMinor: 100_000_000},
+	"JPY": {Code: "JPY", Exponent: 0, MaxAmountMinor: 150_000_000},
+	"KWD": {Code: "KWD", Exponent: 3, MaxAmountMinor: 350_000_000},
+	"NOK": {Code: "NOK", Exponent: 2, MaxAmountMinor: 1_200_000_000},
+	"PLN": {Code: "PLN", Exponent: 2, MaxAmountMinor: 450_000_000},
+	"SEK": {Code: "SEK", Exponent: 2, MaxAmountMinor: 1_200_000_000},
+	"USD": {Code: "USD", Exponent: 2, MaxAmountMinor: 110_000_000},
+}
+
+// LookupCurrency returns the currency with the given ISO-4217 code. Codes are
+// case sensitive and must be upper case.
+func LookupCurrency(code string) (Currency, error) {
+	c, ok := currencies[code]
+	if !ok {
+		return Currency{}, fmt.Errorf("unsupported currency %q", code)
+	}
+	return c, nil
+}
+
+// Money is an amount of a currency in minor units.
+type Money struct {
+	Currency    string
+	AmountMinor int64
+}
+
+// NewMoney validates an amount against the limits of its currency.
+func NewMoney(currency string, amountMinor int64) (Money, error) {
+	c, err := LookupCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	if amountMinor <= 0 {
+		return Money{}, fmt.Errorf("amount must be positive")
+	}
+	if amountMinor > c.MaxAmountMinor {
+		return Money{}, fmt.Errorf("amount exceeds the %s limit of %s", c.Code, c.Format(c.MaxAmountMinor))
+	}
+	return Money{Currency: c.Code, AmountMinor: amountMinor}, nil
+}
+
+// String formats m in major units, e.g. "9.99 EUR".
+func (m Money) String() string {
+	c, err := LookupCurrency(m.Currency)
+	if err != nil {
+		return fmt.Sprintf("%d %s (minor units)", m.AmountMinor, m.Currency)
+	}
+	return c.Format(m.AmountMinor) + " " + c.Code
+}
+
+// Format formats amountMinor in major units of c, e.g. 999 as "9.99" for EUR.
+func (c Currency) Format(amountMinor int64) string {
+	s := strconv.FormatInt(amountMinor, 10)
+	if c.Exponent == 0 {
+		return s
+	}
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= c.Exponent {
+		s = strings.Repeat("0", c.Exponent-len(s)+1) + s
+	}
+	return sign + s[:len(s)-c.Exponent] + "." + s[len(s)-c.Exponent:]
+}
+
+// MoneyFromPrice converts a price in major units, as sent by legacy clients,
+// into Money of currency c. The price must be finite and have no more decimal
+// places than the currency's exponent once rounded to the precision of a
+// float32.
+func MoneyFromPrice(price float32, c Currency) (Money, error) {
+	if math.IsNaN(float64(price)) || math.IsInf(float64(price), 0) {
+		return Money{}, fmt.Errorf("price must be a finite number")
+	}
+
+	// Format with the fewest digits that round-trip through a float32, so that
+	// 9.99 is "9.99" rather than 9.98999977111816.
+	s := strconv.FormatFloat(float64(price), 'f', -1, 32)
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > c.Exponent {
+		return Money{}, fmt.Errorf("price %s has more than %d decimal places", s, c.Exponent)
+	}
+	frac += strings.Repeat("0", c.Exponent-len(frac))
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("price %s is out of range", s)
+	}
+	return NewMoney(c.Code, amount)
+}
+
+// ParseMoney parses an amount in major units of currency c, e.g. "9.99" as 999
+// minor units of EUR. The amount must have no more decimal places than the
+// currency's exponent.
+func ParseMoney(amount string, c Currency) (Money, error) {
+	whole, frac, hasFrac := strings.Cut(amount, ".")
+	if whole == "" || strings.HasPrefix(whole, "+") || (hasFrac && frac == "") {
+		return Money{}, fmt.Errorf("amount %q is not a decimal number", amount)
+	}
+	if len(frac) > c.Exponent {
+		return Money{}, fmt.Errorf("amount %s has more than %d decimal places", amount, c.Exponent)
+	}
+	frac += strings.Repeat("0", c.Exponent-len(frac))
+
+	minor, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q is not a decimal number", amount)
+	}
+	return NewMoney(c.Code, minor)
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewMoney(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		currency string
+		amount   int64
+		wantErr  bool
+	}{
+		{name: "eur", currency: "EUR", amount: 999},
+		{name: "jpy", currency: "JPY", amount: 1500},
+		{name: "at_limit", currency: "EUR", amount: 100_000_000},
+		{name: "over_limit", currency: "EUR", amount: 100_000_001, wantErr: true},
+		{name: "zero", currency: "EUR", amount: 0, wantErr: true},
+		{name: "negative", currency: "USD", amount: -1, wantErr: true},
+		{name: "lower_case", currency: "eur", amount: 1, wantErr: true},
+		{name: "unknown", currency: "XXX", amount: 1, wantErr: true},
+		{name: "empty", currency: "", amount: 1, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := NewMoney(tc.currency, tc.amount)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if err == nil && (got.Currency != tc.currency || got.AmountMinor != tc.amount) {
+				t.Errorf("unexpected money %+v", got)
+			}
+		})
+	}
+}
+
+func TestMoneyFromPrice(t *testing.T) {
+	t.Parallel()
+
+	eur, _ := LookupCurrency("EUR")
+	jpy, _ := LookupCurrency("JPY")
+	kwd, _ := LookupCurrency("KWD")
+
+	cases := []struct {
+		name     string
+		price    float32
+		currency Currency
+		want     int64
+		wantErr  bool
+	}{
+		{name: "whole", price: 12, currency: eur, want: 1200},
+		{name: "cents", price: 9.99, currency: eur, want: 999},
+		{name: "one decimal", price: 0.5, currency: eur, want: 50},
+		{name: "zero", price: 0, currency: eur, wantErr: true},
+		{name: "negative", price: -1, currency: eur, wantErr: true},
+		{name: "sub cent", price: 0.001, currency: eur, wantErr: true},
+		{name: "nan", price: float32(math.NaN()), currency: eur, wantErr: true},
+		{name: "inf", price: float32(math.Inf(1)), currency: eur, wantErr: true},
+		{name: "over limit", price: 2_000_000, currency: eur, wantErr: true},
+		{name: "yen", price: 1500, currency: jpy, want: 1500},
+		{name: "fractional yen", price: 0.5, currency: jpy, wantErr: true},
+		{name: "fils", price: 1.125, currency: kwd, want: 1125},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := MoneyFromPrice(tc.price, tc.currency)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if got.AmountMinor != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, got.AmountMinor)
+			}
+		})
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	t.Parallel()
+
+	eur, _ := LookupCurrency("EUR")
+	jpy, _ := LookupCurrency("JPY")
+
+	cases := []struct {
+		name     string
+		amount   string
+		currency Currency
+		want     int64
+		wantErr  bool
+	}{
+		{name: "whole", amount: "12", currency: eur, want: 1200},
+		{name: "cents", amount: "9.99", currency: eur, want: 999},
+		{name: "tenths", amount: "0.5", currency: eur, want: 50},
+		{name: "no_minor_unit", amount: "1500", currency: jpy, want: 1500},
+		{name: "too_precise", amount: "9.999", currency: eur, wantErr: true},
+		{name: "fraction_of_yen", amount: "1.5", currency: jpy, wantErr: true},
+		{name: "negative", amount: "-1", currency: eur, wantErr: true},
+		{name: "signed", amount: "+1", currency: eur, wantErr: true},
+		{name: "trailing_dot", amount: "1.", currency: eur, wantErr: true},
+		{name: "not_a_number", amount: "1e3", currency: eur, wantErr: true},
+		{name: "empty", amount: "", currency: eur, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseMoney(tc.amount, tc.currency)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if err == nil && got.AmountMinor != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, got.AmountMinor)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		money Money
+		want  string
+	}{
+		{money: Money{Currency: "EUR", AmountMinor: 999}, want: "9.99 EUR"},
+		{money: Money{Currency: "EUR", AmountMinor: 5}, want: "0.05 EUR"},
+		{money: Money{Currency: "JPY", AmountMinor: 1500}, want: "1500 JPY"},
+		{money: Money{Currency: "KWD", AmountMinor: 1125}, want: "1.125 KWD"},
+	}
+
+	for _, tc := range cases {
+		if got := tc.money.String(); got != tc.want {
+			t.Errorf("%+v: expected %q, got %q", tc.money, tc.want, got)
+		}
+	}
+}
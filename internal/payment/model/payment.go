@@ -0,0 +1,152 @@
+// Package model defines the payment records stored by the payment service.
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Status is the lifecycle state of a payment.
+type Status string
+
+const (
+	StatusPending           Status = "PENDING"
+	StatusAuthorized        Status = "AUTHORIZED"
+	StatusCaptured          Status = "CAPTURED"
+	StatusPartiallyRefunded Status = "PARTIALLY_REFUNDED"
+	StatusRefunded          Status = "REFUNDED"
+	StatusCancelled         Status = "CANCELLED"
+)
+
+// transitions lists the statuses each status may move to.
+var transitions = map[Status][]Status{
+	StatusPending:           {StatusAuthorized, StatusCancelled},
+	StatusAuthorized:        {StatusCaptured, StatusCancelled},
+	StatusCaptured:          {StatusPartiallyRefunded, StatusRefunded},
+	StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+}
+
+// CanTransition reports whether a payment may move from one status to another.
+func CanTransition(from, to Status) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrIllegalTransition is returned when an operation is not allowed in the
+// current status of a payment.
+var ErrIllegalTransition = errors.New("illegal payment status transition")
+
+// Payment is a persisted payment.
+type Payment struct {
+	// BillID is the unique, time-ordered ID of the payment.
+	BillID int64
+
+	// MerchantID optionally identifies the merchant being paid.
+	MerchantID string
+
+	// Currency is the ISO-4217 code of the currency and AmountMinor the amount
+	// in its minor units, e.g. cents.
+	Currency    string
+	AmountMinor int64
+
+	// RefundedMinor is the amount refunded so far, in minor units.
+	RefundedMinor int64
+
+	Status    Status
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Transition is a recorded change of the status of a payment.
+type Transition struct {
+	ID     int64
+	BillID int64
+	From   Status
+	To     Status
+
+	// AmountMinor is the amount moved by the transition: the payment amount,
+	// or the refunded amount for refunds.
+	AmountMinor int64
+
+	// Actor identifies who requested the transition.
+	Actor     string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// TransitionEvent is a transition together with the payment attributes that
+// watchers filter and render it by.
+type TransitionEvent struct {
+	Transition
+	MerchantID string
+	Currency   string
+}
+
+// Authorize moves a pending payment to AUTHORIZED.
+func (p *Payment) Authorize(at time.Time, actor string) (*Transition, error) {
+	return p.transition(StatusAuthorized, p.AmountMinor, at, actor, "")
+}
+
+// Capture moves an authorized payment to CAPTURED.
+func (p *Payment) Capture(at time.Time, actor string) (*Transition, error) {
+	return p.transition(StatusCaptured, p.AmountMinor, at, actor, "")
+}
+
+// Cancel moves a payment that has not been captured to CANCELLED.
+func (p *Payment) Cancel(at time.Time, actor, reason string) (*Transition, error) {
+	return p.transition(StatusCancelled, p.AmountMinor, at, actor, reason)
+}
+
+// Refund refunds amountMinor of a captured payment, or everything not yet
+// refunded if amountMinor is zero. The payment becomes REFUNDED once fully
+// refunded and PARTIALLY_REFUNDED otherwise.
+func (p *Payment) Refund(amountMinor int64, at time.Time, actor, reason string) (*Transition, error) {
+	remaining := p.AmountMinor - p.RefundedMinor
+	if amountMinor == 0 {
+		amountMinor = remaining
+	}
+	if amountMinor < 0 {
+		return nil, fmt.Errorf("refund amount must be positive")
+	}
+
+	to := StatusPartiallyRefunded
+	if amountMinor == remaining {
+		to = StatusRefunded
+	}
+	if CanTransition(p.Status, to) && amountMinor > remaining {
+		return nil, fmt.Errorf("%w: refund of %d exceeds the %d not yet refunded",
+			ErrIllegalTransition, amountMinor, remaining)
+	}
+
+	t, err := p.transition(to, amountMinor, at, actor, reason)
+	if err != nil {
+		return nil, err
+	}
+	p.RefundedMinor += amountMinor
+	return t, nil
+}
+
+// transition moves p to status to, returning the record of the change.
+func (p *Payment) transition(to Status, amountMinor int64, at time.Time, actor, reason string) (*Transition, error) {
+	if !CanTransition(p.Status, to) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrIllegalTransition, p.Status, to)
+	}
+
+	t := &Transition{
+		BillID:      p.BillID,
+		From:        p.Status,
+		To:          to,
+		AmountMinor: amountMinor,
+		Actor:       actor,
+		Reason:      reason,
+		CreatedAt:   at,
+	}
+	p.Status = to
+	p.UpdatedAt = at
+	return t, nil
+}
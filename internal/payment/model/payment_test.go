@@ -0,0 +1,78 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPaymentLifecycle(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	type step func(p *Payment) (*Transition, error)
+	var (
+		authorize = func(p *Payment) (*Transition, error) { return p.Authorize(at, "test") }
+		capture   = func(p *Payment) (*Transition, error) { return p.Capture(at, "test") }
+		cancel    = func(p *Payment) (*Transition, error) { return p.Cancel(at, "test", "") }
+		refund    = func(amount int64) step {
+			return func(p *Payment) (*Transition, error) { return p.Refund(amount, at, "test", "") }
+		}
+	)
+
+	cases := []struct {
+		name         string
+		steps        []step
+		want         Status
+		wantRefunded int64
+		wantErr      error
+	}{
+		{name: "authorize", steps: []step{authorize}, want: StatusAuthorized},
+		{name: "capture", steps: []step{authorize, capture}, want: StatusCaptured},
+		{name: "cancel_pending", steps: []step{cancel}, want: StatusCancelled},
+		{name: "cancel_authorized", steps: []step{authorize, cancel}, want: StatusCancelled},
+		{name: "full_refund", steps: []step{authorize, capture, refund(0)}, want: StatusRefunded, wantRefunded: 1000},
+		{name: "partial_refund", steps: []step{authorize, capture, refund(300)}, want: StatusPartiallyRefunded, wantRefunded: 300},
+		{name: "partial_refunds_to_full", steps: []step{authorize, capture, refund(300), refund(700)}, want: StatusRefunded, wantRefunded: 1000},
+		{name: "refund_rest", steps: []step{authorize, capture, refund(300), refund(0)}, want: StatusRefunded, wantRefunded: 1000},
+
+		{name: "capture_pending", steps: []step{capture}, wantErr: ErrIllegalTransition},
+		{name: "cancel_captured", steps: []step{authorize, capture, cancel}, wantErr: ErrIllegalTransition},
+		{name: "refund_authorized", steps: []step{authorize, refund(0)}, wantErr: ErrIllegalTransition},
+		{name: "refund_too_much", steps: []step{authorize, capture, refund(1001)}, wantErr: ErrIllegalTransition},
+		{name: "refund_refunded", steps: []step{authorize, capture, refund(0), refund(1)}, wantErr: ErrIllegalTransition},
+		{name: "authorize_twice", steps: []step{authorize, authorize}, wantErr: ErrIllegalTransition},
+		{name: "authorize_cancelled", steps: []step{cancel, authorize}, wantErr: ErrIllegalTransition},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := &Payment{BillID: 1, Currency: "EUR", AmountMinor: 1000, Status: StatusPending}
+			var err error
+			for _, s := range tc.steps {
+				var tr *Transition
+				from := p.Status
+				if tr, err = s(p); err != nil {
+					break
+				}
+				if tr.From != from || tr.To != p.Status || tr.Actor != "test" || !tr.CreatedAt.Equal(at) {
+					t.Errorf("unexpected transition %+v", tr)
+				}
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			if p.Status != tc.want || p.RefundedMinor != tc.wantRefunded {
+				t.Errorf("expected %s with %d refunded, got %s with %d", tc.want, tc.wantRefunded, p.Status, p.RefundedMinor)
+			}
+		})
+	}
+}
@@ -2,50 +2,341 @@ package payment
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"strconv"
+	"time"
 
-	p "github.com/paveletto99/microservice-blueprint/internal/pb/payment"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	paymentdb "github.com/paveletto99/microservice-blueprint/internal/payment/database"
+	"github.com/paveletto99/microservice-blueprint/internal/payment/model"
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
 	"github.com/paveletto99/microservice-blueprint/internal/serverenv"
+	"github.com/paveletto99/microservice-blueprint/pkg/database/idempotency"
+	"github.com/paveletto99/microservice-blueprint/pkg/database/outbox"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+	"github.com/paveletto99/microservice-blueprint/pkg/pagetoken"
+	"github.com/paveletto99/microservice-blueprint/pkg/snowflake"
+)
+
+// Outbox topics of payment events. Events carry a snapshot of the payment.
+const (
+	TopicPaymentCreated = "payment.created"
+	TopicPaymentUpdated = "payment.updated"
+)
+
+// IdempotencyKeyHeader is the metadata entry that may carry the idempotency key
+// of a Create call instead of the request field.
+const IdempotencyKeyHeader = "idempotency-key"
+
+// Scopes of the idempotency keys of Create calls. The legacy scope predates
+// payment.v1 and keeps keys used before the migration valid.
+const (
+	createScope       = "payment.v1.Create"
+	legacyCreateScope = "payment.Create"
 )
 
 // Compile time assert that this server implements the required grpc interface.
-var _ p.PaymentServer = (*Server)(nil)
+var _ paymentv1.PaymentServiceServer = (*Server)(nil)
 
-// NewServer builds a new FederationServer.
-func NewServer(env *serverenv.ServerEnv, config *Config) p.PaymentServer {
-	return &Server{
-		env: env,
-		// db:        database.New(env.Database()),
-		// publishdb: publishdb.New(env.Database()),
-		config: config,
+// NewServer builds a new payment.v1 PaymentServiceServer. The server expects
+// requests to have passed the interceptors of internal/validation, which
+// enforce the field constraints declared in payment.proto. Expired idempotency
+// keys are deleted in the background until env is closed.
+func NewServer(env *serverenv.ServerEnv, config *Config) (*Server, error) {
+	if env.Database() == nil {
+		return nil, fmt.Errorf("missing database in server environment")
+	}
+
+	ids, err := snowflake.New(config.NodeID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NODE_ID: %w", err)
+	}
+
+	keys, err := idempotency.New(env.Database(), &config.Idempotency)
+	if err != nil {
+		return nil, fmt.Errorf("idempotency.New: %w", err)
+	}
+
+	legacyCurrency, err := model.LookupCurrency(config.LegacyCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LEGACY_CURRENCY: %w", err)
+	}
+
+	pages, err := newPageTokenCodec(&config.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.WatchPollInterval <= 0 || config.WatchHeartbeatInterval <= 0 || config.WatchGapTimeout <= 0 {
+		return nil, fmt.Errorf("WATCH_POLL_INTERVAL, WATCH_HEARTBEAT_INTERVAL and WATCH_GAP_TIMEOUT must be positive")
 	}
+
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	cleanupDone := make(chan struct{})
+	go func() {
+		defer close(cleanupDone)
+		if err := keys.Run(cleanupCtx); err != nil {
+			slog.Error("idempotency cleanup stopped", "error", err)
+		}
+	}()
+	env.RegisterCloser(func(context.Context) error {
+		stopCleanup()
+		<-cleanupDone
+		return nil
+	})
+
+	db := paymentdb.New(env.Database())
+	return &Server{
+		env:            env,
+		db:             db,
+		watcher:        newWatcher(db, config.WatchPollInterval, config.WatchGapTimeout),
+		keys:           keys,
+		ids:            ids,
+		pages:          pages,
+		legacyCurrency: legacyCurrency,
+		config:         config,
+	}, nil
 }
 
 type Server struct {
-	p.UnimplementedPaymentServer
-	env *serverenv.ServerEnv
-	// db        *database.FederationOutDB
-	// publishdb *publishdb.PublishDB
-	config *Config
+	paymentv1.UnimplementedPaymentServiceServer
+	env            *serverenv.ServerEnv
+	db             *paymentdb.PaymentDB
+	watcher        *watcher
+	keys           *idempotency.Store
+	ids            *snowflake.Generator
+	pages          *pagetoken.Codec
+	legacyCurrency model.Currency
+	config         *Config
+}
+
+// Close ends the watch streams of the server. It should be called when the
+// server shuts down, as watch streams otherwise never end by themselves.
+func (s *Server) Close() {
+	s.watcher.close()
+}
+
+// paymentEvent is the outbox payload describing a payment.
+type paymentEvent struct {
+	BillID        int64     `json:"bill_id"`
+	MerchantID    string    `json:"merchant_id,omitempty"`
+	Currency      string    `json:"currency"`
+	AmountMinor   int64     `json:"amount_minor"`
+	RefundedMinor int64     `json:"refunded_minor"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
-// Create implements the PaymentServer Create endpoint.
-func (s Server) Create(ctx context.Context, req *p.CreatePaymentRequest) (*p.CreatePaymentResponse, error) {
+// enqueuePaymentEvent writes an outbox event on topic describing p.
+func enqueuePaymentEvent(ctx context.Context, tx *sql.Tx, topic string, p *model.Payment) error {
+	payload, err := json.Marshal(&paymentEvent{
+		BillID:        p.BillID,
+		MerchantID:    p.MerchantID,
+		Currency:      p.Currency,
+		AmountMinor:   p.AmountMinor,
+		RefundedMinor: p.RefundedMinor,
+		Status:        string(p.Status),
+		CreatedAt:     p.CreatedAt,
+		UpdatedAt:     p.UpdatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding payment event: %w", err)
+	}
+	return outbox.Enqueue(ctx, tx, &outbox.Event{
+		Topic:   topic,
+		Key:     strconv.FormatInt(p.BillID, 10),
+		Payload: payload,
+	})
+}
+
+// Create implements the PaymentService Create endpoint. It persists the
+// payment and a payment.created outbox event in one transaction and returns
+// the new bill ID.
+//
+// If the request carries an idempotency key, in the request or in the
+// idempotency-key metadata, retries with the same key and payload return the
+// original response, and reusing the key for a different payload fails with
+// FailedPrecondition.
+func (s *Server) Create(ctx context.Context, req *paymentv1.CreatePaymentRequest) (*paymentv1.CreatePaymentResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
 	defer cancel()
-	// response, err := s.fetch(ctx, req, s.publishdb.IterateExposures, publishmodel.TruncateWindow(time.Now(), s.config.TruncateWindow)) // Don't fetch the current window, which isn't complete yet.
-	// if err != nil {
-	// 	stats.Record(ctx, mFetchFailed.M(1))
-	// logger.Error("failed to fetch", "error")
-	// 	return nil, errors.New("internal error")
-	// }
 
-	// simulate error
-	if req.Price == 0.0 {
-		slog.Error("failed to fetch", "error")
+	amount, err := moneyFromProto(req.GetAmount())
+	if err != nil {
+		return nil, apperrors.New(apperrors.InvalidAmount, "invalid amount: %s", err)
+	}
+
+	key, err := idempotencyKey(ctx, req.GetIdempotencyKey())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	unkeyed := proto.Clone(req).(*paymentv1.CreatePaymentRequest)
+	unkeyed.IdempotencyKey = ""
+	return s.createPayment(ctx, createScope, key, unkeyed, req.GetMerchantId(), amount)
+}
+
+// createPayment creates a payment of amount. If key is not empty, the payment
+// is created at most once per scope and key, and req is the payload that later
+// calls with the key must match.
+func (s *Server) createPayment(ctx context.Context, scope, key string, req proto.Message, merchantID string, amount model.Money) (*paymentv1.CreatePaymentResponse, error) {
+	if key == "" {
+		var resp *paymentv1.CreatePaymentResponse
+		if err := s.db.InTx(ctx, func(tx *sql.Tx) (err error) {
+			resp, err = s.create(ctx, tx, merchantID, amount)
+			return err
+		}); err != nil {
+			slog.ErrorContext(ctx, "failed to create payment", "error", err)
+			return nil, statusFromError(err, "failed to create payment")
+		}
+		s.watcher.notify()
+		return resp, nil
+	}
+
+	hash, err := requestHash(req)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to hash request")
+	}
+
+	b, replayed, err := s.keys.Do(ctx, scope, key, hash, func(tx *sql.Tx) ([]byte, error) {
+		resp, err := s.create(ctx, tx, merchantID, amount)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(resp)
+	})
+	if err != nil {
+		if !errors.Is(err, idempotency.ErrKeyReused) {
+			slog.ErrorContext(ctx, "failed to create payment", "error", err)
+		}
+		return nil, statusFromError(err, "failed to create payment")
+	}
+
+	var resp paymentv1.CreatePaymentResponse
+	if err := proto.Unmarshal(b, &resp); err != nil {
+		slog.ErrorContext(ctx, "failed to decode stored response", "error", err)
+		return nil, status.Error(codes.Internal, "failed to create payment")
+	}
+	if replayed {
+		slog.InfoContext(ctx, "replayed payment creation", "bill_id", resp.BillId)
+	} else {
+		s.watcher.notify()
+	}
+	return &resp, nil
+}
+
+// create inserts a new pending payment of amount, its first transition and
+// its payment.created event, in tx.
+func (s *Server) create(ctx context.Context, tx *sql.Tx, merchantID string, amount model.Money) (*paymentv1.CreatePaymentResponse, error) {
+	billID, err := s.ids.Next()
+	if err != nil {
+		return nil, fmt.Errorf("generating bill id: %w", err)
+	}
+
+	now := time.Now().UTC()
+	payment := &model.Payment{
+		BillID:      billID,
+		MerchantID:  merchantID,
+		Currency:    amount.Currency,
+		AmountMinor: amount.AmountMinor,
+		Status:      model.StatusPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.db.InsertPayment(ctx, tx, payment); err != nil {
+		return nil, err
+	}
+	if err := s.db.InsertTransition(ctx, tx, &model.Transition{
+		BillID:      billID,
+		To:          model.StatusPending,
+		AmountMinor: amount.AmountMinor,
+		Actor:       actorFromContext(ctx),
+		CreatedAt:   now,
+	}); err != nil {
+		return nil, err
+	}
+	if err := enqueuePaymentEvent(ctx, tx, TopicPaymentCreated, payment); err != nil {
+		return nil, err
+	}
+	return &paymentv1.CreatePaymentResponse{
+		BillId: payment.BillID,
+		Amount: moneyToProto(amount),
+	}, nil
+}
+
+// moneyFromProto validates m against the exponent and limits of its currency.
+func moneyFromProto(m *paymentv1.Money) (model.Money, error) {
+	if m == nil {
+		return model.Money{}, fmt.Errorf("amount is required")
+	}
+	return model.NewMoney(m.GetCurrencyCode(), m.GetAmountMinor())
+}
+
+func moneyToProto(m model.Money) *paymentv1.Money {
+	return &paymentv1.Money{
+		CurrencyCode: m.Currency,
+		AmountMinor:  m.AmountMinor,
+	}
+}
+
+// idempotencyKey returns the idempotency key of a request, taken from its
+// field or from the idempotency-key metadata. It is an error to send two
+// different keys.
+func idempotencyKey(ctx context.Context, key string) (string, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get(IdempotencyKeyHeader) {
+			if key != "" && v != key {
+				return "", fmt.Errorf("conflicting idempotency keys")
+			}
+			key = v
+		}
+	}
+	if len(key) > idempotency.MaxKeyLength {
+		return "", fmt.Errorf("idempotency key longer than %d bytes", idempotency.MaxKeyLength)
+	}
+	return key, nil
+}
+
+// requestHash fingerprints req. The idempotency key must have been cleared.
+func requestHash(req proto.Message) ([]byte, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return nil, err
 	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
 
-	response := p.CreatePaymentResponse{BillId: 0}
+// statusFromError maps a storage or state machine error to an error of the
+// catalogue or a gRPC status, keeping internal details out of the message
+// returned to clients.
+func statusFromError(err error, msg string) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
 
-	return &response, nil
+	switch {
+	case errors.Is(err, paymentdb.ErrNotFound):
+		return apperrors.New(apperrors.PaymentNotFound, "payment not found")
+	case errors.Is(err, model.ErrIllegalTransition):
+		return apperrors.New(apperrors.IllegalTransition, "%s", err)
+	case errors.Is(err, idempotency.ErrKeyReused):
+		return apperrors.New(apperrors.IdempotencyKeyReused, "idempotency key was already used with a different request")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, msg)
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, msg)
+	default:
+		return apperrors.New(apperrors.Internal, "%s", msg)
+	}
 }
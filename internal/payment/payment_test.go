@@ -0,0 +1,263 @@
+package payment
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	paymentdb "github.com/paveletto99/microservice-blueprint/internal/payment/database"
+	"github.com/paveletto99/microservice-blueprint/internal/payment/model"
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
+	"github.com/paveletto99/microservice-blueprint/pkg/database/dbtest"
+	"github.com/paveletto99/microservice-blueprint/pkg/database/idempotency"
+	"github.com/paveletto99/microservice-blueprint/pkg/snowflake"
+)
+
+var testDatabaseInstance *dbtest.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = dbtest.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+func testConfig(node int64) *Config {
+	return &Config{
+		Timeout:        time.Minute,
+		NodeID:         node,
+		LegacyCurrency: "EUR",
+		Idempotency:    idempotency.Config{Retention: time.Hour, CleanupInterval: time.Hour},
+
+		WatchPollInterval:      10 * time.Millisecond,
+		WatchHeartbeatInterval: time.Hour,
+		WatchBufferSize:        64,
+		WatchGapTimeout:        time.Minute,
+	}
+}
+
+func eur(amountMinor int64) *paymentv1.Money {
+	return &paymentv1.Money{CurrencyCode: "EUR", AmountMinor: amountMinor}
+}
+
+func TestCreate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testDatabaseInstance.NewServerEnv(t)
+	srv, err := NewServer(env, testConfig(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := srv.Create(ctx, &paymentv1.CreatePaymentRequest{Amount: eur(999)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := srv.Create(ctx, &paymentv1.CreatePaymentRequest{
+		Amount: &paymentv1.Money{CurrencyCode: "JPY", AmountMinor: 1500},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.BillId <= 0 || second.BillId <= first.BillId {
+		t.Errorf("expected increasing positive bill IDs, got %d then %d", first.BillId, second.BillId)
+	}
+	if node := snowflake.Node(first.BillId); node != 3 {
+		t.Errorf("expected bill ID from node 3, got %d", node)
+	}
+
+	got, err := paymentdb.New(env.Database()).GetPayment(ctx, first.BillId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Currency != "EUR" || got.AmountMinor != 999 || got.Status != model.StatusPending {
+		t.Errorf("unexpected payment %+v", got)
+	}
+	if got, want := second.GetAmount(), (&paymentv1.Money{CurrencyCode: "JPY", AmountMinor: 1500}); !proto.Equal(got, want) {
+		t.Errorf("expected amount %v, got %v", want, got)
+	}
+
+	var events int
+	if err := env.Database().Pool.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM outbox WHERE topic = ?`, TopicPaymentCreated).Scan(&events); err != nil {
+		t.Fatal(err)
+	}
+	if events != 2 {
+		t.Errorf("expected 2 outbox events, got %d", events)
+	}
+}
+
+func TestCreate_invalidAmount(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testDatabaseInstance.NewServerEnv(t)
+	srv, err := NewServer(env, testConfig(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		amount *paymentv1.Money
+	}{
+		{name: "missing", amount: nil},
+		{name: "zero", amount: eur(0)},
+		{name: "negative", amount: eur(-5)},
+		{name: "over_limit", amount: eur(100_000_001)},
+		{name: "no_currency", amount: &paymentv1.Money{AmountMinor: 100}},
+		{name: "unknown_currency", amount: &paymentv1.Money{CurrencyCode: "XTS", AmountMinor: 100}},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := srv.Create(ctx, &paymentv1.CreatePaymentRequest{Amount: tc.amount})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("expected InvalidArgument, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCreate_validation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testDatabaseInstance.NewServerEnv(t)
+	srv, err := NewServer(env, testConfig(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := startTestServer(t, srv)
+
+	_, err = client.Create(ctx, &paymentv1.CreatePaymentRequest{
+		Amount:     &paymentv1.Money{CurrencyCode: "eur", AmountMinor: 100},
+		MerchantId: strings.Repeat("m", 65),
+	})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+
+	var fields []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if want := []string{"amount.currency_code", "merchant_id"}; !slices.Equal(fields, want) {
+		t.Errorf("expected violations of %v, got %v", want, fields)
+	}
+}
+
+func TestCreate_idempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testDatabaseInstance.NewServerEnv(t)
+	srv, err := NewServer(env, testConfig(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := srv.Create(ctx, &paymentv1.CreatePaymentRequest{Amount: eur(1250), IdempotencyKey: "order-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same key in metadata replays the original response.
+	mdCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(IdempotencyKeyHeader, "order-1"))
+	replay, err := srv.Create(mdCtx, &paymentv1.CreatePaymentRequest{Amount: eur(1250)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.BillId != first.BillId {
+		t.Errorf("expected replayed bill ID %d, got %d", first.BillId, replay.BillId)
+	}
+
+	var payments int
+	if err := env.Database().Pool.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM payments`).Scan(&payments); err != nil {
+		t.Fatal(err)
+	}
+	if payments != 1 {
+		t.Errorf("expected 1 payment, got %d", payments)
+	}
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		req  *paymentv1.CreatePaymentRequest
+		code codes.Code
+	}{
+		{
+			name: "different_payload",
+			ctx:  ctx,
+			req:  &paymentv1.CreatePaymentRequest{Amount: eur(1300), IdempotencyKey: "order-1"},
+			code: codes.FailedPrecondition,
+		},
+		{
+			name: "conflicting_keys",
+			ctx:  mdCtx,
+			req:  &paymentv1.CreatePaymentRequest{Amount: eur(1250), IdempotencyKey: "order-2"},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "key_too_long",
+			ctx:  ctx,
+			req:  &paymentv1.CreatePaymentRequest{Amount: eur(100), IdempotencyKey: string(make([]byte, 256))},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := srv.Create(tc.ctx, tc.req); status.Code(err) != tc.code {
+				t.Errorf("expected %v, got %v", tc.code, err)
+			}
+		})
+	}
+}
+
+func TestConfig_nodeIDRequired(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var config Config
+	if err := envconfig.ProcessWith(ctx, &envconfig.Config{
+		Target:   &config,
+		Lookuper: envconfig.MapLookuper(map[string]string{}),
+	}); err == nil || !strings.Contains(err.Error(), "NODE_ID") {
+		t.Errorf("expected an error about the missing NODE_ID, got %v", err)
+	}
+
+	if err := envconfig.ProcessWith(ctx, &envconfig.Config{
+		Target:   &config,
+		Lookuper: envconfig.MapLookuper(map[string]string{"NODE_ID": "7"}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if config.NodeID != 7 {
+		t.Errorf("expected node 7, got %d", config.NodeID)
+	}
+}
@@ -0,0 +1,577 @@
+package payment
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	paymentdb "github.com/paveletto99/microservice-blueprint/internal/payment/database"
+	"github.com/paveletto99/microservice-blueprint/internal/payment/model"
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+// watchBatchSize is the number of transitions read per query by the watcher
+// and by catch-up after a cursor.
+const watchBatchSize = 500
+
+var errWatcherClosed = errors.New("payment watcher is closed")
+
+// errShuttingDown is returned to watchers when the server stops. They may
+// reconnect to another replica right away, resuming from their last cursor.
+func errShuttingDown() error {
+	return apperrors.New(apperrors.ServiceUnavailable, "server is shutting down").WithRetryAfter(time.Second)
+}
+
+// WatchPayment implements the PaymentService WatchPayment endpoint.
+func (s *Server) WatchPayment(req *paymentv1.WatchPaymentRequest, stream paymentv1.PaymentService_WatchPaymentServer) error {
+	ctx := stream.Context()
+
+	billID := req.GetBillId()
+	if _, err := s.db.GetPayment(ctx, billID); err != nil {
+		return statusFromError(err, "failed to read payment")
+	}
+
+	return s.watch(stream, &paymentdb.TransitionFilter{BillID: billID}, req.GetCursor(), true, req.GetOverflowPolicy(),
+		func(e *model.TransitionEvent) bool { return e.BillID == billID })
+}
+
+// WatchPayments implements the PaymentService WatchPayments endpoint.
+func (s *Server) WatchPayments(req *paymentv1.WatchPaymentsRequest, stream paymentv1.PaymentService_WatchPaymentsServer) error {
+	merchantID := req.GetMerchantId()
+	return s.watch(stream, &paymentdb.TransitionFilter{MerchantID: merchantID}, req.GetCursor(), false, req.GetOverflowPolicy(),
+		func(e *model.TransitionEvent) bool { return e.MerchantID == merchantID })
+}
+
+// watchStream is the stream of both watch endpoints.
+type watchStream interface {
+	Context() context.Context
+	Send(*paymentv1.WatchEvent) error
+}
+
+// watch streams the transitions selected by filter and match. If cursor is
+// set, or replayAll is true, transitions since the cursor are read from the
+// database before live ones are sent.
+func (s *Server) watch(stream watchStream, filter *paymentdb.TransitionFilter, cursor string, replayAll bool,
+	policy paymentv1.OverflowPolicy, match func(*model.TransitionEvent) bool,
+) error {
+	ctx := stream.Context()
+
+	var after int64
+	if cursor != "" {
+		var err error
+		if after, err = decodeCursor(cursor); err != nil {
+			return status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+	}
+
+	sub, pos, err := s.watcher.subscribe(ctx, match, s.config.WatchBufferSize, policy)
+	if err != nil {
+		if errors.Is(err, errWatcherClosed) {
+			return errShuttingDown()
+		}
+		slog.ErrorContext(ctx, "failed to start watch", "error", err)
+		return statusFromError(err, "failed to start watch")
+	}
+	defer s.watcher.unsubscribe(sub)
+
+	if cursor != "" || replayAll {
+		if err := s.catchUp(stream, filter, after, pos); err != nil {
+			return err
+		}
+	}
+
+	heartbeat := time.NewTicker(s.config.WatchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+
+		case <-sub.ready:
+			items, dropped, closed := sub.take()
+			for _, item := range items {
+				if err := stream.Send(watchEventToProto(item.event, item.cursor, dropped)); err != nil {
+					return err
+				}
+				dropped = 0
+			}
+			if dropped > 0 {
+				// Everything queued was dropped; report it on a heartbeat.
+				if err := stream.Send(&paymentv1.WatchEvent{Heartbeat: true, Dropped: dropped}); err != nil {
+					return err
+				}
+			}
+			if closed {
+				return errShuttingDown()
+			}
+
+		case <-heartbeat.C:
+			event := &paymentv1.WatchEvent{Heartbeat: true}
+			if c, ok := s.watcher.idleCursor(sub); ok {
+				event.Cursor = encodeCursor(c)
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// catchUp sends the transitions after the cursor that the subscription will
+// not deliver, i.e. those the watcher had already seen when it was created.
+func (s *Server) catchUp(stream watchStream, filter *paymentdb.TransitionFilter, after int64, pos *watchPosition) error {
+	ctx := stream.Context()
+
+	f := *filter
+	f.AfterID = after
+	f.UpToID = pos.upTo()
+	if f.UpToID <= f.AfterID {
+		return nil
+	}
+
+	for {
+		events, err := s.db.ListTransitionEvents(ctx, &f, watchBatchSize)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to read payment transitions", "error", err)
+			return statusFromError(err, "failed to read payment transitions")
+		}
+		for _, e := range events {
+			if !pos.covers(e.ID) {
+				continue
+			}
+			if err := stream.Send(watchEventToProto(e, min(e.ID, pos.watermark), 0)); err != nil {
+				return err
+			}
+		}
+		if len(events) < watchBatchSize {
+			return nil
+		}
+		f.AfterID = events[len(events)-1].ID
+	}
+}
+
+func watchEventToProto(e *model.TransitionEvent, cursor, dropped int64) *paymentv1.WatchEvent {
+	t := transitionToProto(&e.Transition, e.Currency)
+	return &paymentv1.WatchEvent{
+		Cursor:     encodeCursor(cursor),
+		BillId:     e.BillID,
+		MerchantId: e.MerchantID,
+		Transition: t,
+		Dropped:    dropped,
+	}
+}
+
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString(binary.BigEndian.AppendUint64(nil, uint64(id)))
+}
+
+func decodeCursor(s string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) != 8 {
+		return 0, fmt.Errorf("malformed cursor")
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+// watcher polls the transitions table and fans new transitions out to
+// subscriptions. Polling the database, rather than relying on in-process
+// notifications, makes transitions committed by other replicas visible too.
+//
+// Transition IDs are allocated before commit, so they can become visible out
+// of order. The watcher therefore delivers every transition as soon as it is
+// seen, and separately tracks a watermark below which every transition has
+// been delivered. Cursors never exceed the watermark, so resuming from one
+// never skips a transition, at the cost of occasional repeats.
+//
+// New transitions are read after the highest one seen, so that a gap under
+// the watermark never holds back the transitions above it. The gaps between
+// the watermark and the highest transition are read again on each poll, for
+// the transactions that commit late. Rolled back transactions leave gaps that
+// never fill, so each gap is skipped once it is older than gapTimeout.
+type watcher struct {
+	db       transitionSource
+	interval time.Duration
+
+	// gapTimeout is how long a missing ID holds back the watermark before it
+	// is assumed to belong to a rolled back transaction.
+	gapTimeout time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	started   bool
+	closed    bool
+	watermark int64
+	highest   int64
+	seen      map[int64]struct{}
+	gaps      []watchGap
+	subs      map[*subscription]struct{}
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// watchGap is a range of IDs that were missing when a higher one was first
+// seen, at since. IDs of the range seen later are in watcher.seen.
+type watchGap struct {
+	from, to int64
+	since    time.Time
+}
+
+// transitionSource is the part of the payment database read by the watcher.
+type transitionSource interface {
+	MaxTransitionID(ctx context.Context) (int64, error)
+	ListTransitionEvents(ctx context.Context, f *paymentdb.TransitionFilter, limit int) ([]*model.TransitionEvent, error)
+}
+
+func newWatcher(db transitionSource, interval, gapTimeout time.Duration) *watcher {
+	return &watcher{
+		db:         db,
+		interval:   interval,
+		gapTimeout: gapTimeout,
+		now:        time.Now,
+		seen:       make(map[int64]struct{}),
+		subs:       make(map[*subscription]struct{}),
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// watchPosition is the state of the watcher when a subscription was created.
+// Transitions it covers are not delivered to the subscription.
+type watchPosition struct {
+	watermark int64
+	seen      map[int64]struct{}
+}
+
+// covers reports whether the transition with id was seen before the
+// subscription was created.
+func (p *watchPosition) covers(id int64) bool {
+	if id <= p.watermark {
+		return true
+	}
+	_, ok := p.seen[id]
+	return ok
+}
+
+// upTo returns the highest transition ID covered.
+func (p *watchPosition) upTo() int64 {
+	up := p.watermark
+	for id := range p.seen {
+		up = max(up, id)
+	}
+	return up
+}
+
+// subscribe registers a subscription for transitions matching match. The
+// watcher starts polling with the first subscription.
+func (w *watcher) subscribe(ctx context.Context, match func(*model.TransitionEvent) bool, size int, policy paymentv1.OverflowPolicy) (*subscription, *watchPosition, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil, nil, errWatcherClosed
+	}
+	if !w.started {
+		last, err := w.db.MaxTransitionID(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		w.watermark, w.highest = last, last
+		w.started = true
+		go w.run()
+	}
+
+	sub := &subscription{
+		match:  match,
+		size:   max(size, 1),
+		policy: policy,
+		ready:  make(chan struct{}, 1),
+	}
+	w.subs[sub] = struct{}{}
+
+	pos := &watchPosition{watermark: w.watermark, seen: make(map[int64]struct{}, len(w.seen))}
+	for id := range w.seen {
+		pos.seen[id] = struct{}{}
+	}
+	return sub, pos, nil
+}
+
+func (w *watcher) unsubscribe(sub *subscription) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.subs, sub)
+}
+
+// idleCursor returns the watermark if sub has nothing queued, in which case
+// it has been sent everything up to the watermark.
+func (w *watcher) idleCursor(sub *subscription) (int64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return w.watermark, len(sub.queue) == 0
+}
+
+// notify makes the watcher poll without waiting for the next tick, e.g. after
+// a transition was committed by this replica.
+func (w *watcher) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close stops polling and closes every subscription.
+func (w *watcher) close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	for sub := range w.subs {
+		sub.close()
+	}
+	started := w.started
+	close(w.done)
+	w.mu.Unlock()
+
+	if started {
+		<-w.stopped
+	}
+}
+
+func (w *watcher) run() {
+	defer close(w.stopped)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-w.done
+		cancel()
+	}()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+
+		if err := w.pollAll(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "payment watcher poll failed", "error", err)
+		}
+	}
+}
+
+// pollAll polls while full batches of new transitions come back.
+func (w *watcher) pollAll(ctx context.Context) error {
+	for {
+		added, full, err := w.poll(ctx)
+		if err != nil {
+			return err
+		}
+		if !full || added == 0 {
+			return nil
+		}
+	}
+}
+
+// poll reads the transitions that committed late under the highest one seen,
+// and a batch of those above it, and delivers the new ones. It returns how
+// many transitions were new, and whether the batch above was full.
+func (w *watcher) poll(ctx context.Context) (int, bool, error) {
+	w.mu.Lock()
+	watermark, highest := w.watermark, w.highest
+	w.mu.Unlock()
+
+	var events []*model.TransitionEvent
+	for after := watermark; after < highest; {
+		late, err := w.db.ListTransitionEvents(ctx, &paymentdb.TransitionFilter{AfterID: after, UpToID: highest}, watchBatchSize)
+		if err != nil {
+			return 0, false, err
+		}
+		events = append(events, late...)
+		if len(late) < watchBatchSize {
+			break
+		}
+		after = late[len(late)-1].ID
+	}
+
+	newer, err := w.db.ListTransitionEvents(ctx, &paymentdb.TransitionFilter{AfterID: highest}, watchBatchSize)
+	if err != nil {
+		return 0, false, err
+	}
+	events = append(events, newer...)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	added := 0
+	for _, e := range events {
+		if !w.see(e.ID) {
+			continue
+		}
+		added++
+
+		item := &watchItem{event: e, cursor: min(e.ID, w.watermark)}
+		for sub := range w.subs {
+			sub.push(item)
+		}
+	}
+
+	// Gaps may have expired since the last transition was seen.
+	w.advance()
+	return added, len(newer) == watchBatchSize, nil
+}
+
+// see records the transition id, and the gap under it if it is above the
+// highest one seen so far. It reports whether the transition is new.
+func (w *watcher) see(id int64) bool {
+	if _, ok := w.seen[id]; ok || id <= w.watermark {
+		return false
+	}
+	if id > w.highest+1 {
+		w.gaps = append(w.gaps, watchGap{from: w.highest + 1, to: id - 1, since: w.now()})
+	}
+	w.highest = max(w.highest, id)
+	w.seen[id] = struct{}{}
+	w.advance()
+	return true
+}
+
+// advance moves the watermark over consecutive seen transitions, and over the
+// gaps older than gapTimeout. Such a gap is a transaction that has not
+// committed yet, or never will. Gaps are recorded in the order they appear, so
+// every expired gap is skipped at once.
+func (w *watcher) advance() {
+	now := w.now()
+	for {
+		for len(w.gaps) > 0 && w.gaps[0].to <= w.watermark {
+			w.gaps = w.gaps[1:]
+		}
+
+		next := w.watermark + 1
+		if _, ok := w.seen[next]; ok {
+			delete(w.seen, next)
+			w.watermark = next
+			continue
+		}
+
+		if len(w.gaps) == 0 || w.gaps[0].from > next || now.Sub(w.gaps[0].since) <= w.gapTimeout {
+			return
+		}
+		to := w.gaps[0].to
+		for id := range w.seen {
+			if id <= to {
+				delete(w.seen, id)
+			}
+		}
+		w.watermark = to
+	}
+}
+
+// watchItem is a transition queued for a subscription, with the cursor that
+// resumes after it.
+type watchItem struct {
+	event  *model.TransitionEvent
+	cursor int64
+}
+
+// subscription is the queue of transitions of one watch stream. It never
+// blocks the watcher: when the queue is full, the overflow policy decides
+// which updates are lost.
+type subscription struct {
+	match  func(*model.TransitionEvent) bool
+	size   int
+	policy paymentv1.OverflowPolicy
+
+	mu      sync.Mutex
+	queue   []*watchItem
+	dropped int64
+	closed  bool
+
+	// ready is signalled when the queue or closed changes.
+	ready chan struct{}
+}
+
+func (s *subscription) push(item *watchItem) {
+	if !s.match(item.event) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	switch {
+	case len(s.queue) < s.size:
+		s.queue = append(s.queue, item)
+
+	case s.policy != paymentv1.OverflowPolicy_OVERFLOW_POLICY_DROP && s.coalesce(item):
+		s.dropped++
+
+	default:
+		s.dropped++
+	}
+	s.signal()
+}
+
+// coalesce replaces the queued update of the same payment, if any, with item.
+// The replacement moves to the back of the queue to keep cursors in order.
+func (s *subscription) coalesce(item *watchItem) bool {
+	for i, queued := range s.queue {
+		if queued.event.BillID == item.event.BillID {
+			copy(s.queue[i:], s.queue[i+1:])
+			s.queue[len(s.queue)-1] = item
+			return true
+		}
+	}
+	return false
+}
+
+// take empties the queue. It returns the queued items, how many were lost
+// since the last call, and whether the subscription was closed.
+func (s *subscription) take() ([]*watchItem, int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, dropped := s.queue, s.dropped
+	s.queue, s.dropped = nil, 0
+	return items, dropped, s.closed
+}
+
+func (s *subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.signal()
+}
+
+func (s *subscription) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
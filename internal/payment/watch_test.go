@@ -0,0 +1,446 @@
+package payment
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	paymentdb "github.com/paveletto99/microservice-blueprint/internal/payment/database"
+	"github.com/paveletto99/microservice-blueprint/internal/payment/model"
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
+	"github.com/paveletto99/microservice-blueprint/internal/validation"
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+func TestSubscription_overflow(t *testing.T) {
+	t.Parallel()
+
+	item := func(id, billID int64) *watchItem {
+		return &watchItem{
+			event:  &model.TransitionEvent{Transition: model.Transition{ID: id, BillID: billID}},
+			cursor: id,
+		}
+	}
+
+	cases := []struct {
+		name        string
+		policy      paymentv1.OverflowPolicy
+		wantIDs     []int64
+		wantDropped int64
+	}{
+		{
+			name:        "coalesce",
+			policy:      paymentv1.OverflowPolicy_OVERFLOW_POLICY_UNSPECIFIED,
+			wantIDs:     []int64{2, 4},
+			wantDropped: 2,
+		},
+		{
+			name:        "drop",
+			policy:      paymentv1.OverflowPolicy_OVERFLOW_POLICY_DROP,
+			wantIDs:     []int64{1, 2},
+			wantDropped: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sub := &subscription{
+				match:  func(*model.TransitionEvent) bool { return true },
+				size:   2,
+				policy: tc.policy,
+				ready:  make(chan struct{}, 1),
+			}
+			// Bill 10 changes twice while the queue is full.
+			sub.push(item(1, 10))
+			sub.push(item(2, 20))
+			sub.push(item(3, 10))
+			sub.push(item(4, 10))
+
+			items, dropped, closed := sub.take()
+			if closed {
+				t.Error("unexpected closed subscription")
+			}
+			var ids []int64
+			for _, it := range items {
+				ids = append(ids, it.event.ID)
+			}
+			if len(ids) != len(tc.wantIDs) {
+				t.Fatalf("expected %v, got %v", tc.wantIDs, ids)
+			}
+			for i := range ids {
+				if ids[i] != tc.wantIDs[i] {
+					t.Fatalf("expected %v, got %v", tc.wantIDs, ids)
+				}
+			}
+			if dropped != tc.wantDropped {
+				t.Errorf("expected %d dropped, got %d", tc.wantDropped, dropped)
+			}
+		})
+	}
+}
+
+func TestWatcher_gaps(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	w := newWatcher(nil, time.Second, time.Minute)
+	w.now = func() time.Time { return now }
+	w.watermark, w.highest = 10, 10
+
+	see := func(ids ...int64) {
+		for _, id := range ids {
+			w.see(id)
+		}
+	}
+
+	see(11, 13)
+	if w.watermark != 11 {
+		t.Fatalf("expected watermark 11, got %d", w.watermark)
+	}
+
+	// The late transaction commits: the watermark catches up.
+	see(12)
+	if w.watermark != 13 || len(w.seen) != 0 {
+		t.Fatalf("expected watermark 13 and nothing pending, got %d and %v", w.watermark, w.seen)
+	}
+
+	// Transition 14 never commits. The gap holds the watermark back until it
+	// times out.
+	see(15, 16)
+	now = now.Add(30 * time.Second)
+	w.advance()
+	if w.watermark != 13 {
+		t.Fatalf("expected watermark 13 while the gap is young, got %d", w.watermark)
+	}
+	now = now.Add(time.Minute)
+	w.advance()
+	if w.watermark != 16 || len(w.seen) != 0 || len(w.gaps) != 0 {
+		t.Fatalf("expected watermark 16 after the gap timed out, got %d and %v", w.watermark, w.seen)
+	}
+}
+
+// fakeTransitions is a transitionSource of the transitions committed so far.
+type fakeTransitions struct {
+	mu      sync.Mutex
+	ids     []int64
+	queries int
+}
+
+func (f *fakeTransitions) commit(ids ...int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ids = append(f.ids, ids...)
+	sort.Slice(f.ids, func(i, j int) bool { return f.ids[i] < f.ids[j] })
+}
+
+func (f *fakeTransitions) MaxTransitionID(context.Context) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.ids) == 0 {
+		return 0, nil
+	}
+	return f.ids[len(f.ids)-1], nil
+}
+
+func (f *fakeTransitions) ListTransitionEvents(_ context.Context, filter *paymentdb.TransitionFilter, limit int) ([]*model.TransitionEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queries++
+	var events []*model.TransitionEvent
+	for _, id := range f.ids {
+		if id <= filter.AfterID || (filter.UpToID > 0 && id > filter.UpToID) {
+			continue
+		}
+		if len(events) == limit {
+			break
+		}
+		events = append(events, &model.TransitionEvent{Transition: model.Transition{ID: id, BillID: id}})
+	}
+	return events, nil
+}
+
+func TestWatcher_gapBelowFullBatches(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db := &fakeTransitions{}
+	w := newWatcher(db, time.Second, time.Hour)
+	w.watermark, w.highest = 10, 10
+
+	sub := &subscription{
+		match: func(*model.TransitionEvent) bool { return true },
+		size:  4 * watchBatchSize,
+		ready: make(chan struct{}, 1),
+	}
+	w.subs[sub] = struct{}{}
+	delivered := func() []int64 {
+		items, _, _ := sub.take()
+		ids := make([]int64, 0, len(items))
+		for _, item := range items {
+			ids = append(ids, item.event.ID)
+		}
+		return ids
+	}
+
+	// Transition 11 has not committed yet, while more than a batch of later
+	// ones have.
+	for id := int64(12); id <= 12+2*watchBatchSize; id++ {
+		db.commit(id)
+	}
+	if err := w.pollAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := delivered(); len(got) != 2*watchBatchSize+1 || got[0] != 12 || got[len(got)-1] != 12+2*watchBatchSize {
+		t.Fatalf("expected transitions 12 to %d, got %d of them", 12+2*watchBatchSize, len(got))
+	}
+	if w.watermark != 10 {
+		t.Errorf("expected the gap to hold the watermark at 10, got %d", w.watermark)
+	}
+	// Reading from the watermark would return the same batch forever.
+	if db.queries > 10 {
+		t.Errorf("expected a few queries, got %d", db.queries)
+	}
+
+	// Polls read transitions committed above the gap right away.
+	db.commit(13 + 2*watchBatchSize)
+	if err := w.pollAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := delivered(); len(got) != 1 || got[0] != 13+2*watchBatchSize {
+		t.Errorf("expected the new transition, got %v", got)
+	}
+
+	// The late transaction commits: it is delivered and the watermark catches
+	// up.
+	db.commit(11)
+	if err := w.pollAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := delivered(); len(got) != 1 || got[0] != 11 {
+		t.Errorf("expected the late transition, got %v", got)
+	}
+	if w.watermark != 13+2*watchBatchSize || len(w.seen) != 0 {
+		t.Errorf("expected watermark %d and nothing pending, got %d and %d pending", 13+2*watchBatchSize, w.watermark, len(w.seen))
+	}
+}
+
+func TestWatcher_overlappingGaps(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	db := &fakeTransitions{}
+	w := newWatcher(db, time.Second, 10*time.Second)
+	w.now = func() time.Time { return now }
+	w.watermark, w.highest = 10, 10
+
+	poll := func(wantWatermark int64) {
+		t.Helper()
+
+		if err := w.pollAll(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if w.watermark != wantWatermark {
+			t.Errorf("at %s: expected watermark %d, got %d", now.Format(time.TimeOnly), wantWatermark, w.watermark)
+		}
+	}
+
+	// Transitions 11 and 13 are rolled back, 6s apart: their gaps are pending
+	// together, and each expires 10s after it appeared.
+	db.commit(12)
+	poll(10)
+	now = now.Add(6 * time.Second)
+	db.commit(14)
+	poll(10)
+	now = now.Add(5 * time.Second)
+	poll(12)
+	now = now.Add(5 * time.Second)
+	poll(12)
+	now = now.Add(time.Second)
+	poll(14)
+
+	// Gaps that expired together are skipped in one poll.
+	db.commit(16, 18, 20)
+	poll(14)
+	now = now.Add(time.Minute)
+	poll(20)
+	if len(w.seen) != 0 || len(w.gaps) != 0 {
+		t.Errorf("expected nothing pending, got %v and %v", w.seen, w.gaps)
+	}
+}
+
+// startTestServer serves srv over a local gRPC connection.
+func startTestServer(t *testing.T, srv *Server) paymentv1.PaymentServiceClient {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(validation.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(validation.StreamServerInterceptor()),
+	)
+	paymentv1.RegisterPaymentServiceServer(grpcServer, srv)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return paymentv1.NewPaymentServiceClient(conn)
+}
+
+// recvTransition returns the next transition of stream, skipping heartbeats
+// and transitions already seen.
+func recvTransition(t *testing.T, stream grpc.ServerStreamingClient[paymentv1.WatchEvent], seen map[int64]bool) *paymentv1.WatchEvent {
+	t.Helper()
+
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Heartbeat || seen[event.Transition.GetId()] {
+			continue
+		}
+		seen[event.Transition.GetId()] = true
+		return event
+	}
+}
+
+func TestWatchPayment(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testDatabaseInstance.NewServerEnv(t)
+	srv, err := NewServer(env, testConfig(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	client := startTestServer(t, srv)
+
+	created, err := srv.Create(ctx, &paymentv1.CreatePaymentRequest{Amount: eur(500), MerchantId: "m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := created.BillId
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	stream, err := client.WatchPayment(watchCtx, &paymentv1.WatchPaymentRequest{BillId: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int64]bool)
+
+	// Without a cursor, the history comes first.
+	if e := recvTransition(t, stream, seen); e.Transition.ToStatus != paymentv1.PaymentStatus_PAYMENT_STATUS_PENDING {
+		t.Fatalf("expected PENDING first, got %v", e)
+	}
+
+	if _, err := srv.Authorize(ctx, &paymentv1.AuthorizePaymentRequest{BillId: id}); err != nil {
+		t.Fatal(err)
+	}
+	e := recvTransition(t, stream, seen)
+	if e.Transition.ToStatus != paymentv1.PaymentStatus_PAYMENT_STATUS_AUTHORIZED || e.BillId != id || e.MerchantId != "m1" {
+		t.Fatalf("expected AUTHORIZED, got %v", e)
+	}
+	cursor := e.Cursor
+	cancel()
+
+	// Transitions while disconnected are sent after resuming.
+	if _, err := srv.Capture(ctx, &paymentv1.CapturePaymentRequest{BillId: id}); err != nil {
+		t.Fatal(err)
+	}
+	stream, err = client.WatchPayment(ctx, &paymentv1.WatchPaymentRequest{BillId: id, Cursor: cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := recvTransition(t, stream, seen); e.Transition.ToStatus != paymentv1.PaymentStatus_PAYMENT_STATUS_CAPTURED {
+		t.Fatalf("expected CAPTURED after resuming, got %v", e)
+	}
+
+	// Closing the server ends the stream, telling clients to retry.
+	srv.Close()
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if status.Code(err) != codes.Unavailable {
+				t.Errorf("expected Unavailable, got %v", err)
+			}
+			if e, ok := apperrors.FromError(err); !ok || e.RetryAfter <= 0 {
+				t.Errorf("expected a retry delay, got %v", err)
+			}
+			break
+		}
+	}
+
+	if _, err := client.WatchPayment(ctx, &paymentv1.WatchPaymentRequest{BillId: id}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchPayments(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testDatabaseInstance.NewServerEnv(t)
+	config := testConfig(0)
+	config.WatchHeartbeatInterval = 20 * time.Millisecond
+	srv, err := NewServer(env, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	client := startTestServer(t, srv)
+
+	stream, err := client.WatchPayments(ctx, &paymentv1.WatchPaymentsRequest{MerchantId: "m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Idle streams get heartbeats.
+	if e, err := stream.Recv(); err != nil || !e.Heartbeat {
+		t.Fatalf("expected a heartbeat, got %v, %v", e, err)
+	}
+
+	other, err := srv.Create(ctx, &paymentv1.CreatePaymentRequest{Amount: eur(100), MerchantId: "m2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mine, err := srv.Create(ctx, &paymentv1.CreatePaymentRequest{Amount: eur(100), MerchantId: "m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := recvTransition(t, stream, make(map[int64]bool))
+	if e.BillId != mine.BillId {
+		t.Errorf("expected a transition of %d, not of %d, got %v", mine.BillId, other.BillId, e)
+	}
+
+	badStream, err := client.WatchPayments(ctx, &paymentv1.WatchPaymentsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := badStream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument without merchant, got %v", err)
+	}
+}
@@ -4,7 +4,7 @@
 // - protoc             v3.21.12
 // source: internal/pb/payment/payment.proto
 
-package v1
+package payment
 
 import (
 	context "context"
@@ -22,6 +22,8 @@ const _ = grpc.SupportPackageIsVersion7
 // PaymentClient is the client API for Payment service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Deprecated: Do not use.
 type PaymentClient interface {
 	Create(ctx context.Context, in *CreatePaymentRequest, opts ...grpc.CallOption) (*CreatePaymentResponse, error)
 }
@@ -30,6 +32,7 @@ type paymentClient struct {
 	cc grpc.ClientConnInterface
 }
 
+// Deprecated: Do not use.
 func NewPaymentClient(cc grpc.ClientConnInterface) PaymentClient {
 	return &paymentClient{cc}
 }
@@ -46,6 +49,8 @@ func (c *paymentClient) Create(ctx context.Context, in *CreatePaymentRequest, op
 // PaymentServer is the server API for Payment service.
 // All implementations must embed UnimplementedPaymentServer
 // for forward compatibility
+//
+// Deprecated: Do not use.
 type PaymentServer interface {
 	Create(context.Context, *CreatePaymentRequest) (*CreatePaymentResponse, error)
 	mustEmbedUnimplementedPaymentServer()
@@ -67,6 +72,7 @@ type UnsafePaymentServer interface {
 	mustEmbedUnimplementedPaymentServer()
 }
 
+// Deprecated: Do not use.
 func RegisterPaymentServer(s grpc.ServiceRegistrar, srv PaymentServer) {
 	s.RegisterService(&Payment_ServiceDesc, srv)
 }
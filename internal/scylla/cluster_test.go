@@ -1,23 +1,79 @@
 package scylla
 
 import (
+	"context"
+	"errors"
+	"os"
 	"testing"
 
 	"github.com/gocql/gocql"
+	"github.com/sethvargo/go-envconfig"
 )
 
+type mutant struct {
+	FirstName       string
+	LastName        string
+	Address         string
+	PictureLocation string
+}
+
+// TestCluster runs against the cluster named by SCYLLA_TEST_HOSTS, a comma
+// separated list of hosts with a migrated "catalog" keyspace. The other
+// settings are the defaults of Config.
 func TestCluster(t *testing.T) {
-	cluster := CreateCluster(gocql.Quorum, "catalog", "localhost:9042")
+	hosts := os.Getenv("SCYLLA_TEST_HOSTS")
+	if hosts == "" {
+		t.Skip("🚧 Skipping scylla cluster tests (SCYLLA_TEST_HOSTS is not set)!")
+	}
+
+	ctx := context.Background()
+	var config Config
+	if err := envconfig.ProcessWith(ctx, &envconfig.Config{
+		Target: &config,
+		Lookuper: envconfig.MapLookuper(map[string]string{
+			"SCYLLA_HOSTS":    hosts,
+			"SCYLLA_KEYSPACE": "catalog",
+		}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := config.ClusterConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
 	session, err := gocql.NewSession(*cluster)
 	if err != nil {
 		t.Fatal("unable to connect to scylla", err)
 	}
 	defer session.Close()
 
-	SelectQuery(session)
-	InsertQuery(session, "Mike", "Tyson", "12345 Foo Lane", "http://www.facebook.com/mtyson")
-	InsertQuery(session, "Alex", "Jones", "56789 Hickory St", "http://www.facebook.com/ajones")
-	SelectQuery(session)
+	mutants, err := NewTable[mutant](NewSession(session), TableDef{
+		Name:          "mutant_data",
+		PartitionKey:  []string{"first_name"},
+		ClusteringKey: []string{"last_name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &mutant{"Mike", "Tyson", "12345 Foo Lane", "http://www.facebook.com/mtyson"}
+	if err := mutants.Put(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := mutants.Get(ctx, "Mike", "Tyson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	if err := mutants.Delete(ctx, "Mike", "Tyson"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mutants.Get(ctx, "Mike", "Tyson"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
 }
 
 // more test here https://github.com/scylladb/gocql
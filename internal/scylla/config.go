@@ -0,0 +1,119 @@
+package scylla
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Config is the configuration for connecting to a Scylla cluster.
+type Config struct {
+	Hosts       []string `env:"SCYLLA_HOSTS, default=localhost:9042" json:",omitempty"`
+	Keyspace    string   `env:"SCYLLA_KEYSPACE" json:",omitempty"`
+	Consistency string   `env:"SCYLLA_CONSISTENCY, default=QUORUM" json:",omitempty"`
+
+	// LocalDC, if set, routes queries to hosts in that data center first.
+	LocalDC string `env:"SCYLLA_LOCAL_DC" json:",omitempty"`
+
+	// Username and Password enable password authentication. The password is
+	// usually a reference resolved by the secret manager, e.g.
+	// "secret://scylla-password".
+	Username string `env:"SCYLLA_USERNAME" json:",omitempty"`
+	Password string `env:"SCYLLA_PASSWORD" json:"-"`
+
+	// TLS is enabled when any of the files are set. TLSCertFile and TLSKeyFile
+	// are only needed for client certificate authentication.
+	TLSCertFile           string `env:"SCYLLA_TLS_CERT_FILE" json:",omitempty"`
+	TLSKeyFile            string `env:"SCYLLA_TLS_KEY_FILE" json:",omitempty"`
+	TLSCAFile             string `env:"SCYLLA_TLS_CA_FILE" json:",omitempty"`
+	TLSInsecureSkipVerify bool   `env:"SCYLLA_TLS_INSECURE_SKIP_VERIFY" json:",omitempty"`
+
+	Timeout         time.Duration `env:"SCYLLA_TIMEOUT, default=5s" json:",omitempty"`
+	ConnectTimeout  time.Duration `env:"SCYLLA_CONNECT_TIMEOUT, default=5s" json:",omitempty"`
+	NumRetries      int           `env:"SCYLLA_NUM_RETRIES, default=5" json:",omitempty"`
+	RetryMinBackoff time.Duration `env:"SCYLLA_RETRY_MIN_BACKOFF, default=1s" json:",omitempty"`
+	RetryMaxBackoff time.Duration `env:"SCYLLA_RETRY_MAX_BACKOFF, default=10s" json:",omitempty"`
+
+	// SlowQueryThreshold is the attempt duration at or above which a query is
+	// logged, without its bound values. Zero disables the slow-query log.
+	SlowQueryThreshold time.Duration `env:"SCYLLA_SLOW_QUERY_THRESHOLD, default=500ms" json:",omitempty"`
+
+	// SpeculativeAttempts is the number of additional attempts sent to other
+	// hosts, SpeculativeDelay apart, when an idempotent query is slow to
+	// answer. Zero disables speculative execution. Tables may override it, see
+	// TableDef.
+	SpeculativeAttempts int           `env:"SCYLLA_SPECULATIVE_ATTEMPTS, default=0" json:",omitempty"`
+	SpeculativeDelay    time.Duration `env:"SCYLLA_SPECULATIVE_DELAY, default=100ms" json:",omitempty"`
+}
+
+func (c *Config) ScyllaConfig() *Config {
+	return c
+}
+
+// ClusterConfig builds the gocql cluster configuration described by c.
+func (c *Config) ClusterConfig() (*gocql.ClusterConfig, error) {
+	if len(c.Hosts) == 0 {
+		return nil, fmt.Errorf("at least one scylla host is required")
+	}
+
+	consistency, err := gocql.ParseConsistencyWrapper(c.Consistency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scylla consistency %q: %w", c.Consistency, err)
+	}
+
+	cluster := gocql.NewCluster(c.Hosts...)
+	cluster.Keyspace = c.Keyspace
+	cluster.Consistency = consistency
+	cluster.Timeout = c.Timeout
+	cluster.ConnectTimeout = c.ConnectTimeout
+	cluster.RetryPolicy = &gocql.ExponentialBackoffRetryPolicy{
+		Min:        c.RetryMinBackoff,
+		Max:        c.RetryMaxBackoff,
+		NumRetries: c.NumRetries,
+	}
+
+	fallback := gocql.RoundRobinHostPolicy()
+	if c.LocalDC != "" {
+		fallback = gocql.DCAwareRoundRobinPolicy(c.LocalDC)
+	}
+	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(fallback)
+
+	o := &observer{slowQueryThreshold: c.SlowQueryThreshold}
+	cluster.QueryObserver = o
+	cluster.BatchObserver = o
+	cluster.ConnectObserver = o
+
+	if c.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: c.Username,
+			Password: c.Password,
+		}
+	}
+
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" || c.TLSCAFile != "" || c.TLSInsecureSkipVerify {
+		if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+			return nil, fmt.Errorf("SCYLLA_TLS_CERT_FILE and SCYLLA_TLS_KEY_FILE must be set together")
+		}
+		cluster.SslOpts = &gocql.SslOptions{
+			CertPath:               c.TLSCertFile,
+			KeyPath:                c.TLSKeyFile,
+			CaPath:                 c.TLSCAFile,
+			EnableHostVerification: !c.TLSInsecureSkipVerify,
+		}
+	}
+
+	return cluster, nil
+}
+
+// SpeculativeExecution returns the configured speculative execution policy,
+// or nil if it is disabled.
+func (c *Config) SpeculativeExecution() gocql.SpeculativeExecutionPolicy {
+	if c.SpeculativeAttempts <= 0 {
+		return nil
+	}
+	return &gocql.SimpleSpeculativeExecution{
+		NumAttempts:  c.SpeculativeAttempts,
+		TimeoutDelay: c.SpeculativeDelay,
+	}
+}
@@ -0,0 +1,79 @@
+package scylla
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func testConfig() *Config {
+	return &Config{
+		Hosts:           []string{"scylla-1:9042", "scylla-2:9042"},
+		Keyspace:        "catalog",
+		Consistency:     "local_quorum",
+		Timeout:         2 * time.Second,
+		ConnectTimeout:  3 * time.Second,
+		NumRetries:      3,
+		RetryMinBackoff: 100 * time.Millisecond,
+		RetryMaxBackoff: time.Second,
+	}
+}
+
+func TestConfig_ClusterConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.LocalDC = "eu-west"
+	cfg.Username = "app"
+	cfg.Password = "hunter2"
+	cfg.TLSCAFile = "/etc/scylla/ca.pem"
+
+	cluster, err := cfg.ClusterConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cluster.Keyspace != "catalog" || cluster.Consistency != gocql.LocalQuorum {
+		t.Errorf("unexpected keyspace/consistency %q/%v", cluster.Keyspace, cluster.Consistency)
+	}
+	if cluster.Timeout != 2*time.Second || cluster.ConnectTimeout != 3*time.Second {
+		t.Errorf("unexpected timeouts %v/%v", cluster.Timeout, cluster.ConnectTimeout)
+	}
+	if rp, ok := cluster.RetryPolicy.(*gocql.ExponentialBackoffRetryPolicy); !ok || rp.NumRetries != 3 {
+		t.Errorf("unexpected retry policy %#v", cluster.RetryPolicy)
+	}
+	if auth, ok := cluster.Authenticator.(gocql.PasswordAuthenticator); !ok || auth.Password != "hunter2" {
+		t.Errorf("unexpected authenticator %#v", cluster.Authenticator)
+	}
+	if cluster.SslOpts == nil || cluster.SslOpts.CaPath != "/etc/scylla/ca.pem" || !cluster.SslOpts.EnableHostVerification {
+		t.Errorf("unexpected TLS options %#v", cluster.SslOpts)
+	}
+}
+
+func TestConfig_ClusterConfig_errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		mutate func(*Config)
+	}{
+		{name: "no hosts", mutate: func(c *Config) { c.Hosts = nil }},
+		{name: "bad consistency", mutate: func(c *Config) { c.Consistency = "most" }},
+		{name: "cert without key", mutate: func(c *Config) { c.TLSCertFile = "cert.pem" }},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig()
+			tc.mutate(cfg)
+			if _, err := cfg.ClusterConfig(); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package scylla
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// tagName is the struct tag that names the column a field is mapped to.
+// Exported fields without a tag map to the snake_case form of their name, and
+// a tag of "-" excludes a field.
+const tagName = "cql"
+
+// mapper maps the fields of a struct type to CQL columns.
+type mapper struct {
+	typ     reflect.Type
+	columns []string
+	fields  map[string][]int
+}
+
+// newMapper builds a mapper for the struct type T.
+func newMapper[T any]() (*mapper, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("scylla: row type %s is not a struct", typ)
+	}
+
+	m := &mapper{
+		typ:    typ,
+		fields: make(map[string][]int),
+	}
+	if err := m.addFields(typ, nil); err != nil {
+		return nil, err
+	}
+	if len(m.columns) == 0 {
+		return nil, fmt.Errorf("scylla: row type %s has no mapped fields", typ)
+	}
+	return m, nil
+}
+
+func (m *mapper) addFields(typ reflect.Type, index []int) error {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag, hasTag := f.Tag.Lookup(tagName)
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+
+		idx := append(append([]int(nil), index...), i)
+
+		// Untagged embedded structs contribute their own fields.
+		if f.Anonymous && !hasTag && f.Type.Kind() == reflect.Struct {
+			if err := m.addFields(f.Type, idx); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		column := tag
+		if column == "" {
+			column = toSnakeCase(f.Name)
+		}
+		if _, ok := m.fields[column]; ok {
+			return fmt.Errorf("scylla: column %q is mapped more than once in %s", column, m.typ)
+		}
+		m.columns = append(m.columns, column)
+		m.fields[column] = idx
+	}
+	return nil
+}
+
+// has reports whether column is mapped.
+func (m *mapper) has(column string) bool {
+	_, ok := m.fields[column]
+	return ok
+}
+
+// pointers returns pointers to the fields of v backing columns, in order, for
+// use as scan destinations.
+func (m *mapper) pointers(v reflect.Value, columns []string) []any {
+	ptrs := make([]any, len(columns))
+	for i, c := range columns {
+		ptrs[i] = v.FieldByIndex(m.fields[c]).Addr().Interface()
+	}
+	return ptrs
+}
+
+// values returns the values of the fields of v backing columns, in order, for
+// use as bind arguments.
+func (m *mapper) values(v reflect.Value, columns []string) []any {
+	vals := make([]any, len(columns))
+	for i, c := range columns {
+		vals[i] = v.FieldByIndex(m.fields[c]).Interface()
+	}
+	return vals
+}
+
+// toSnakeCase converts a Go identifier such as "BillID" into "bill_id".
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word at a lower-to-upper transition, or at the last
+			// upper case letter of an acronym followed by a lower case one.
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
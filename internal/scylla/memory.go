@@ -0,0 +1,593 @@
+package scylla
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Compile-time check to verify implements interface.
+var _ Session = (*MemorySession)(nil)
+
+// MemorySession is an in-memory Session for unit tests. It supports the CQL
+// the repository layer generates, with every value bound with "?":
+//
+//	SELECT <columns> FROM <table> [WHERE <column> = ? [AND ...]]
+//	INSERT INTO <table> (<columns>) VALUES (?, ...) [IF NOT EXISTS] [USING TTL <n>|?]
+//	DELETE FROM <table> WHERE <column> = ? [AND ...] [IF EXISTS | IF <column> = ? [AND ...]]
+//
+// As in Scylla, selects must restrict the full partition key unless they scan
+// the whole table, and rows are returned in clustering order. Tables must be
+// created with CreateTable before use.
+type MemorySession struct {
+	mu     sync.Mutex
+	tables map[string]*memoryTable
+	now    func() time.Time
+}
+
+type memoryTable struct {
+	partitionKey  []string
+	clusteringKey []string
+	rows          map[string]*memoryRow
+}
+
+type memoryRow struct {
+	values  map[string]any
+	expires time.Time
+}
+
+// NewMemorySession creates an empty in-memory session.
+func NewMemorySession() *MemorySession {
+	return &MemorySession{
+		tables: make(map[string]*memoryTable),
+		now:    time.Now,
+	}
+}
+
+// SetClock replaces the clock used to expire rows written with a TTL.
+func (m *MemorySession) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// CreateTable creates the table name with the given primary key. Creating an
+// existing table is a no-op.
+func (m *MemorySession) CreateTable(name string, partitionKey, clusteringKey []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tables[name]; ok {
+		return
+	}
+	m.tables[name] = &memoryTable{
+		partitionKey:  partitionKey,
+		clusteringKey: clusteringKey,
+		rows:          make(map[string]*memoryRow),
+	}
+}
+
+// Exec implements Session.
+func (m *MemorySession) Exec(_ context.Context, s *Statement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, err := parseMemoryStatement(s.CQL)
+	if err != nil {
+		return err
+	}
+	if q.kind == "SELECT" {
+		return fmt.Errorf("scylla: memory: Exec of a SELECT")
+	}
+	_, err = m.apply(q, s.Values)
+	return err
+}
+
+// ExecCAS implements Session.
+func (m *MemorySession) ExecCAS(_ context.Context, s *Statement) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, err := parseMemoryStatement(s.CQL)
+	if err != nil {
+		return false, err
+	}
+	if !q.conditional {
+		return false, fmt.Errorf("scylla: memory: ExecCAS of a statement without IF: %s", s.CQL)
+	}
+	return m.apply(q, s.Values)
+}
+
+// ExecBatch implements Session. Statements are applied atomically: if any of
+// them fails, the writes of the others are rolled back.
+func (m *MemorySession) ExecBatch(_ context.Context, _ gocql.BatchType, stmts []*Statement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parsed := make([]*memoryStatement, len(stmts))
+	staged := make(map[*memoryTable]map[string]*memoryRow)
+	for i, s := range stmts {
+		q, err := parseMemoryStatement(s.CQL)
+		if err != nil {
+			return err
+		}
+		if q.kind == "SELECT" || q.conditional {
+			return fmt.Errorf("scylla: memory: unsupported statement in batch: %s", s.CQL)
+		}
+		t, err := m.table(q.table)
+		if err != nil {
+			return err
+		}
+		parsed[i] = q
+		if _, ok := staged[t]; !ok {
+			staged[t] = t.rows
+		}
+	}
+
+	// Writes go to copies of the rows of the tables, which replace them once
+	// every statement succeeded. Rows are replaced rather than modified, so
+	// shallow copies suffice.
+	for t, rows := range staged {
+		t.rows = maps.Clone(rows)
+	}
+	for i, q := range parsed {
+		if _, err := m.apply(q, stmts[i].Values); err != nil {
+			for t, rows := range staged {
+				t.rows = rows
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Iter implements Session.
+func (m *MemorySession) Iter(_ context.Context, s *Statement) Iter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, err := parseMemoryStatement(s.CQL)
+	if err != nil {
+		return &memoryIter{err: err}
+	}
+	if q.kind != "SELECT" {
+		return &memoryIter{err: fmt.Errorf("scylla: memory: Iter of a %s", q.kind)}
+	}
+	rows, err := m.selectRows(q, s.Values)
+	if err != nil {
+		return &memoryIter{err: err}
+	}
+
+	if s.PageSize <= 0 {
+		return &memoryIter{rows: rows}
+	}
+
+	var offset int
+	if len(s.PageState) > 0 {
+		if len(s.PageState) != 8 {
+			return &memoryIter{err: fmt.Errorf("scylla: memory: invalid page state")}
+		}
+		offset = int(binary.BigEndian.Uint64(s.PageState))
+	}
+	if offset > len(rows) {
+		offset = len(rows)
+	}
+	end := offset + s.PageSize
+	var next []byte
+	if end < len(rows) {
+		next = binary.BigEndian.AppendUint64(nil, uint64(end))
+	} else {
+		end = len(rows)
+	}
+	return &memoryIter{rows: rows[offset:end], next: next}
+}
+
+func (m *MemorySession) table(name string) (*memoryTable, error) {
+	if t, ok := m.tables[name]; ok {
+		return t, nil
+	}
+	// Allow keyspace-qualified names for tables created unqualified.
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		if t, ok := m.tables[name[i+1:]]; ok {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("scylla: memory: unconfigured table %s", name)
+}
+
+// apply executes an INSERT or DELETE, reporting whether it was applied.
+func (m *MemorySession) apply(q *memoryStatement, values []any) (bool, error) {
+	t, err := m.table(q.table)
+	if err != nil {
+		return false, err
+	}
+	if len(values) != q.binds {
+		return false, fmt.Errorf("scylla: memory: expected %d values, got %d", q.binds, len(values))
+	}
+	now := m.now()
+
+	switch q.kind {
+	case "INSERT":
+		row := &memoryRow{values: make(map[string]any, len(q.columns))}
+		for i, c := range q.columns {
+			row.values[c] = values[i]
+		}
+		key, err := t.key(row.values)
+		if err != nil {
+			return false, err
+		}
+		if q.ifNotExists {
+			if existing, ok := t.rows[key]; ok && !existing.expired(now) {
+				return false, nil
+			}
+		}
+
+		ttl := q.ttl
+		if q.ttlBound {
+			v, ok := values[len(values)-1].(int)
+			if !ok {
+				return false, fmt.Errorf("scylla: memory: TTL must be bound as an int, got %T", values[len(values)-1])
+			}
+			ttl = time.Duration(v) * time.Second
+		}
+		if ttl > 0 {
+			row.expires = now.Add(ttl)
+		}
+		t.rows[key] = row
+		return true, nil
+
+	case "DELETE":
+		where := bindConditions(q.where, values)
+		key, err := t.key(where)
+		if err != nil {
+			return false, err
+		}
+		existing, ok := t.rows[key]
+		exists := ok && !existing.expired(now)
+		if q.ifExists && !exists {
+			return false, nil
+		}
+		if len(q.conditions) > 0 {
+			if !exists {
+				return false, nil
+			}
+			for c, v := range bindConditions(q.conditions, values[len(q.where):]) {
+				if !equalValues(existing.values[c], v) {
+					return false, nil
+				}
+			}
+		}
+		delete(t.rows, key)
+		return true, nil
+	}
+	return false, fmt.Errorf("scylla: memory: unsupported statement %s", q.kind)
+}
+
+func (m *MemorySession) selectRows(q *memoryStatement, values []any) ([][]any, error) {
+	t, err := m.table(q.table)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != q.binds {
+		return nil, fmt.Errorf("scylla: memory: expected %d values, got %d", q.binds, len(values))
+	}
+
+	where := bindConditions(q.where, values)
+	if len(where) > 0 {
+		for _, c := range t.partitionKey {
+			if _, ok := where[c]; !ok {
+				return nil, fmt.Errorf("scylla: memory: select from %s must restrict partition key column %s", q.table, c)
+			}
+		}
+	}
+
+	now := m.now()
+	var matched []*memoryRow
+	for _, r := range t.rows {
+		if r.expired(now) {
+			continue
+		}
+		ok := true
+		for c, v := range where {
+			if !equalValues(r.values[c], v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, r)
+		}
+	}
+
+	order := append(append([]string(nil), t.partitionKey...), t.clusteringKey...)
+	sort.Slice(matched, func(i, j int) bool {
+		for _, c := range order {
+			if cmp := compareValues(matched[i].values[c], matched[j].values[c]); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	rows := make([][]any, len(matched))
+	for i, r := range matched {
+		row := make([]any, len(q.columns))
+		for j, c := range q.columns {
+			row[j] = r.values[c]
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// key encodes the primary key of values, which must hold every key column.
+func (t *memoryTable) key(values map[string]any) (string, error) {
+	var b strings.Builder
+	for _, c := range append(append([]string(nil), t.partitionKey...), t.clusteringKey...) {
+		v, ok := values[c]
+		if !ok {
+			return "", fmt.Errorf("scylla: memory: missing primary key column %s", c)
+		}
+		fmt.Fprintf(&b, "%#v\x00", v)
+	}
+	return b.String(), nil
+}
+
+func (r *memoryRow) expired(now time.Time) bool {
+	return !r.expires.IsZero() && !now.Before(r.expires)
+}
+
+// memoryStatement is a parsed statement of the supported CQL subset.
+type memoryStatement struct {
+	kind    string
+	table   string
+	columns []string
+
+	// where and conditions are the columns of "col = ?" restrictions and IF
+	// conditions, bound in order after the columns of an INSERT.
+	where      []string
+	conditions []string
+
+	conditional bool
+	ifNotExists bool
+	ifExists    bool
+
+	ttl      time.Duration
+	ttlBound bool
+
+	binds int
+}
+
+var (
+	memorySelect = regexp.MustCompile(`(?is)^SELECT\s+(.+?)\s+FROM\s+(\S+)(?:\s+WHERE\s+(.+))?$`)
+	memoryInsert = regexp.MustCompile(`(?is)^INSERT\s+INTO\s+(\S+)\s*\((.+?)\)\s*VALUES\s*\((.+?)\)(\s+IF\s+NOT\s+EXISTS)?(?:\s+USING\s+TTL\s+(\d+|\?))?$`)
+	memoryDelete = regexp.MustCompile(`(?is)^DELETE\s+FROM\s+(\S+)\s+WHERE\s+(.+?)(?:\s+IF\s+(EXISTS|.+))?$`)
+
+	memoryStatements sync.Map
+)
+
+// parseMemoryStatement parses stmt, caching the result like a prepared
+// statement.
+func parseMemoryStatement(stmt string) (*memoryStatement, error) {
+	if q, ok := memoryStatements.Load(stmt); ok {
+		return q.(*memoryStatement), nil
+	}
+
+	cql := strings.TrimSuffix(strings.Join(strings.Fields(stmt), " "), ";")
+	q := &memoryStatement{}
+	var err error
+
+	switch {
+	case memorySelect.MatchString(cql):
+		m := memorySelect.FindStringSubmatch(cql)
+		q.kind, q.table, q.columns = "SELECT", m[2], splitList(m[1])
+		if m[3] != "" {
+			if q.where, err = parseConditions(m[3]); err != nil {
+				return nil, err
+			}
+		}
+		if len(q.columns) == 1 && q.columns[0] == "*" {
+			return nil, fmt.Errorf("scylla: memory: SELECT * is not supported, list the columns")
+		}
+		q.binds = len(q.where)
+
+	case memoryInsert.MatchString(cql):
+		m := memoryInsert.FindStringSubmatch(cql)
+		q.kind, q.table, q.columns = "INSERT", m[1], splitList(m[2])
+		for _, v := range splitList(m[3]) {
+			if v != "?" {
+				return nil, fmt.Errorf("scylla: memory: only bound values are supported: %s", stmt)
+			}
+		}
+		if n := len(splitList(m[3])); n != len(q.columns) {
+			return nil, fmt.Errorf("scylla: memory: %d columns but %d values: %s", len(q.columns), n, stmt)
+		}
+		q.ifNotExists = m[4] != ""
+		q.conditional = q.ifNotExists
+		q.binds = len(q.columns)
+		switch ttl := m[5]; ttl {
+		case "":
+		case "?":
+			q.ttlBound = true
+			q.binds++
+		default:
+			n, _ := strconv.Atoi(ttl)
+			q.ttl = time.Duration(n) * time.Second
+		}
+
+	case memoryDelete.MatchString(cql):
+		m := memoryDelete.FindStringSubmatch(cql)
+		q.kind, q.table = "DELETE", m[1]
+		if q.where, err = parseConditions(m[2]); err != nil {
+			return nil, err
+		}
+		switch cond := m[3]; {
+		case cond == "":
+		case strings.EqualFold(cond, "EXISTS"):
+			q.ifExists, q.conditional = true, true
+		default:
+			if q.conditions, err = parseConditions(cond); err != nil {
+				return nil, err
+			}
+			q.conditional = true
+		}
+		q.binds = len(q.where) + len(q.conditions)
+
+	default:
+		return nil, fmt.Errorf("scylla: memory: unsupported statement: %s", stmt)
+	}
+
+	memoryStatements.Store(stmt, q)
+	return q, nil
+}
+
+// parseConditions parses "a = ? AND b = ?" into its columns.
+func parseConditions(s string) ([]string, error) {
+	var cols []string
+	for _, cond := range regexp.MustCompile(`(?i)\s+AND\s+`).Split(s, -1) {
+		col, val, ok := strings.Cut(cond, "=")
+		if !ok || strings.TrimSpace(val) != "?" {
+			return nil, fmt.Errorf("scylla: memory: only \"column = ?\" restrictions are supported, got %q", cond)
+		}
+		cols = append(cols, strings.TrimSpace(col))
+	}
+	return cols, nil
+}
+
+func bindConditions(cols []string, values []any) map[string]any {
+	m := make(map[string]any, len(cols))
+	for i, c := range cols {
+		m[c] = values[i]
+	}
+	return m
+}
+
+func splitList(s string) []string {
+	parts := strings.Split(s, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return parts
+}
+
+// equalValues reports whether a and b are equal, treating numbers of
+// different types as equal if their values are, as bound values are
+// converted to the column type by Scylla.
+func equalValues(a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	numeric := func(v reflect.Value) bool { return v.CanInt() || v.CanUint() || v.CanFloat() }
+	return av.IsValid() && bv.IsValid() && numeric(av) && numeric(bv) && compareValues(a, b) == 0
+}
+
+// compareValues orders values of the same clustering column.
+func compareValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b)
+		}
+	case []byte:
+		if b, ok := b.([]byte); ok {
+			return bytes.Compare(a, b)
+		}
+	case gocql.UUID:
+		if b, ok := b.(gocql.UUID); ok {
+			return bytes.Compare(a[:], b[:])
+		}
+	}
+
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case av.CanInt() && bv.CanInt():
+		return compareOrdered(av.Int(), bv.Int())
+	case av.CanUint() && bv.CanUint():
+		return compareOrdered(av.Uint(), bv.Uint())
+	case av.CanFloat() && bv.CanFloat():
+		return compareOrdered(av.Float(), bv.Float())
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// memoryIter iterates over selected rows.
+type memoryIter struct {
+	rows [][]any
+	next []byte
+	pos  int
+	err  error
+}
+
+func (it *memoryIter) Scan(dest ...any) bool {
+	if it.err != nil || it.pos >= len(it.rows) {
+		return false
+	}
+	row := it.rows[it.pos]
+	if len(dest) != len(row) {
+		it.err = fmt.Errorf("scylla: memory: scanning %d columns into %d destinations", len(row), len(dest))
+		return false
+	}
+	for i, d := range dest {
+		if err := assign(d, row[i]); err != nil {
+			it.err = err
+			return false
+		}
+	}
+	it.pos++
+	return true
+}
+
+func (it *memoryIter) PageState() []byte { return it.next }
+func (it *memoryIter) NumRows() int      { return len(it.rows) }
+func (it *memoryIter) Close() error      { return it.err }
+
+// assign stores v in the value dest points to, converting between compatible
+// types as the gocql unmarshaler would. A nil v stores the zero value.
+func assign(dest, v any) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return fmt.Errorf("scylla: memory: scan destination %T is not a pointer", dest)
+	}
+	dv = dv.Elem()
+
+	if v == nil {
+		dv.SetZero()
+		return nil
+	}
+	sv := reflect.ValueOf(v)
+	switch {
+	case sv.Type().AssignableTo(dv.Type()):
+		dv.Set(sv)
+	case sv.Type().ConvertibleTo(dv.Type()) && sv.Kind() != reflect.String && dv.Kind() != reflect.String:
+		dv.Set(sv.Convert(dv.Type()))
+	default:
+		return fmt.Errorf("scylla: memory: cannot scan %T into %s", v, dv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package scylla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type entry struct {
+	Customer string
+	BillID   int64
+	Amount   int64
+}
+
+func testTable(t *testing.T, def TableDef) (*Table[entry], *MemorySession) {
+	t.Helper()
+
+	session := NewMemorySession()
+	session.CreateTable("ledger", []string{"customer"}, []string{"bill_id"})
+
+	def.Name = "ledger"
+	def.PartitionKey = []string{"customer"}
+	def.ClusteringKey = []string{"bill_id"}
+	table, err := NewTable[entry](session, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table, session
+}
+
+func TestTable_memory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, _ := testTable(t, TableDef{})
+
+	for _, e := range []*entry{
+		{"alice", 3, 300},
+		{"alice", 1, 100},
+		{"alice", 2, 200},
+		{"bob", 1, 50},
+	} {
+		if err := table.Put(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := table.Get(ctx, "alice", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != (entry{"alice", 2, 200}) {
+		t.Errorf("unexpected row %+v", got)
+	}
+	if _, err := table.Get(ctx, "alice", 4); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	rows, err := table.List(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].BillID != 1 || rows[2].BillID != 3 {
+		t.Errorf("expected rows in clustering order, got %+v", rows)
+	}
+
+	// Page through the partition.
+	var (
+		paged []*entry
+		page  = Page{Size: 2}
+		pages int
+	)
+	for {
+		rows, next, err := table.ListPage(ctx, page, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, rows...)
+		pages++
+		if len(next) == 0 {
+			break
+		}
+		page.State = next
+	}
+	if len(paged) != 3 || pages != 2 {
+		t.Errorf("expected 3 rows in 2 pages, got %d rows in %d pages", len(paged), pages)
+	}
+
+	if err := table.Delete(ctx, "alice", 1); err != nil {
+		t.Fatal(err)
+	}
+	if rows, _ := table.List(ctx, "alice"); len(rows) != 2 {
+		t.Errorf("expected 2 rows after delete, got %d", len(rows))
+	}
+}
+
+func TestTable_memoryLightweightTransactions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, _ := testTable(t, TableDef{})
+
+	applied, err := table.PutIfNotExists(ctx, &entry{"alice", 1, 100})
+	if err != nil || !applied {
+		t.Fatalf("expected first insert to apply, got %t, %v", applied, err)
+	}
+	applied, err = table.PutIfNotExists(ctx, &entry{"alice", 1, 999})
+	if err != nil || applied {
+		t.Fatalf("expected second insert not to apply, got %t, %v", applied, err)
+	}
+	if got, _ := table.Get(ctx, "alice", 1); got.Amount != 100 {
+		t.Errorf("expected original row to be kept, got %+v", got)
+	}
+}
+
+func TestTable_memoryTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, session := testTable(t, TableDef{TTL: time.Minute})
+
+	now := time.Now()
+	session.SetClock(func() time.Time { return now })
+
+	if err := table.Put(ctx, &entry{"alice", 1, 100}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.Get(ctx, "alice", 1); err != nil {
+		t.Fatalf("expected row before TTL, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := table.Get(ctx, "alice", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected row to expire, got %v", err)
+	}
+	if applied, _ := table.PutIfNotExists(ctx, &entry{"alice", 1, 200}); !applied {
+		t.Errorf("expected insert over expired row to apply")
+	}
+}
+
+func TestBatch_memory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	table, session := testTable(t, TableDef{})
+
+	if err := table.Put(ctx, &entry{"alice", 1, 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBatch(ctx, session, gocql.LoggedBatch)
+	table.AddPut(b, &entry{"alice", 2, 200})
+	table.AddPut(b, &entry{"bob", 1, 50})
+	if err := table.AddDelete(b, "alice", 1); err != nil {
+		t.Fatal(err)
+	}
+	if b.Size() != 3 {
+		t.Errorf("expected 3 statements, got %d", b.Size())
+	}
+	if err := b.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows, _ := table.List(ctx, "alice"); len(rows) != 1 || rows[0].BillID != 2 {
+		t.Errorf("unexpected rows after batch %+v", rows)
+	}
+	if _, err := table.Get(ctx, "bob", 1); err != nil {
+		t.Errorf("expected batched insert, got %v", err)
+	}
+}
+
+func TestMemorySession_batchAtomic(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	session := NewMemorySession()
+	session.CreateTable("ledger", []string{"customer"}, []string{"bill_id"})
+
+	insert := "INSERT INTO ledger (customer, bill_id) VALUES (?, ?)"
+	if err := session.Exec(ctx, &Statement{CQL: insert, Values: []any{"alice", 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last statement only fails once bound, after the others were applied.
+	err := session.ExecBatch(ctx, gocql.LoggedBatch, []*Statement{
+		{CQL: insert, Values: []any{"bob", 1}},
+		{CQL: "DELETE FROM ledger WHERE customer = ? AND bill_id = ?", Values: []any{"alice", 1}},
+		{CQL: insert, Values: []any{"carol"}},
+	})
+	if err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+
+	var customers []string
+	iter := session.Iter(ctx, &Statement{CQL: "SELECT customer FROM ledger"})
+	var customer string
+	for iter.Scan(&customer) {
+		customers = append(customers, customer)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(customers) != 1 || customers[0] != "alice" {
+		t.Errorf("expected the failed batch to leave no writes, got %q", customers)
+	}
+}
+
+func TestMemorySession_errors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	session := NewMemorySession()
+	session.CreateTable("ledger", []string{"customer"}, []string{"bill_id"})
+
+	cases := []struct {
+		name string
+		stmt *Statement
+	}{
+		{name: "unknown table", stmt: &Statement{CQL: "SELECT a FROM nope WHERE a = ?", Values: []any{1}}},
+		{name: "missing partition key", stmt: &Statement{CQL: "SELECT customer FROM ledger WHERE bill_id = ?", Values: []any{1}}},
+		{name: "unsupported", stmt: &Statement{CQL: "UPDATE ledger SET amount = 1 WHERE customer = ?", Values: []any{"a"}}},
+		{name: "wrong value count", stmt: &Statement{CQL: "SELECT customer FROM ledger WHERE customer = ?"}},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := session.Iter(ctx, tc.stmt).Close(); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package scylla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+)
+
+const (
+	// migrationLock is the row of schema_migrations_lock held while migrating,
+	// so that replicas starting together do not apply the same migration twice.
+	migrationLock = "schema_migrations"
+
+	// migrationLockTTL bounds how long a lock outlives a runner that died
+	// without releasing it. A live runner renews its lock every
+	// migrationLockRenewal, so migrations may take longer than that.
+	migrationLockTTL     = 5 * time.Minute
+	migrationLockRenewal = migrationLockTTL / 3
+
+	// migrationLockTimeout is how long Migrate waits for another runner.
+	migrationLockTimeout = 2 * time.Minute
+)
+
+// errMigrationLockLost is the cause of the cancellation of a migration whose
+// lock was taken over, e.g. after it could not be renewed in time.
+var errMigrationLockLost = errors.New("migration lock lost")
+
+// Migrate applies, in lexical order, every *.cql file in fsys that is not yet
+// recorded in the schema_migrations table of the session's keyspace, which
+// must already exist. The version of a migration is the file name up to the
+// first underscore, e.g. "000001".
+//
+// CQL DDL is not transactional, so statements are applied one by one, waiting
+// for schema agreement after each, and the version is recorded only once all
+// of them have succeeded. Migrations should use IF NOT EXISTS / IF EXISTS so
+// that one interrupted half way can be run again.
+//
+// The migration lock is renewed while migrations run. If it is lost, Migrate
+// stops before the next statement.
+func (db *DB) Migrate(ctx context.Context, fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.cql")
+	if err != nil {
+		return fmt.Errorf("listing migrations: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version text PRIMARY KEY,
+			applied_at timestamp
+		)`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			name text PRIMARY KEY,
+			owner uuid,
+			acquired_at timestamp
+		)`,
+	} {
+		if err := db.execDDL(ctx, stmt); err != nil {
+			return fmt.Errorf("creating migration tables: %w", err)
+		}
+	}
+
+	owner, err := db.acquireMigrationLock(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		db.renewMigrationLock(ctx, owner, cancel)
+	}()
+	defer func() {
+		cancel(nil)
+		<-renewed
+		if err := db.releaseMigrationLock(context.Background(), owner); err != nil {
+			slog.Warn("failed to release migration lock", "error", err)
+		}
+	}()
+
+	applied := make(map[string]bool)
+	iter := db.Session.Query(`SELECT version FROM schema_migrations`).WithContext(ctx).Iter()
+	var v string
+	for iter.Scan(&v) {
+		applied[v] = true
+	}
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("listing applied migrations: %w", err)
+	}
+
+	for _, file := range files {
+		version, _, _ := strings.Cut(path.Base(file), "_")
+		if applied[version] {
+			continue
+		}
+
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("reading migration %s: %w", file, err)
+		}
+		for _, stmt := range database.SplitStatements(string(b)) {
+			if err := context.Cause(ctx); err != nil {
+				return fmt.Errorf("applying migration %s: %w", file, err)
+			}
+			if err := db.execDDL(ctx, stmt); err != nil {
+				return fmt.Errorf("applying migration %s: %w", file, err)
+			}
+		}
+		if err := db.Session.Query(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			version, time.Now().UTC()).WithContext(ctx).Exec(); err != nil {
+			return fmt.Errorf("recording migration %s: %w", file, err)
+		}
+		slog.InfoContext(ctx, "applied migration", "version", version, "file", file)
+	}
+	return nil
+}
+
+// execDDL executes a schema change and waits until every node agrees on the
+// resulting schema, so the next statement does not race against it.
+func (db *DB) execDDL(ctx context.Context, stmt string) error {
+	if err := db.Session.Query(stmt).WithContext(ctx).Exec(); err != nil {
+		return err
+	}
+	if err := db.Session.AwaitSchemaAgreement(ctx); err != nil {
+		return fmt.Errorf("waiting for schema agreement: %w", err)
+	}
+	return nil
+}
+
+// acquireMigrationLock takes the migration lock with a lightweight
+// transaction, polling until it is free or migrationLockTimeout elapses. It
+// returns the owner token needed to release it.
+func (db *DB) acquireMigrationLock(ctx context.Context) (gocql.UUID, error) {
+	owner, err := gocql.RandomUUID()
+	if err != nil {
+		return owner, fmt.Errorf("generating lock owner: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, migrationLockTimeout)
+	defer cancel()
+
+	for {
+		existing := make(map[string]any)
+		applied, err := db.Session.Query(`
+			INSERT INTO schema_migrations_lock (name, owner, acquired_at) VALUES (?, ?, ?)
+			IF NOT EXISTS USING TTL ?`,
+			migrationLock, owner, time.Now().UTC(), int(migrationLockTTL/time.Second)).
+			WithContext(ctx).MapScanCAS(existing)
+		if err != nil {
+			return owner, fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		if applied {
+			return owner, nil
+		}
+
+		slog.InfoContext(ctx, "waiting for migration lock", "owner", existing["owner"])
+		select {
+		case <-ctx.Done():
+			return owner, fmt.Errorf("timed out acquiring migration lock")
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// renewMigrationLock extends the TTL of the lock held by owner every
+// migrationLockRenewal until ctx is done. If another runner took the lock over,
+// it cancels ctx with errMigrationLockLost. Failed renewals are retried at the
+// next tick, which leaves two attempts before the lock expires.
+func (db *DB) renewMigrationLock(ctx context.Context, owner gocql.UUID, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(migrationLockRenewal)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Rewriting the owner extends the row past the TTL of the insert.
+		existing := make(map[string]any)
+		applied, err := db.Session.Query(`
+			UPDATE schema_migrations_lock USING TTL ? SET owner = ?
+			WHERE name = ? IF owner = ?`,
+			int(migrationLockTTL/time.Second), owner, migrationLock, owner).
+			WithContext(ctx).MapScanCAS(existing)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			slog.WarnContext(ctx, "failed to renew migration lock", "error", err)
+		case !applied:
+			slog.ErrorContext(ctx, "migration lock taken over", "owner", existing["owner"])
+			cancel(errMigrationLockLost)
+			return
+		}
+	}
+}
+
+// releaseMigrationLock releases the lock if it is still held by owner.
+func (db *DB) releaseMigrationLock(ctx context.Context, owner gocql.UUID) error {
+	existing := make(map[string]any)
+	_, err := db.Session.Query(`DELETE FROM schema_migrations_lock WHERE name = ? IF owner = ?`,
+		migrationLock, owner).WithContext(ctx).MapScanCAS(existing)
+	return err
+}
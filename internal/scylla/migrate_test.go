@@ -0,0 +1,44 @@
+package scylla
+
+import (
+	"io/fs"
+	"regexp"
+	"testing"
+
+	"github.com/paveletto99/microservice-blueprint/migrations"
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+)
+
+func TestMigrationFiles(t *testing.T) {
+	t.Parallel()
+
+	files, err := fs.Glob(migrations.ScyllaFS, "*.cql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected embedded CQL migrations")
+	}
+
+	versions := make(map[string]string)
+	name := regexp.MustCompile(`^(\d{6})_\w+\.cql$`)
+	for _, file := range files {
+		m := name.FindStringSubmatch(file)
+		if m == nil {
+			t.Errorf("%s: expected name of the form 000001_description.cql", file)
+			continue
+		}
+		if prev, ok := versions[m[1]]; ok {
+			t.Errorf("%s: version %s already used by %s", file, m[1], prev)
+		}
+		versions[m[1]] = file
+
+		b, err := fs.ReadFile(migrations.ScyllaFS, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(database.SplitStatements(string(b))) == 0 {
+			t.Errorf("%s: expected at least one statement", file)
+		}
+	}
+}
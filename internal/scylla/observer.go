@@ -0,0 +1,156 @@
+package scylla
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	queryLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scylla_query_duration_seconds",
+		Help:    "latency of each attempt of a scylla query or batch by statement",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"op", "statement"})
+
+	queryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scylla_query_errors_total",
+		Help: "total number of failed attempts of scylla queries and batches by statement",
+	}, []string{"op", "statement"})
+
+	queryRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scylla_query_retries_total",
+		Help: "total number of retried or speculative attempts of scylla queries and batches by statement",
+	}, []string{"op", "statement"})
+
+	hostRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scylla_host_requests_total",
+		Help: "total number of query and batch attempts served by each scylla host",
+	}, []string{"host", "datacenter", "result"})
+
+	connectLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scylla_connect_duration_seconds",
+		Help:    "latency of establishing connections to scylla hosts",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"host", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(queryLatency, queryErrors, queryRetries, hostRequests, connectLatency)
+}
+
+// observer records metrics, trace annotations and slow-query logs for every
+// attempt of every query and batch executed by a session, and for every
+// connection it dials.
+//
+// gocql calls observers after the fact, so spans are not created here: the
+// attempts are annotated on the span in the query's context, which Table
+// starts for each operation.
+type observer struct {
+	slowQueryThreshold time.Duration
+}
+
+var (
+	_ gocql.QueryObserver   = (*observer)(nil)
+	_ gocql.BatchObserver   = (*observer)(nil)
+	_ gocql.ConnectObserver = (*observer)(nil)
+)
+
+// ObserveQuery implements gocql.QueryObserver.
+func (o *observer) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	o.observe(ctx, statementOp(q.Statement), q.Statement, q.Keyspace, q.Host, q.Attempt, q.End.Sub(q.Start), q.Err)
+}
+
+// ObserveBatch implements gocql.BatchObserver. Batches are labelled with their
+// first statement.
+func (o *observer) ObserveBatch(ctx context.Context, b gocql.ObservedBatch) {
+	var stmt string
+	if len(b.Statements) > 0 {
+		stmt = b.Statements[0]
+	}
+	o.observe(ctx, "BATCH", stmt, b.Keyspace, b.Host, b.Attempt, b.End.Sub(b.Start), b.Err)
+}
+
+// ObserveConnect implements gocql.ConnectObserver.
+func (o *observer) ObserveConnect(c gocql.ObservedConnect) {
+	elapsed := c.End.Sub(c.Start)
+	connectLatency.WithLabelValues(hostAddr(c.Host), result(c.Err)).Observe(elapsed.Seconds())
+	if c.Err != nil {
+		slog.Warn("failed to connect to scylla host", "host", hostAddr(c.Host), "duration", elapsed, "error", c.Err)
+	}
+}
+
+func (o *observer) observe(ctx context.Context, op, stmt, keyspace string, host *gocql.HostInfo, attempt int, elapsed time.Duration, err error) {
+	stmt = normalizeStatement(stmt)
+	addr, dc := hostAddr(host), ""
+	if host != nil {
+		dc = host.DataCenter()
+	}
+
+	queryLatency.WithLabelValues(op, stmt).Observe(elapsed.Seconds())
+	hostRequests.WithLabelValues(addr, dc, result(err)).Inc()
+	if err != nil {
+		queryErrors.WithLabelValues(op, stmt).Inc()
+	}
+	if attempt > 0 {
+		queryRetries.WithLabelValues(op, stmt).Inc()
+	}
+
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		attrs := []attribute.KeyValue{
+			attribute.String("db.scylla.host", addr),
+			attribute.String("db.scylla.datacenter", dc),
+			attribute.Int("db.scylla.attempt", attempt),
+			attribute.Int64("db.scylla.duration_us", elapsed.Microseconds()),
+		}
+		if err != nil {
+			attrs = append(attrs, attribute.String("error", err.Error()))
+		}
+		span.AddEvent("scylla attempt", trace.WithAttributes(attrs...))
+	}
+
+	// Bound values are never logged, they may hold personal data.
+	if o.slowQueryThreshold > 0 && elapsed >= o.slowQueryThreshold {
+		slog.WarnContext(ctx, "slow scylla query",
+			"op", op,
+			"statement", stmt,
+			"keyspace", keyspace,
+			"host", addr,
+			"attempt", attempt,
+			"duration", elapsed,
+			"error", err)
+	}
+}
+
+// statementOp returns the CQL verb of stmt, e.g. "SELECT".
+func statementOp(stmt string) string {
+	op, _, _ := strings.Cut(strings.TrimSpace(stmt), " ")
+	return strings.ToUpper(op)
+}
+
+// normalizeStatement collapses whitespace so that the same statement written
+// across several lines maps to a single label value. Statements are expected
+// to use bind markers, so their number is bounded.
+func normalizeStatement(stmt string) string {
+	return strings.Join(strings.Fields(stmt), " ")
+}
+
+func hostAddr(h *gocql.HostInfo) string {
+	if h == nil {
+		return ""
+	}
+	return h.HostnameAndPort()
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
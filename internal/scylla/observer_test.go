@@ -0,0 +1,97 @@
+package scylla
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterValue(t *testing.T, c *prometheus.CounterVec, labels ...string) float64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := c.WithLabelValues(labels...).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestObserver(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	o := &observer{slowQueryThreshold: 10 * time.Millisecond}
+	stmt := "SELECT * FROM payments\n\tWHERE customer = ?"
+	label := "SELECT * FROM payments WHERE customer = ?"
+	start := time.Now()
+
+	t.Run("errors_and_retries", func(t *testing.T) {
+		errorsBefore := counterValue(t, queryErrors, "SELECT", label)
+		retriesBefore := counterValue(t, queryRetries, "SELECT", label)
+
+		o.ObserveQuery(ctx, gocql.ObservedQuery{Statement: stmt, Start: start, End: start, Err: errors.New("timeout")})
+		o.ObserveQuery(ctx, gocql.ObservedQuery{Statement: stmt, Start: start, End: start, Attempt: 1})
+
+		if got := counterValue(t, queryErrors, "SELECT", label) - errorsBefore; got != 1 {
+			t.Errorf("expected 1 error recorded, got %v", got)
+		}
+		if got := counterValue(t, queryRetries, "SELECT", label) - retriesBefore; got != 1 {
+			t.Errorf("expected 1 retry recorded, got %v", got)
+		}
+	})
+
+	t.Run("slow_query", func(t *testing.T) {
+		buf.Reset()
+
+		o.ObserveQuery(ctx, gocql.ObservedQuery{
+			Statement: stmt,
+			Values:    []any{"top secret"},
+			Start:     start,
+			End:       start.Add(time.Second),
+		})
+
+		out := buf.String()
+		if !strings.Contains(out, "slow scylla query") {
+			t.Fatalf("expected slow query log, got %q", out)
+		}
+		if strings.Contains(out, "top secret") {
+			t.Errorf("expected values not to be logged, got %q", out)
+		}
+	})
+
+	t.Run("fast_query", func(t *testing.T) {
+		buf.Reset()
+
+		o.ObserveBatch(ctx, gocql.ObservedBatch{Statements: []string{stmt}, Start: start, End: start})
+		if buf.Len() != 0 {
+			t.Errorf("expected no log output, got %q", buf.String())
+		}
+	})
+}
+
+func TestConfig_SpeculativeExecution(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	if sp := cfg.SpeculativeExecution(); sp != nil {
+		t.Errorf("expected speculative execution to be disabled, got %#v", sp)
+	}
+
+	cfg.SpeculativeAttempts = 2
+	cfg.SpeculativeDelay = 50 * time.Millisecond
+	sp := cfg.SpeculativeExecution()
+	if sp == nil || sp.Attempts() != 2 || sp.Delay() != 50*time.Millisecond {
+		t.Errorf("unexpected speculative execution policy %#v", sp)
+	}
+}
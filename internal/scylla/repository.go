@@ -0,0 +1,370 @@
+package scylla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans of table operations.
+var tracer = otel.Tracer("github.com/paveletto99/microservice-blueprint/internal/scylla")
+
+// ErrNotFound is returned when a lookup by primary key matches no row.
+var ErrNotFound = errors.New("scylla: not found")
+
+// Repository is the storage contract of a read-model of rows of type T, keyed
+// by a primary key of partition key columns followed by clustering columns.
+// Table implements it over a Scylla table; other read-models (caches, fakes)
+// may implement it too.
+type Repository[T any] interface {
+	// Get returns the row with the full primary key, or ErrNotFound.
+	Get(ctx context.Context, key ...any) (*T, error)
+
+	// List returns all rows of the partition, in clustering order.
+	List(ctx context.Context, partitionKey ...any) ([]*T, error)
+
+	// ListPage returns one page of the partition, in clustering order, and the
+	// paging state of the next page, which is empty after the last page.
+	ListPage(ctx context.Context, page Page, partitionKey ...any) ([]*T, []byte, error)
+
+	// Put inserts row, replacing any row with the same primary key.
+	Put(ctx context.Context, row *T) error
+
+	// PutIfNotExists inserts row unless one with the same primary key exists,
+	// reporting whether it was inserted.
+	PutIfNotExists(ctx context.Context, row *T) (bool, error)
+
+	// Delete removes the row with the full primary key. Deleting a missing row
+	// is not an error.
+	Delete(ctx context.Context, key ...any) error
+}
+
+// Page selects a page of results.
+type Page struct {
+	// Size is the maximum number of rows returned.
+	Size int
+
+	// State is the paging state returned with the previous page, or empty for
+	// the first page. It is opaque and should only reach clients wrapped in a
+	// signed token, see package pagetoken.
+	State []byte
+}
+
+// TableDef describes a table that rows of a struct type map to.
+type TableDef struct {
+	// Name is the table name, optionally qualified with a keyspace.
+	Name string
+
+	// PartitionKey and ClusteringKey are the columns of the primary key, in
+	// declaration order.
+	PartitionKey  []string
+	ClusteringKey []string
+
+	// TTL, if set, is applied to every row written through the table.
+	TTL time.Duration
+
+	// Speculative, if set, is the speculative execution policy of idempotent
+	// queries on the table, e.g. DB.Speculative. gocql never speculates on
+	// queries that are not idempotent.
+	Speculative gocql.SpeculativeExecutionPolicy
+
+	// NonIdempotentWrites marks Put and Delete as unsafe to execute more than
+	// once, e.g. because the row holds counters or a column defaults to now().
+	// Reads are always idempotent and lightweight transactions never are.
+	NonIdempotentWrites bool
+}
+
+// primaryKey returns the partition key columns followed by the clustering
+// columns.
+func (d *TableDef) primaryKey() []string {
+	return append(append([]string(nil), d.PartitionKey...), d.ClusteringKey...)
+}
+
+// Table is a Repository over a Scylla table.
+//
+// The CQL for each operation is generated once, when the table is created, and
+// reused verbatim for every call. Queries with bind values are prepared by
+// gocql and cached per session under their statement text, so each statement
+// is prepared only once per connection.
+type Table[T any] struct {
+	session Session
+	def     TableDef
+	mapper  *mapper
+	stmts   statements
+}
+
+// statements are the generated CQL statements of a table.
+type statements struct {
+	get            string
+	list           string
+	insert         string
+	insertIfAbsent string
+	delete         string
+}
+
+// Compile-time check that Table implements Repository.
+var _ Repository[struct{ ID int }] = (*Table[struct{ ID int }])(nil)
+
+// NewTable returns a Table mapping rows of type T to def. Struct fields are
+// mapped to columns using the `cql` tag, see mapper.
+func NewTable[T any](session Session, def TableDef) (*Table[T], error) {
+	if def.Name == "" {
+		return nil, fmt.Errorf("scylla: table name is required")
+	}
+	if len(def.PartitionKey) == 0 {
+		return nil, fmt.Errorf("scylla: table %s: partition key is required", def.Name)
+	}
+
+	m, err := newMapper[T]()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range def.primaryKey() {
+		if !m.has(c) {
+			return nil, fmt.Errorf("scylla: table %s: key column %q is not mapped by %s", def.Name, c, m.typ)
+		}
+	}
+
+	return &Table[T]{
+		session: session,
+		def:     def,
+		mapper:  m,
+		stmts:   buildStatements(&def, m.columns),
+	}, nil
+}
+
+func buildStatements(def *TableDef, columns []string) statements {
+	cols := strings.Join(columns, ", ")
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", def.Name, cols, marks)
+	var using string
+	if def.TTL > 0 {
+		using = fmt.Sprintf(" USING TTL %d", int64(def.TTL/time.Second))
+	}
+
+	return statements{
+		get:            fmt.Sprintf("SELECT %s FROM %s WHERE %s", cols, def.Name, whereEqual(def.primaryKey())),
+		list:           fmt.Sprintf("SELECT %s FROM %s WHERE %s", cols, def.Name, whereEqual(def.PartitionKey)),
+		insert:         insert + using,
+		insertIfAbsent: insert + " IF NOT EXISTS" + using,
+		delete:         fmt.Sprintf("DELETE FROM %s WHERE %s", def.Name, whereEqual(def.primaryKey())),
+	}
+}
+
+func whereEqual(columns []string) string {
+	conds := make([]string, len(columns))
+	for i, c := range columns {
+		conds[i] = c + " = ?"
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// Get implements Repository.
+func (t *Table[T]) Get(ctx context.Context, key ...any) (_ *T, err error) {
+	if err := t.checkKey(key, len(t.def.PartitionKey)+len(t.def.ClusteringKey)); err != nil {
+		return nil, err
+	}
+	ctx, end := t.startSpan(ctx, "get")
+	defer func() { end(err) }()
+
+	row := new(T)
+	iter := t.session.Iter(ctx, t.statement(t.stmts.get, true, key...))
+	found := iter.Scan(t.mapper.pointers(reflect.ValueOf(row).Elem(), t.mapper.columns)...)
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("scylla: get from %s: %w", t.def.Name, err)
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return row, nil
+}
+
+// List implements Repository.
+func (t *Table[T]) List(ctx context.Context, partitionKey ...any) (_ []*T, err error) {
+	if err := t.checkKey(partitionKey, len(t.def.PartitionKey)); err != nil {
+		return nil, err
+	}
+	ctx, end := t.startSpan(ctx, "list")
+	defer func() { end(err) }()
+
+	iter := t.session.Iter(ctx, t.statement(t.stmts.list, true, partitionKey...))
+
+	var rows []*T
+	for {
+		row := new(T)
+		if !iter.Scan(t.mapper.pointers(reflect.ValueOf(row).Elem(), t.mapper.columns)...) {
+			break
+		}
+		rows = append(rows, row)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("scylla: list from %s: %w", t.def.Name, err)
+	}
+	return rows, nil
+}
+
+// ListPage implements Repository.
+func (t *Table[T]) ListPage(ctx context.Context, page Page, partitionKey ...any) (_ []*T, _ []byte, err error) {
+	if err := t.checkKey(partitionKey, len(t.def.PartitionKey)); err != nil {
+		return nil, nil, err
+	}
+	if page.Size <= 0 {
+		return nil, nil, fmt.Errorf("scylla: page size must be positive")
+	}
+	ctx, end := t.startSpan(ctx, "list_page")
+	defer func() { end(err) }()
+
+	stmt := t.statement(t.stmts.list, true, partitionKey...)
+	stmt.PageSize, stmt.PageState = page.Size, page.State
+	iter := t.session.Iter(ctx, stmt)
+	next := iter.PageState()
+
+	rows := make([]*T, 0, iter.NumRows())
+	for {
+		row := new(T)
+		if !iter.Scan(t.mapper.pointers(reflect.ValueOf(row).Elem(), t.mapper.columns)...) {
+			break
+		}
+		rows = append(rows, row)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, nil, fmt.Errorf("scylla: list from %s: %w", t.def.Name, err)
+	}
+	return rows, next, nil
+}
+
+// Put implements Repository.
+func (t *Table[T]) Put(ctx context.Context, row *T) (err error) {
+	ctx, end := t.startSpan(ctx, "put")
+	defer func() { end(err) }()
+
+	if err := t.session.Exec(ctx, t.statement(t.stmts.insert, !t.def.NonIdempotentWrites, t.rowValues(row)...)); err != nil {
+		return fmt.Errorf("scylla: insert into %s: %w", t.def.Name, err)
+	}
+	return nil
+}
+
+// PutIfNotExists implements Repository using a lightweight transaction.
+func (t *Table[T]) PutIfNotExists(ctx context.Context, row *T) (_ bool, err error) {
+	ctx, end := t.startSpan(ctx, "put_if_not_exists")
+	defer func() { end(err) }()
+
+	applied, err := t.session.ExecCAS(ctx, t.statement(t.stmts.insertIfAbsent, false, t.rowValues(row)...))
+	if err != nil {
+		return false, fmt.Errorf("scylla: insert into %s: %w", t.def.Name, err)
+	}
+	return applied, nil
+}
+
+// Delete implements Repository.
+func (t *Table[T]) Delete(ctx context.Context, key ...any) (err error) {
+	if err := t.checkKey(key, len(t.def.PartitionKey)+len(t.def.ClusteringKey)); err != nil {
+		return err
+	}
+	ctx, end := t.startSpan(ctx, "delete")
+	defer func() { end(err) }()
+
+	if err := t.session.Exec(ctx, t.statement(t.stmts.delete, !t.def.NonIdempotentWrites, key...)); err != nil {
+		return fmt.Errorf("scylla: delete from %s: %w", t.def.Name, err)
+	}
+	return nil
+}
+
+// AddPut adds the insert of row to b.
+func (t *Table[T]) AddPut(b *Batch, row *T) {
+	b.stmts = append(b.stmts, t.statement(t.stmts.insert, !t.def.NonIdempotentWrites, t.rowValues(row)...))
+}
+
+// AddDelete adds the delete of the row with the full primary key to b.
+func (t *Table[T]) AddDelete(b *Batch, key ...any) error {
+	if err := t.checkKey(key, len(t.def.PartitionKey)+len(t.def.ClusteringKey)); err != nil {
+		return err
+	}
+	b.stmts = append(b.stmts, t.statement(t.stmts.delete, !t.def.NonIdempotentWrites, key...))
+	return nil
+}
+
+// statement returns stmt bound to values, marked with its idempotency and the
+// table's speculative execution policy.
+func (t *Table[T]) statement(stmt string, idempotent bool, values ...any) *Statement {
+	return &Statement{
+		CQL:         stmt,
+		Values:      values,
+		Idempotent:  idempotent,
+		Speculative: t.def.Speculative,
+	}
+}
+
+// startSpan starts the span of an operation on the table. The session's
+// observer annotates it with every attempt, see observer.
+func (t *Table[T]) startSpan(ctx context.Context, op string) (context.Context, func(error)) {
+	ctx, span := tracer.Start(ctx, "scylla."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "scylla"),
+			attribute.String("db.scylla.table", t.def.Name),
+		))
+	return ctx, func(err error) {
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (t *Table[T]) rowValues(row *T) []any {
+	return t.mapper.values(reflect.ValueOf(row).Elem(), t.mapper.columns)
+}
+
+func (t *Table[T]) checkKey(key []any, want int) error {
+	if len(key) != want {
+		return fmt.Errorf("scylla: table %s: expected %d key values, got %d", t.def.Name, want, len(key))
+	}
+	return nil
+}
+
+// Batch groups writes to one or more tables so they are applied together.
+type Batch struct {
+	ctx     context.Context
+	session Session
+	typ     gocql.BatchType
+	stmts   []*Statement
+}
+
+// NewBatch starts a batch of the given type. Logged batches are atomic across
+// partitions; unlogged batches are cheaper and best kept to a single
+// partition.
+func NewBatch(ctx context.Context, session Session, typ gocql.BatchType) *Batch {
+	return &Batch{
+		ctx:     ctx,
+		session: session,
+		typ:     typ,
+	}
+}
+
+// Size returns the number of statements in the batch.
+func (b *Batch) Size() int {
+	return len(b.stmts)
+}
+
+// Exec applies the batch. An empty batch is a no-op.
+func (b *Batch) Exec() error {
+	if len(b.stmts) == 0 {
+		return nil
+	}
+	if err := b.session.ExecBatch(b.ctx, b.typ, b.stmts); err != nil {
+		return fmt.Errorf("scylla: batch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package scylla
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type embedded struct {
+	CreatedAt time.Time
+}
+
+type payment struct {
+	embedded
+	BillID   int64  `cql:"bill_id"`
+	Customer string `cql:"customer"`
+	Amount   int64
+	Ignored  string `cql:"-"`
+	internal string
+}
+
+func TestNewMapper(t *testing.T) {
+	t.Parallel()
+
+	m, err := newMapper[payment]()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"created_at", "bill_id", "customer", "amount"}
+	if !reflect.DeepEqual(m.columns, want) {
+		t.Errorf("expected columns %q, got %q", want, m.columns)
+	}
+
+	p := payment{BillID: 7, Customer: "c", Amount: 100}
+	if got := m.values(reflect.ValueOf(&p).Elem(), []string{"bill_id", "amount"}); !reflect.DeepEqual(got, []any{int64(7), int64(100)}) {
+		t.Errorf("unexpected values %v", got)
+	}
+
+	ptrs := m.pointers(reflect.ValueOf(&p).Elem(), []string{"customer"})
+	*(ptrs[0].(*string)) = "d"
+	if p.Customer != "d" {
+		t.Errorf("expected pointer to Customer, got %v", p.Customer)
+	}
+}
+
+func TestNewMapper_errors(t *testing.T) {
+	t.Parallel()
+
+	type duplicate struct {
+		A string `cql:"x"`
+		B string `cql:"x"`
+	}
+	if _, err := newMapper[duplicate](); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("expected duplicate column error, got %v", err)
+	}
+	if _, err := newMapper[string](); err == nil {
+		t.Errorf("expected error for non-struct row type")
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"ID":              "id",
+		"BillID":          "bill_id",
+		"PictureLocation": "picture_location",
+		"HTTPServer":      "http_server",
+		"name":            "name",
+	}
+	for in, want := range cases {
+		if got := toSnakeCase(in); got != want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNewTable(t *testing.T) {
+	t.Parallel()
+
+	table, err := NewTable[payment](nil, TableDef{
+		Name:          "payments.by_customer",
+		PartitionKey:  []string{"customer"},
+		ClusteringKey: []string{"bill_id"},
+		TTL:           24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := statements{
+		get:            "SELECT created_at, bill_id, customer, amount FROM payments.by_customer WHERE customer = ? AND bill_id = ?",
+		list:           "SELECT created_at, bill_id, customer, amount FROM payments.by_customer WHERE customer = ?",
+		insert:         "INSERT INTO payments.by_customer (created_at, bill_id, customer, amount) VALUES (?, ?, ?, ?) USING TTL 86400",
+		insertIfAbsent: "INSERT INTO payments.by_customer (created_at, bill_id, customer, amount) VALUES (?, ?, ?, ?) IF NOT EXISTS USING TTL 86400",
+		delete:         "DELETE FROM payments.by_customer WHERE customer = ? AND bill_id = ?",
+	}
+	if table.stmts != want {
+		t.Errorf("expected statements\n%+v\ngot\n%+v", want, table.stmts)
+	}
+
+	if _, err := NewTable[payment](nil, TableDef{Name: "t", PartitionKey: []string{"missing"}}); err == nil {
+		t.Errorf("expected error for unmapped key column")
+	}
+	if _, err := table.Get(context.Background(), "only-partition"); err == nil {
+		t.Errorf("expected error for incomplete primary key")
+	}
+}
@@ -0,0 +1,159 @@
+package scylla
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/gocql/gocql"
+)
+
+// Session is the subset of a Scylla session the repository layer needs. It is
+// implemented over gocql by NewSession, and in memory by MemorySession.
+type Session interface {
+	// Exec executes a statement that returns no rows.
+	Exec(ctx context.Context, s *Statement) error
+
+	// Iter executes a statement and iterates over its rows. If s.PageSize is
+	// set, only that page is returned, see Statement.
+	Iter(ctx context.Context, s *Statement) Iter
+
+	// ExecCAS executes a lightweight transaction and reports whether it was
+	// applied.
+	ExecCAS(ctx context.Context, s *Statement) (bool, error)
+
+	// ExecBatch applies statements as one batch of type typ.
+	ExecBatch(ctx context.Context, typ gocql.BatchType, stmts []*Statement) error
+}
+
+// Statement is a CQL statement with its bound values and execution options.
+type Statement struct {
+	CQL    string
+	Values []any
+
+	// Idempotent marks the statement as safe to execute more than once, which
+	// allows retries and speculative execution.
+	Idempotent bool
+
+	// Speculative, if set, is the speculative execution policy of the
+	// statement. It only applies to idempotent statements.
+	Speculative gocql.SpeculativeExecutionPolicy
+
+	// PageSize, if positive, limits the rows returned by Iter to a single page
+	// starting at PageState.
+	PageSize  int
+	PageState []byte
+}
+
+// Iter iterates over the rows of a query. *gocql.Iter implements it.
+type Iter interface {
+	// Scan copies the columns of the next row into dest, reporting whether
+	// there was one.
+	Scan(dest ...any) bool
+
+	// PageState returns the paging state of the next page, empty after the
+	// last page.
+	PageState() []byte
+
+	// NumRows returns the number of rows in the current page.
+	NumRows() int
+
+	// Close releases the iterator and returns any error of the query.
+	Close() error
+}
+
+// NewSession returns a Session over s.
+func NewSession(s *gocql.Session) Session {
+	return &gocqlSession{s: s}
+}
+
+type gocqlSession struct {
+	s *gocql.Session
+}
+
+func (g *gocqlSession) query(ctx context.Context, s *Statement) *gocql.Query {
+	q := g.s.Query(s.CQL, s.Values...).WithContext(ctx).Idempotent(s.Idempotent)
+	if s.Idempotent && s.Speculative != nil {
+		q = q.SetSpeculativeExecutionPolicy(s.Speculative)
+	}
+	return q
+}
+
+func (g *gocqlSession) Exec(ctx context.Context, s *Statement) error {
+	return g.query(ctx, s).Exec()
+}
+
+func (g *gocqlSession) Iter(ctx context.Context, s *Statement) Iter {
+	q := g.query(ctx, s)
+	if s.PageSize > 0 {
+		// Setting the page state, even when empty, disables automatic paging
+		// so the iterator stops at the end of this page.
+		q = q.PageSize(s.PageSize).PageState(s.PageState)
+	}
+	return q.Iter()
+}
+
+func (g *gocqlSession) ExecCAS(ctx context.Context, s *Statement) (bool, error) {
+	// The existing row is returned when the statement is not applied; it is
+	// not needed, but must be scanned somewhere.
+	existing := make(map[string]any)
+	return g.query(ctx, s).MapScanCAS(existing)
+}
+
+func (g *gocqlSession) ExecBatch(ctx context.Context, typ gocql.BatchType, stmts []*Statement) error {
+	b := g.s.NewBatch(typ).WithContext(ctx)
+	idempotent := true
+	var speculative gocql.SpeculativeExecutionPolicy
+	for _, s := range stmts {
+		b.Entries = append(b.Entries, gocql.BatchEntry{
+			Stmt:       s.CQL,
+			Args:       s.Values,
+			Idempotent: s.Idempotent,
+		})
+		idempotent = idempotent && s.Idempotent
+		if speculative == nil {
+			speculative = s.Speculative
+		}
+	}
+	if idempotent && speculative != nil {
+		b.SpeculativeExecutionPolicy(speculative)
+	}
+	return g.s.ExecuteBatch(b)
+}
+
+// DB is a connection to a Scylla cluster.
+type DB struct {
+	Session *gocql.Session
+
+	// Speculative is the configured speculative execution policy, nil if
+	// disabled. Pass it to TableDef.Speculative to apply it to a table.
+	Speculative gocql.SpeculativeExecutionPolicy
+}
+
+// NewFromEnv connects to the cluster described by cfg.
+func NewFromEnv(ctx context.Context, cfg *Config) (*DB, error) {
+	cluster, err := cfg.ClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scylla session: %w", err)
+	}
+	return &DB{
+		Session:     session,
+		Speculative: cfg.SpeculativeExecution(),
+	}, nil
+}
+
+// Tables returns the Session that tables of the repository layer use.
+func (db *DB) Tables() Session {
+	return NewSession(db.Session)
+}
+
+// Close closes the session and all of its connections.
+func (db *DB) Close(ctx context.Context) {
+	slog.InfoContext(ctx, "closing scylla session")
+	db.Session.Close()
+}
@@ -3,8 +3,14 @@ package serverenv
 
 import (
 	"context"
+	"log/slog"
+	"sync"
 
+	"github.com/paveletto99/microservice-blueprint/internal/scylla"
 	"github.com/paveletto99/microservice-blueprint/pkg/database"
+	"github.com/paveletto99/microservice-blueprint/pkg/observability"
+	"github.com/paveletto99/microservice-blueprint/pkg/secrets"
+	"github.com/paveletto99/microservice-blueprint/pkg/storage"
 )
 
 // "context"
@@ -16,13 +22,18 @@ import (
 
 // ServerEnv represents latent environment configuration for servers in this application.
 type ServerEnv struct {
-	database *database.DB
+	database      *database.DB
+	scylla        *scylla.DB
+	secretManager secrets.SecretManager
+	blobstore     storage.Blobstore
+
+	observabilityExporter observability.Exporter
+
+	closers   []func(context.Context) error
+	closersMu sync.Mutex
 	// authorizedAppProvider authorizedapp.Provider
-	// blobstore             storage.Blobstore
 	// exporter              metrics.ExporterFromContext
 	// keyManager            keys.KeyManager
-	// secretManager         secrets.SecretManager
-	// observabilityExporter observability.Exporter
 }
 
 // Option defines function types to modify the ServerEnv on creation.
@@ -52,6 +63,22 @@ func WithDatabase(db *database.DB) Option {
 	}
 }
 
+// WithScylla attaches a Scylla session to the environment.
+func WithScylla(db *scylla.DB) Option {
+	return func(s *ServerEnv) *ServerEnv {
+		s.scylla = db
+		return s
+	}
+}
+
+// WithSecretManager creates an Option to install a specific secret manager to use.
+func WithSecretManager(sm secrets.SecretManager) Option {
+	return func(s *ServerEnv) *ServerEnv {
+		s.secretManager = sm
+		return s
+	}
+}
+
 // // WithAuthorizedAppProvider installs a provider for an authorized app.
 // func WithAuthorizedAppProvider(p authorizedapp.Provider) Option {
 // 	return func(s *ServerEnv) *ServerEnv {
@@ -68,14 +95,6 @@ func WithDatabase(db *database.DB) Option {
 // 	}
 // }
 
-// // WithSecretManager creates an Option to install a specific secret manager to use.
-// func WithSecretManager(sm secrets.SecretManager) Option {
-// 	return func(s *ServerEnv) *ServerEnv {
-// 		s.secretManager = sm
-// 		return s
-// 	}
-// }
-
 // // WithKeyManager creates an Option to install a specific KeyManager to use for signing requests.
 // func WithKeyManager(km keys.KeyManager) Option {
 // 	return func(s *ServerEnv) *ServerEnv {
@@ -84,33 +103,33 @@ func WithDatabase(db *database.DB) Option {
 // 	}
 // }
 
-// // WithBlobStorage creates an Option to install a specific Blob storage system.
-// func WithBlobStorage(sto storage.Blobstore) Option {
-// 	return func(s *ServerEnv) *ServerEnv {
-// 		s.blobstore = sto
-// 		return s
-// 	}
-// }
+// WithBlobStorage creates an Option to install a specific Blob storage system.
+func WithBlobStorage(sto storage.Blobstore) Option {
+	return func(s *ServerEnv) *ServerEnv {
+		s.blobstore = sto
+		return s
+	}
+}
 
-// // WithObservabilityExporter creates an Option to install a specific observability exporter system.
-// func WithObservabilityExporter(oe observability.Exporter) Option {
-// 	return func(s *ServerEnv) *ServerEnv {
-// 		s.observabilityExporter = oe
-// 		return s
-// 	}
-// }
+// WithObservabilityExporter creates an Option to install a specific observability exporter system.
+func WithObservabilityExporter(oe observability.Exporter) Option {
+	return func(s *ServerEnv) *ServerEnv {
+		s.observabilityExporter = oe
+		return s
+	}
+}
 
-// func (s *ServerEnv) SecretManager() secrets.SecretManager {
-// 	return s.secretManager
-// }
+func (s *ServerEnv) SecretManager() secrets.SecretManager {
+	return s.secretManager
+}
 
 // func (s *ServerEnv) KeyManager() keys.KeyManager {
 // 	return s.keyManager
 // }
 
-// func (s *ServerEnv) Blobstore() storage.Blobstore {
-// 	return s.blobstore
-// }
+func (s *ServerEnv) Blobstore() storage.Blobstore {
+	return s.blobstore
+}
 
 // func (s *ServerEnv) AuthorizedAppProvider() authorizedapp.Provider {
 // 	return s.authorizedAppProvider
@@ -120,9 +139,23 @@ func (s *ServerEnv) Database() *database.DB {
 	return s.database
 }
 
-// func (s *ServerEnv) ObservabilityExporter() observability.Exporter {
-// 	return s.observabilityExporter
-// }
+func (s *ServerEnv) Scylla() *scylla.DB {
+	return s.scylla
+}
+
+func (s *ServerEnv) ObservabilityExporter() observability.Exporter {
+	return s.observabilityExporter
+}
+
+// RegisterCloser registers f to be called when the env is closed, e.g. to
+// close the clients of other services. Closers run first, most recent first,
+// while the database and the exporter are still open.
+func (s *ServerEnv) RegisterCloser(f func(context.Context) error) {
+	s.closersMu.Lock()
+	defer s.closersMu.Unlock()
+
+	s.closers = append(s.closers, f)
+}
 
 // func (s *ServerEnv) GetKeyManager() keys.KeyManager {
 // 	return s.keyManager
@@ -155,15 +188,30 @@ func (s *ServerEnv) Close(ctx context.Context) error {
 		return nil
 	}
 
+	s.closersMu.Lock()
+	closers := s.closers
+	s.closers = nil
+	s.closersMu.Unlock()
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i](ctx); err != nil {
+			slog.ErrorContext(ctx, "failed to close resource", "error", err)
+		}
+	}
+
 	if s.database != nil {
 		s.database.Close(ctx)
 	}
 
-	// if s.observabilityExporter != nil {
-	// 	if err := s.observabilityExporter.Close(); err != nil {
-	// 		return nil
-	// 	}
-	// }
+	if s.scylla != nil {
+		s.scylla.Close(ctx)
+	}
+
+	// Closed last, so that spans of the shutdown above are flushed too.
+	if s.observabilityExporter != nil {
+		if err := s.observabilityExporter.Close(); err != nil {
+			slog.ErrorContext(ctx, "failed to close observability exporter", "error", err)
+		}
+	}
 
 	return nil
 }
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/paveletto99/microservice-blueprint/internal/scylla"
 	"github.com/paveletto99/microservice-blueprint/internal/serverenv"
 	"github.com/paveletto99/microservice-blueprint/pkg/database"
+	"github.com/paveletto99/microservice-blueprint/pkg/observability"
+	"github.com/paveletto99/microservice-blueprint/pkg/secrets"
+	"github.com/paveletto99/microservice-blueprint/pkg/storage"
 	"github.com/sethvargo/go-envconfig"
 )
 
@@ -16,6 +20,31 @@ type DatabaseConfigProvider interface {
 	DatabaseConfig() *database.Config
 }
 
+// ScyllaConfigProvider ensures that the environment config can provide a
+// Scylla config.
+type ScyllaConfigProvider interface {
+	ScyllaConfig() *scylla.Config
+}
+
+// ObservabilityExporterConfigProvider signals that the config knows how to
+// configure an observability exporter.
+type ObservabilityExporterConfigProvider interface {
+	ObservabilityExporterConfig() *observability.Config
+}
+
+// SecretManagerConfigProvider signals that the config knows how to configure a
+// secret manager. Values of the form "secret://<name>" are then resolved
+// through it.
+type SecretManagerConfigProvider interface {
+	SecretManagerConfig() *secrets.Config
+}
+
+// BlobstoreConfigProvider signals that the config knows how to configure a
+// blobstore.
+type BlobstoreConfigProvider interface {
+	BlobstoreConfig() *storage.Config
+}
+
 // Setup runs common initialization code for all servers. See SetupWith.
 func Setup(ctx context.Context, config interface{}) (*serverenv.ServerEnv, error) {
 	return SetupWith(ctx, config, envconfig.OsLookuper())
@@ -34,6 +63,34 @@ func SetupWith(ctx context.Context, config interface{}, l envconfig.Lookuper) (*
 	// Build a list of options to pass to the server env.
 	var serverEnvOpts []serverenv.Option
 
+	// Configure the secret manager first, so that values of the form
+	// "secret://<name>" can be resolved through it when processing the rest of
+	// the configuration.
+	if provider, ok := config.(SecretManagerConfigProvider); ok {
+		slog.Info("configuring secret manager")
+
+		smConfig := provider.SecretManagerConfig()
+		if err := envconfig.ProcessWith(ctx, &envconfig.Config{
+			Target:   smConfig,
+			Lookuper: l,
+		}); err != nil {
+			return nil, fmt.Errorf("unable to process secret manager env: %w", err)
+		}
+
+		sm, err := secrets.SecretManagerFor(ctx, smConfig)
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to secret manager: %w", err)
+		}
+
+		// Enable secret expansion for the remaining configuration.
+		mutators = append(mutators, secrets.Resolver(sm))
+
+		// Update serverEnv setup.
+		serverEnvOpts = append(serverEnvOpts, serverenv.WithSecretManager(sm))
+
+		slog.Info("secret manager", "type", smConfig.Type)
+	}
+
 	c := &envconfig.Config{
 		Target:   config,
 		Lookuper: l,
@@ -44,7 +101,25 @@ func SetupWith(ctx context.Context, config interface{}, l envconfig.Lookuper) (*
 	if err := envconfig.ProcessWith(ctx, c); err != nil {
 		return nil, fmt.Errorf("error loading environment variables: %w", err)
 	}
-	slog.Info("provided", "config", config)
+	// The processed config may hold resolved secrets, so only its type is logged.
+	slog.Info("provided", "config", fmt.Sprintf("%T", config))
+
+	// Setup the observability exporter before any connection, so that their
+	// telemetry is exported.
+	if provider, ok := config.(ObservabilityExporterConfigProvider); ok {
+		slog.Info("configuring observability exporter")
+
+		oeConfig := provider.ObservabilityExporterConfig()
+		oe, err := observability.NewFromEnv(ctx, oeConfig)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create observability exporter: %w", err)
+		}
+
+		// Update serverEnv setup.
+		serverEnvOpts = append(serverEnvOpts, serverenv.WithObservabilityExporter(oe))
+
+		slog.Info("observability exporter", "type", oeConfig.ExporterType)
+	}
 
 	// Setup the database connection.
 	if provider, ok := config.(DatabaseConfigProvider); ok {
@@ -53,6 +128,7 @@ func SetupWith(ctx context.Context, config interface{}, l envconfig.Lookuper) (*
 		dbConfig := provider.DatabaseConfig()
 		db, err := database.NewFromEnv(ctx, dbConfig)
 		if err != nil {
+			serverenv.New(ctx, serverEnvOpts...).Close(ctx)
 			return nil, fmt.Errorf("unable to connect to database: %w", err)
 		}
 
@@ -62,5 +138,40 @@ func SetupWith(ctx context.Context, config interface{}, l envconfig.Lookuper) (*
 		slog.Info("database", "config", dbConfig)
 	}
 
+	// Setup the Scylla session.
+	if provider, ok := config.(ScyllaConfigProvider); ok {
+		slog.Info("configuring scylla")
+
+		scyllaConfig := provider.ScyllaConfig()
+		db, err := scylla.NewFromEnv(ctx, scyllaConfig)
+		if err != nil {
+			// Don't leak connections opened above.
+			serverenv.New(ctx, serverEnvOpts...).Close(ctx)
+			return nil, fmt.Errorf("unable to connect to scylla: %w", err)
+		}
+
+		// Update serverEnv setup.
+		serverEnvOpts = append(serverEnvOpts, serverenv.WithScylla(db))
+
+		slog.Info("scylla", "hosts", scyllaConfig.Hosts, "keyspace", scyllaConfig.Keyspace)
+	}
+
+	// Setup the blobstore.
+	if provider, ok := config.(BlobstoreConfigProvider); ok {
+		slog.Info("configuring blobstore")
+
+		blobstoreConfig := provider.BlobstoreConfig()
+		blobstore, err := storage.BlobstoreFor(ctx, blobstoreConfig)
+		if err != nil {
+			serverenv.New(ctx, serverEnvOpts...).Close(ctx)
+			return nil, fmt.Errorf("unable to create blobstore: %w", err)
+		}
+
+		// Update serverEnv setup.
+		serverEnvOpts = append(serverEnvOpts, serverenv.WithBlobStorage(blobstore))
+
+		slog.Info("blobstore", "type", blobstoreConfig.Type)
+	}
+
 	return serverenv.New(ctx, serverEnvOpts...), nil
 }
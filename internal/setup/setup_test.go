@@ -0,0 +1,94 @@
+package setup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/secrets"
+	"github.com/paveletto99/microservice-blueprint/pkg/storage"
+	"github.com/sethvargo/go-envconfig"
+)
+
+type testConfig struct {
+	Secrets  secrets.Config
+	Password string `env:"PASSWORD"`
+}
+
+func (c *testConfig) SecretManagerConfig() *secrets.Config {
+	return &c.Secrets
+}
+
+func TestSetupWith_secrets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "scylla-password"), []byte("hunter2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var config testConfig
+	env, err := SetupWith(ctx, &config, envconfig.MapLookuper(map[string]string{
+		"SECRET_MANAGER":         "FILESYSTEM",
+		"SECRET_FILESYSTEM_ROOT": root,
+		"PASSWORD":               "secret://scylla-password",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close(ctx)
+
+	if config.Password != "hunter2" {
+		t.Errorf("expected secret to be resolved, got %q", config.Password)
+	}
+	if env.SecretManager() == nil {
+		t.Errorf("expected secret manager to be installed")
+	}
+	if env.Scylla() != nil || env.Database() != nil {
+		t.Errorf("expected no database connections")
+	}
+}
+
+type blobstoreConfig struct {
+	Blobstore storage.Config
+}
+
+func (c *blobstoreConfig) BlobstoreConfig() *storage.Config {
+	return &c.Blobstore
+}
+
+func TestSetupWith_blobstore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+
+	var config blobstoreConfig
+	env, err := SetupWith(ctx, &config, envconfig.MapLookuper(map[string]string{
+		"BLOBSTORE":                 "FILESYSTEM",
+		"BLOBSTORE_FILESYSTEM_ROOT": root,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close(ctx)
+
+	if _, ok := env.Blobstore().(*storage.Filesystem); !ok {
+		t.Errorf("expected a filesystem blobstore, got %T", env.Blobstore())
+	}
+
+	var invalid blobstoreConfig
+	if _, err := SetupWith(ctx, &invalid, envconfig.MapLookuper(map[string]string{
+		"BLOBSTORE": "FILESYSTEM",
+	})); err == nil || !strings.Contains(err.Error(), "BLOBSTORE_FILESYSTEM_ROOT") {
+		t.Errorf("expected an error about the missing root, got %v", err)
+	}
+
+	// The blobstore is never picked implicitly.
+	if _, err := SetupWith(ctx, &invalid, envconfig.MapLookuper(map[string]string{})); err == nil || !strings.Contains(err.Error(), "BLOBSTORE") {
+		t.Errorf("expected an error about the missing BLOBSTORE, got %v", err)
+	}
+}
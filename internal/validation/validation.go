@@ -0,0 +1,350 @@
+// Package validation enforces the constraints declared on request fields with
+// the (validate.field) option of internal/pb/validate.
+//
+// Validation is meant to run in the gRPC interceptors of this package, so that
+// handlers only receive well-formed requests and clients get every violation
+// as google.rpc.BadRequest details of an InvalidArgument status.
+package validation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	validatepb "github.com/paveletto99/microservice-blueprint/internal/pb/validate"
+)
+
+// Violation is a field that breaks one of its constraints.
+type Violation struct {
+	// Field is the path to the field, e.g. "amount.currency_code" or
+	// "statuses[1]".
+	Field       string
+	Description string
+}
+
+// Error is returned by Validate when a message breaks its constraints.
+type Error struct {
+	Violations []*Violation
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.Field+": "+v.Description)
+	}
+	return "invalid request: " + strings.Join(parts, "; ")
+}
+
+// GRPCStatus returns an InvalidArgument status carrying the violations as
+// BadRequest field violations. It lets status.Convert and handlers returning
+// the error as is produce the right status.
+func (e *Error) GRPCStatus() *status.Status {
+	br := &errdetails.BadRequest{}
+	for _, v := range e.Violations {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+
+	st := status.New(codes.InvalidArgument, e.Error())
+	if detailed, err := st.WithDetails(br); err == nil {
+		return detailed
+	}
+	return st
+}
+
+// Validate checks msg against the constraints declared in its descriptor,
+// including those of the messages it contains. It returns an *Error listing
+// every violation, or another error if the constraints themselves are
+// invalid.
+func Validate(msg proto.Message) error {
+	var violations []*Violation
+	if err := validateMessage(msg.ProtoReflect(), "", &violations); err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+// UnaryServerInterceptor validates the requests of unary RPCs.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := validateRequest(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor validates every message received on streams.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ServerStream: ss})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validateRequest(m)
+}
+
+// validateRequest validates req and converts the failure to a gRPC status.
+// Messages that are not protos are left to the handler.
+func validateRequest(req any) error {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+
+	err := Validate(msg)
+	if err == nil {
+		return nil
+	}
+	if verr, ok := err.(*Error); ok {
+		return verr.GRPCStatus().Err()
+	}
+	return status.Errorf(codes.Internal, "invalid constraints of %s: %s", msg.ProtoReflect().Descriptor().FullName(), err)
+}
+
+func validateMessage(m protoreflect.Message, prefix string, violations *[]*Violation) error {
+	rules, err := rulesFor(m.Descriptor())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range rules.fields {
+		path := prefix + string(f.fd.Name())
+
+		if f.rules != nil && f.rules.check(f.fd, m, path, violations) {
+			continue
+		}
+		if !f.nested || !m.Has(f.fd) {
+			continue
+		}
+
+		if f.fd.IsList() {
+			list := m.Get(f.fd).List()
+			for i := 0; i < list.Len(); i++ {
+				if err := validateMessage(list.Get(i).Message(), fmt.Sprintf("%s[%d].", path, i), violations); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := validateMessage(m.Get(f.fd).Message(), path+".", violations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageRules are the compiled constraints of a message type. fields only
+// lists the fields that have rules or may contain messages with rules.
+type messageRules struct {
+	fields []*fieldEntry
+}
+
+type fieldEntry struct {
+	fd     protoreflect.FieldDescriptor
+	rules  *fieldRules
+	nested bool
+}
+
+// cache maps message full names to their *messageRules.
+var cache sync.Map
+
+func rulesFor(md protoreflect.MessageDescriptor) (*messageRules, error) {
+	if r, ok := cache.Load(md.FullName()); ok {
+		return r.(*messageRules), nil
+	}
+
+	r := &messageRules{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		entry := &fieldEntry{
+			fd:     fd,
+			nested: fd.Message() != nil && !fd.IsMap(),
+		}
+
+		if pb, ok := proto.GetExtension(fd.Options(), validatepb.E_Field).(*validatepb.FieldRules); ok && pb != nil {
+			rules, err := compile(fd, pb, fd.IsList())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fd.FullName(), err)
+			}
+			entry.rules = rules
+		}
+
+		if entry.rules != nil || entry.nested {
+			r.fields = append(r.fields, entry)
+		}
+	}
+
+	cache.Store(md.FullName(), r)
+	return r, nil
+}
+
+// fieldRules are compiled FieldRules. They apply to a whole field if list is
+// true, or to a single value otherwise.
+type fieldRules struct {
+	pb      *validatepb.FieldRules
+	list    bool
+	pattern *regexp.Regexp
+	items   *fieldRules
+}
+
+func compile(fd protoreflect.FieldDescriptor, pb *validatepb.FieldRules, list bool) (*fieldRules, error) {
+	r := &fieldRules{pb: pb, list: list}
+
+	if list {
+		switch pb.GetType().(type) {
+		case nil:
+		case *validatepb.FieldRules_Repeated:
+			if items := pb.GetRepeated().GetItems(); items != nil {
+				var err error
+				if r.items, err = compile(fd, items, false); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("repeated field needs repeated rules")
+		}
+		return r, nil
+	}
+
+	kind := fd.Kind()
+	switch pb.GetType().(type) {
+	case nil:
+	case *validatepb.FieldRules_String_:
+		if kind != protoreflect.StringKind {
+			return nil, fmt.Errorf("string rules on a %s field", kind)
+		}
+		if p := pb.GetString_().GetPattern(); p != "" {
+			var err error
+			if r.pattern, err = regexp.Compile(p); err != nil {
+				return nil, fmt.Errorf("invalid pattern: %w", err)
+			}
+		}
+	case *validatepb.FieldRules_Int32:
+		if kind != protoreflect.Int32Kind && kind != protoreflect.Sint32Kind && kind != protoreflect.Sfixed32Kind {
+			return nil, fmt.Errorf("int32 rules on a %s field", kind)
+		}
+	case *validatepb.FieldRules_Int64:
+		if kind != protoreflect.Int64Kind && kind != protoreflect.Sint64Kind && kind != protoreflect.Sfixed64Kind {
+			return nil, fmt.Errorf("int64 rules on a %s field", kind)
+		}
+	case *validatepb.FieldRules_Enum:
+		if kind != protoreflect.EnumKind {
+			return nil, fmt.Errorf("enum rules on a %s field", kind)
+		}
+	case *validatepb.FieldRules_Repeated:
+		return nil, fmt.Errorf("repeated rules on a singular field")
+	}
+	return r, nil
+}
+
+// check checks field fd of m and appends its violations. It reports whether
+// the field is unset, in which case there is nothing left to check.
+func (r *fieldRules) check(fd protoreflect.FieldDescriptor, m protoreflect.Message, path string, violations *[]*Violation) bool {
+	if !m.Has(fd) {
+		if r.pb.GetRequired() {
+			*violations = append(*violations, &Violation{Field: path, Description: "value is required"})
+		}
+		return true
+	}
+
+	if !r.list {
+		r.checkValue(fd, m.Get(fd), path, violations)
+		return false
+	}
+
+	list := m.Get(fd).List()
+	if limit := r.pb.GetRepeated().MaxItems; limit != nil && uint64(list.Len()) > *limit {
+		*violations = append(*violations, &Violation{
+			Field:       path,
+			Description: fmt.Sprintf("value must contain at most %d items", *limit),
+		})
+	}
+	if r.items != nil {
+		for i := 0; i < list.Len(); i++ {
+			r.items.checkValue(fd, list.Get(i), fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+	}
+	return false
+}
+
+// checkValue checks a single value of field fd.
+func (r *fieldRules) checkValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, path string, violations *[]*Violation) {
+	violate := func(format string, args ...any) {
+		*violations = append(*violations, &Violation{Field: path, Description: fmt.Sprintf(format, args...)})
+	}
+
+	switch t := r.pb.GetType().(type) {
+	case *validatepb.FieldRules_String_:
+		s, rules := v.String(), t.String_
+		if n := uint64(utf8.RuneCountInString(s)); rules.MinLen != nil && n < *rules.MinLen {
+			violate("value length must be at least %d characters", *rules.MinLen)
+		}
+		if n := uint64(utf8.RuneCountInString(s)); rules.MaxLen != nil && n > *rules.MaxLen {
+			violate("value length must be at most %d characters", *rules.MaxLen)
+		}
+		if rules.MaxBytes != nil && uint64(len(s)) > *rules.MaxBytes {
+			violate("value length must be at most %d bytes", *rules.MaxBytes)
+		}
+		if r.pattern != nil && !r.pattern.MatchString(s) {
+			violate("value does not match regex pattern %q", rules.Pattern)
+		}
+
+	case *validatepb.FieldRules_Int32:
+		n, rules := int32(v.Int()), t.Int32
+		checkBounds(n, rules.Gt, rules.Gte, rules.Lt, rules.Lte, violate)
+
+	case *validatepb.FieldRules_Int64:
+		n, rules := v.Int(), t.Int64
+		checkBounds(n, rules.Gt, rules.Gte, rules.Lt, rules.Lte, violate)
+
+	case *validatepb.FieldRules_Enum:
+		n, rules := v.Enum(), t.Enum
+		if rules.DefinedOnly && fd.Enum().Values().ByNumber(n) == nil {
+			violate("value must be one of the defined enum values")
+		}
+		if slices.Contains(rules.NotIn, int32(n)) {
+			violate("value must not be in list %v", rules.NotIn)
+		}
+	}
+}
+
+func checkBounds[T int32 | int64](n T, gt, gte, lt, lte *T, violate func(string, ...any)) {
+	if gt != nil && n <= *gt {
+		violate("value must be greater than %d", *gt)
+	}
+	if gte != nil && n < *gte {
+		violate("value must be greater than or equal to %d", *gte)
+	}
+	if lt != nil && n >= *lt {
+		violate("value must be less than %d", *lt)
+	}
+	if lte != nil && n > *lte {
+		violate("value must be less than or equal to %d", *lte)
+	}
+}
@@ -0,0 +1,168 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	paymentv1 "github.com/paveletto99/microservice-blueprint/internal/pb/payment/v1"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	eur := func(amountMinor int64) *paymentv1.Money {
+		return &paymentv1.Money{CurrencyCode: "EUR", AmountMinor: amountMinor}
+	}
+
+	cases := []struct {
+		name string
+		msg  proto.Message
+		want []string
+	}{
+		{
+			name: "valid",
+			msg:  &paymentv1.CreatePaymentRequest{Amount: eur(100), MerchantId: "m1"},
+		},
+		{
+			name: "optional_fields_unset",
+			msg:  &paymentv1.ListPaymentsRequest{},
+		},
+		{
+			name: "required_message",
+			msg:  &paymentv1.CreatePaymentRequest{},
+			want: []string{"amount: value is required"},
+		},
+		{
+			name: "nested",
+			msg:  &paymentv1.CreatePaymentRequest{Amount: &paymentv1.Money{CurrencyCode: "euro", AmountMinor: -1}},
+			want: []string{
+				`amount.currency_code: value does not match regex pattern "^[A-Z]{3}$"`,
+				"amount.amount_minor: value must be greater than 0",
+			},
+		},
+		{
+			name: "max_bytes",
+			msg:  &paymentv1.CreatePaymentRequest{Amount: eur(1), MerchantId: strings.Repeat("é", 33)},
+			want: []string{"merchant_id: value length must be at most 64 bytes"},
+		},
+		{
+			name: "required_scalar",
+			msg:  &paymentv1.CancelPaymentRequest{Reason: "duplicate"},
+			want: []string{"bill_id: value is required"},
+		},
+		{
+			name: "int32_bounds",
+			msg:  &paymentv1.ListPaymentsRequest{PageSize: -1},
+			want: []string{"page_size: value must be greater than or equal to 0"},
+		},
+		{
+			name: "repeated_items",
+			msg: &paymentv1.ListPaymentsRequest{Statuses: []paymentv1.PaymentStatus{
+				paymentv1.PaymentStatus_PAYMENT_STATUS_PENDING,
+				paymentv1.PaymentStatus_PAYMENT_STATUS_UNSPECIFIED,
+				paymentv1.PaymentStatus(42),
+			}},
+			want: []string{
+				"statuses[1]: value must not be in list [0]",
+				"statuses[2]: value must be one of the defined enum values",
+			},
+		},
+		{
+			name: "max_items",
+			msg:  &paymentv1.ListPaymentsRequest{Statuses: make([]paymentv1.PaymentStatus, 7)},
+			want: []string{
+				"statuses: value must contain at most 6 items",
+				"statuses[0]: value must not be in list [0]",
+				"statuses[1]: value must not be in list [0]",
+				"statuses[2]: value must not be in list [0]",
+				"statuses[3]: value must not be in list [0]",
+				"statuses[4]: value must not be in list [0]",
+				"statuses[5]: value must not be in list [0]",
+				"statuses[6]: value must not be in list [0]",
+			},
+		},
+		{
+			name: "nested_in_unannotated",
+			msg:  &paymentv1.WatchEvent{Transition: &paymentv1.PaymentTransition{Amount: &paymentv1.Money{}}},
+			want: []string{
+				"transition.amount.currency_code: value is required",
+				"transition.amount.amount_minor: value is required",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := Validate(tc.msg)
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var verr *Error
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			var got []string
+			for _, v := range verr.Violations {
+				got = append(got, v.Field+": "+v.Description)
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("expected violations\n%s\ngot\n%s", strings.Join(tc.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/payment.v1.PaymentService/Get"}
+
+	var called bool
+	handler := func(ctx context.Context, req any) (any, error) {
+		called = true
+		return &paymentv1.Payment{}, nil
+	}
+
+	if _, err := interceptor(ctx, &paymentv1.GetPaymentRequest{BillId: 1}, info, handler); err != nil || !called {
+		t.Fatalf("expected the handler to run, got %v", err)
+	}
+
+	called = false
+	_, err := interceptor(ctx, &paymentv1.GetPaymentRequest{}, info, handler)
+	if called {
+		t.Error("expected the handler not to run")
+	}
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if len(st.Details()) != 1 {
+		t.Fatalf("expected one detail, got %v", st.Details())
+	}
+	br, ok := st.Details()[0].(*errdetails.BadRequest)
+	if !ok {
+		t.Fatalf("expected BadRequest, got %T", st.Details()[0])
+	}
+	if v := br.GetFieldViolations(); len(v) != 1 || v[0].GetField() != "bill_id" || v[0].GetDescription() != "value is required" {
+		t.Errorf("unexpected violations %v", v)
+	}
+}
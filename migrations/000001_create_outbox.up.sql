@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS outbox (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  topic VARCHAR(255) NOT NULL,
+  event_key VARCHAR(255) NOT NULL,
+  payload BLOB NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at DATETIME(6) NOT NULL,
+  last_error TEXT,
+  delivered_at DATETIME(6) NULL,
+  PRIMARY KEY (id),
+  KEY outbox_pending (delivered_at, next_attempt_at)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS payments (
+  bill_id BIGINT NOT NULL,
+  amount_minor BIGINT NOT NULL,
+  status VARCHAR(32) NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  PRIMARY KEY (bill_id)
+);
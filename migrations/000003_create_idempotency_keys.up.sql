@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  scope VARCHAR(64) NOT NULL,
+  idem_key VARCHAR(255) NOT NULL,
+  request_hash VARBINARY(64) NOT NULL,
+  response BLOB NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  expires_at DATETIME(6) NOT NULL,
+  PRIMARY KEY (scope, idem_key),
+  KEY idempotency_keys_expires_at (expires_at)
+);
@@ -0,0 +1 @@
+ALTER TABLE payments ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'EUR';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS payment_transitions;
+DROP INDEX payments_merchant ON payments;
+UPDATE payments SET status = 'CREATED' WHERE status = 'PENDING';
+ALTER TABLE payments DROP COLUMN updated_at;
+ALTER TABLE payments DROP COLUMN refunded_minor;
+ALTER TABLE payments DROP COLUMN merchant_id;
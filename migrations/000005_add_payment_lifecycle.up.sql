@@ -0,0 +1,18 @@
+ALTER TABLE payments ADD COLUMN merchant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN refunded_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN updated_at DATETIME(6) NULL;
+UPDATE payments SET status = 'PENDING', updated_at = created_at WHERE status = 'CREATED';
+CREATE INDEX payments_merchant ON payments (merchant_id, bill_id);
+
+CREATE TABLE IF NOT EXISTS payment_transitions (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  bill_id BIGINT NOT NULL,
+  from_status VARCHAR(32) NOT NULL,
+  to_status VARCHAR(32) NOT NULL,
+  amount_minor BIGINT NOT NULL,
+  actor VARCHAR(255) NOT NULL,
+  reason VARCHAR(255) NOT NULL DEFAULT '',
+  created_at DATETIME(6) NOT NULL,
+  PRIMARY KEY (id),
+  KEY payment_transitions_bill (bill_id, id)
+);
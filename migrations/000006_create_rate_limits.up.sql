@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS rate_limits (
+  bucket_key VARCHAR(255) NOT NULL,
+  tokens BIGINT UNSIGNED NOT NULL,
+  remaining BIGINT UNSIGNED NOT NULL,
+  interval_ns BIGINT NOT NULL,
+  reset_at DATETIME(6) NOT NULL,
+  updated_at DATETIME(6) NOT NULL,
+  PRIMARY KEY (bucket_key),
+  KEY rate_limits_updated_at (updated_at)
+);
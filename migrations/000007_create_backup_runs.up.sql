@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS backup_runs (
+  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  database_name VARCHAR(64) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  location VARCHAR(1024) NOT NULL,
+  table_count INT UNSIGNED NOT NULL DEFAULT 0,
+  row_count BIGINT UNSIGNED NOT NULL DEFAULT 0,
+  byte_count BIGINT UNSIGNED NOT NULL DEFAULT 0,
+  error TEXT,
+  started_at DATETIME(6) NOT NULL,
+  finished_at DATETIME(6),
+  PRIMARY KEY (id),
+  KEY backup_runs_database_status (database_name, status, started_at)
+);
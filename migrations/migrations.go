@@ -0,0 +1,28 @@
+// Package migrations embeds the SQL and CQL schema migrations so that they can
+// be applied by database.DB.Migrate and scylla.DB.Migrate from any binary or
+// test.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// FS holds the *.up.sql and *.down.sql migration files.
+//
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed scylla/*.cql
+var scyllaFS embed.FS
+
+// ScyllaFS holds the *.cql migration files of the Scylla keyspace.
+var ScyllaFS = mustSub(scyllaFS, "scylla")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
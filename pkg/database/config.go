@@ -1,6 +1,7 @@
 package database
 
 import (
+	"log/slog"
 	"net/url"
 	"strconv"
 	"time"
@@ -26,6 +27,10 @@ type Config struct {
 	PoolMaxConnLife    time.Duration `env:"DB_POOL_MAX_CONN_LIFETIME, default=5m" json:",omitempty"`
 	PoolMaxConnIdle    time.Duration `env:"DB_POOL_MAX_CONN_IDLE_TIME, default=1m" json:",omitempty"`
 	PoolHealthCheck    time.Duration `env:"DB_POOL_HEALTH_CHECK_PERIOD, default=1m" json:",omitempty"`
+
+	// SlowQueryThreshold is the statement duration at or above which a query is
+	// logged, with its arguments redacted. Zero disables the slow-query log.
+	SlowQueryThreshold time.Duration `env:"DB_SLOW_QUERY_THRESHOLD, default=500ms" json:",omitempty"`
 }
 
 func (c *Config) DatabaseConfig() *Config {
@@ -76,3 +81,28 @@ func (c *Config) ConnectionURL() string {
 
 	return u.String()
 }
+
+// LogValue implements slog.LogValuer. The password, which may be a resolved
+// secret, is redacted.
+func (c *Config) LogValue() slog.Value {
+	if c == nil {
+		return slog.Value{}
+	}
+
+	password := ""
+	if c.Password != "" {
+		password = "REDACTED"
+	}
+	return slog.GroupValue(
+		slog.String("name", c.Name),
+		slog.String("user", c.User),
+		slog.String("host", c.Host),
+		slog.String("port", c.Port),
+		slog.String("password", password),
+		slog.String("sslmode", c.SSLMode),
+		slog.Int("connect_timeout", c.ConnectionTimeout),
+		slog.String("pool_max_conns", c.PoolMaxConnections),
+		slog.Duration("pool_max_conn_lifetime", c.PoolMaxConnLife),
+		slog.Duration("slow_query_threshold", c.SlowQueryThreshold),
+	)
+}
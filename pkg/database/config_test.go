@@ -0,0 +1,26 @@
+package database
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestConfig_LogValue(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	logger.Info("database", "config", &Config{Name: "payments", User: "app", Host: "db", Password: "hunter2"})
+
+	got := buf.String()
+	if strings.Contains(got, "hunter2") {
+		t.Errorf("expected the password to be redacted, got %s", got)
+	}
+	for _, want := range []string{"config.name=payments", "config.user=app", "config.password=REDACTED"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %s", want, got)
+		}
+	}
+}
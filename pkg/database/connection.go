@@ -4,40 +4,97 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	vit "vitess.io/vitess/go/vt/vitessdriver"
 )
 
 type DB struct {
 	Pool *sql.DB
+
+	// poolStats exports Pool.Stats() and is unregistered on Close.
+	poolStats prometheus.Collector
 }
 
 // NewFromEnv sets up the database connections using the configuration in the
 // process's environment variables. This should be called just once per server
 // instance.
 func NewFromEnv(ctx context.Context, cfg *Config) (*DB, error) {
-	db, err := vit.Open("localhost:15991", "@primary")
-
+	connector, err := vitessConnector(vit.Configuration{
+		Address: "localhost:15991",
+		Target:  "@primary",
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse connection string: %w", err)
 	}
 
-	//ping vitess
-	if err := db.Ping(); err != nil {
+	db, err := NewFromConnector(ctx, connector, cfg)
+	if err != nil {
 		return nil, fmt.Errorf("failed to ping vitess: %w", err)
 	}
+	return db, nil
+}
+
+// NewFromConnector creates a DB on top of connector with the same
+// instrumentation as NewFromEnv, and checks that it is reachable. It allows
+// other drivers to be used, for example by tests.
+func NewFromConnector(ctx context.Context, connector driver.Connector, cfg *Config) (*DB, error) {
+	db := sql.OpenDB(Instrument(connector, cfg.SlowQueryThreshold))
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
 	// Set the connection pool settings.
 
-	return &DB{Pool: db}, nil
+	name := cfg.Name
+	if name == "" {
+		name = "vitess"
+	}
+
+	return &DB{
+		Pool:      db,
+		poolStats: registerPoolStats(db, name),
+	}, nil
+}
+
+// vitessConnector builds a driver.Connector for the vitess driver so that it
+// can be wrapped by Instrument. The driver type is unexported, so it is taken
+// from a handle that is never connected.
+func vitessConnector(c vit.Configuration) (driver.Connector, error) {
+	if c.Protocol == "" {
+		c.Protocol = "grpc"
+	}
+	name, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := sql.Open("vitess", string(name))
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+
+	dc, ok := handle.Driver().(driver.DriverContext)
+	if !ok {
+		return nil, fmt.Errorf("vitess driver does not implement driver.DriverContext")
+	}
+	return dc.OpenConnector(string(name))
 }
 
 // Close releases database connections.
 func (db *DB) Close(ctx context.Context) {
 	slog.Info("Closing connection pool.")
+	if db.poolStats != nil {
+		prometheus.Unregister(db.poolStats)
+	}
 	db.Pool.Close()
 }
 
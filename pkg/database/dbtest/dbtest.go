@@ -0,0 +1,275 @@
+// Package dbtest provides ephemeral, fully migrated databases for tests.
+//
+// A TestInstance connects to a MySQL-protocol server (MySQL itself, or the
+// MySQL port of a vttestserver) named by the DB_TEST_DSN environment variable.
+// It migrates a template schema once and clones it into a fresh schema for
+// every test, which is dropped when the test finishes. When DB_TEST_DSN is not
+// set, tests that ask for a database are skipped.
+//
+// Typical use, from a package's TestMain:
+//
+//	var testDatabaseInstance *dbtest.TestInstance
+//
+//	func TestMain(m *testing.M) {
+//		testDatabaseInstance = dbtest.MustTestInstance()
+//		defer testDatabaseInstance.MustClose()
+//		m.Run()
+//	}
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/paveletto99/microservice-blueprint/internal/serverenv"
+	"github.com/paveletto99/microservice-blueprint/migrations"
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+)
+
+// DSNEnvKey is the environment variable holding the go-sql-driver/mysql DSN
+// of the server that hosts test databases, e.g. "root@tcp(localhost:3306)/".
+const DSNEnvKey = "DB_TEST_DSN"
+
+// connectTimeout bounds how long MustTestInstance waits for the server, which
+// may still be starting when tests begin.
+const connectTimeout = 30 * time.Second
+
+// TestInstance hands out isolated databases cloned from a migrated template.
+type TestInstance struct {
+	admin    *sql.DB
+	config   *mysql.Config
+	template string
+
+	skipReason string
+}
+
+// MustTestInstance is NewTestInstance, except it panics on error.
+func MustTestInstance() *TestInstance {
+	ti, err := NewTestInstance()
+	if err != nil {
+		panic(err)
+	}
+	return ti
+}
+
+// NewTestInstance connects to the server named by DB_TEST_DSN and prepares the
+// template schema. If the variable is unset, the returned instance skips every
+// test that requests a database.
+func NewTestInstance() (*TestInstance, error) {
+	dsn := os.Getenv(DSNEnvKey)
+	if dsn == "" {
+		return &TestInstance{
+			skipReason: fmt.Sprintf("🚧 Skipping database tests (%s is not set)!", DSNEnvKey),
+		}, nil
+	}
+
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", DSNEnvKey, err)
+	}
+	config.DBName = ""
+	config.ParseTime = true
+	config.Loc = time.UTC
+
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connector: %w", err)
+	}
+	admin := sql.OpenDB(connector)
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := waitForServer(ctx, admin); err != nil {
+		admin.Close()
+		return nil, err
+	}
+
+	ti := &TestInstance{
+		admin:    admin,
+		config:   config,
+		template: "dbtest_template_" + randomSuffix(),
+	}
+	if err := ti.createTemplate(ctx); err != nil {
+		ti.Close()
+		return nil, err
+	}
+	return ti, nil
+}
+
+// MustClose is Close, except it panics on error.
+func (i *TestInstance) MustClose() {
+	if err := i.Close(); err != nil {
+		panic(err)
+	}
+}
+
+// Close drops the template schema and closes the admin connection.
+func (i *TestInstance) Close() error {
+	if i.admin == nil {
+		return nil
+	}
+	defer i.admin.Close()
+
+	if _, err := i.admin.Exec("DROP DATABASE IF EXISTS " + quote(i.template)); err != nil {
+		return fmt.Errorf("failed to drop template database: %w", err)
+	}
+	return nil
+}
+
+// NewDatabase creates a new database cloned from the migrated template and
+// returns it along with its configuration. The database is dropped when the
+// test finishes.
+func (i *TestInstance) NewDatabase(tb testing.TB) (*database.DB, *database.Config) {
+	tb.Helper()
+
+	if i.skipReason != "" {
+		tb.Skip(i.skipReason)
+	}
+
+	ctx := context.Background()
+	name := "dbtest_" + randomSuffix()
+	if err := i.clone(ctx, name); err != nil {
+		tb.Fatalf("failed to clone template database: %s", err)
+	}
+
+	config := i.config.Clone()
+	config.DBName = name
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		tb.Fatalf("failed to create connector: %s", err)
+	}
+
+	host, port, _ := net.SplitHostPort(config.Addr)
+	dbConfig := &database.Config{
+		Name:     name,
+		User:     config.User,
+		Password: config.Passwd,
+		Host:     host,
+		Port:     port,
+	}
+
+	db, err := database.NewFromConnector(ctx, connector, dbConfig)
+	if err != nil {
+		tb.Fatalf("failed to connect to test database: %s", err)
+	}
+
+	tb.Cleanup(func() {
+		db.Close(ctx)
+
+		if _, err := i.admin.ExecContext(ctx, "DROP DATABASE IF EXISTS "+quote(name)); err != nil {
+			tb.Errorf("failed to drop test database %s: %s", name, err)
+		}
+	})
+
+	return db, dbConfig
+}
+
+// NewServerEnv is NewDatabase wrapped in a serverenv.ServerEnv, for tests of
+// handlers and servers that take their dependencies from the environment.
+func (i *TestInstance) NewServerEnv(tb testing.TB, opts ...serverenv.Option) *serverenv.ServerEnv {
+	tb.Helper()
+
+	db, _ := i.NewDatabase(tb)
+	opts = append([]serverenv.Option{serverenv.WithDatabase(db)}, opts...)
+	return serverenv.New(context.Background(), opts...)
+}
+
+// createTemplate creates the template schema and applies all migrations to it.
+func (i *TestInstance) createTemplate(ctx context.Context) error {
+	if _, err := i.admin.ExecContext(ctx, "CREATE DATABASE "+quote(i.template)); err != nil {
+		return fmt.Errorf("failed to create template database: %w", err)
+	}
+
+	config := i.config.Clone()
+	config.DBName = i.template
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return fmt.Errorf("failed to create connector: %w", err)
+	}
+
+	db, err := database.NewFromConnector(ctx, connector, &database.Config{Name: i.template})
+	if err != nil {
+		return fmt.Errorf("failed to connect to template database: %w", err)
+	}
+	defer db.Close(ctx)
+
+	if err := db.Migrate(ctx, migrations.FS); err != nil {
+		return fmt.Errorf("failed to migrate template database: %w", err)
+	}
+	return nil
+}
+
+// clone creates name with the tables, and rows, of the template. MySQL has no
+// CREATE DATABASE ... TEMPLATE, so the tables are copied one by one.
+func (i *TestInstance) clone(ctx context.Context, name string) error {
+	rows, err := i.admin.QueryContext(ctx, `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = ? AND table_type = 'BASE TABLE'`, i.template)
+	if err != nil {
+		return fmt.Errorf("listing template tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning template table: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing template tables: %w", err)
+	}
+
+	if _, err := i.admin.ExecContext(ctx, "CREATE DATABASE "+quote(name)); err != nil {
+		return fmt.Errorf("creating database: %w", err)
+	}
+	for _, t := range tables {
+		dst, src := quote(name)+"."+quote(t), quote(i.template)+"."+quote(t)
+		if _, err := i.admin.ExecContext(ctx, "CREATE TABLE "+dst+" LIKE "+src); err != nil {
+			return fmt.Errorf("cloning table %s: %w", t, err)
+		}
+		if _, err := i.admin.ExecContext(ctx, "INSERT INTO "+dst+" SELECT * FROM "+src); err != nil {
+			return fmt.Errorf("copying rows of %s: %w", t, err)
+		}
+	}
+	return nil
+}
+
+// waitForServer pings db until it answers or ctx is done.
+func waitForServer(ctx context.Context, db *sql.DB) error {
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to reach test database server: %w", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func quote(ident string) string {
+	return "`" + ident + "`"
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate random name: %s", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,77 @@
+package dbtest_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+	"github.com/paveletto99/microservice-blueprint/pkg/database/dbtest"
+)
+
+var testDatabaseInstance *dbtest.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = dbtest.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+func TestNewDatabase(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	db1, cfg1 := testDatabaseInstance.NewDatabase(t)
+	db2, cfg2 := testDatabaseInstance.NewDatabase(t)
+	if cfg1.Name == cfg2.Name {
+		t.Fatalf("expected distinct databases, both are %q", cfg1.Name)
+	}
+
+	// Migrations were applied to the clone.
+	var n int
+	if err := db1.Pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Errorf("expected migrations to be recorded")
+	}
+
+	// Writes to one database are invisible to the other.
+	if err := db1.InTx(ctx, nil, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO outbox (topic, event_key, payload, created_at, next_attempt_at)
+			VALUES ('t', 'k', 'p', NOW(), NOW())`)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		db   *database.DB
+		want int
+	}{
+		{db1, 1},
+		{db2, 0},
+	} {
+		var got int
+		if err := tc.db.Pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox`).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("expected %d outbox rows, got %d", tc.want, got)
+		}
+	}
+}
+
+func TestNewServerEnv(t *testing.T) {
+	t.Parallel()
+
+	env := testDatabaseInstance.NewServerEnv(t)
+	if env.Database() == nil {
+		t.Fatal("expected server env to have a database")
+	}
+	if err := env.Database().Pool.PingContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"vitess.io/vitess/go/mysql/sqlerror"
+)
+
+// ErrorNumber returns the MySQL error number of err, e.g. sqlerror.ERDupEntry,
+// or 0 if err is nil. Errors of go-sql-driver/mysql carry the number in a
+// field. Errors of the vitess driver come from vtgate and carry it in their
+// message, e.g. "Duplicate entry ... (errno 1062) (sqlstate 23000)". Other
+// errors are mapped from their vitess code, usually to
+// sqlerror.ERUnknownError.
+func ErrorNumber(err error) sqlerror.ErrorCode {
+	if err == nil {
+		return 0
+	}
+
+	var merr *mysql.MySQLError
+	if errors.As(err, &merr) {
+		return sqlerror.ErrorCode(merr.Number)
+	}
+	var serr *sqlerror.SQLError
+	if errors.As(err, &serr) {
+		return serr.Num
+	}
+	if serr, ok := sqlerror.NewSQLErrorFromError(err).(*sqlerror.SQLError); ok {
+		return serr.Num
+	}
+	return sqlerror.ERUnknownError
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"vitess.io/vitess/go/mysql/sqlerror"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+func TestErrorNumber(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		err  error
+		want sqlerror.ErrorCode
+	}{
+		{"nil", nil, 0},
+		{"mysql", fmt.Errorf("inserting: %w", &mysql.MySQLError{Number: 1062}), sqlerror.ERDupEntry},
+		{"sqlerror", fmt.Errorf("inserting: %w", sqlerror.NewSQLError(sqlerror.ERLockDeadlock, sqlerror.SSLockDeadlock, "deadlock")), sqlerror.ERLockDeadlock},
+		{
+			"vtgate",
+			fmt.Errorf("inserting: %w", vterrors.Errorf(vtrpcpb.Code_ALREADY_EXISTS,
+				"target: ks.0.primary: vttablet: Duplicate entry 'a' for key 'PRIMARY' (errno 1062) (sqlstate 23000) (CallerID: app)")),
+			sqlerror.ERDupEntry,
+		},
+		{"other", errors.New("connection refused"), sqlerror.ERUnknownError},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ErrorNumber(tc.err); got != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// placeholderList matches a parenthesised list made only of placeholders,
+	// e.g. "(?, ?, ?)".
+	placeholderList = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+
+	// repeatedTuples matches a run of folded placeholder lists, e.g. the rows
+	// of a multi-row INSERT.
+	repeatedTuples = regexp.MustCompile(`\(\?\+\)(?:\s*,\s*\(\?\+\))+`)
+)
+
+// Fingerprint returns a normalized form of query that is stable across
+// different argument values, suitable as a low-cardinality metric label.
+// String and numeric literals become "?", comments are dropped, whitespace is
+// collapsed and lists of placeholders (including the rows of a multi-row
+// INSERT) are folded into a single "(?+)".
+func Fingerprint(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	space := false
+	emit := func(s string) {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			i++
+
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space = true
+
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+			space = true
+
+		case c == '\'' || c == '"':
+			i = skipQuoted(query, i)
+			emit("?")
+
+		case isDigit(c) && (i == 0 || !isIdentByte(query[i-1])):
+			for i < len(query) && (isIdentByte(query[i]) || query[i] == '.') {
+				i++
+			}
+			emit("?")
+
+		default:
+			start := i
+			for i < len(query) && !isSpecialByte(query, i) {
+				i++
+			}
+			if i == start {
+				i++
+			}
+			emit(query[start:i])
+		}
+	}
+
+	fp := placeholderList.ReplaceAllString(b.String(), "(?+)")
+	return repeatedTuples.ReplaceAllString(fp, "(?+)")
+}
+
+// skipQuoted returns the index just past the quoted literal starting at i. Both
+// doubled quotes and backslash escapes are honoured.
+func skipQuoted(query string, i int) int {
+	quote := query[i]
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return i
+}
+
+// isSpecialByte reports whether the byte at i starts a token that Fingerprint
+// handles on its own.
+func isSpecialByte(query string, i int) bool {
+	switch c := query[i]; {
+	case c == ' ' || c == '\t' || c == '\n' || c == '\r', c == '\'' || c == '"':
+		return true
+	case c == '-':
+		return i+1 < len(query) && query[i+1] == '-'
+	case c == '/':
+		return i+1 < len(query) && query[i+1] == '*'
+	case isDigit(c):
+		return i == 0 || !isIdentByte(query[i-1])
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
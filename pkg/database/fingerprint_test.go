@@ -0,0 +1,58 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "placeholders",
+			query: "SELECT id FROM payment WHERE id = ?",
+			want:  "SELECT id FROM payment WHERE id = ?",
+		},
+		{
+			name:  "literals",
+			query: "SELECT id FROM payment WHERE price > 10.5 AND currency='EUR' AND note = 'it''s'",
+			want:  "SELECT id FROM payment WHERE price > ? AND currency=? AND note = ?",
+		},
+		{
+			name:  "identifiers with digits",
+			query: "SELECT col1 FROM t2",
+			want:  "SELECT col1 FROM t2",
+		},
+		{
+			name:  "whitespace and comments",
+			query: "SELECT  *\n\tFROM payment -- trailing\n WHERE /* inline */ id=1",
+			want:  "SELECT * FROM payment WHERE id=?",
+		},
+		{
+			name:  "in list",
+			query: "SELECT * FROM payment WHERE id IN (1, 2, 3)",
+			want:  "SELECT * FROM payment WHERE id IN (?+)",
+		},
+		{
+			name:  "multi row insert",
+			query: "INSERT INTO payment (id, price) VALUES (?, ?), (?, ?), (?, ?)",
+			want:  "INSERT INTO payment (id, price) VALUES (?+)",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Fingerprint(tc.query); got != tc.want {
+				t.Errorf("Fingerprint(%q) = %q, want %q", tc.query, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package idempotency
+
+import (
+	"time"
+)
+
+// Config represents the configuration and associated environment variables for
+// idempotency keys.
+type Config struct {
+	// Retention is how long a key and its response are remembered. Retries
+	// arriving later than this are treated as new requests.
+	Retention time.Duration `env:"IDEMPOTENCY_RETENTION, default=24h"`
+
+	// CleanupInterval is how often expired keys are deleted.
+	CleanupInterval time.Duration `env:"IDEMPOTENCY_CLEANUP_INTERVAL, default=1h"`
+}
+
+// IdempotencyConfig returns the idempotency configuration.
+func (c *Config) IdempotencyConfig() *Config {
+	return c
+}
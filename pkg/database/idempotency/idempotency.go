@@ -0,0 +1,180 @@
+// Package idempotency records the outcome of requests carrying an idempotency
+// key, so that retries of the same request return the original response
+// instead of repeating its side effects.
+//
+// Keys are stored together with a hash of the request they were first used
+// with and the encoded response, in the same transaction as the change the
+// request made. A key is therefore never remembered without its effects, nor
+// the effects without the key.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"vitess.io/vitess/go/mysql/sqlerror"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+)
+
+// MaxKeyLength is the longest key that can be stored.
+const MaxKeyLength = 255
+
+// ErrKeyReused is returned when a key is presented again with a request that
+// differs from the one it was first used with.
+var ErrKeyReused = errors.New("idempotency key reused with a different request")
+
+// Store remembers idempotency keys and their responses.
+type Store struct {
+	db     *database.DB
+	config *Config
+	now    func() time.Time
+}
+
+// New creates a Store on db.
+func New(db *database.DB, config *Config) (*Store, error) {
+	if config.Retention <= 0 {
+		return nil, fmt.Errorf("idempotency: retention must be positive")
+	}
+	if config.CleanupInterval <= 0 {
+		return nil, fmt.Errorf("idempotency: cleanup interval must be positive")
+	}
+	return &Store{
+		db:     db,
+		config: config,
+		now:    func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+// Do runs f at most once per scope and key. The first call runs f in a
+// transaction and stores the response it returns, committing both together.
+// Later calls within the retention window return the stored response without
+// calling f, provided requestHash matches the first call; otherwise Do returns
+// ErrKeyReused. If f fails nothing is stored and the key may be used again.
+//
+// The returned bool reports whether the response was replayed.
+func (s *Store) Do(ctx context.Context, scope, key string, requestHash []byte, f func(tx *sql.Tx) ([]byte, error)) ([]byte, bool, error) {
+	if key == "" {
+		return nil, false, fmt.Errorf("idempotency: key is required")
+	}
+	if len(key) > MaxKeyLength {
+		return nil, false, fmt.Errorf("idempotency: key longer than %d bytes", MaxKeyLength)
+	}
+	if requestHash == nil {
+		requestHash = []byte{}
+	}
+
+	response, replayed, err := s.do(ctx, scope, key, requestHash, f)
+	if isConflict(err) {
+		// Another request with this key committed first. Retrying finds its row
+		// and replays, or reports the mismatch.
+		slog.DebugContext(ctx, "idempotency key claimed concurrently, retrying", "scope", scope)
+		response, replayed, err = s.do(ctx, scope, key, requestHash, f)
+	}
+	return response, replayed, err
+}
+
+func (s *Store) do(ctx context.Context, scope, key string, requestHash []byte, f func(tx *sql.Tx) ([]byte, error)) ([]byte, bool, error) {
+	var (
+		response []byte
+		replayed bool
+	)
+	err := s.db.InTx(ctx, nil, func(tx *sql.Tx) error {
+		now := s.now()
+
+		var (
+			storedHash []byte
+			expiresAt  time.Time
+		)
+		err := tx.QueryRowContext(ctx, `
+			SELECT request_hash, response, expires_at
+			FROM idempotency_keys
+			WHERE scope = ? AND idem_key = ?
+			FOR UPDATE`, scope, key).
+			Scan(&storedHash, &response, &expiresAt)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return fmt.Errorf("reading idempotency key: %w", err)
+		case expiresAt.After(now):
+			if !bytes.Equal(storedHash, requestHash) {
+				return ErrKeyReused
+			}
+			replayed = true
+			return nil
+		default:
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM idempotency_keys WHERE scope = ? AND idem_key = ?`,
+				scope, key); err != nil {
+				return fmt.Errorf("deleting expired idempotency key: %w", err)
+			}
+		}
+
+		if response, err = f(tx); err != nil {
+			return err
+		}
+		if response == nil {
+			response = []byte{}
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO idempotency_keys
+				(scope, idem_key, request_hash, response, created_at, expires_at)
+			VALUES
+				(?, ?, ?, ?, ?, ?)`,
+			scope, key, requestHash, response, now, now.Add(s.config.Retention)); err != nil {
+			return fmt.Errorf("inserting idempotency key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return response, replayed, nil
+}
+
+// Run deletes expired keys every CleanupInterval until ctx is done.
+func (s *Store) Run(ctx context.Context) error {
+	cleanup := time.NewTicker(s.config.CleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-cleanup.C:
+			n, err := s.Cleanup(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "idempotency cleanup failed", "error", err)
+				continue
+			}
+			slog.DebugContext(ctx, "idempotency cleanup", "deleted", n)
+		}
+	}
+}
+
+// Cleanup deletes expired keys and returns how many were removed.
+func (s *Store) Cleanup(ctx context.Context) (int64, error) {
+	res, err := s.db.Pool.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE expires_at <= ?`, s.now())
+	if err != nil {
+		return 0, fmt.Errorf("deleting expired idempotency keys: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// isConflict reports whether err means a concurrent transaction inserted the
+// same key, whichever driver reported it.
+func isConflict(err error) bool {
+	switch database.ErrorNumber(err) {
+	case sqlerror.ERDupEntry, sqlerror.ERLockDeadlock:
+		return true
+	}
+	return false
+}
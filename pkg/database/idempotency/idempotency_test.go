@@ -0,0 +1,207 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database/dbtest"
+)
+
+var testDatabaseInstance *dbtest.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = dbtest.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+func newTestStore(t *testing.T) (*Store, *time.Time) {
+	t.Helper()
+
+	db, _ := testDatabaseInstance.NewDatabase(t)
+	s, err := New(db, &Config{Retention: time.Hour, CleanupInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestNew_invalidConfig(t *testing.T) {
+	t.Parallel()
+
+	for _, config := range []*Config{
+		{CleanupInterval: time.Hour},
+		{Retention: time.Hour},
+	} {
+		if _, err := New(nil, config); err == nil {
+			t.Errorf("expected %+v to be rejected", config)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, now := newTestStore(t)
+
+	calls := 0
+	f := func(tx *sql.Tx) ([]byte, error) {
+		calls++
+		return []byte{byte(calls)}, nil
+	}
+
+	cases := []struct {
+		name     string
+		advance  time.Duration
+		key      string
+		hash     string
+		want     []byte
+		replayed bool
+		err      error
+	}{
+		{name: "first", key: "a", hash: "h1", want: []byte{1}},
+		{name: "replay", key: "a", hash: "h1", want: []byte{1}, replayed: true},
+		{name: "other_key", key: "b", hash: "h1", want: []byte{2}},
+		{name: "reused", key: "a", hash: "h2", err: ErrKeyReused},
+		{name: "expired", advance: time.Hour, key: "a", hash: "h2", want: []byte{3}},
+		{name: "replay_after_expiry", key: "a", hash: "h2", want: []byte{3}, replayed: true},
+	}
+
+	// Cases share the store and run in order.
+	for _, tc := range cases {
+		*now = now.Add(tc.advance)
+
+		got, replayed, err := s.Do(ctx, "test", tc.key, []byte(tc.hash), f)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%s: expected error %v, got %v", tc.name, tc.err, err)
+		}
+		if string(got) != string(tc.want) || replayed != tc.replayed {
+			t.Errorf("%s: expected %v (replayed=%t), got %v (replayed=%t)",
+				tc.name, tc.want, tc.replayed, got, replayed)
+		}
+	}
+}
+
+// vtgateDuplicate is the error of the vitess driver when a concurrent request
+// inserted the same key first.
+func vtgateDuplicate() error {
+	return fmt.Errorf("inserting idempotency key: %w", vterrors.Errorf(vtrpcpb.Code_ALREADY_EXISTS,
+		"target: ks.0.primary: vttablet: Duplicate entry 'test-k' for key 'idempotency_keys.PRIMARY' (errno 1062) (sqlstate 23000)"))
+}
+
+func TestDo_conflict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, _ := newTestStore(t)
+
+	// The first attempt loses the race for the key, the retry goes through.
+	calls := 0
+	got, replayed, err := s.Do(ctx, "test", "k", []byte("h"), func(*sql.Tx) ([]byte, error) {
+		if calls++; calls == 1 {
+			return nil, vtgateDuplicate()
+		}
+		return []byte("ok"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ok" || replayed || calls != 2 {
+		t.Errorf("expected a response after a retry, got %q (replayed=%t) after %d calls", got, replayed, calls)
+	}
+}
+
+func TestIsConflict(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"mysql_duplicate", &mysql.MySQLError{Number: 1062}, true},
+		{"mysql_deadlock", fmt.Errorf("commit: %w", &mysql.MySQLError{Number: 1213}), true},
+		{"mysql_other", &mysql.MySQLError{Number: 1146}, false},
+		{"vtgate_duplicate", vtgateDuplicate(), true},
+		{
+			"vtgate_deadlock",
+			vterrors.Errorf(vtrpcpb.Code_ABORTED, "Deadlock found when trying to get lock; try restarting transaction (errno 1213) (sqlstate 40001)"),
+			true,
+		},
+		{"vtgate_other", vterrors.Errorf(vtrpcpb.Code_UNAVAILABLE, "no healthy tablet"), false},
+		{"other", ErrKeyReused, false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := isConflict(tc.err); got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDo_failureIsNotRemembered(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, _ := newTestStore(t)
+
+	boom := errors.New("boom")
+	if _, _, err := s.Do(ctx, "test", "k", []byte("h"), func(*sql.Tx) ([]byte, error) {
+		return nil, boom
+	}); !errors.Is(err, boom) {
+		t.Fatalf("expected %v, got %v", boom, err)
+	}
+
+	got, replayed, err := s.Do(ctx, "test", "k", []byte("other"), func(*sql.Tx) ([]byte, error) {
+		return []byte("ok"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ok" || replayed {
+		t.Errorf("expected a fresh response, got %q (replayed=%t)", got, replayed)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, now := newTestStore(t)
+
+	f := func(*sql.Tx) ([]byte, error) { return nil, nil }
+	if _, _, err := s.Do(ctx, "test", "old", nil, f); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(30 * time.Minute)
+	if _, _, err := s.Do(ctx, "test", "new", nil, f); err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(45 * time.Minute)
+	n, err := s.Cleanup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 expired key deleted, got %d", n)
+	}
+}
@@ -0,0 +1,425 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the statement spans. It follows the global tracer provider,
+// even when that is installed after this package is loaded.
+var tracer = otel.Tracer("github.com/paveletto99/microservice-blueprint/pkg/database")
+
+// Compile-time checks that the wrappers expose the optional driver interfaces
+// database/sql looks for.
+var (
+	_ driver.Connector = (*instrumentedConnector)(nil)
+
+	_ interface {
+		driver.Conn
+		driver.ConnBeginTx
+		driver.ConnPrepareContext
+		driver.ExecerContext
+		driver.QueryerContext
+		driver.Pinger
+		driver.SessionResetter
+		driver.Validator
+		driver.NamedValueChecker
+	} = (*instrumentedConn)(nil)
+
+	_ interface {
+		driver.Stmt
+		driver.StmtExecContext
+		driver.StmtQueryContext
+		driver.NamedValueChecker
+	} = (*instrumentedStmt)(nil)
+
+	_ interface {
+		driver.RowsNextResultSet
+		driver.RowsColumnTypeScanType
+		driver.RowsColumnTypeDatabaseTypeName
+		driver.RowsColumnTypeLength
+		driver.RowsColumnTypeNullable
+		driver.RowsColumnTypePrecisionScale
+	} = (*instrumentedRows)(nil)
+)
+
+// Instrument wraps connector so that every statement executed through it
+// records its latency and errors by query fingerprint, runs inside a trace
+// span and, when it takes at least slowQueryThreshold, is logged with its
+// arguments redacted. A zero threshold disables the slow-query log. Queries
+// are observed until their rows are closed.
+func Instrument(connector driver.Connector, slowQueryThreshold time.Duration) driver.Connector {
+	return &instrumentedConnector{
+		Connector: connector,
+		inst:      &instrumentation{slowQueryThreshold: slowQueryThreshold},
+	}
+}
+
+// instrumentation holds the settings shared by every wrapped connection.
+type instrumentation struct {
+	slowQueryThreshold time.Duration
+}
+
+// start begins observing a statement. The returned function must be called
+// with the statement's error once it completes.
+func (in *instrumentation) start(ctx context.Context, op, query string, args []driver.NamedValue) (context.Context, func(error)) {
+	fp := Fingerprint(query)
+	ctx, span := tracer.Start(ctx, "sql."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "vitess"),
+			attribute.String("db.statement", fp),
+		))
+	start := time.Now()
+
+	return ctx, func(err error) {
+		defer span.End()
+
+		elapsed := time.Since(start)
+		queryLatency.WithLabelValues(op, fp).Observe(elapsed.Seconds())
+
+		if err != nil && !errors.Is(err, driver.ErrSkip) {
+			queryErrors.WithLabelValues(op, fp).Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		if in.slowQueryThreshold > 0 && elapsed >= in.slowQueryThreshold {
+			slog.WarnContext(ctx, "slow query",
+				"op", op,
+				"fingerprint", fp,
+				"duration", elapsed,
+				"args", redactArgs(args),
+				"error", err)
+		}
+	}
+}
+
+// redactArgs describes args by type only, so that logs never contain values.
+func redactArgs(args []driver.NamedValue) []string {
+	out := make([]string, 0, len(args))
+	for _, a := range args {
+		name := a.Name
+		if name == "" {
+			name = fmt.Sprintf("$%d", a.Ordinal)
+		}
+		out = append(out, fmt.Sprintf("%s=<%T>", name, a.Value))
+	}
+	return out
+}
+
+type instrumentedConnector struct {
+	driver.Connector
+	inst *instrumentation
+}
+
+// Connect implements driver.Connector.
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, inst: c.inst}, nil
+}
+
+type instrumentedConn struct {
+	driver.Conn
+	inst *instrumentation
+}
+
+// Ping implements driver.Pinger.
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession implements driver.SessionResetter, so that database/sql
+// discards the connections the driver reports as broken.
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator.
+func (c *instrumentedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue implements driver.NamedValueChecker, so that arguments are
+// converted by the driver. driver.ErrSkip falls back to the default
+// conversion of database/sql.
+func (c *instrumentedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// PrepareContext implements driver.ConnPrepareContext.
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, conn: c, query: query, inst: c.inst}, nil
+}
+
+// ExecContext implements driver.ExecerContext.
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, done := c.inst.start(ctx, "exec", query, args)
+	res, err := execer.ExecContext(ctx, query, args)
+	done(err)
+	return res, err
+}
+
+// QueryContext implements driver.QueryerContext.
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, done := c.inst.start(ctx, "query", query, args)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	return observeRows(rows, err, done)
+}
+
+// BeginTx implements driver.ConnBeginTx. Drivers without it can only begin
+// default transactions, so other options are refused as database/sql does.
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var (
+		tx  driver.Tx
+		err error
+	)
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else {
+		if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+			return nil, errors.New("sql: driver does not support non-default isolation level")
+		}
+		if opts.ReadOnly {
+			return nil, errors.New("sql: driver does not support read-only transactions")
+		}
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{Tx: tx, ctx: ctx, inst: c.inst}, nil
+}
+
+type instrumentedTx struct {
+	driver.Tx
+	ctx  context.Context
+	inst *instrumentation
+}
+
+// Commit implements driver.Tx.
+func (t *instrumentedTx) Commit() error {
+	_, done := t.inst.start(t.ctx, "commit", "COMMIT", nil)
+	err := t.Tx.Commit()
+	done(err)
+	return err
+}
+
+// Rollback implements driver.Tx.
+func (t *instrumentedTx) Rollback() error {
+	_, done := t.inst.start(t.ctx, "rollback", "ROLLBACK", nil)
+	err := t.Tx.Rollback()
+	done(err)
+	return err
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	conn  *instrumentedConn
+	query string
+	inst  *instrumentation
+}
+
+// CheckNamedValue implements driver.NamedValueChecker. database/sql only asks
+// the connection when the statement can't check values, so the statement asks
+// it instead.
+func (s *instrumentedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+// ExecContext implements driver.StmtExecContext.
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, done := s.inst.start(ctx, "exec", s.query, args)
+
+	var (
+		res driver.Result
+		err error
+	)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(args); err == nil {
+			res, err = s.Stmt.Exec(values)
+		}
+	}
+	done(err)
+	return res, err
+}
+
+// QueryContext implements driver.StmtQueryContext.
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, done := s.inst.start(ctx, "query", s.query, args)
+
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+	return observeRows(rows, err, done)
+}
+
+// observeRows returns rows that complete the observation of their query with
+// done when they are closed, or completes it now if the query failed.
+func observeRows(rows driver.Rows, err error, done func(error)) (driver.Rows, error) {
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, done: done}, nil
+}
+
+// instrumentedRows forwards the optional interfaces of the rows of the driver,
+// with the defaults database/sql uses for those it does not implement.
+type instrumentedRows struct {
+	driver.Rows
+	done func(error)
+
+	// err is the first error reading the rows.
+	err error
+}
+
+// Next implements driver.Rows.
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+// Close implements driver.Rows.
+func (r *instrumentedRows) Close() error {
+	err := r.Rows.Close()
+	if r.done != nil {
+		r.done(errors.Join(r.err, err))
+		r.done = nil
+	}
+	return err
+}
+
+// HasNextResultSet implements driver.RowsNextResultSet.
+func (r *instrumentedRows) HasNextResultSet() bool {
+	if n, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return n.HasNextResultSet()
+	}
+	return false
+}
+
+// NextResultSet implements driver.RowsNextResultSet.
+func (r *instrumentedRows) NextResultSet() error {
+	if n, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return n.NextResultSet()
+	}
+	return io.EOF
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType.
+func (r *instrumentedRows) ColumnTypeScanType(index int) reflect.Type {
+	if c, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return c.ColumnTypeScanType(index)
+	}
+	return reflect.TypeFor[any]()
+}
+
+// ColumnTypeDatabaseTypeName implements driver.RowsColumnTypeDatabaseTypeName.
+func (r *instrumentedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if c, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return c.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+// ColumnTypeLength implements driver.RowsColumnTypeLength.
+func (r *instrumentedRows) ColumnTypeLength(index int) (int64, bool) {
+	if c, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return c.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable.
+func (r *instrumentedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if c, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return c.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+// ColumnTypePrecisionScale implements driver.RowsColumnTypePrecisionScale.
+func (r *instrumentedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if c, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return c.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+func namedValuesToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, nv := range named {
+		if nv.Name != "" {
+			return nil, fmt.Errorf("database: driver does not support named parameters")
+		}
+		values[i] = nv.Value
+	}
+	return values, nil
+}
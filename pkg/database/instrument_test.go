@@ -0,0 +1,273 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+var errFake = errors.New("fake failure")
+
+// fakeConnector is a minimal driver whose statements sleep for delay and fail
+// when the query contains "fail". Queries return rows rows, each read after
+// delay. Connections are broken when broken is set.
+type fakeConnector struct {
+	delay    time.Duration
+	rows     int
+	broken   atomic.Bool
+	connects atomic.Int64
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	c.connects.Add(1)
+	return &fakeConn{c}, nil
+}
+func (c *fakeConnector) Driver() driver.Driver { return nil }
+
+type fakeConn struct {
+	c *fakeConnector
+}
+
+// cents is an argument type that only the fake driver can convert.
+type cents struct{ n int64 }
+
+func (c *fakeConn) ResetSession(context.Context) error {
+	if c.c.broken.Load() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := nv.Value.(cents); ok {
+		nv.Value = v.n
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (c *fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{c: c.c, left: c.c.rows}, nil
+}
+
+type fakeRows struct {
+	c    *fakeConnector
+	left int
+}
+
+func (r *fakeRows) Columns() []string { return []string{"name"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	r.left--
+	time.Sleep(r.c.delay)
+	dest[0] = "x"
+	return nil
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(int) string { return "VARCHAR" }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+// fakeTx is the transaction of fakeConn, which only supports default ones.
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	time.Sleep(c.c.delay)
+	if strings.Contains(query, "fail") {
+		return nil, errFake
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func counterValue(t *testing.T, op, fp string) float64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := queryErrors.WithLabelValues(op, fp).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestInstrument(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	t.Run("errors", func(t *testing.T) {
+		db := sql.OpenDB(Instrument(&fakeConnector{}, time.Hour))
+		defer db.Close()
+
+		query := "UPDATE fail SET x = 1 WHERE id = 2"
+		fp := Fingerprint(query)
+		before := counterValue(t, "exec", fp)
+
+		if _, err := db.ExecContext(ctx, query); !errors.Is(err, errFake) {
+			t.Fatalf("expected %v, got %v", errFake, err)
+		}
+		if got, want := counterValue(t, "exec", fp)-before, 1.0; got != want {
+			t.Errorf("expected %v errors recorded, got %v", want, got)
+		}
+	})
+
+	t.Run("slow_query", func(t *testing.T) {
+		buf.Reset()
+
+		db := sql.OpenDB(Instrument(&fakeConnector{delay: 5 * time.Millisecond}, time.Millisecond))
+		defer db.Close()
+
+		if _, err := db.ExecContext(ctx, "UPDATE payment SET note = ? WHERE id = 1", "top secret"); err != nil {
+			t.Fatal(err)
+		}
+
+		out := buf.String()
+		if !strings.Contains(out, "slow query") {
+			t.Fatalf("expected slow query log, got %q", out)
+		}
+		if strings.Contains(out, "top secret") {
+			t.Errorf("expected arguments to be redacted, got %q", out)
+		}
+	})
+
+	t.Run("fast_query", func(t *testing.T) {
+		buf.Reset()
+
+		db := sql.OpenDB(Instrument(&fakeConnector{}, time.Hour))
+		defer db.Close()
+
+		if _, err := db.ExecContext(ctx, "UPDATE payment SET note = ?", "x"); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("expected no log output, got %q", buf.String())
+		}
+	})
+}
+
+func TestInstrument_driverInterfaces(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("session_reset", func(t *testing.T) {
+		t.Parallel()
+
+		connector := &fakeConnector{}
+		db := sql.OpenDB(Instrument(connector, 0))
+		defer db.Close()
+
+		if _, err := db.ExecContext(ctx, "UPDATE a SET b = 1"); err != nil {
+			t.Fatal(err)
+		}
+		// The idle connection reports itself broken when reused.
+		connector.broken.Store(true)
+		if _, err := db.ExecContext(ctx, "UPDATE a SET b = 1"); err != nil {
+			t.Fatal(err)
+		}
+		if got := connector.connects.Load(); got != 2 {
+			t.Errorf("expected the broken connection to be replaced, got %d connections", got)
+		}
+	})
+
+	t.Run("named_value_checker", func(t *testing.T) {
+		t.Parallel()
+
+		db := sql.OpenDB(Instrument(&fakeConnector{}, 0))
+		defer db.Close()
+
+		if _, err := db.ExecContext(ctx, "UPDATE a SET b = ?", cents{n: 999}); err != nil {
+			t.Errorf("expected the driver to convert the argument, got %v", err)
+		}
+	})
+
+	t.Run("begin_tx", func(t *testing.T) {
+		t.Parallel()
+
+		db := sql.OpenDB(Instrument(&fakeConnector{}, 0))
+		defer db.Close()
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Options the driver can't honour are refused rather than dropped.
+		for _, opts := range []*sql.TxOptions{
+			{ReadOnly: true},
+			{Isolation: sql.LevelSerializable},
+		} {
+			if tx, err := db.BeginTx(ctx, opts); err == nil {
+				tx.Rollback()
+				t.Errorf("expected %+v to be refused", opts)
+			}
+		}
+	})
+
+	t.Run("rows", func(t *testing.T) {
+		t.Parallel()
+
+		db := sql.OpenDB(Instrument(&fakeConnector{delay: 5 * time.Millisecond, rows: 3}, 0))
+		defer db.Close()
+
+		query := "SELECT name FROM instrumented_rows"
+		fp := Fingerprint(query)
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := types[0].DatabaseTypeName(); got != "VARCHAR" {
+			t.Errorf("expected the column type of the driver, got %q", got)
+		}
+		if count, _ := latencyValue(t, "query", fp); count != 0 {
+			t.Fatalf("expected the query to be observed until its rows are closed, got %d observations", count)
+		}
+
+		for rows.Next() {
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+		count, sum := latencyValue(t, "query", fp)
+		if count != 1 || sum < (15*time.Millisecond).Seconds() {
+			t.Errorf("expected the reading of the rows to be observed, got %d observations of %fs", count, sum)
+		}
+	})
+}
+
+func latencyValue(t *testing.T, op, fp string) (uint64, float64) {
+	t.Helper()
+
+	var m dto.Metric
+	if err := queryLatency.WithLabelValues(op, fp).(interface{ Write(*dto.Metric) error }).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
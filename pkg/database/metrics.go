@@ -0,0 +1,45 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var (
+	queryLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "database_query_duration_seconds",
+		Help:    "latency of database statements by query fingerprint",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"op", "fingerprint"})
+
+	queryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "database_query_errors_total",
+		Help: "total number of failed database statements by query fingerprint",
+	}, []string{"op", "fingerprint"})
+)
+
+func init() {
+	prometheus.MustRegister(queryLatency, queryErrors)
+}
+
+// registerPoolStats exports the sql.DBStats of pool (open, in-use and idle
+// connections, wait count and duration) as prometheus metrics labelled with
+// name. The returned collector must be unregistered when the pool is closed. A
+// nil collector is returned if one is already registered under the same name.
+func registerPoolStats(pool *sql.DB, name string) prometheus.Collector {
+	c := collectors.NewDBStatsCollector(pool, name)
+	if err := prometheus.Register(c); err != nil {
+		are := prometheus.AlreadyRegisteredError{}
+		if errors.As(err, &are) {
+			slog.Warn("database pool stats already registered", "db_name", name)
+			return nil
+		}
+		slog.Error("failed to register database pool stats", "error", err)
+		return nil
+	}
+	return c
+}
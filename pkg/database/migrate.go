@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// migrationLock is the name of the advisory lock held while migrating, so that
+// replicas starting together do not apply the same migration twice.
+const migrationLock = "schema_migrations"
+
+// Migrate applies, in lexical order, every *.up.sql file in fsys that is not
+// yet recorded in the schema_migrations table. The version of a migration is
+// the file name up to the first underscore, e.g. "000001".
+func (db *DB) Migrate(ctx context.Context, fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.up.sql")
+	if err != nil {
+		return fmt.Errorf("listing migrations: %w", err)
+	}
+	sort.Strings(files)
+
+	conn, err := db.Pool.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %w", err)
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 60)`, migrationLock).Scan(&locked); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("timed out acquiring migration lock")
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, migrationLock); err != nil {
+			slog.Warn("failed to release migration lock", "error", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version VARCHAR(255) NOT NULL,
+			applied_at DATETIME(6) NOT NULL,
+			PRIMARY KEY (version)
+		)`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	applied := make(map[string]bool)
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("listing applied migrations: %w", err)
+	}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning applied migration: %w", err)
+		}
+		applied[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing applied migrations: %w", err)
+	}
+
+	for _, file := range files {
+		version, _, _ := strings.Cut(path.Base(file), "_")
+		if applied[version] {
+			continue
+		}
+
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("reading migration %s: %w", file, err)
+		}
+
+		// MySQL commits DDL implicitly, so statements are applied one by one and
+		// the version is recorded only once all of them have succeeded.
+		for _, stmt := range SplitStatements(string(b)) {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("applying migration %s: %w", file, err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			version, time.Now().UTC()); err != nil {
+			return fmt.Errorf("recording migration %s: %w", file, err)
+		}
+		slog.InfoContext(ctx, "applied migration", "version", version, "file", file)
+	}
+	return nil
+}
+
+// SplitStatements splits a script into its individual statements on
+// semicolons that are outside quoted literals and comments. Statements that
+// are empty or contain only comments are dropped.
+func SplitStatements(script string) []string {
+	var (
+		stmts []string
+		start int
+	)
+	flush := func(end int) {
+		if s := strings.TrimSpace(script[start:end]); Fingerprint(s) != "" {
+			stmts = append(stmts, s)
+		}
+	}
+
+	for i := 0; i < len(script); {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(script, i)
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(script)
+			}
+		case c == ';':
+			flush(i)
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+	flush(len(script))
+	return stmts
+}
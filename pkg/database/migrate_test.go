@@ -0,0 +1,49 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "single",
+			script: "CREATE TABLE a (id INT)",
+			want:   []string{"CREATE TABLE a (id INT)"},
+		},
+		{
+			name:   "multiple",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:   "quoted semicolons",
+			script: "INSERT INTO a VALUES ('x;y'); INSERT INTO `b;c` VALUES (\"z;\")",
+			want:   []string{"INSERT INTO a VALUES ('x;y')", "INSERT INTO `b;c` VALUES (\"z;\")"},
+		},
+		{
+			name:   "comments",
+			script: "-- header; with semicolon\nCREATE TABLE a (id INT); /* trailing; */\n-- done\n",
+			want:   []string{"-- header; with semicolon\nCREATE TABLE a (id INT)"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := SplitStatements(tc.script); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("SplitStatements(%q) = %q, want %q", tc.script, got, tc.want)
+			}
+		})
+	}
+}
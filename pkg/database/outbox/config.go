@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"time"
+)
+
+// Config represents the configuration and associated environment variables for
+// the outbox relay.
+type Config struct {
+	// PollInterval is how often the relay looks for pending events.
+	PollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL, default=1s"`
+
+	// BatchSize is the maximum number of events claimed per poll.
+	BatchSize int `env:"OUTBOX_BATCH_SIZE, default=100"`
+
+	// Lease is how long a claimed event is hidden from other relays while it is
+	// being published. It must comfortably exceed the publish timeout.
+	Lease time.Duration `env:"OUTBOX_LEASE, default=30s"`
+
+	// MinBackoff and MaxBackoff bound the exponential delay between attempts to
+	// publish an event that failed.
+	MinBackoff time.Duration `env:"OUTBOX_MIN_BACKOFF, default=1s"`
+	MaxBackoff time.Duration `env:"OUTBOX_MAX_BACKOFF, default=5m"`
+
+	// MaxAttempts is the number of failed attempts after which an event is
+	// parked and no longer retried. Zero retries forever.
+	MaxAttempts int `env:"OUTBOX_MAX_ATTEMPTS, default=25"`
+
+	// Retention is how long delivered events are kept before being deleted, and
+	// CleanupInterval is how often the deletion runs.
+	Retention       time.Duration `env:"OUTBOX_RETENTION, default=168h"`
+	CleanupInterval time.Duration `env:"OUTBOX_CLEANUP_INTERVAL, default=1h"`
+
+	// Publisher is the type of the publisher returned by PublisherFor. The
+	// default, LOG, only logs events and is meant for development.
+	Publisher string `env:"OUTBOX_PUBLISHER, default=LOG"`
+
+	// HTTPURL is the endpoint the HTTP publisher posts events to, and
+	// HTTPTimeout the time allowed for each post. HTTPContentType is the
+	// content type of the payloads.
+	HTTPURL         string        `env:"OUTBOX_HTTP_URL"`
+	HTTPTimeout     time.Duration `env:"OUTBOX_HTTP_TIMEOUT, default=10s"`
+	HTTPContentType string        `env:"OUTBOX_HTTP_CONTENT_TYPE, default=application/json"`
+}
+
+// OutboxConfig returns the outbox configuration.
+func (c *Config) OutboxConfig() *Config {
+	return c
+}
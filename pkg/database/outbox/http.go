@@ -0,0 +1,78 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+func init() {
+	RegisterPublisher("HTTP", NewHTTPPublisher)
+}
+
+// Compile-time check to verify implements interface.
+var _ Publisher = (*HTTPPublisher)(nil)
+
+// HTTPPublisher posts each event to a URL, e.g. a webhook or the HTTP bridge of
+// a message broker. The payload is the body of the request, and the ID, topic
+// and key of the event are sent in the Outbox-Event-Id, Outbox-Topic and
+// Outbox-Key headers. Any response other than 2xx fails the publish.
+type HTTPPublisher struct {
+	client      *http.Client
+	url         string
+	contentType string
+}
+
+// NewHTTPPublisher creates a publisher posting to the OUTBOX_HTTP_URL of cfg.
+func NewHTTPPublisher(_ context.Context, cfg *Config) (Publisher, error) {
+	if cfg.HTTPURL == "" {
+		return nil, fmt.Errorf("missing OUTBOX_HTTP_URL")
+	}
+	u, err := url.Parse(cfg.HTTPURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OUTBOX_HTTP_URL %q, expected an http or https URL", cfg.HTTPURL)
+	}
+	if cfg.HTTPTimeout <= 0 {
+		return nil, fmt.Errorf("OUTBOX_HTTP_TIMEOUT must be positive, got %s", cfg.HTTPTimeout)
+	}
+
+	return &HTTPPublisher{
+		client:      &http.Client{Timeout: cfg.HTTPTimeout},
+		url:         u.String(),
+		contentType: cfg.HTTPContentType,
+	}, nil
+}
+
+// Publish implements Publisher.
+func (p *HTTPPublisher) Publish(ctx context.Context, e *Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(e.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if p.contentType != "" {
+		req.Header.Set("Content-Type", p.contentType)
+	}
+	req.Header.Set("Outbox-Event-Id", strconv.FormatInt(e.ID, 10))
+	req.Header.Set("Outbox-Topic", e.Topic)
+	if e.Key != "" {
+		req.Header.Set("Outbox-Key", e.Key)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so that the connection can be reused.
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s: %q", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+)
+
+func init() {
+	RegisterPublisher("LOG", NewLogPublisher)
+}
+
+// Compile-time check to verify implements interface.
+var _ Publisher = (*LogPublisher)(nil)
+
+// LogPublisher writes events to the default logger instead of sending them
+// anywhere. It marks them delivered all the same, so it is only meant for local
+// development.
+type LogPublisher struct{}
+
+// NewLogPublisher creates a LogPublisher.
+func NewLogPublisher(context.Context, *Config) (Publisher, error) {
+	return &LogPublisher{}, nil
+}
+
+// Publish implements Publisher.
+func (p *LogPublisher) Publish(ctx context.Context, e *Event) error {
+	slog.InfoContext(ctx, "outbox event",
+		"id", e.ID, "topic", e.Topic, "key", e.Key, "payload", string(e.Payload))
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package outbox implements the transactional outbox pattern on top of
+// pkg/database. Events are written to the outbox table in the same transaction
+// as the business change that produced them, and a Relay later publishes them,
+// so that state changes and events can never diverge.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event is a message waiting in, or delivered from, the outbox.
+type Event struct {
+	ID        int64
+	Topic     string
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+
+	// Attempts is the number of failed publish attempts so far.
+	Attempts int
+}
+
+// Publisher delivers events to a downstream system such as a message broker.
+// Publish may be called more than once for the same event, so consumers must
+// be idempotent on Event.ID.
+type Publisher interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface.
+type PublisherFunc func(ctx context.Context, e *Event) error
+
+// Publish implements Publisher.
+func (f PublisherFunc) Publish(ctx context.Context, e *Event) error {
+	return f(ctx, e)
+}
+
+// Enqueue writes events to the outbox inside tx. It is meant to be called from
+// a database.DB.InTx callback, alongside the change the events describe.
+func Enqueue(ctx context.Context, tx *sql.Tx, events ...*Event) error {
+	now := time.Now().UTC()
+	for _, e := range events {
+		if e.Topic == "" {
+			return fmt.Errorf("outbox: event topic is required")
+		}
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = now
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO outbox
+				(topic, event_key, payload, created_at, attempts, next_attempt_at)
+			VALUES
+				(?, ?, ?, ?, 0, ?)`,
+			e.Topic, e.Key, e.Payload, e.CreatedAt, e.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("inserting outbox event: %w", err)
+		}
+		if e.ID, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("reading outbox event id: %w", err)
+		}
+	}
+	return nil
+}
+
+// MemoryPublisher is a Publisher that records events in memory. It is intended
+// for tests.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+// Publish implements Publisher.
+func (p *MemoryPublisher) Publish(_ context.Context, e *Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cp := *e
+	p.events = append(p.events, &cp)
+	return nil
+}
+
+// Events returns the events published so far, in publish order.
+func (p *MemoryPublisher) Events() []*Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*Event(nil), p.events...)
+}
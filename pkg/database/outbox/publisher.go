@@ -0,0 +1,57 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// NewPublisherFunc creates a Publisher from the outbox configuration.
+type NewPublisherFunc func(context.Context, *Config) (Publisher, error)
+
+var (
+	publishers     = map[string]NewPublisherFunc{}
+	publishersLock sync.RWMutex
+)
+
+// RegisterPublisher registers a new publisher with the given name. If a
+// publisher is already registered with the given name, it panics. Publishers
+// are usually registered via an init function.
+func RegisterPublisher(name string, fn NewPublisherFunc) {
+	publishersLock.Lock()
+	defer publishersLock.Unlock()
+
+	if _, ok := publishers[name]; ok {
+		panic(fmt.Sprintf("outbox publisher %q is already registered", name))
+	}
+	publishers[name] = fn
+}
+
+// RegisteredPublishers returns the list of the names of the registered
+// publishers.
+func RegisteredPublishers() []string {
+	publishersLock.RLock()
+	defer publishersLock.RUnlock()
+
+	list := make([]string, 0, len(publishers))
+	for k := range publishers {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// PublisherFor returns the publisher of the type of cfg, or an error if one
+// does not exist.
+func PublisherFor(ctx context.Context, cfg *Config) (Publisher, error) {
+	publishersLock.RLock()
+	defer publishersLock.RUnlock()
+
+	name := cfg.Publisher
+	fn, ok := publishers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown or uncompiled outbox publisher %q", name)
+	}
+	return fn(ctx, cfg)
+}
@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPPublisher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var got *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got, body = r, string(b)
+		if r.Header.Get("Outbox-Topic") == "rejected" {
+			http.Error(w, "no such topic", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := PublisherFor(ctx, &Config{
+		Publisher:       "HTTP",
+		HTTPURL:         srv.URL + "/events",
+		HTTPTimeout:     time.Second,
+		HTTPContentType: "application/json",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Publish(ctx, &Event{ID: 42, Topic: "payment.created", Key: "7", Payload: []byte(`{"bill_id":7}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != http.MethodPost || got.URL.Path != "/events" {
+		t.Errorf("expected a POST to /events, got %s %s", got.Method, got.URL.Path)
+	}
+	if body != `{"bill_id":7}` {
+		t.Errorf("expected the payload as body, got %q", body)
+	}
+	for k, want := range map[string]string{
+		"Content-Type":    "application/json",
+		"Outbox-Event-Id": "42",
+		"Outbox-Topic":    "payment.created",
+		"Outbox-Key":      "7",
+	} {
+		if v := got.Header.Get(k); v != want {
+			t.Errorf("expected %s %q, got %q", k, want, v)
+		}
+	}
+
+	err = p.Publish(ctx, &Event{ID: 43, Topic: "rejected"})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no such topic") {
+		t.Errorf("expected the publish to fail with the response, got %v", err)
+	}
+}
+
+func TestPublisherFor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cases := []struct {
+		name   string
+		config *Config
+		err    string
+	}{
+		{"http", &Config{Publisher: "HTTP", HTTPURL: "https://events.example.com/", HTTPTimeout: time.Second}, ""},
+		{"http_without_url", &Config{Publisher: "HTTP", HTTPTimeout: time.Second}, "missing OUTBOX_HTTP_URL"},
+		{"http_invalid_url", &Config{Publisher: "HTTP", HTTPURL: "events.example.com", HTTPTimeout: time.Second}, "invalid OUTBOX_HTTP_URL"},
+		{"http_without_timeout", &Config{Publisher: "HTTP", HTTPURL: "https://events.example.com/"}, "OUTBOX_HTTP_TIMEOUT"},
+		{"log", &Config{Publisher: "LOG"}, ""},
+		{"unknown", &Config{Publisher: "KAFKA"}, "unknown or uncompiled outbox publisher"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := PublisherFor(ctx, tc.config)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil || p == nil {
+				t.Errorf("expected a publisher, got %v", err)
+			}
+		})
+	}
+
+	if got, want := RegisteredPublishers(), []string{"HTTP", "LOG"}; !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+)
+
+// Relay moves events from the outbox table to a Publisher. Several relays may
+// run against the same table; claimed events are leased so that each one is
+// normally published by a single relay at a time.
+type Relay struct {
+	config    *Config
+	store     store
+	publisher Publisher
+	now       func() time.Time
+}
+
+// NewRelay creates a relay that publishes events stored in db.
+func NewRelay(db *database.DB, publisher Publisher, config *Config) (*Relay, error) {
+	if db == nil {
+		return nil, fmt.Errorf("missing database")
+	}
+	return newRelay(&sqlStore{db: db}, publisher, config)
+}
+
+func newRelay(s store, publisher Publisher, config *Config) (*Relay, error) {
+	if publisher == nil {
+		return nil, fmt.Errorf("missing publisher")
+	}
+	if config.BatchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive, got %d", config.BatchSize)
+	}
+	if config.PollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be positive, got %s", config.PollInterval)
+	}
+	if config.CleanupInterval <= 0 {
+		return nil, fmt.Errorf("cleanup interval must be positive, got %s", config.CleanupInterval)
+	}
+
+	return &Relay{
+		config:    config,
+		store:     s,
+		publisher: publisher,
+		now:       func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+// Run polls the outbox and publishes pending events until ctx is done. It also
+// deletes delivered events older than the configured retention.
+func (r *Relay) Run(ctx context.Context) error {
+	poll := time.NewTicker(r.config.PollInterval)
+	defer poll.Stop()
+
+	cleanup := time.NewTicker(r.config.CleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-poll.C:
+			// Keep draining while full batches come back.
+			for {
+				n, err := r.RelayOnce(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "outbox relay failed", "error", err)
+				}
+				if err != nil || n < r.config.BatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+
+		case <-cleanup.C:
+			n, err := r.Cleanup(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "outbox cleanup failed", "error", err)
+				continue
+			}
+			slog.DebugContext(ctx, "outbox cleanup", "deleted", n)
+		}
+	}
+}
+
+// RelayOnce claims a single batch of pending events and tries to publish each
+// of them. It returns the number of events claimed. Events that fail to
+// publish are rescheduled with exponential backoff.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	now := r.now()
+	events, err := r.store.claim(ctx, now, r.config.Lease, r.config.BatchSize, r.config.MaxAttempts)
+	if err != nil {
+		return 0, fmt.Errorf("claiming events: %w", err)
+	}
+
+	for _, e := range events {
+		if err := r.publisher.Publish(ctx, e); err != nil {
+			attempts := e.Attempts + 1
+			next := r.now().Add(r.backoff(attempts))
+			slog.WarnContext(ctx, "failed to publish outbox event",
+				"id", e.ID, "topic", e.Topic, "attempts", attempts, "next_attempt", next, "error", err)
+
+			if err := r.store.failed(ctx, e.ID, attempts, next, err.Error()); err != nil {
+				return len(events), err
+			}
+			continue
+		}
+
+		if err := r.store.delivered(ctx, e.ID, r.now()); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// Cleanup deletes events delivered longer ago than the configured retention and
+// returns how many were removed.
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	return r.store.purge(ctx, r.now().Add(-r.config.Retention))
+}
+
+// backoff returns the delay before the given attempt: MinBackoff doubled for
+// every previous failure, capped at MaxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.config.MinBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d <= 0 || d >= r.config.MaxBackoff {
+			return r.config.MaxBackoff
+		}
+	}
+	if d > r.config.MaxBackoff {
+		return r.config.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,293 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is an in-memory store used to test the relay without a database.
+type memoryStore struct {
+	mu   sync.Mutex
+	rows map[int64]*memoryRow
+}
+
+type memoryRow struct {
+	event       Event
+	nextAttempt time.Time
+	delivered   time.Time
+	lastError   string
+}
+
+func newMemoryStore(now time.Time, events ...*Event) *memoryStore {
+	s := &memoryStore{rows: make(map[int64]*memoryRow)}
+	for i, e := range events {
+		e.ID = int64(i + 1)
+		s.rows[e.ID] = &memoryRow{event: *e, nextAttempt: now}
+	}
+	return s
+}
+
+func (s *memoryStore) claim(_ context.Context, now time.Time, lease time.Duration, limit, maxAttempts int) ([]*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int64, 0, len(s.rows))
+	for id := range s.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var out []*Event
+	for _, id := range ids {
+		r := s.rows[id]
+		if !r.delivered.IsZero() || r.nextAttempt.After(now) {
+			continue
+		}
+		if maxAttempts > 0 && r.event.Attempts >= maxAttempts {
+			continue
+		}
+		if len(out) == limit {
+			break
+		}
+		r.nextAttempt = now.Add(lease)
+		e := r.event
+		out = append(out, &e)
+	}
+	return out, nil
+}
+
+func (s *memoryStore) delivered(_ context.Context, id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rows[id].delivered = at
+	return nil
+}
+
+func (s *memoryStore) failed(_ context.Context, id int64, attempts int, next time.Time, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.rows[id]
+	r.event.Attempts = attempts
+	r.nextAttempt = next
+	r.lastError = reason
+	return nil
+}
+
+func (s *memoryStore) purge(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, r := range s.rows {
+		if !r.delivered.IsZero() && r.delivered.Before(before) {
+			delete(s.rows, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func testConfig() *Config {
+	return &Config{
+		PollInterval:    time.Second,
+		BatchSize:       2,
+		Lease:           30 * time.Second,
+		MinBackoff:      time.Second,
+		MaxBackoff:      10 * time.Second,
+		MaxAttempts:     3,
+		Retention:       time.Hour,
+		CleanupInterval: time.Hour,
+	}
+}
+
+// testClock is a manually advanced clock.
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestRelayOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := &testClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	s := newMemoryStore(clock.now(),
+		&Event{Topic: "payment.created", Key: "1"},
+		&Event{Topic: "payment.created", Key: "2"},
+		&Event{Topic: "payment.created", Key: "3"},
+	)
+	pub := &MemoryPublisher{}
+
+	r, err := newRelay(s, pub, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.now = clock.now
+
+	n, err := r.RelayOnce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 2; got != want {
+		t.Errorf("expected %d events claimed, got %d", want, got)
+	}
+
+	if _, err := r.RelayOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := pub.Events()
+	if got, want := len(events), 3; got != want {
+		t.Fatalf("expected %d events published, got %d", want, got)
+	}
+	for i, e := range events {
+		if got, want := e.ID, int64(i+1); got != want {
+			t.Errorf("expected event %d to have id %d, got %d", i, want, got)
+		}
+	}
+
+	// Nothing is left to publish.
+	if n, err := r.RelayOnce(ctx); err != nil || n != 0 {
+		t.Errorf("expected no pending events, got %d (err: %v)", n, err)
+	}
+}
+
+func TestRelayOnce_retries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := &testClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := newMemoryStore(clock.now(), &Event{Topic: "payment.created"})
+
+	var mu sync.Mutex
+	calls := 0
+	pub := PublisherFunc(func(context.Context, *Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return errors.New("broker unavailable")
+	})
+
+	r, err := newRelay(s, pub, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.now = clock.now
+
+	for _, step := range []struct {
+		advance time.Duration
+		claimed int
+	}{
+		{0, 1},                      // first attempt
+		{500 * time.Millisecond, 0}, // backing off for 1s
+		{500 * time.Millisecond, 1}, // second attempt
+		{time.Second, 0},            // backing off for 2s
+		{time.Second, 1},            // third attempt
+		{time.Hour, 0},              // MaxAttempts reached, parked
+	} {
+		clock.advance(step.advance)
+		n, err := r.RelayOnce(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != step.claimed {
+			t.Fatalf("at %s: expected %d events claimed, got %d", clock.now(), step.claimed, n)
+		}
+	}
+
+	if got, want := calls, 3; got != want {
+		t.Errorf("expected %d publish attempts, got %d", want, got)
+	}
+	if got, want := s.rows[1].lastError, "broker unavailable"; got != want {
+		t.Errorf("expected last error %q, got %q", want, got)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := &testClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := newMemoryStore(clock.now(), &Event{Topic: "a"}, &Event{Topic: "b"})
+
+	r, err := newRelay(s, &MemoryPublisher{}, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.now = clock.now
+
+	if _, err := r.RelayOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Still inside the retention window.
+	clock.advance(30 * time.Minute)
+	if n, err := r.Cleanup(ctx); err != nil || n != 0 {
+		t.Fatalf("expected nothing purged, got %d (err: %v)", n, err)
+	}
+
+	clock.advance(time.Hour)
+	if n, err := r.Cleanup(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 events purged, got %d (err: %v)", n, err)
+	}
+}
+
+func TestNewRelay_invalidConfig(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		modify func(*Config)
+		err    string
+	}{
+		{"batch_size", func(c *Config) { c.BatchSize = 0 }, "batch size"},
+		{"poll_interval", func(c *Config) { c.PollInterval = 0 }, "poll interval"},
+		{"negative_poll_interval", func(c *Config) { c.PollInterval = -time.Second }, "poll interval"},
+		{"cleanup_interval", func(c *Config) { c.CleanupInterval = 0 }, "cleanup interval"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := testConfig()
+			tc.modify(config)
+			if _, err := newRelay(newMemoryStore(time.Now()), &MemoryPublisher{}, config); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	r := &Relay{config: testConfig()}
+
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, tc := range cases {
+		if got := r.backoff(tc.attempts); got != tc.want {
+			t.Errorf("backoff(%d) = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
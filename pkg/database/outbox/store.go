@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+)
+
+// store is the persistence used by the Relay. It is an interface so that the
+// relay logic can be exercised without a database.
+type store interface {
+	// claim leases up to limit pending events that are due at now and have
+	// failed fewer than maxAttempts times (zero means no limit), hiding them
+	// from other relays until now+lease.
+	claim(ctx context.Context, now time.Time, lease time.Duration, limit, maxAttempts int) ([]*Event, error)
+
+	// delivered marks the event as published at the given time.
+	delivered(ctx context.Context, id int64, at time.Time) error
+
+	// failed records a failed attempt and schedules the next one.
+	failed(ctx context.Context, id int64, attempts int, next time.Time, reason string) error
+
+	// purge deletes events delivered before the given time.
+	purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// sqlStore is the store backed by the outbox table.
+type sqlStore struct {
+	db *database.DB
+}
+
+func (s *sqlStore) claim(ctx context.Context, now time.Time, lease time.Duration, limit, maxAttempts int) ([]*Event, error) {
+	var events []*Event
+
+	err := s.db.InTx(ctx, nil, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, topic, event_key, payload, created_at, attempts
+			FROM outbox
+			WHERE delivered_at IS NULL AND next_attempt_at <= ?`
+		args := []any{now}
+		if maxAttempts > 0 {
+			query += ` AND attempts < ?`
+			args = append(args, maxAttempts)
+		}
+		query += ` ORDER BY id LIMIT ? FOR UPDATE`
+		args = append(args, limit)
+
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("selecting pending events: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e Event
+			if err := rows.Scan(&e.ID, &e.Topic, &e.Key, &e.Payload, &e.CreatedAt, &e.Attempts); err != nil {
+				return fmt.Errorf("scanning pending event: %w", err)
+			}
+			events = append(events, &e)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("iterating pending events: %w", err)
+		}
+
+		for _, e := range events {
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE outbox SET next_attempt_at = ? WHERE id = ?`,
+				now.Add(lease), e.ID); err != nil {
+				return fmt.Errorf("leasing event %d: %w", e.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (s *sqlStore) delivered(ctx context.Context, id int64, at time.Time) error {
+	if _, err := s.db.Pool.ExecContext(ctx,
+		`UPDATE outbox SET delivered_at = ?, last_error = NULL WHERE id = ?`,
+		at, id); err != nil {
+		return fmt.Errorf("marking event %d delivered: %w", id, err)
+	}
+	return nil
+}
+
+func (s *sqlStore) failed(ctx context.Context, id int64, attempts int, next time.Time, reason string) error {
+	if _, err := s.db.Pool.ExecContext(ctx,
+		`UPDATE outbox SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?`,
+		attempts, next, reason, id); err != nil {
+		return fmt.Errorf("marking event %d failed: %w", id, err)
+	}
+	return nil
+}
+
+func (s *sqlStore) purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.Pool.ExecContext(ctx,
+		`DELETE FROM outbox WHERE delivered_at IS NOT NULL AND delivered_at < ?`,
+		before)
+	if err != nil {
+		return 0, fmt.Errorf("deleting delivered events: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database/dbtest"
+)
+
+var testDatabaseInstance *dbtest.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = dbtest.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+func TestEnqueueAndRelay(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t)
+
+	events := []*Event{
+		{Topic: "payment.created", Key: "1", Payload: []byte(`{"id":1}`)},
+		{Topic: "payment.created", Key: "2", Payload: []byte(`{"id":2}`)},
+	}
+	if err := db.InTx(ctx, nil, func(tx *sql.Tx) error {
+		return Enqueue(ctx, tx, events...)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rolled back transaction leaves nothing behind.
+	if err := db.InTx(ctx, nil, func(tx *sql.Tx) error {
+		if err := Enqueue(ctx, tx, &Event{Topic: "payment.created", Key: "3"}); err != nil {
+			return err
+		}
+		return sql.ErrTxDone
+	}); err == nil {
+		t.Fatal("expected transaction to fail")
+	}
+
+	pub := &MemoryPublisher{}
+	r, err := NewRelay(db, pub, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.RelayOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := pub.Events()
+	if len(got) != len(events) {
+		t.Fatalf("expected %d events published, got %d", len(events), len(got))
+	}
+	for i, e := range got {
+		if e.ID != events[i].ID || e.Key != events[i].Key || string(e.Payload) != string(events[i].Payload) {
+			t.Errorf("event %d: expected %+v, got %+v", i, events[i], e)
+		}
+	}
+
+	// Delivered events are not relayed again, and are purged after retention.
+	if n, err := r.RelayOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("expected no pending events, got %d (err: %v)", n, err)
+	}
+	r.now = func() time.Time { return time.Now().UTC().Add(r.config.Retention + time.Minute) }
+	if n, err := r.Cleanup(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 events purged, got %d (err: %v)", n, err)
+	}
+}
@@ -0,0 +1,205 @@
+// Package errors is the catalogue of application errors shared by our
+// services.
+//
+// Every error has a stable Code, such as PAYMENT_DECLINED, that clients can
+// rely on. On gRPC, an *Error becomes a status whose code comes from the
+// catalogue, with google.rpc.ErrorInfo, RetryInfo and LocalizedMessage
+// details. On HTTP, it becomes an RFC 7807 problem details document. Clients
+// decode both back into an *Error with FromError and FromResponse.
+package errors
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Domain is the ErrorInfo domain of the errors of the catalogue.
+const Domain = "microservice-blueprint.paveletto99.github.com"
+
+// DefaultLocale is the locale of the messages of the catalogue.
+const DefaultLocale = "en-US"
+
+// Code identifies an application error. Codes are part of the API: once
+// published, they must not be renamed.
+type Code string
+
+// Codes of the catalogue.
+const (
+	Internal           Code = "INTERNAL"
+	ServiceUnavailable Code = "SERVICE_UNAVAILABLE"
+	RateLimited        Code = "RATE_LIMITED"
+
+	PaymentNotFound      Code = "PAYMENT_NOT_FOUND"
+	PaymentDeclined      Code = "PAYMENT_DECLINED"
+	InsufficientFunds    Code = "INSUFFICIENT_FUNDS"
+	InvalidAmount        Code = "INVALID_AMOUNT"
+	CurrencyMismatch     Code = "CURRENCY_MISMATCH"
+	IllegalTransition    Code = "ILLEGAL_STATUS_TRANSITION"
+	IdempotencyKeyReused Code = "IDEMPOTENCY_KEY_REUSED"
+)
+
+// Definition describes how the errors of a code are represented.
+type Definition struct {
+	// GRPCCode and HTTPStatus are the status codes of the errors.
+	GRPCCode   codes.Code
+	HTTPStatus int
+
+	// Title is a short, human-readable summary of the problem, in the default
+	// locale. It is the title of problem details and the default localized
+	// message shown to end users.
+	Title string
+}
+
+// catalogue is the list of registered codes.
+var (
+	catalogue = map[Code]Definition{
+		Internal:           {codes.Internal, http.StatusInternalServerError, "Something went wrong on our side."},
+		ServiceUnavailable: {codes.Unavailable, http.StatusServiceUnavailable, "The service is temporarily unavailable."},
+		RateLimited:        {codes.ResourceExhausted, http.StatusTooManyRequests, "Too many requests, try again later."},
+
+		PaymentNotFound:      {codes.NotFound, http.StatusNotFound, "The payment does not exist."},
+		PaymentDeclined:      {codes.FailedPrecondition, http.StatusPaymentRequired, "The payment was declined."},
+		InsufficientFunds:    {codes.FailedPrecondition, http.StatusPaymentRequired, "There are not enough funds for the payment."},
+		InvalidAmount:        {codes.InvalidArgument, http.StatusBadRequest, "The amount is not valid."},
+		CurrencyMismatch:     {codes.InvalidArgument, http.StatusBadRequest, "The currency does not match the payment."},
+		IllegalTransition:    {codes.FailedPrecondition, http.StatusConflict, "The payment does not allow this operation in its current status."},
+		IdempotencyKeyReused: {codes.FailedPrecondition, http.StatusUnprocessableEntity, "The idempotency key was already used with a different request."},
+	}
+	catalogueLock sync.RWMutex
+)
+
+// Register adds a code to the catalogue. If the code is already registered,
+// it panics. Codes are usually registered via an init function.
+func Register(code Code, def Definition) {
+	catalogueLock.Lock()
+	defer catalogueLock.Unlock()
+
+	if _, ok := catalogue[code]; ok {
+		panic(fmt.Sprintf("error code %q is already registered", code))
+	}
+	catalogue[code] = def
+}
+
+// Codes returns the list of the registered codes.
+func Codes() []Code {
+	catalogueLock.RLock()
+	defer catalogueLock.RUnlock()
+
+	list := make([]Code, 0, len(catalogue))
+	for k := range catalogue {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// Lookup returns the definition of code. Unknown codes are defined as
+// Internal.
+func Lookup(code Code) Definition {
+	catalogueLock.RLock()
+	defer catalogueLock.RUnlock()
+
+	if def, ok := catalogue[code]; ok {
+		return def
+	}
+	return catalogue[Internal]
+}
+
+// Error is an application error. Only its code, message, metadata, retry
+// delay and localized message are sent to clients, never its cause.
+type Error struct {
+	Code Code
+
+	// Message explains the error to developers, in English.
+	Message string
+
+	// Metadata holds structured details of the error, e.g. the ID of the
+	// payment. It is sent as ErrorInfo metadata.
+	Metadata map[string]string
+
+	// RetryAfter, when positive, is how long clients should wait before
+	// retrying.
+	RetryAfter time.Duration
+
+	// Locale and LocalizedMessage are the message shown to end users. They
+	// default to the title of the code in DefaultLocale.
+	Locale           string
+	LocalizedMessage string
+
+	cause error
+}
+
+// New returns an error with the given code and message.
+func New(code Code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap is New for an error caused by err. The cause is available to
+// errors.Is and errors.As, and is logged, but is not sent to clients.
+func Wrap(err error, code Code, format string, args ...any) *Error {
+	e := New(code, format, args...)
+	e.cause = err
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// WithMetadata sets a metadata entry and returns e.
+func (e *Error) WithMetadata(key, value string) *Error {
+	if e.Metadata == nil {
+		e.Metadata = make(map[string]string)
+	}
+	e.Metadata[key] = value
+	return e
+}
+
+// WithRetryAfter sets the retry delay and returns e.
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	e.RetryAfter = d
+	return e
+}
+
+// WithLocalizedMessage sets the message shown to end users and returns e.
+func (e *Error) WithLocalizedMessage(locale, msg string) *Error {
+	e.Locale, e.LocalizedMessage = locale, msg
+	return e
+}
+
+// localized returns the locale and message shown to end users.
+func (e *Error) localized() (string, string) {
+	if e.LocalizedMessage != "" {
+		return e.Locale, e.LocalizedMessage
+	}
+	return DefaultLocale, Lookup(e.Code).Title
+}
+
+// CodeOf returns the code of err as decoded by FromError, Internal if it has
+// none, or "" if err is nil.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	if e, ok := FromError(err); ok {
+		return e.Code
+	}
+	return Internal
+}
+
+// HasCode reports whether err has the given code.
+func HasCode(err error, code Code) bool {
+	return err != nil && CodeOf(err) == code
+}
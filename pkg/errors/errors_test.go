@@ -0,0 +1,238 @@
+package errors_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+func TestCodeOf(t *testing.T) {
+	t.Parallel()
+
+	declined := apperrors.New(apperrors.PaymentDeclined, "declined by issuer")
+
+	cases := []struct {
+		name string
+		err  error
+		want apperrors.Code
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "error", err: declined, want: apperrors.PaymentDeclined},
+		{name: "wrapped", err: fmt.Errorf("authorize: %w", declined), want: apperrors.PaymentDeclined},
+		{name: "status", err: status.Convert(declined).Err(), want: apperrors.PaymentDeclined},
+		{name: "other status", err: status.Error(codes.NotFound, "not found"), want: apperrors.Internal},
+		{name: "plain", err: stderrors.New("oops"), want: apperrors.Internal},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := apperrors.CodeOf(tc.err); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	t.Parallel()
+
+	cause := stderrors.New("connection reset")
+	err := apperrors.Wrap(cause, apperrors.Internal, "failed to authorize")
+
+	if !stderrors.Is(err, cause) {
+		t.Errorf("expected the cause to be unwrapped")
+	}
+	if msg := status.Convert(err).Message(); msg != "failed to authorize" {
+		t.Errorf("expected the cause to stay out of the status, got %q", msg)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	code := apperrors.Code("TEST_CARD_EXPIRED")
+	apperrors.Register(code, apperrors.Definition{GRPCCode: codes.FailedPrecondition, HTTPStatus: http.StatusPaymentRequired, Title: "The card expired."})
+
+	if got := apperrors.Lookup(code).HTTPStatus; got != http.StatusPaymentRequired {
+		t.Errorf("expected 402, got %d", got)
+	}
+	if got := apperrors.Lookup("NOT_REGISTERED").GRPCCode; got != codes.Internal {
+		t.Errorf("expected unknown codes to be Internal, got %v", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering %s twice to panic", code)
+		}
+	}()
+	apperrors.Register(code, apperrors.Definition{})
+}
+
+// failingHealth fails every call of the health service with err, so that
+// errors cross the wire.
+type failingHealth struct {
+	healthpb.UnimplementedHealthServer
+	err error
+}
+
+func (f *failingHealth) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	return nil, f.err
+}
+
+func (f *failingHealth) Watch(*healthpb.HealthCheckRequest, grpc.ServerStreamingServer[healthpb.HealthCheckResponse]) error {
+	return f.err
+}
+
+func TestGRPC(t *testing.T) {
+	t.Parallel()
+
+	want := apperrors.New(apperrors.InsufficientFunds, "balance too low").
+		WithMetadata("bill_id", "42").
+		WithRetryAfter(30*time.Second).
+		WithLocalizedMessage("it-IT", "Fondi insufficienti.")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, &failingHealth{err: want})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(apperrors.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(apperrors.StreamClientInterceptor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := healthpb.NewHealthClient(conn)
+
+	check := func(t *testing.T, err error) {
+		t.Helper()
+
+		if got := status.Code(err); got != codes.FailedPrecondition {
+			t.Errorf("expected FailedPrecondition, got %v", got)
+		}
+		got, ok := err.(*apperrors.Error)
+		if !ok {
+			t.Fatalf("expected an *Error, got %T", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %#v, got %#v", want, got)
+		}
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		check(t, err)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+
+		stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = stream.Recv()
+		check(t, err)
+	})
+}
+
+func TestHTTP(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		err        error
+		wantStatus int
+		want       *apperrors.Error
+	}{
+		{
+			name:       "declined",
+			err:        apperrors.New(apperrors.PaymentDeclined, "declined by issuer").WithMetadata("bill_id", "42"),
+			wantStatus: http.StatusPaymentRequired,
+			want: &apperrors.Error{
+				Code:             apperrors.PaymentDeclined,
+				Message:          "declined by issuer",
+				Metadata:         map[string]string{"bill_id": "42"},
+				Locale:           apperrors.DefaultLocale,
+				LocalizedMessage: "The payment was declined.",
+			},
+		},
+		{
+			name:       "rate limited",
+			err:        apperrors.New(apperrors.RateLimited, "slow down").WithRetryAfter(1500 * time.Millisecond),
+			wantStatus: http.StatusTooManyRequests,
+			want: &apperrors.Error{
+				Code:             apperrors.RateLimited,
+				Message:          "slow down",
+				RetryAfter:       2 * time.Second,
+				Locale:           apperrors.DefaultLocale,
+				LocalizedMessage: "Too many requests, try again later.",
+			},
+		},
+		{
+			name:       "unexpected",
+			err:        stderrors.New("secret database details"),
+			wantStatus: http.StatusInternalServerError,
+			want: &apperrors.Error{
+				Code:             apperrors.Internal,
+				Message:          "internal error",
+				Locale:           apperrors.DefaultLocale,
+				LocalizedMessage: "Something went wrong on our side.",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			apperrors.WriteProblem(w, httptest.NewRequest(http.MethodPost, "/payments", nil), tc.err)
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("expected status %d, got %d", tc.wantStatus, resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != apperrors.ProblemContentType {
+				t.Errorf("expected content type %s, got %s", apperrors.ProblemContentType, ct)
+			}
+
+			got, ok := apperrors.FromResponse(resp)
+			if !ok {
+				t.Fatal("expected problem details")
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %#v, got %#v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// GRPCStatus returns the status of e, with its code from the catalogue and
+// ErrorInfo, RetryInfo and LocalizedMessage details. It lets handlers return
+// e as is.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(Lookup(e.Code).GRPCCode, e.Message)
+
+	locale, msg := e.localized()
+	details := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{Reason: string(e.Code), Domain: Domain, Metadata: e.Metadata},
+		&errdetails.LocalizedMessage{Locale: locale, Message: msg},
+	}
+	if e.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(e.RetryAfter)})
+	}
+	if detailed, err := st.WithDetails(details...); err == nil {
+		return detailed
+	}
+	return st
+}
+
+// FromError returns the *Error in err's chain or, for a status sent by one of
+// our services, decodes it from the status details. It returns false for
+// other errors.
+func FromError(err error) (*Error, bool) {
+	if err == nil {
+		return nil, false
+	}
+	var e *Error
+	if stderrors.As(err, &e) {
+		return e, true
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil, false
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.GetDomain() == Domain {
+			e = &Error{Code: Code(info.GetReason()), Message: st.Message(), Metadata: info.GetMetadata()}
+			break
+		}
+	}
+	if e == nil {
+		return nil, false
+	}
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.RetryInfo:
+			e.RetryAfter = d.GetRetryDelay().AsDuration()
+		case *errdetails.LocalizedMessage:
+			e.Locale, e.LocalizedMessage = d.GetLocale(), d.GetMessage()
+		}
+	}
+	return e, true
+}
+
+// UnaryClientInterceptor decodes the errors of unary calls into *Error when
+// they come from one of our services. Other errors are returned as they are.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return decode(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
+
+// StreamClientInterceptor is UnaryClientInterceptor for streams.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, decode(err)
+		}
+		return &decodingStream{ClientStream: stream}, nil
+	}
+}
+
+type decodingStream struct {
+	grpc.ClientStream
+}
+
+func (s *decodingStream) RecvMsg(m any) error {
+	return decode(s.ClientStream.RecvMsg(m))
+}
+
+func decode(err error) error {
+	if e, ok := FromError(err); ok {
+		return e
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package errors
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProblemContentType is the media type of problem details documents.
+const ProblemContentType = "application/problem+json"
+
+// typePrefix prefixes the code in the type URI of problem details.
+const typePrefix = "urn:problem-type:" + Domain + ":"
+
+// Problem is an RFC 7807 problem details document. Code, Metadata and
+// LocalizedMessage are extension members.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	Code             Code              `json:"code"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	LocalizedMessage string            `json:"localized_message,omitempty"`
+}
+
+// Problem returns the problem details of e. The title is the one of its code
+// in the catalogue, the detail its message.
+func (e *Error) Problem() *Problem {
+	def := Lookup(e.Code)
+	_, msg := e.localized()
+	return &Problem{
+		Type:             typePrefix + string(e.Code),
+		Title:            def.Title,
+		Status:           def.HTTPStatus,
+		Detail:           e.Message,
+		Code:             e.Code,
+		Metadata:         e.Metadata,
+		LocalizedMessage: msg,
+	}
+}
+
+// WriteProblem writes err as problem details. Errors other than *Error are
+// logged and written as Internal, so that their details don't leak. The retry
+// delay is also sent as a Retry-After header, and the locale of the localized
+// message as Content-Language.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	e, ok := FromError(err)
+	if !ok {
+		slog.ErrorContext(r.Context(), "request failed", "path", r.URL.Path, "error", err)
+		e = New(Internal, "internal error")
+	}
+
+	p := e.Problem()
+	p.Instance = r.URL.Path
+
+	h := w.Header()
+	h.Set("Content-Type", ProblemContentType)
+	if locale, _ := e.localized(); locale != "" {
+		h.Set("Content-Language", locale)
+	}
+	if e.RetryAfter > 0 {
+		// Retry-After is in whole seconds, round up so clients don't come back
+		// too early.
+		h.Set("Retry-After", strconv.FormatInt(int64((e.RetryAfter+time.Second-1)/time.Second), 10))
+	}
+	w.WriteHeader(p.Status)
+
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write problem details", "error", err)
+	}
+}
+
+// FromResponse decodes the problem details of a failed response into an
+// *Error, like FromError does for gRPC. It returns false if the body is not a
+// problem details document of one of our services. The body is consumed but
+// not closed.
+func FromResponse(resp *http.Response) (*Error, bool) {
+	mt, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mt != ProblemContentType {
+		return nil, false
+	}
+
+	var p Problem
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&p); err != nil {
+		return nil, false
+	}
+	if !strings.HasPrefix(p.Type, typePrefix) || p.Code == "" {
+		return nil, false
+	}
+
+	e := &Error{
+		Code:             p.Code,
+		Message:          p.Detail,
+		Metadata:         p.Metadata,
+		Locale:           resp.Header.Get("Content-Language"),
+		LocalizedMessage: p.LocalizedMessage,
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		e.RetryAfter = time.Duration(s) * time.Second
+	}
+	return e, true
+}
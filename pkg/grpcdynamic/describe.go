@@ -0,0 +1,110 @@
+package grpcdynamic
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Describe renders d in the .proto syntax, e.g. a service with its methods or
+// a message with its fields. Nested messages and enums are rendered too, but
+// not the types of fields, which can be described on their own.
+func Describe(d protoreflect.Descriptor) string {
+	var b strings.Builder
+	describe(&b, d, "")
+	return b.String()
+}
+
+func describe(b *strings.Builder, d protoreflect.Descriptor, indent string) {
+	switch d := d.(type) {
+	case protoreflect.ServiceDescriptor:
+		fmt.Fprintf(b, "%sservice %s {\n", indent, d.Name())
+		for i := 0; i < d.Methods().Len(); i++ {
+			describe(b, d.Methods().Get(i), indent+"  ")
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+
+	case protoreflect.MethodDescriptor:
+		fmt.Fprintf(b, "%srpc %s(%s%s) returns (%s%s);\n", indent, d.Name(),
+			streamPrefix(d.IsStreamingClient()), d.Input().FullName(),
+			streamPrefix(d.IsStreamingServer()), d.Output().FullName())
+
+	case protoreflect.MessageDescriptor:
+		fmt.Fprintf(b, "%smessage %s {\n", indent, d.Name())
+		for i := 0; i < d.Enums().Len(); i++ {
+			describe(b, d.Enums().Get(i), indent+"  ")
+		}
+		for i := 0; i < d.Messages().Len(); i++ {
+			// Map entries are rendered as the map fields using them.
+			if m := d.Messages().Get(i); !m.IsMapEntry() {
+				describe(b, m, indent+"  ")
+			}
+		}
+		for i := 0; i < d.Fields().Len(); i++ {
+			f := d.Fields().Get(i)
+			if o := f.ContainingOneof(); o != nil && !o.IsSynthetic() {
+				// Oneofs are rendered at their first field.
+				if o.Fields().Get(0) != f {
+					continue
+				}
+				fmt.Fprintf(b, "%s  oneof %s {\n", indent, o.Name())
+				for j := 0; j < o.Fields().Len(); j++ {
+					describe(b, o.Fields().Get(j), indent+"    ")
+				}
+				fmt.Fprintf(b, "%s  }\n", indent)
+				continue
+			}
+			describe(b, f, indent+"  ")
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+
+	case protoreflect.FieldDescriptor:
+		label := ""
+		switch {
+		case d.IsMap():
+		case d.IsList():
+			label = "repeated "
+		case d.Cardinality() == protoreflect.Required:
+			label = "required "
+		case d.HasOptionalKeyword():
+			label = "optional "
+		}
+		fmt.Fprintf(b, "%s%s%s %s = %d;\n", indent, label, fieldType(d), d.Name(), d.Number())
+
+	case protoreflect.EnumDescriptor:
+		fmt.Fprintf(b, "%senum %s {\n", indent, d.Name())
+		for i := 0; i < d.Values().Len(); i++ {
+			describe(b, d.Values().Get(i), indent+"  ")
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+
+	case protoreflect.EnumValueDescriptor:
+		fmt.Fprintf(b, "%s%s = %d;\n", indent, d.Name(), d.Number())
+
+	default:
+		fmt.Fprintf(b, "%s%s\n", indent, d.FullName())
+	}
+}
+
+func streamPrefix(streaming bool) string {
+	if streaming {
+		return "stream "
+	}
+	return ""
+}
+
+// fieldType returns the type of f as written in a .proto file.
+func fieldType(f protoreflect.FieldDescriptor) string {
+	if f.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", fieldType(f.MapKey()), fieldType(f.MapValue()))
+	}
+	switch f.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(f.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(f.Enum().FullName())
+	default:
+		return f.Kind().String()
+	}
+}
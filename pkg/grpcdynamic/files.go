@@ -0,0 +1,107 @@
+package grpcdynamic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// filesSource serves descriptors loaded once from local files.
+type filesSource struct {
+	files *protoregistry.Files
+}
+
+// NewFileSource returns a source of the services of local files: .proto files,
+// found in importPaths, and descriptor sets, as written by
+// `protoc --include_imports --descriptor_set_out`. The well-known types of
+// google/protobuf may be imported without being in importPaths. If
+// importPaths is empty, .proto files are found relative to the working
+// directory.
+func NewFileSource(ctx context.Context, importPaths, protoFiles, descriptorSets []string) (Source, error) {
+	var fdps []*descriptorpb.FileDescriptorProto
+	seen := make(map[string]bool)
+	add := func(fdp *descriptorpb.FileDescriptorProto) {
+		if !seen[fdp.GetName()] {
+			seen[fdp.GetName()] = true
+			fdps = append(fdps, fdp)
+		}
+	}
+
+	for _, path := range descriptorSets {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+		}
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(b, &set); err != nil {
+			return nil, fmt.Errorf("failed to decode descriptor set %s: %w", path, err)
+		}
+		for _, fdp := range set.GetFile() {
+			add(fdp)
+		}
+	}
+
+	if len(protoFiles) > 0 {
+		if len(importPaths) == 0 {
+			importPaths = []string{"."}
+		}
+		compiler := protocompile.Compiler{
+			Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: importPaths}),
+		}
+		compiled, err := compiler.Compile(ctx, protoFiles...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile proto files: %w", err)
+		}
+
+		// Imports are linked along with the files importing them.
+		var walk func(fd protoreflect.FileDescriptor)
+		walk = func(fd protoreflect.FileDescriptor) {
+			if seen[fd.Path()] {
+				return
+			}
+			imports := fd.Imports()
+			for i := 0; i < imports.Len(); i++ {
+				walk(imports.Get(i).FileDescriptor)
+			}
+			add(protodesc.ToFileDescriptorProto(fd))
+		}
+		for _, fd := range compiled {
+			walk(fd)
+		}
+	}
+
+	files, err := buildFiles(fdps)
+	if err != nil {
+		return nil, err
+	}
+	return &filesSource{files: files}, nil
+}
+
+func (s *filesSource) ListServices(context.Context) ([]string, error) {
+	var names []string
+	s.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			names = append(names, string(services.Get(i).FullName()))
+		}
+		return true
+	})
+	slices.Sort(names)
+	return names, nil
+}
+
+func (s *filesSource) FindSymbol(_ context.Context, name string) (protoreflect.Descriptor, error) {
+	return findSymbol(s.files, name)
+}
+
+func (s *filesSource) Close() error {
+	return nil
+}
@@ -0,0 +1,240 @@
+package grpcdynamic
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// serve starts a health server with reflection and returns a connection to
+// it.
+func serve(t *testing.T) (*grpc.ClientConn, *health.Server) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := health.NewServer()
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	reflection.Register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, hs
+}
+
+func TestReflectionSource(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, _ := serve(t)
+	src := NewReflectionSource(conn)
+	defer src.Close()
+
+	services, err := src.ListServices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(services, "grpc.health.v1.Health") {
+		t.Errorf("expected the health service, got %q", services)
+	}
+
+	for _, name := range []string{"grpc.health.v1.Health/Check", "/grpc.health.v1.Health/Check", "grpc.health.v1.Health.Check"} {
+		md, err := FindMethod(ctx, src, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := FullMethod(md); got != "/grpc.health.v1.Health/Check" {
+			t.Errorf("%s: expected /grpc.health.v1.Health/Check, got %s", name, got)
+		}
+	}
+
+	if _, err := src.FindSymbol(ctx, "grpc.health.v1.Nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := FindMethod(ctx, src, "grpc.health.v1.HealthCheckRequest"); err == nil {
+		t.Errorf("expected a message not to be a method")
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	conn, hs := serve(t)
+	hs.SetServingStatus("payment", healthpb.HealthCheckResponse_NOT_SERVING)
+	src := NewReflectionSource(conn)
+	defer src.Close()
+
+	check, err := FindMethod(ctx, src, "grpc.health.v1.Health/Check")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	collect := func(m proto.Message) error {
+		got = append(got, protojson.Format(m))
+		return nil
+	}
+	if err := Invoke(ctx, conn, check, strings.NewReader(`{"service": "payment"}`), collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !strings.Contains(got[0], "NOT_SERVING") {
+		t.Errorf("expected NOT_SERVING, got %q", got)
+	}
+
+	// An empty input is an empty request, i.e. the health of the server.
+	got = nil
+	if err := Invoke(ctx, conn, check, strings.NewReader(""), collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !strings.Contains(got[0], `"SERVING"`) {
+		t.Errorf("expected SERVING, got %q", got)
+	}
+
+	err = Invoke(ctx, conn, check, strings.NewReader(`{"service": "unknown"}`), collect)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+	err = Invoke(ctx, conn, check, strings.NewReader(`{"nope": 1}`), collect)
+	if err == nil || !strings.Contains(err.Error(), "invalid grpc.health.v1.HealthCheckRequest") {
+		t.Errorf("expected an invalid request, got %v", err)
+	}
+	err = Invoke(ctx, conn, check, strings.NewReader(`{} {}`), collect)
+	if err == nil || !strings.Contains(err.Error(), "single request") {
+		t.Errorf("expected too many requests, got %v", err)
+	}
+
+	// Watch streams until the handler stops it.
+	watch, err := FindMethod(ctx, src, "grpc.health.v1.Health/Watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errStop := errors.New("stop")
+	var events int
+	err = Invoke(ctx, conn, watch, strings.NewReader(`{"service": "payment"}`), func(m proto.Message) error {
+		if events++; events == 1 {
+			hs.SetServingStatus("payment", healthpb.HealthCheckResponse_SERVING)
+			return nil
+		}
+		return errStop
+	})
+	if !errors.Is(err, errStop) || events != 2 {
+		t.Errorf("expected to stop after 2 events, got %d and %v", events, err)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "greeter.proto"), []byte(`syntax = "proto3";
+
+package greeter.v1;
+
+import "google/protobuf/timestamp.proto";
+
+message HelloRequest {
+  string name = 1;
+  optional int32 times = 2;
+  map<string, string> labels = 3;
+  oneof lang {
+    string code = 4;
+    bool auto = 5;
+  }
+}
+
+message HelloReply {
+  repeated string messages = 1;
+  google.protobuf.Timestamp time = 2;
+}
+
+service Greeter {
+  rpc Hello(HelloRequest) returns (stream HelloReply);
+}
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The health service comes from a descriptor set.
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}}
+	b, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPath := filepath.Join(dir, "health.protoset")
+	if err := os.WriteFile(setPath, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewFileSource(ctx, []string{dir}, []string{"greeter.proto"}, []string{setPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	services, err := src.ListServices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"greeter.v1.Greeter", "grpc.health.v1.Health"}; !slices.Equal(services, want) {
+		t.Errorf("expected %q, got %q", want, services)
+	}
+
+	d, err := src.FindSymbol(ctx, "greeter.v1.Greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Describe(d), `service Greeter {
+  rpc Hello(greeter.v1.HelloRequest) returns (stream greeter.v1.HelloReply);
+}
+`; got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	d, err = src.FindSymbol(ctx, "greeter.v1.HelloRequest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Describe(d), `message HelloRequest {
+  string name = 1;
+  optional int32 times = 2;
+  map<string, string> labels = 3;
+  oneof lang {
+    string code = 4;
+    bool auto = 5;
+  }
+}
+`; got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	if _, err := NewFileSource(ctx, []string{dir}, []string{"missing.proto"}, nil); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+}
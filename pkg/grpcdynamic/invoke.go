@@ -0,0 +1,168 @@
+package grpcdynamic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Invoke calls md over conn, with requests read from in as a sequence of JSON
+// objects in the protojson format. Unary and server-streaming methods take
+// one request, an empty one if in has none; client-streaming and
+// bidirectional methods take every request of in, sent as they are read.
+// Each response is passed to handle as it arrives.
+func Invoke(ctx context.Context, conn grpc.ClientConnInterface, md protoreflect.MethodDescriptor, in io.Reader, handle func(proto.Message) error, opts ...grpc.CallOption) error {
+	types := typesOf(md.ParentFile())
+	dec := json.NewDecoder(in)
+	next := func() (proto.Message, error) {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to read request: %w", err)
+		}
+		req := dynamicpb.NewMessage(md.Input())
+		if err := (protojson.UnmarshalOptions{Resolver: types}).Unmarshal(raw, req); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", md.Input().FullName(), err)
+		}
+		return req, nil
+	}
+	// single returns the only request of in.
+	single := func() (proto.Message, error) {
+		req, err := next()
+		if err == io.EOF {
+			return dynamicpb.NewMessage(md.Input()), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := next(); err != io.EOF {
+			return nil, fmt.Errorf("%s takes a single request", md.FullName())
+		}
+		return req, nil
+	}
+
+	if !md.IsStreamingClient() && !md.IsStreamingServer() {
+		req, err := single()
+		if err != nil {
+			return err
+		}
+		resp := dynamicpb.NewMessage(md.Output())
+		if err := conn.Invoke(ctx, FullMethod(md), req, resp, opts...); err != nil {
+			return err
+		}
+		return handle(resp)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    string(md.Name()),
+		ServerStreams: md.IsStreamingServer(),
+		ClientStreams: md.IsStreamingClient(),
+	}, FullMethod(md), opts...)
+	if err != nil {
+		return err
+	}
+
+	// Requests are sent while responses are received, so that bidirectional
+	// streams can be used interactively.
+	sendErr := make(chan error, 1)
+	go func() {
+		err := sendAll(stream, md, next, single)
+		if err != nil {
+			// Invalid input ends the call.
+			cancel()
+		}
+		sendErr <- err
+	}()
+
+	for {
+		resp := dynamicpb.NewMessage(md.Output())
+		err := stream.RecvMsg(resp)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			select {
+			case sErr := <-sendErr:
+				if sErr != nil {
+					return sErr
+				}
+			default:
+			}
+			return err
+		}
+		if err := handle(resp); err != nil {
+			return err
+		}
+	}
+	select {
+	case err := <-sendErr:
+		return err
+	default:
+		// The server ended the call before reading every request.
+		return nil
+	}
+}
+
+// sendAll sends the requests of a stream and closes its sending side.
+func sendAll(stream grpc.ClientStream, md protoreflect.MethodDescriptor, next, single func() (proto.Message, error)) error {
+	if !md.IsStreamingClient() {
+		req, err := single()
+		if err != nil {
+			return err
+		}
+		if err := stream.SendMsg(req); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return stream.CloseSend()
+	}
+
+	for {
+		req, err := next()
+		if err == io.EOF {
+			return stream.CloseSend()
+		}
+		if err != nil {
+			return err
+		}
+		// io.EOF means the server ended the call, its status is received
+		// on the other side.
+		if err := stream.SendMsg(req); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// typesOf returns the message types of fd and its imports, to resolve the
+// google.protobuf.Any fields of messages.
+func typesOf(fd protoreflect.FileDescriptor) *dynamicpb.Types {
+	files := new(protoregistry.Files)
+	var register func(fd protoreflect.FileDescriptor)
+	register = func(fd protoreflect.FileDescriptor) {
+		if _, err := files.FindFileByPath(fd.Path()); err == nil {
+			return
+		}
+		// Conflicts are impossible within the imports of a linked file.
+		_ = files.RegisterFile(fd)
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			register(imports.Get(i).FileDescriptor)
+		}
+	}
+	register(fd)
+	return dynamicpb.NewTypes(files)
+}
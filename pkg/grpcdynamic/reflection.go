@@ -0,0 +1,198 @@
+package grpcdynamic
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// reflectionSource gets descriptors from the server reflection service of a
+// server, over a single stream opened on first use.
+type reflectionSource struct {
+	client reflectionpb.ServerReflectionClient
+
+	mu     sync.Mutex
+	stream reflectionpb.ServerReflection_ServerReflectionInfoClient
+	cancel context.CancelFunc // of the stream
+
+	// fdps are the files received so far by name, and files their registry.
+	fdps  map[string]*descriptorpb.FileDescriptorProto
+	files *protoregistry.Files
+}
+
+// NewReflectionSource returns a source asking the server at the other end of
+// conn, which must serve grpc.reflection.v1.ServerReflection. It does not
+// close conn.
+func NewReflectionSource(conn grpc.ClientConnInterface) Source {
+	return &reflectionSource{
+		client: reflectionpb.NewServerReflectionClient(conn),
+		fdps:   make(map[string]*descriptorpb.FileDescriptorProto),
+		files:  new(protoregistry.Files),
+	}
+}
+
+func (s *reflectionSource) ListServices(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp, err := s.send(ctx, &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		names = append(names, svc.GetName())
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (s *reflectionSource) FindSymbol(ctx context.Context, name string) (protoreflect.Descriptor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d, err := findSymbol(s.files, name); err == nil {
+		return d, nil
+	}
+
+	resp, err := s.send(ctx, &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: name},
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.add(ctx, resp.GetFileDescriptorResponse().GetFileDescriptorProto()); err != nil {
+		return nil, err
+	}
+	return findSymbol(s.files, name)
+}
+
+func (s *reflectionSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reset()
+	return nil
+}
+
+// add adds the given serialized files, fetching the dependencies the server
+// did not send, and relinks the registry. s.mu must be held.
+func (s *reflectionSource) add(ctx context.Context, raw [][]byte) error {
+	for len(raw) > 0 {
+		var missing []string
+		for _, b := range raw {
+			fdp := new(descriptorpb.FileDescriptorProto)
+			if err := proto.Unmarshal(b, fdp); err != nil {
+				return fmt.Errorf("failed to decode file descriptor: %w", err)
+			}
+			s.fdps[fdp.GetName()] = fdp
+			missing = append(missing, fdp.GetDependency()...)
+		}
+
+		raw = nil
+		for _, dep := range missing {
+			if _, ok := s.fdps[dep]; ok {
+				continue
+			}
+			resp, err := s.send(ctx, &reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get %s: %w", dep, err)
+			}
+			raw = append(raw, resp.GetFileDescriptorResponse().GetFileDescriptorProto()...)
+		}
+	}
+
+	fdps := make([]*descriptorpb.FileDescriptorProto, 0, len(s.fdps))
+	for _, fdp := range s.fdps {
+		fdps = append(fdps, fdp)
+	}
+	files, err := buildFiles(fdps)
+	if err != nil {
+		return err
+	}
+	s.files = files
+	return nil
+}
+
+// send sends req and returns the response, opening the stream first if
+// needed. Errors of the server are returned as status errors. s.mu must be
+// held.
+func (s *reflectionSource) send(ctx context.Context, req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	if s.stream == nil {
+		// The stream outlives ctx, but keeps its values, e.g. the metadata
+		// sent to the server.
+		sctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		stream, err := s.client.ServerReflectionInfo(sctx)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to open reflection stream: %w", err)
+		}
+		s.stream, s.cancel = stream, cancel
+	}
+
+	resp, err := s.roundTrip(ctx, req)
+	if err != nil {
+		// The stream may be broken, or still deliver the response: the next
+		// call opens another.
+		s.reset()
+		return nil, err
+	}
+	if e := resp.GetErrorResponse(); e != nil {
+		return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+// roundTrip sends req and waits for its response, or for ctx to be done.
+func (s *reflectionSource) roundTrip(ctx context.Context, req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	type result struct {
+		resp *reflectionpb.ServerReflectionResponse
+		err  error
+	}
+	stream := s.stream
+	done := make(chan result, 1)
+	go func() {
+		if err := stream.Send(req); err != nil {
+			done <- result{err: fmt.Errorf("failed to send reflection request: %w", err)}
+			return
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			err = fmt.Errorf("failed to receive reflection response: %w", err)
+		}
+		done <- result{resp: resp, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.resp, r.err
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// reset closes the stream. s.mu must be held.
+func (s *reflectionSource) reset() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.stream, s.cancel = nil, nil
+}
@@ -0,0 +1,80 @@
+// Package grpcdynamic calls gRPC methods that are only known at run time,
+// with messages built from JSON. Descriptors of the services come from the
+// server itself, through gRPC reflection, or from local .proto files and
+// descriptor sets.
+package grpcdynamic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ErrNotFound is returned when a symbol is not known to a source.
+var ErrNotFound = errors.New("symbol not found")
+
+// Source provides the descriptors of services.
+type Source interface {
+	// ListServices returns the full names of the services, sorted.
+	ListServices(ctx context.Context) ([]string, error)
+
+	// FindSymbol returns the descriptor of the service, method, message, enum
+	// or field with the given full name, or ErrNotFound.
+	FindSymbol(ctx context.Context, name string) (protoreflect.Descriptor, error)
+
+	// Close releases the resources of the source.
+	Close() error
+}
+
+// FindMethod returns the descriptor of a method, named either
+// package.Service/Method, as on the wire, or package.Service.Method.
+func FindMethod(ctx context.Context, src Source, name string) (protoreflect.MethodDescriptor, error) {
+	name = strings.TrimPrefix(name, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[:i] + "." + name[i+1:]
+	}
+
+	d, err := src.FindSymbol(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", name)
+	}
+	return md, nil
+}
+
+// FullMethod returns the name of md on the wire, e.g.
+// /payment.v1.PaymentService/Get.
+func FullMethod(md protoreflect.MethodDescriptor) string {
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
+
+// buildFiles links file descriptor protos, given in any order, into a
+// registry. Every dependency of the files must be among them.
+func buildFiles(fdps []*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: fdps})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link descriptors: %w", err)
+	}
+	return files, nil
+}
+
+// findSymbol looks name up in files.
+func findSymbol(files *protoregistry.Files, name string) (protoreflect.Descriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if errors.Is(err, protoregistry.NotFound) {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s: %w", name, err)
+	}
+	return d, nil
+}
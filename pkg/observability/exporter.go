@@ -0,0 +1,158 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporter types.
+const (
+	ExporterNoop   = "NOOP"
+	ExporterStdout = "STDOUT"
+	ExporterOTLP   = "OTLP"
+	ExporterMemory = "MEMORY"
+)
+
+// Config represents the config for an observability exporter.
+//
+// The standard OTEL_* variables are honoured on top of it, for example
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES for the resource,
+// OTEL_TRACES_SAMPLER for sampling and OTEL_EXPORTER_OTLP_ENDPOINT for the
+// OTLP collector.
+type Config struct {
+	ExporterType string `env:"OBSERVABILITY_EXPORTER, default=NOOP"`
+
+	// MetricsInterval is how often metrics are pushed to the STDOUT and OTLP
+	// exporters.
+	MetricsInterval time.Duration `env:"OBSERVABILITY_METRICS_INTERVAL, default=1m"`
+
+	// ShutdownTimeout bounds how long Close waits to flush pending telemetry.
+	ShutdownTimeout time.Duration `env:"OBSERVABILITY_SHUTDOWN_TIMEOUT, default=10s"`
+}
+
+// Exporter defines the minimum shared functionality for an observability
+// exporter used by this application.
+type Exporter interface {
+	TracerProvider() trace.TracerProvider
+	MeterProvider() metric.MeterProvider
+
+	// Close flushes pending telemetry and shuts the exporter down.
+	Close() error
+}
+
+// NewFromEnv creates the exporter of the given config and installs it as the
+// global tracer and meter provider, together with the W3C trace-context and
+// baggage propagators, so that instrumentation libraries pick it up.
+func NewFromEnv(ctx context.Context, config *Config) (Exporter, error) {
+	// The default resource describes the SDK and reads OTEL_SERVICE_NAME and
+	// OTEL_RESOURCE_ATTRIBUTES.
+	res := resource.Default()
+
+	var e Exporter
+	switch typ := strings.ToUpper(config.ExporterType); typ {
+	case ExporterNoop, "":
+		e = newSDKExporter(config,
+			sdktrace.NewTracerProvider(sdktrace.WithResource(res)),
+			sdkmetric.NewMeterProvider(sdkmetric.WithResource(res)))
+	case ExporterStdout, ExporterOTLP:
+		spans, metrics, err := newPushExporters(ctx, typ)
+		if err != nil {
+			return nil, err
+		}
+		reader := sdkmetric.NewPeriodicReader(metrics, sdkmetric.WithInterval(config.MetricsInterval))
+		e = newSDKExporter(config,
+			sdktrace.NewTracerProvider(sdktrace.WithResource(res), sdktrace.WithBatcher(spans)),
+			sdkmetric.NewMeterProvider(sdkmetric.WithResource(res), sdkmetric.WithReader(reader)))
+	case ExporterMemory:
+		e = newMemoryExporter(config, res)
+	default:
+		return nil, fmt.Errorf("unknown observability exporter %q", typ)
+	}
+
+	otel.SetTracerProvider(e.TracerProvider())
+	otel.SetMeterProvider(e.MeterProvider())
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	return e, nil
+}
+
+// newPushExporters creates the span and metric exporters of the STDOUT and
+// OTLP exporter types.
+func newPushExporters(ctx context.Context, typ string) (sdktrace.SpanExporter, sdkmetric.Exporter, error) {
+	if typ == ExporterStdout {
+		spans, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
+		}
+		metrics, err := stdoutmetric.New()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create stdout metric exporter: %w", err)
+		}
+		return spans, metrics, nil
+	}
+
+	spans, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create otlp trace exporter: %w", err)
+	}
+	metrics, err := otlpmetricgrpc.New(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create otlp metric exporter: %w", err)
+	}
+	return spans, metrics, nil
+}
+
+// sdkExporter is an exporter backed by the OpenTelemetry SDK providers.
+type sdkExporter struct {
+	tracerProvider  *sdktrace.TracerProvider
+	meterProvider   *sdkmetric.MeterProvider
+	shutdownTimeout time.Duration
+}
+
+func newSDKExporter(config *Config, tp *sdktrace.TracerProvider, mp *sdkmetric.MeterProvider) *sdkExporter {
+	return &sdkExporter{
+		tracerProvider:  tp,
+		meterProvider:   mp,
+		shutdownTimeout: config.ShutdownTimeout,
+	}
+}
+
+func (e *sdkExporter) TracerProvider() trace.TracerProvider {
+	return e.tracerProvider
+}
+
+func (e *sdkExporter) MeterProvider() metric.MeterProvider {
+	return e.meterProvider
+}
+
+func (e *sdkExporter) Close() error {
+	ctx := context.Background()
+	if e.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.shutdownTimeout)
+		defer cancel()
+	}
+
+	if err := e.tracerProvider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown tracer provider: %w", err)
+	}
+	if err := e.meterProvider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown meter provider: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package observability_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/observability"
+)
+
+// The exporters install global providers, so these tests don't run in
+// parallel.
+
+func newMemoryExporter(t *testing.T) *observability.MemoryExporter {
+	t.Helper()
+
+	e, err := observability.NewFromEnv(context.Background(), &observability.Config{ExporterType: observability.ExporterMemory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := e.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return e.(*observability.MemoryExporter)
+}
+
+// findSpan returns the span with the given name and kind.
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string, kind trace.SpanKind) tracetest.SpanStub {
+	t.Helper()
+
+	for _, s := range spans {
+		if s.Name == name && s.SpanKind == kind {
+			return s
+		}
+	}
+	t.Fatalf("no %v span %q in %d spans", kind, name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+// assertChild asserts that child continues the trace of parent.
+func assertChild(t *testing.T, parent, child tracetest.SpanStub) {
+	t.Helper()
+
+	if got, want := child.SpanContext.TraceID(), parent.SpanContext.TraceID(); got != want {
+		t.Errorf("expected trace %v, got %v", want, got)
+	}
+	if got, want := child.Parent.SpanID(), parent.SpanContext.SpanID(); got != want {
+		t.Errorf("expected parent span %v, got %v", want, got)
+	}
+	if !child.Parent.IsRemote() {
+		t.Errorf("expected a remote parent")
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	cases := []struct {
+		name    string
+		typ     string
+		wantErr bool
+	}{
+		{name: "noop", typ: observability.ExporterNoop},
+		{name: "default", typ: ""},
+		{name: "stdout", typ: observability.ExporterStdout},
+		{name: "memory", typ: observability.ExporterMemory},
+		{name: "lower case", typ: "memory"},
+		{name: "unknown", typ: "ZIPKIN", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := observability.NewFromEnv(context.Background(), &observability.Config{ExporterType: tc.typ})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if otel.GetTracerProvider() != e.TracerProvider() {
+				t.Errorf("expected the tracer provider to be installed globally")
+			}
+			if err := e.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPropagation_grpc(t *testing.T) {
+	e := newMemoryExporter(t)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx := context.Background()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server span ends after the response is sent, so wait for it.
+	srv.GracefulStop()
+
+	const method = "grpc.health.v1.Health/Check"
+	spans := e.Spans()
+	assertChild(t, findSpan(t, spans, method, trace.SpanKindClient), findSpan(t, spans, method, trace.SpanKindServer))
+
+	rm, err := e.Metrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			found = found || m.Name == "rpc.server.duration"
+		}
+	}
+	if !found {
+		t.Errorf("expected rpc.server.duration to be recorded")
+	}
+}
+
+func TestPropagation_http(t *testing.T) {
+	e := newMemoryExporter(t)
+
+	srv := httptest.NewServer(otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("traceparent") == "" {
+			t.Errorf("expected a traceparent header")
+		}
+	}), "http.server"))
+	t.Cleanup(srv.Close)
+
+	client := &http.Client{Transport: observability.NewTransport(http.DefaultTransport)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	srv.Close()
+
+	spans := e.Spans()
+	assertChild(t, findSpan(t, spans, "HTTP GET", trace.SpanKindClient), findSpan(t, spans, "http.server", trace.SpanKindServer))
+}
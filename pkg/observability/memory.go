@@ -0,0 +1,52 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// MemoryExporter keeps telemetry in memory so tests can inspect it. Spans are
+// recorded as soon as they end.
+type MemoryExporter struct {
+	*sdkExporter
+
+	spans  *tracetest.InMemoryExporter
+	reader *sdkmetric.ManualReader
+}
+
+func newMemoryExporter(config *Config, res *resource.Resource) *MemoryExporter {
+	spans := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+	return &MemoryExporter{
+		sdkExporter: newSDKExporter(config,
+			sdktrace.NewTracerProvider(sdktrace.WithResource(res), sdktrace.WithSyncer(spans)),
+			sdkmetric.NewMeterProvider(sdkmetric.WithResource(res), sdkmetric.WithReader(reader))),
+		spans:  spans,
+		reader: reader,
+	}
+}
+
+// Spans returns the spans ended so far.
+func (e *MemoryExporter) Spans() tracetest.SpanStubs {
+	return e.spans.GetSpans()
+}
+
+// Reset forgets the spans ended so far.
+func (e *MemoryExporter) Reset() {
+	e.spans.Reset()
+}
+
+// Metrics collects the current value of all metrics.
+func (e *MemoryExporter) Metrics(ctx context.Context) (*metricdata.ResourceMetrics, error) {
+	var rm metricdata.ResourceMetrics
+	if err := e.reader.Collect(ctx, &rm); err != nil {
+		return nil, fmt.Errorf("failed to collect metrics: %w", err)
+	}
+	return &rm, nil
+}
@@ -0,0 +1,13 @@
+package observability
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// NewTransport wraps base so that outgoing requests are traced and carry the
+// W3C trace context. It works with any transport, http3.Transport included.
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
@@ -0,0 +1,19 @@
+package pagetoken
+
+import "time"
+
+// Config is the configuration of page token signing.
+type Config struct {
+	// Keys are comma-separated, base64-encoded HMAC keys of at least 32 bytes.
+	// The first signs new tokens; all of them are accepted. The value is
+	// usually a reference resolved by the secret manager, e.g.
+	// "secret://page-token-keys".
+	Keys []string `env:"PAGE_TOKEN_KEYS" json:"-"`
+
+	// TTL is how long a token stays valid after it is issued.
+	TTL time.Duration `env:"PAGE_TOKEN_TTL, default=1h" json:",omitempty"`
+}
+
+func (c *Config) PageTokenConfig() *Config {
+	return c
+}
@@ -0,0 +1,116 @@
+package pagetoken
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	testKey  = bytes.Repeat([]byte{1}, 32)
+	otherKey = bytes.Repeat([]byte{2}, 32)
+)
+
+func testCodec(t *testing.T, keys ...[]byte) *Codec {
+	t.Helper()
+
+	c, err := New(time.Hour, keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return c
+}
+
+func TestCodec_roundTrip(t *testing.T) {
+	t.Parallel()
+
+	c := testCodec(t, testKey)
+	state := []byte{0x00, 0x04, 0xde, 0xad, 0xbe, 0xef}
+
+	token := c.Encode("payments/list?customer=1", state)
+	got, err := c.Decode("payments/list?customer=1", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, state) {
+		t.Errorf("expected state %x, got %x", state, got)
+	}
+
+	if token := c.Encode("scope", nil); token != "" {
+		t.Errorf("expected empty token for last page, got %q", token)
+	}
+	if got, err := c.Decode("scope", ""); got != nil || err != nil {
+		t.Errorf("expected first page for empty token, got %x, %v", got, err)
+	}
+}
+
+func TestCodec_Decode_errors(t *testing.T) {
+	t.Parallel()
+
+	c := testCodec(t, testKey)
+	token := c.Encode("scope", []byte("state"))
+
+	tampered, _ := base64.RawURLEncoding.DecodeString(token)
+	tampered[len(tampered)-macLen-1] ^= 0xff
+
+	expired := testCodec(t, testKey)
+	expired.now = func() time.Time { return c.now().Add(2 * time.Hour) }
+
+	cases := []struct {
+		name  string
+		codec *Codec
+		scope string
+		token string
+		want  error
+	}{
+		{name: "garbage", codec: c, scope: "scope", token: "not a token!", want: ErrInvalidToken},
+		{name: "truncated", codec: c, scope: "scope", token: token[:10], want: ErrInvalidToken},
+		{name: "tampered", codec: c, scope: "scope", token: base64.RawURLEncoding.EncodeToString(tampered), want: ErrInvalidToken},
+		{name: "foreign scope", codec: c, scope: "other", token: token, want: ErrInvalidToken},
+		{name: "unknown key", codec: testCodec(t, otherKey), scope: "scope", token: token, want: ErrInvalidToken},
+		{name: "expired", codec: expired, scope: "scope", token: token, want: ErrExpiredToken},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := tc.codec.Decode(tc.scope, tc.token); !errors.Is(err, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestCodec_keyRotation(t *testing.T) {
+	t.Parallel()
+
+	old := testCodec(t, testKey)
+	rotated := testCodec(t, otherKey, testKey)
+
+	if _, err := rotated.Decode("scope", old.Encode("scope", []byte("state"))); err != nil {
+		t.Errorf("expected token signed with previous key to be accepted, got %v", err)
+	}
+	if _, err := old.Decode("scope", rotated.Encode("scope", []byte("state"))); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected new codec to sign with the first key, got %v", err)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewFromConfig(&Config{TTL: time.Hour}); err == nil {
+		t.Errorf("expected error without keys")
+	}
+	if _, err := NewFromConfig(&Config{TTL: time.Hour, Keys: []string{base64.StdEncoding.EncodeToString([]byte("short"))}}); err == nil {
+		t.Errorf("expected error for short key")
+	}
+	if _, err := NewFromConfig(&Config{TTL: time.Hour, Keys: []string{base64.StdEncoding.EncodeToString(testKey)}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
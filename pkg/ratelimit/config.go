@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Type is the type of store to use for rate limiting.
+type Type string
+
+const (
+	// TypeNoop does not limit anything.
+	TypeNoop Type = "NOOP"
+
+	// TypeMemory keeps the buckets in memory. Each replica enforces the limits
+	// on its own, so a client may get up to Tokens times the number of replicas.
+	TypeMemory Type = "MEMORY"
+
+	// TypeDatabase keeps the buckets in the SQL database, so that limits hold
+	// across replicas.
+	TypeDatabase Type = "DATABASE"
+)
+
+// Config represents the configuration and associated environment variables for
+// rate limiting.
+type Config struct {
+	Type Type `env:"RATE_LIMIT_TYPE, default=MEMORY"`
+
+	// Tokens is the number of requests each client may make per Interval.
+	Tokens   uint64        `env:"RATE_LIMIT_TOKENS, default=60"`
+	Interval time.Duration `env:"RATE_LIMIT_INTERVAL, default=1m"`
+
+	// IPHeader, if set, is the header holding the client IP, e.g.
+	// X-Forwarded-For behind a load balancer. Only set it when the header is
+	// overwritten by a trusted proxy, otherwise clients can pick their own
+	// bucket. The first address of the header is used.
+	IPHeader string `env:"RATE_LIMIT_IP_HEADER"`
+
+	// SweepInterval is how often buckets left alone for at least SweepMinTTL are
+	// deleted.
+	SweepInterval time.Duration `env:"RATE_LIMIT_SWEEP_INTERVAL, default=6h"`
+	SweepMinTTL   time.Duration `env:"RATE_LIMIT_SWEEP_MIN_TTL, default=12h"`
+
+	// VerifyAPIKey, if set, authenticates the API key of a client and returns
+	// the client it belongs to, which then gets its own bucket. Without it, or
+	// for keys it rejects, clients are limited by mTLS principal or IP:
+	// unverified keys would let clients pick a fresh bucket for every call.
+	VerifyAPIKey func(ctx context.Context, apiKey string) (client string, ok bool)
+}
+
+// RateLimitConfig returns the rate limiting configuration.
+func (c *Config) RateLimitConfig() *Config {
+	return c
+}
@@ -0,0 +1,272 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+	"vitess.io/vitess/go/mysql/sqlerror"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+)
+
+// Compile-time check that DatabaseStore is a limiter.Store.
+var _ limiter.Store = (*DatabaseStore)(nil)
+
+// DatabaseStore is a limiter.Store keeping its buckets in the rate_limits
+// table, so that all the replicas sharing the database share the limits.
+//
+// Buckets refill completely at the end of each interval, which starts with the
+// first request after the previous one ended. Every take is a short
+// transaction locking the row of the bucket.
+type DatabaseStore struct {
+	db     *database.DB
+	config *Config
+	now    func() time.Time
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	stopped  chan struct{}
+}
+
+// bucket is a row of the rate_limits table.
+type bucket struct {
+	tokens    uint64
+	remaining uint64
+	interval  time.Duration
+	resetAt   time.Time
+}
+
+// NewDatabaseStore creates a DatabaseStore on db. Until it is closed, it
+// deletes the buckets unused for SweepMinTTL every SweepInterval.
+func NewDatabaseStore(ctx context.Context, db *database.DB, config *Config) (*DatabaseStore, error) {
+	if config.Tokens == 0 || config.Interval <= 0 {
+		return nil, fmt.Errorf("ratelimit: tokens and interval must be positive")
+	}
+	if config.SweepInterval <= 0 {
+		return nil, fmt.Errorf("ratelimit: sweep interval must be positive")
+	}
+	s := &DatabaseStore{
+		db:      db,
+		config:  config,
+		now:     func() time.Time { return time.Now().UTC() },
+		stopCh:  make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.sweep(context.WithoutCancel(ctx))
+	return s, nil
+}
+
+// Take takes a token from the bucket of key.
+func (s *DatabaseStore) Take(ctx context.Context, key string) (uint64, uint64, uint64, bool, error) {
+	var ok bool
+	b, err := s.update(ctx, key, func(b *bucket) {
+		if b.remaining > 0 {
+			b.remaining--
+			ok = true
+		}
+	})
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	return b.tokens, b.remaining, uint64(b.resetAt.UnixNano()), ok, nil
+}
+
+// Get returns the limit and remaining tokens of the bucket of key, without
+// taking any.
+func (s *DatabaseStore) Get(ctx context.Context, key string) (uint64, uint64, error) {
+	if s.isStopped() {
+		return 0, 0, limiter.ErrStopped
+	}
+	stored, err := s.read(ctx, s.db.Pool.QueryRowContext, key, "")
+	if err != nil {
+		return 0, 0, err
+	}
+	b := s.refill(stored)
+	return b.tokens, b.remaining, nil
+}
+
+// Set overrides the limit of the bucket of key and fills it.
+func (s *DatabaseStore) Set(ctx context.Context, key string, tokens uint64, interval time.Duration) error {
+	now := s.now()
+	_, err := s.update(ctx, key, func(b *bucket) {
+		b.tokens, b.remaining, b.interval = tokens, tokens, interval
+		b.resetAt = now.Add(interval)
+	})
+	return err
+}
+
+// Burst adds tokens to the bucket of key until it next refills.
+func (s *DatabaseStore) Burst(ctx context.Context, key string, tokens uint64) error {
+	_, err := s.update(ctx, key, func(b *bucket) {
+		b.remaining += tokens
+	})
+	return err
+}
+
+// Close stops the sweeping of the buckets. The buckets stay in the database
+// for the other replicas. Once closed, the other methods return
+// limiter.ErrStopped.
+func (s *DatabaseStore) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+	select {
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *DatabaseStore) isStopped() bool {
+	select {
+	case <-s.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// update applies f to the bucket of key and stores the result.
+func (s *DatabaseStore) update(ctx context.Context, key string, f func(b *bucket)) (*bucket, error) {
+	if s.isStopped() {
+		return nil, limiter.ErrStopped
+	}
+
+	b, err := s.updateTx(ctx, key, f)
+	if isConflict(err) {
+		// Another replica created the bucket first. Retrying finds its row.
+		slog.DebugContext(ctx, "rate limit bucket created concurrently, retrying")
+		b, err = s.updateTx(ctx, key, f)
+	}
+	return b, err
+}
+
+func (s *DatabaseStore) updateTx(ctx context.Context, key string, f func(b *bucket)) (*bucket, error) {
+	var b *bucket
+	err := s.db.InTx(ctx, nil, func(tx *sql.Tx) error {
+		stored, err := s.read(ctx, tx.QueryRowContext, key, "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		b = s.refill(stored)
+		f(b)
+
+		switch {
+		case stored == nil:
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO rate_limits
+					(bucket_key, tokens, remaining, interval_ns, reset_at, updated_at)
+				VALUES
+					(?, ?, ?, ?, ?, ?)`,
+				key, b.tokens, b.remaining, int64(b.interval), b.resetAt, s.now())
+
+		case *b != *stored:
+			// Unchanged buckets, e.g. after a rejected take, are not written.
+			_, err = tx.ExecContext(ctx, `
+				UPDATE rate_limits
+				SET tokens = ?, remaining = ?, interval_ns = ?, reset_at = ?, updated_at = ?
+				WHERE bucket_key = ?`,
+				b.tokens, b.remaining, int64(b.interval), b.resetAt, s.now(), key)
+		}
+		if err != nil {
+			return fmt.Errorf("saving rate limit bucket: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// read returns the stored bucket of key, or nil if there is none.
+func (s *DatabaseStore) read(ctx context.Context, queryRow func(context.Context, string, ...any) *sql.Row, key, lock string) (*bucket, error) {
+	var (
+		b        bucket
+		interval int64
+	)
+	err := queryRow(ctx, `
+		SELECT tokens, remaining, interval_ns, reset_at
+		FROM rate_limits
+		WHERE bucket_key = ? `+lock, key).
+		Scan(&b.tokens, &b.remaining, &interval, &b.resetAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading rate limit bucket: %w", err)
+	}
+	b.interval = time.Duration(interval)
+	b.resetAt = b.resetAt.UTC()
+	return &b, nil
+}
+
+// refill returns a copy of stored, refilled if its interval ended. A missing
+// bucket is full, with the default limit.
+func (s *DatabaseStore) refill(stored *bucket) *bucket {
+	now := s.now()
+	if stored == nil {
+		return &bucket{
+			tokens:    s.config.Tokens,
+			remaining: s.config.Tokens,
+			interval:  s.config.Interval,
+			resetAt:   now.Add(s.config.Interval),
+		}
+	}
+
+	b := *stored
+	if !now.Before(b.resetAt) {
+		b.remaining = b.tokens
+		b.resetAt = now.Add(b.interval)
+	}
+	return &b
+}
+
+// sweep runs Cleanup every SweepInterval until the store is closed.
+func (s *DatabaseStore) sweep(ctx context.Context) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.config.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+
+		case <-ticker.C:
+			n, err := s.Cleanup(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "rate limit cleanup failed", "error", err)
+				continue
+			}
+			slog.DebugContext(ctx, "rate limit cleanup", "deleted", n)
+		}
+	}
+}
+
+// Cleanup deletes the buckets unused for SweepMinTTL and returns how many
+// were removed.
+func (s *DatabaseStore) Cleanup(ctx context.Context) (int64, error) {
+	res, err := s.db.Pool.ExecContext(ctx,
+		`DELETE FROM rate_limits WHERE updated_at <= ?`, s.now().Add(-s.config.SweepMinTTL))
+	if err != nil {
+		return 0, fmt.Errorf("deleting stale rate limit buckets: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// isConflict reports whether err means a concurrent transaction inserted the
+// same bucket.
+func isConflict(err error) bool {
+	switch database.ErrorNumber(err) {
+	case sqlerror.ERDupEntry, sqlerror.ERLockDeadlock:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database/dbtest"
+)
+
+var testDatabaseInstance *dbtest.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = dbtest.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+func newTestDatabaseStore(t *testing.T) (*DatabaseStore, *time.Time) {
+	t.Helper()
+
+	db, _ := testDatabaseInstance.NewDatabase(t)
+	s, err := NewDatabaseStore(context.Background(), db, &Config{
+		Tokens:        2,
+		Interval:      time.Minute,
+		SweepInterval: time.Hour,
+		SweepMinTTL:   time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close(context.Background()) })
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestDatabaseStore_Take(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, now := newTestDatabaseStore(t)
+	start := *now
+
+	cases := []struct {
+		name      string
+		advance   time.Duration
+		key       string
+		remaining uint64
+		reset     time.Time
+		ok        bool
+	}{
+		{name: "first", key: "a", remaining: 1, reset: start.Add(time.Minute), ok: true},
+		{name: "second", key: "a", remaining: 0, reset: start.Add(time.Minute), ok: true},
+		{name: "exhausted", advance: 30 * time.Second, key: "a", remaining: 0, reset: start.Add(time.Minute)},
+		{name: "other_key", key: "b", remaining: 1, reset: start.Add(90 * time.Second), ok: true},
+		{name: "refilled", advance: 30 * time.Second, key: "a", remaining: 1, reset: start.Add(2 * time.Minute), ok: true},
+	}
+
+	for _, tc := range cases {
+		*now = now.Add(tc.advance)
+
+		tokens, remaining, reset, ok, err := s.Take(ctx, tc.key)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if tokens != 2 {
+			t.Errorf("%s: expected 2 tokens, got %d", tc.name, tokens)
+		}
+		if remaining != tc.remaining || ok != tc.ok {
+			t.Errorf("%s: expected remaining %d and ok %t, got %d and %t", tc.name, tc.remaining, tc.ok, remaining, ok)
+		}
+		if got := time.Unix(0, int64(reset)).UTC(); !got.Equal(tc.reset) {
+			t.Errorf("%s: expected reset at %v, got %v", tc.name, tc.reset, got)
+		}
+	}
+}
+
+func TestDatabaseStore_SetBurst(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, _ := newTestDatabaseStore(t)
+
+	if err := s.Set(ctx, "k", 5, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Burst(ctx, "k", 3); err != nil {
+		t.Fatal(err)
+	}
+	tokens, remaining, err := s.Get(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens != 5 || remaining != 8 {
+		t.Errorf("expected 5 tokens and 8 remaining, got %d and %d", tokens, remaining)
+	}
+
+	if tokens, remaining, err := s.Get(ctx, "missing"); err != nil || tokens != 2 || remaining != 2 {
+		t.Errorf("expected a full default bucket, got %d, %d, %v", tokens, remaining, err)
+	}
+}
+
+func TestDatabaseStore_Cleanup(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, now := newTestDatabaseStore(t)
+
+	if _, _, _, _, err := s.Take(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(time.Hour)
+	if _, _, _, _, err := s.Take(ctx, "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.Cleanup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 stale bucket to be deleted, got %d", n)
+	}
+
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, err := s.Take(ctx, "new"); err != limiter.ErrStopped {
+		t.Errorf("expected ErrStopped after Close, got %v", err)
+	}
+}
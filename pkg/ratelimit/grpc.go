@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+// UnaryServerInterceptor limits the rate of calls of each client. Buckets are
+// per method, since methods differ widely in cost: a client exhausting
+// Payment.Create may still read its payments.
+//
+// The X-RateLimit-* headers are sent as header metadata. Rejected calls fail
+// with RATE_LIMITED, whose RetryInfo tells when the bucket refills. If the
+// store fails, calls are let through and the error is logged, so that an
+// outage of the store does not take the service down with it.
+func UnaryServerInterceptor(store limiter.Store, config *Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := limit(ctx, store, config, info.FullMethod, func(md metadata.MD) error {
+			return grpc.SetHeader(ctx, md)
+		}); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streams. Only opening
+// a stream takes a token, not its messages.
+func StreamServerInterceptor(store limiter.Store, config *Config) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := limit(ss.Context(), store, config, info.FullMethod, ss.SetHeader); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func limit(ctx context.Context, store limiter.Store, config *Config, method string, setHeader func(metadata.MD) error) error {
+	res, err := take(ctx, store, method+"|"+grpcIdentity(ctx, config))
+	if err != nil {
+		slog.ErrorContext(ctx, "rate limiter failed, allowing call", "grpc.method", method, "error", err)
+		return nil
+	}
+
+	now := time.Now()
+	if h := res.headers(now); h != nil {
+		if err := setHeader(metadata.New(h)); err != nil {
+			slog.WarnContext(ctx, "failed to set rate limit headers", "grpc.method", method, "error", err)
+		}
+	}
+	if !res.ok {
+		return apperrors.New(apperrors.RateLimited, "rate limit of %d calls exceeded for %s", res.limit, method).
+			WithRetryAfter(res.retryAfter(now))
+	}
+	return nil
+}
+
+// grpcIdentity returns the bucket key of the client of the call.
+func grpcIdentity(ctx context.Context, config *Config) string {
+	var (
+		state      *tls.ConnectionState
+		remoteAddr string
+	)
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &info.State
+		}
+		if p.Addr != nil {
+			remoteAddr = p.Addr.String()
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var apiKey string
+	if v := md.Get(APIKeyHeader); len(v) > 0 {
+		apiKey = v[0]
+	}
+	var header []string
+	if config.IPHeader != "" {
+		header = md.Get(config.IPHeader)
+	}
+	return identity(state, apiClient(ctx, config, apiKey), clientIP(header, remoteAddr))
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+// Middleware limits the rate of requests of each client to the wrapped
+// handler. It is the HTTP counterpart of UnaryServerInterceptor: rejected
+// requests get RATE_LIMITED problem details, with status 429 and a
+// Retry-After header. Buckets are per client only, wrap handlers with their
+// own store to limit them separately.
+func Middleware(store limiter.Store, config *Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			res, err := take(ctx, store, httpIdentity(r, config))
+			if err != nil {
+				slog.ErrorContext(ctx, "rate limiter failed, allowing request", "path", r.URL.Path, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := time.Now()
+			for k, v := range res.headers(now) {
+				w.Header().Set(k, v)
+			}
+			if !res.ok {
+				apperrors.WriteProblem(w, r, apperrors.New(apperrors.RateLimited, "rate limit of %d requests exceeded", res.limit).
+					WithRetryAfter(res.retryAfter(now)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader is the header, or gRPC metadata key, carrying the API key of
+// clients.
+const APIKeyHeader = "X-API-Key"
+
+// Kinds of client identities, prefixing the keys of the buckets.
+const (
+	kindPrincipal = "principal"
+	kindAPIKey    = "apikey"
+	kindIP        = "ip"
+)
+
+// identity returns the bucket key of a client: its mTLS principal, else the
+// client its API key was verified for, else its IP. Values are hashed so that
+// neither identities nor addresses end up in the store.
+func identity(state *tls.ConnectionState, apiClient, ip string) string {
+	if p := Principal(state); p != "" {
+		return key(kindPrincipal, p)
+	}
+	if apiClient != "" {
+		return key(kindAPIKey, apiClient)
+	}
+	return key(kindIP, ip)
+}
+
+// apiClient returns the client apiKey belongs to, or "" if the key is missing
+// or could not be verified.
+func apiClient(ctx context.Context, config *Config, apiKey string) string {
+	if apiKey == "" || config.VerifyAPIKey == nil {
+		return ""
+	}
+	client, ok := config.VerifyAPIKey(ctx, apiKey)
+	if !ok {
+		return ""
+	}
+	return client
+}
+
+func key(kind, value string) string {
+	h := sha256.Sum256([]byte(value))
+	return kind + ":" + hex.EncodeToString(h[:])
+}
+
+// Principal returns the identity of a client authenticated with mTLS: the
+// SPIFFE ID of its certificate if any, else its common name. Certificates
+// that were not verified are ignored.
+func Principal(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return certPrincipal(state.VerifiedChains[0][0])
+}
+
+func certPrincipal(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	return cert.Subject.CommonName
+}
+
+// clientIP returns the first address of the header values if any, else the
+// host of remoteAddr.
+func clientIP(header []string, remoteAddr string) string {
+	for _, v := range header {
+		if ip, _, _ := strings.Cut(v, ","); strings.TrimSpace(ip) != "" {
+			return strings.TrimSpace(ip)
+		}
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// httpIdentity returns the bucket key of the client of r.
+func httpIdentity(r *http.Request, config *Config) string {
+	var header []string
+	if config.IPHeader != "" {
+		header = r.Header.Values(config.IPHeader)
+	}
+	client := apiClient(r.Context(), config, r.Header.Get(APIKeyHeader))
+	return identity(r.TLS, client, clientIP(header, r.RemoteAddr))
+}
@@ -0,0 +1,114 @@
+// Package ratelimit limits the rate of requests of each client with token
+// buckets, both as gRPC interceptors and as HTTP middleware.
+//
+// Clients are identified by their authenticated principal, their API key or,
+// failing both, their IP address. Rejected requests fail with the RATE_LIMITED
+// application error, that is ResourceExhausted on gRPC and 429 on HTTP, with a
+// Retry-After delay. Every response carries X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset headers.
+//
+// Buckets live in a limiter.Store: in memory, or in the SQL database for
+// limits that hold across replicas.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+	"github.com/sethvargo/go-limiter/memorystore"
+	"github.com/sethvargo/go-limiter/noopstore"
+
+	"github.com/paveletto99/microservice-blueprint/pkg/database"
+)
+
+// Names of the headers describing the bucket of the client.
+const (
+	HeaderLimit     = "X-RateLimit-Limit"
+	HeaderRemaining = "X-RateLimit-Remaining"
+	HeaderReset     = "X-RateLimit-Reset"
+	HeaderRetry     = "Retry-After"
+)
+
+// RateLimiterFor returns the store of the type in config. db is only used by
+// TypeDatabase and may be nil otherwise. Callers must close the store.
+func RateLimiterFor(ctx context.Context, config *Config, db *database.DB) (limiter.Store, error) {
+	switch typ := Type(strings.ToUpper(string(config.Type))); typ {
+	case TypeNoop:
+		return noopstore.New()
+	case TypeMemory, "":
+		return memorystore.New(&memorystore.Config{
+			Tokens:        config.Tokens,
+			Interval:      config.Interval,
+			SweepInterval: config.SweepInterval,
+			SweepMinTTL:   config.SweepMinTTL,
+		})
+	case TypeDatabase:
+		if db == nil {
+			return nil, fmt.Errorf("ratelimit: %s store requires a database", typ)
+		}
+		return NewDatabaseStore(ctx, db, config)
+	default:
+		return nil, fmt.Errorf("ratelimit: unknown store type %q", config.Type)
+	}
+}
+
+// result is the outcome of taking a token.
+type result struct {
+	limit, remaining uint64
+	reset            time.Time
+	ok               bool
+}
+
+// retryAfter returns how long the client must wait for the bucket to refill,
+// at least a second.
+func (r *result) retryAfter(now time.Time) time.Duration {
+	if d := r.reset.Sub(now); d > time.Second {
+		return d
+	}
+	return time.Second
+}
+
+// headers returns the X-RateLimit-* headers of r. The reset is sent in seconds
+// from now, like Retry-After, so that clients don't depend on our clock. Stores
+// that don't limit, like the noop one, report a zero limit and get no headers.
+func (r *result) headers(now time.Time) map[string]string {
+	if r.limit == 0 {
+		return nil
+	}
+	h := map[string]string{
+		HeaderLimit:     strconv.FormatUint(r.limit, 10),
+		HeaderRemaining: strconv.FormatUint(r.remaining, 10),
+		HeaderReset:     seconds(r.reset.Sub(now)),
+	}
+	if !r.ok {
+		h[HeaderRetry] = seconds(r.retryAfter(now))
+	}
+	return h
+}
+
+// seconds formats d in whole seconds, rounded up so that clients don't come
+// back too early.
+func seconds(d time.Duration) string {
+	if d <= 0 {
+		return "0"
+	}
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// take takes a token from the bucket of key.
+func take(ctx context.Context, store limiter.Store, key string) (*result, error) {
+	limit, remaining, reset, ok, err := store.Take(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &result{
+		limit:     limit,
+		remaining: remaining,
+		reset:     time.Unix(0, int64(reset)),
+		ok:        ok,
+	}, nil
+}
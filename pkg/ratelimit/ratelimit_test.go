@@ -0,0 +1,339 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	apperrors "github.com/paveletto99/microservice-blueprint/pkg/errors"
+)
+
+func newMemoryStore(t *testing.T, tokens uint64) limiter.Store {
+	t.Helper()
+
+	store, err := RateLimiterFor(context.Background(), &Config{Type: TypeMemory, Tokens: tokens, Interval: time.Hour}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close(context.Background()) })
+	return store
+}
+
+func TestRateLimiterFor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	if _, err := RateLimiterFor(ctx, &Config{Type: "REDIS"}, nil); err == nil {
+		t.Errorf("expected an error for an unknown type")
+	}
+	if _, err := RateLimiterFor(ctx, &Config{Type: TypeDatabase}, nil); err == nil {
+		t.Errorf("expected an error for a database store without database")
+	}
+
+	store, err := RateLimiterFor(ctx, &Config{Type: "noop"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close(ctx)
+	if _, _, _, ok, _ := store.Take(ctx, "k"); !ok {
+		t.Errorf("expected the noop store to allow everything")
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	t.Parallel()
+
+	spiffe, _ := url.Parse("spiffe://example.org/partner")
+	verified := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	cases := []struct {
+		name      string
+		state     *tls.ConnectionState
+		apiClient string
+		ip        string
+		want      string
+	}{
+		{
+			name:  "spiffe",
+			state: verified(&x509.Certificate{URIs: []*url.URL{spiffe}, Subject: pkix.Name{CommonName: "cn"}}),
+			want:  key(kindPrincipal, "spiffe://example.org/partner"),
+		},
+		{
+			name:      "common name",
+			state:     verified(&x509.Certificate{Subject: pkix.Name{CommonName: "cn"}}),
+			apiClient: "partner",
+			want:      key(kindPrincipal, "cn"),
+		},
+		{
+			name:      "unverified",
+			state:     &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "cn"}}}},
+			apiClient: "partner",
+			want:      key(kindAPIKey, "partner"),
+		},
+		{
+			name: "ip",
+			ip:   "10.0.0.1",
+			want: key(kindIP, "10.0.0.1"),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := identity(tc.state, tc.apiClient, tc.ip); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		header     []string
+		remoteAddr string
+		want       string
+	}{
+		{name: "remote", remoteAddr: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "remote without port", remoteAddr: "10.0.0.1", want: "10.0.0.1"},
+		{name: "header", header: []string{"192.0.2.1, 10.0.0.2"}, remoteAddr: "10.0.0.1:1234", want: "192.0.2.1"},
+		{name: "empty header", header: []string{""}, remoteAddr: "10.0.0.1:1234", want: "10.0.0.1"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := clientIP(tc.header, tc.remoteAddr); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (healthServer) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (healthServer) Watch(_ *healthpb.HealthCheckRequest, stream grpc.ServerStreamingServer[healthpb.HealthCheckResponse]) error {
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+func TestGRPC(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore(t, 2)
+	config := &Config{VerifyAPIKey: verifyPartnerKey}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(store, config)),
+		grpc.StreamInterceptor(StreamServerInterceptor(store, config)))
+	healthpb.RegisterHealthServer(srv, healthServer{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := healthpb.NewHealthClient(conn)
+
+	check := func(t *testing.T, md metadata.MD, err error, remaining string, allowed bool) {
+		t.Helper()
+
+		if got := md.Get(HeaderRemaining); len(got) != 1 || got[0] != remaining {
+			t.Errorf("expected %s %s, got %v", HeaderRemaining, remaining, got)
+		}
+		if got := md.Get(HeaderLimit); len(got) != 1 || got[0] != "2" {
+			t.Errorf("expected %s 2, got %v", HeaderLimit, got)
+		}
+		if allowed {
+			if err != nil {
+				t.Fatalf("expected the call to be allowed, got %v", err)
+			}
+			return
+		}
+
+		if got := status.Code(err); got != codes.ResourceExhausted {
+			t.Errorf("expected ResourceExhausted, got %v", got)
+		}
+		e, ok := apperrors.FromError(err)
+		if !ok || e.Code != apperrors.RateLimited {
+			t.Fatalf("expected RATE_LIMITED, got %v", err)
+		}
+		if e.RetryAfter <= 0 {
+			t.Errorf("expected a retry delay")
+		}
+		if got := md.Get(HeaderRetry); len(got) != 1 {
+			t.Errorf("expected a %s header, got %v", HeaderRetry, got)
+		}
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+
+		for _, want := range []struct {
+			remaining string
+			allowed   bool
+		}{{"1", true}, {"0", true}, {"0", false}} {
+			var md metadata.MD
+			_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Header(&md))
+			check(t, md, err, want.remaining, want.allowed)
+		}
+
+		// Another client has its own bucket.
+		ctx := metadata.AppendToOutgoingContext(context.Background(), APIKeyHeader, "partner-key")
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Errorf("expected another client to be allowed, got %v", err)
+		}
+
+		// Keys that don't verify don't get a bucket of their own.
+		ctx = metadata.AppendToOutgoingContext(context.Background(), APIKeyHeader, "made-up")
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("expected an unverified key to share the bucket of its IP, got %v", err)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+
+		// Methods have their own buckets too.
+		for _, want := range []struct {
+			remaining string
+			allowed   bool
+		}{{"1", true}, {"0", true}, {"0", false}} {
+			stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = stream.Recv()
+			md, _ := stream.Header()
+			check(t, md, err, want.remaining, want.allowed)
+		}
+	})
+}
+
+// verifyPartnerKey accepts the single key of the partner client.
+func verifyPartnerKey(_ context.Context, apiKey string) (string, bool) {
+	return "partner", apiKey == "partner-key"
+}
+
+func TestMiddleware_apiKeys(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		verify func(context.Context, string) (string, bool)
+	}{
+		{name: "without verifier"},
+		{name: "rejected", verify: verifyPartnerKey},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := newMemoryStore(t, 2)
+			handler := Middleware(store, &Config{VerifyAPIKey: tc.verify})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			// A new key on every request still draws from the bucket of the IP.
+			for i := range 3 {
+				r := httptest.NewRequest(http.MethodPost, "/backup", nil)
+				r.Header.Set(APIKeyHeader, "key-"+strconv.Itoa(i))
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+
+				want := http.StatusNoContent
+				if i == 2 {
+					want = http.StatusTooManyRequests
+				}
+				if got := w.Result().StatusCode; got != want {
+					t.Errorf("request %d: expected status %d, got %d", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore(t, 1)
+	handler := Middleware(store, &Config{IPHeader: "X-Forwarded-For"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(forwardedFor string) *http.Response {
+		r := httptest.NewRequest(http.MethodPost, "/backup", nil)
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	resp := serve("192.0.2.1")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+	if got := resp.Header.Get(HeaderRemaining); got != "0" {
+		t.Errorf("expected %s 0, got %q", HeaderRemaining, got)
+	}
+
+	resp = serve("192.0.2.1")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+	if got, err := strconv.Atoi(resp.Header.Get(HeaderRetry)); err != nil || got <= 0 {
+		t.Errorf("expected a positive %s, got %q", HeaderRetry, resp.Header.Get(HeaderRetry))
+	}
+	if got := resp.Header.Get(HeaderReset); got == "" || got == "0" {
+		t.Errorf("expected a %s in the future, got %q", HeaderReset, got)
+	}
+	if e, ok := apperrors.FromResponse(resp); !ok || e.Code != apperrors.RateLimited {
+		t.Errorf("expected RATE_LIMITED problem details, got %v", e)
+	}
+
+	if resp := serve("192.0.2.2"); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected another client to be allowed, got status %d", resp.StatusCode)
+	}
+}
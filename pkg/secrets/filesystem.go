@@ -0,0 +1,42 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	RegisterManager("FILESYSTEM", NewFilesystem)
+}
+
+// Compile-time check to verify implements interface.
+var _ SecretManager = (*Filesystem)(nil)
+
+// Filesystem is a secret manager that reads secrets from files, such as those
+// mounted from Kubernetes secrets.
+type Filesystem struct {
+	root string
+}
+
+// NewFilesystem creates a secret manager that reads secrets from files under
+// FilesystemRoot.
+func NewFilesystem(ctx context.Context, cfg *Config) (SecretManager, error) {
+	if cfg.FilesystemRoot == "" {
+		return nil, fmt.Errorf("missing SECRET_FILESYSTEM_ROOT")
+	}
+	return &Filesystem{root: cfg.FilesystemRoot}, nil
+}
+
+// GetSecretValue returns the contents of the file name, relative to the root,
+// with surrounding whitespace trimmed.
+func (sm *Filesystem) GetSecretValue(_ context.Context, name string) (string, error) {
+	pth := filepath.Join(sm.root, filepath.Clean("/"+name))
+	b, err := os.ReadFile(pth)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %q: %w", name, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
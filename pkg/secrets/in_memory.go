@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+func init() {
+	RegisterManager("IN_MEMORY", NewInMemory)
+}
+
+// Compile-time check to verify implements interface.
+var _ SecretManager = (*InMemory)(nil)
+
+// InMemory is a secret manager that keeps secrets in memory. It is intended
+// for local development and testing.
+type InMemory struct {
+	mu      sync.RWMutex
+	secrets map[string]string
+}
+
+// NewInMemory creates a new, empty in-memory secret manager.
+func NewInMemory(ctx context.Context, _ *Config) (SecretManager, error) {
+	return NewInMemoryFromMap(ctx, nil)
+}
+
+// NewInMemoryFromMap creates a new in-memory secret manager holding m.
+func NewInMemoryFromMap(ctx context.Context, m map[string]string) (SecretManager, error) {
+	secrets := make(map[string]string, len(m))
+	for k, v := range m {
+		secrets[k] = v
+	}
+	return &InMemory{secrets: secrets}, nil
+}
+
+// GetSecretValue implements SecretManager.
+func (sm *InMemory) GetSecretValue(_ context.Context, name string) (string, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	v, ok := sm.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q does not exist", name)
+	}
+	return v, nil
+}
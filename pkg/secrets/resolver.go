@@ -0,0 +1,30 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// SecretPrefix is the prefix that marks an environment variable value as a
+// reference to a secret, e.g. "secret://scylla-password".
+const SecretPrefix = "secret://"
+
+// Resolver returns an envconfig mutator that replaces values prefixed with
+// SecretPrefix with the named secret from sm. Other values are unchanged.
+func Resolver(sm SecretManager) envconfig.MutatorFunc {
+	return func(ctx context.Context, originalKey, resolvedKey, originalValue, currentValue string) (string, bool, error) {
+		name, ok := strings.CutPrefix(currentValue, SecretPrefix)
+		if !ok {
+			return currentValue, false, nil
+		}
+
+		v, err := sm.GetSecretValue(ctx, name)
+		if err != nil {
+			return "", true, fmt.Errorf("failed to resolve %s: %w", resolvedKey, err)
+		}
+		return v, false, nil
+	}
+}
@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sm, err := NewInMemoryFromMap(ctx, map[string]string{"db-password": "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve := Resolver(sm)
+
+	cases := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", value: "password", want: "password"},
+		{name: "secret", value: "secret://db-password", want: "hunter2"},
+		{name: "missing", value: "secret://nope", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, _, err := resolve(ctx, "KEY", "KEY", tc.value, tc.value)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFilesystem(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "password"), []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err := NewFilesystem(ctx, &Config{FilesystemRoot: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := sm.GetSecretValue(ctx, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "hunter2" {
+		t.Errorf("expected %q, got %q", "hunter2", got)
+	}
+
+	// Names cannot escape the root.
+	if _, err := sm.GetSecretValue(ctx, "../"+filepath.Base(root)+"/password"); err == nil {
+		t.Errorf("expected error reading outside root")
+	}
+}
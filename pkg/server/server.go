@@ -15,9 +15,13 @@ import (
 
 	"github.com/paveletto99/microservice-blueprint/pkg/observability"
 	"github.com/quic-go/quic-go/http3"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"google.golang.org/grpc"
 )
 
+// gracefulStopTimeout bounds how long ServeGRPC waits for in-flight RPCs.
+var gracefulStopTimeout = 5 * time.Second
+
 // Server provides a gracefully-stoppable http server implementation. It is safe
 // for concurrent use in goroutines.
 type Server struct {
@@ -32,7 +36,7 @@ type Server struct {
 func New(port string) (*Server, error) {
 	// Create the net listener first, so the connection ready when we return. This
 	// guarantees that it can accept requests.
-	addr := fmt.Sprintf(":" + port)
+	addr := ":" + port
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create listener on %s: %w", addr, err)
@@ -95,7 +99,7 @@ func (s *Server) ServeHTTP3(ctx context.Context, srv *http3.Server) error {
 	// Shutdown the prometheus metrics proxy.
 	if metricsDone != nil {
 		if err := metricsDone(); err != nil {
-			slog.Error("failed to close metrics exporter: %w", err)
+			slog.Error("failed to close metrics exporter", "error", err)
 		}
 	}
 
@@ -152,40 +156,46 @@ func (s *Server) ServeHTTP(ctx context.Context, srv *http.Server) error {
 	return nil
 }
 
-// ServeHTTPHandler is a convenience wrapper around ServeHTTP. It creates an
-// HTTP server using the provided handler, wrapped in OpenCensus for
-// observability.
+// ServeHTTPHandler is a convenience wrapper around ServeHTTP3. It creates an
+// HTTP/3 server using the provided handler, wrapped in OpenTelemetry for
+// observability. Incoming W3C trace contexts are continued.
 func (s *Server) ServeHTTPHandler(ctx context.Context, handler http.Handler) error {
 	return s.ServeHTTP3(ctx, &http3.Server{
 		Addr:    net.JoinHostPort(s.ip, s.port),
-		Handler: handler,
+		Handler: otelhttp.NewHandler(handler, "http.server"),
 	})
-	// return s.ServeHTTP(ctx, &http.Server{
-	// 	ReadHeaderTimeout: 10 * time.Second,
-	// 	Handler: &ochttp.Handler{
-	// 		Handler:          handler,
-	// 		IsPublicEndpoint: true,
-	// 		Propagation:      &tracecontext.HTTPFormat{},
-	// 	},
-	// })
 }
 
 // ServeGRPC starts the server and blocks until the provided context is closed.
 // When the provided context is closed, the server is gracefully stopped with a
-// timeout of 5 seconds.
+// timeout of 5 seconds, after which remaining RPCs, such as long-lived streams,
+// are cancelled.
 //
 // Once a server has been stopped, it is NOT safe for reuse.
 func (s *Server) ServeGRPC(ctx context.Context, srv *grpc.Server) error {
 
 	// Spawn a goroutine that listens for context closure. When the context is
 	// closed, the server is stopped.
-	errCh := make(chan error, 1)
+	shutdown := make(chan struct{})
 	go func() {
+		defer close(shutdown)
 		<-ctx.Done()
 
 		slog.DebugContext(ctx, "server.Serve: context closed")
 		slog.DebugContext(ctx, "server.Serve: shutting down")
-		srv.GracefulStop()
+
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(gracefulStopTimeout):
+			slog.WarnContext(ctx, "server.Serve: graceful stop timed out, cancelling remaining RPCs")
+			srv.Stop()
+		}
 	}()
 
 	// Run the server. This will block until the provided context is closed.
@@ -193,15 +203,10 @@ func (s *Server) ServeGRPC(ctx context.Context, srv *grpc.Server) error {
 		return fmt.Errorf("failed to serve: %w", err)
 	}
 
+	// Serve returns as soon as stopping begins; wait for in-flight RPCs.
+	<-shutdown
 	slog.Debug("server.Serve: serving stopped")
-
-	// Return any errors that happened during shutdown.
-	select {
-	case err := <-errCh:
-		return fmt.Errorf("failed to shutdown: %w", err)
-	default:
-		return nil
-	}
+	return nil
 }
 
 // Addr returns the server's listening address (ip + port).
@@ -0,0 +1,97 @@
+// Package snowflake generates unique, roughly time-ordered 63-bit IDs.
+//
+// An ID is laid out, from the most significant bit, as
+//
+//	0 | milliseconds since Epoch (41) | node (10) | sequence (12)
+//
+// so IDs from one generator strictly increase, IDs from different nodes never
+// collide, and sorting IDs sorts them by creation time to the millisecond.
+package snowflake
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+
+	// MaxNode is the largest valid node number.
+	MaxNode = 1<<nodeBits - 1
+
+	maxSequence = 1<<sequenceBits - 1
+	maxMillis   = 1<<41 - 1
+)
+
+// Epoch is the time IDs count from. It leaves room for about 69 years.
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Generator generates IDs for a single node. It is safe for concurrent use.
+type Generator struct {
+	mu       sync.Mutex
+	node     int64
+	lastMs   int64
+	sequence int64
+
+	now func() time.Time
+}
+
+// New creates a generator for node, which must be unique among the processes
+// generating IDs of the same kind and between 0 and MaxNode.
+func New(node int64) (*Generator, error) {
+	if node < 0 || node > MaxNode {
+		return nil, fmt.Errorf("snowflake node %d out of range [0, %d]", node, MaxNode)
+	}
+	return &Generator{
+		node: node,
+		now:  time.Now,
+	}, nil
+}
+
+// Next returns a new ID. When the 4096 IDs of the current millisecond are used
+// up, or the clock moved backwards, it waits for the clock to catch up.
+func (g *Generator) Next() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.millis()
+	for ms < g.lastMs {
+		// The clock moved backwards, e.g. after an NTP adjustment. Reusing old
+		// timestamps could repeat IDs, so wait until it passes lastMs again.
+		time.Sleep(time.Duration(g.lastMs-ms) * time.Millisecond)
+		ms = g.millis()
+	}
+
+	if ms == g.lastMs {
+		g.sequence = (g.sequence + 1) & maxSequence
+		if g.sequence == 0 {
+			for ms <= g.lastMs {
+				ms = g.millis()
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+
+	if ms > maxMillis {
+		return 0, fmt.Errorf("snowflake epoch exhausted")
+	}
+	g.lastMs = ms
+	return ms<<(nodeBits+sequenceBits) | g.node<<sequenceBits | g.sequence, nil
+}
+
+func (g *Generator) millis() int64 {
+	return g.now().Sub(Epoch).Milliseconds()
+}
+
+// Time returns the time, to the millisecond, at which id was generated.
+func Time(id int64) time.Time {
+	return Epoch.Add(time.Duration(id>>(nodeBits+sequenceBits)) * time.Millisecond)
+}
+
+// Node returns the node that generated id.
+func Node(id int64) int64 {
+	return id >> sequenceBits & MaxNode
+}
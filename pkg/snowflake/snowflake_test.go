@@ -0,0 +1,107 @@
+package snowflake
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGenerator_Next(t *testing.T) {
+	t.Parallel()
+
+	g, err := New(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10000
+	var last int64
+	for i := 0; i < n; i++ {
+		id, err := g.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= last {
+			t.Fatalf("expected increasing IDs, got %d after %d", id, last)
+		}
+		if Node(id) != 7 {
+			t.Fatalf("expected node 7, got %d", Node(id))
+		}
+		last = id
+	}
+
+	if d := time.Since(Time(last)); d < 0 || d > time.Minute {
+		t.Errorf("expected ID time close to now, got %s", Time(last))
+	}
+}
+
+func TestGenerator_concurrent(t *testing.T) {
+	t.Parallel()
+
+	g, err := New(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[int64]bool)
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				id, err := g.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("duplicate ID %d", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGenerator_clockBackwards(t *testing.T) {
+	t.Parallel()
+
+	g, err := New(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now()
+	calls := 0
+	g.now = func() time.Time {
+		calls++
+		if calls == 2 {
+			// Jump back once, then recover.
+			return base.Add(-time.Millisecond)
+		}
+		return base.Add(time.Duration(calls) * time.Millisecond)
+	}
+
+	first, _ := g.Next()
+	second, _ := g.Next()
+	if second <= first {
+		t.Errorf("expected IDs to increase across a clock jump, got %d after %d", second, first)
+	}
+}
+
+func TestNew_invalidNode(t *testing.T) {
+	t.Parallel()
+
+	for _, node := range []int64{-1, MaxNode + 1} {
+		if _, err := New(node); err == nil {
+			t.Errorf("expected error for node %d", node)
+		}
+	}
+}
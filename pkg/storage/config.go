@@ -0,0 +1,28 @@
+package storage
+
+// Config represents the config for a blobstore.
+type Config struct {
+	// Type is the name of the blobstore. It has no default: IN_MEMORY would
+	// silently lose everything written on restart, and is meant for tests.
+	Type string `env:"BLOBSTORE, required"`
+
+	// FilesystemRoot is the directory of the buckets of the FILESYSTEM
+	// blobstore.
+	FilesystemRoot string `env:"BLOBSTORE_FILESYSTEM_ROOT"`
+
+	// S3Endpoint is the URL of the S3-compatible service of the S3 blobstore,
+	// e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000.
+	S3Endpoint        string `env:"BLOBSTORE_S3_ENDPOINT"`
+	S3Region          string `env:"BLOBSTORE_S3_REGION, default=us-east-1"`
+	S3AccessKeyID     string `env:"BLOBSTORE_S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `env:"BLOBSTORE_S3_SECRET_ACCESS_KEY" json:"-"`
+
+	// S3PathStyle addresses buckets in the path of URLs, as most
+	// S3-compatible services expect, rather than in their host.
+	S3PathStyle bool `env:"BLOBSTORE_S3_PATH_STYLE, default=true"`
+
+	// S3PartSize is the size of the parts of multipart uploads, in bytes.
+	// Smaller objects are uploaded in a single request. S3 requires at least
+	// 5 MiB.
+	S3PartSize int64 `env:"BLOBSTORE_S3_PART_SIZE, default=16777216"`
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+func init() {
+	RegisterBlobstore("FILESYSTEM", NewFilesystem)
+}
+
+// Compile-time check to verify implements interface.
+var _ Blobstore = (*Filesystem)(nil)
+
+// Directories of the root of a Filesystem that are not buckets, which can't
+// start with a dot.
+const (
+	metadataDir = ".metadata"
+	tmpDir      = ".tmp"
+)
+
+// Filesystem is a blobstore that keeps the objects of each bucket in a
+// directory of its root, e.g. a mounted volume. The contents of an object are
+// the file at its name, so an object can't be named after the directory of
+// another. Objects are created atomically, by renaming temporary files.
+type Filesystem struct {
+	root string
+
+	// mu keeps readers from seeing the contents of an object with the
+	// metadata of the one it replaces.
+	mu sync.RWMutex
+}
+
+// fileMetadata is the metadata file of an object.
+type fileMetadata struct {
+	ContentType string            `json:"content_type"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	SHA256      string            `json:"sha256"`
+}
+
+// NewFilesystem creates a blobstore that keeps buckets under FilesystemRoot.
+func NewFilesystem(_ context.Context, cfg *Config) (Blobstore, error) {
+	if cfg.FilesystemRoot == "" {
+		return nil, fmt.Errorf("missing BLOBSTORE_FILESYSTEM_ROOT")
+	}
+	for _, dir := range []string{metadataDir, tmpDir} {
+		if err := os.MkdirAll(filepath.Join(cfg.FilesystemRoot, dir), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create blobstore directory: %w", err)
+		}
+	}
+	return &Filesystem{root: cfg.FilesystemRoot}, nil
+}
+
+// CreateObject implements Blobstore.
+func (s *Filesystem) CreateObject(ctx context.Context, bucket, name string, contents io.Reader, opts *CreateOptions) (*Object, error) {
+	if err := validate(bucket, name); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.root, tmpDir), "object-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	c := newChecksummer(&contextReader{ctx: ctx, r: contents})
+	if _, err := io.Copy(tmp, c); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write object: %w", err)
+	}
+
+	meta := &fileMetadata{
+		ContentType: opts.contentType(),
+		Metadata:    opts.metadata(),
+		SHA256:      c.sum(),
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	metaTmp := tmp.Name() + ".json"
+	if err := os.WriteFile(metaTmp, b, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write metadata: %w", err)
+	}
+	defer os.Remove(metaTmp)
+
+	objectPath, metaPath := s.objectPath(bucket, name), s.metadataPath(bucket, name)
+	for _, dir := range []string{filepath.Dir(objectPath), filepath.Dir(metaPath)} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create object directory: %w", err)
+		}
+	}
+	s.mu.Lock()
+	err = os.Rename(tmp.Name(), objectPath)
+	if err == nil {
+		err = os.Rename(metaTmp, metaPath)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object: %w", err)
+	}
+	return s.StatObject(ctx, bucket, name)
+}
+
+// GetObject implements Blobstore.
+func (s *Filesystem) GetObject(ctx context.Context, bucket, name string) (io.ReadCloser, *Object, error) {
+	if err := validate(bucket, name); err != nil {
+		return nil, nil, err
+	}
+
+	f, o, err := s.open(bucket, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return verify(f, o.SHA256), o, nil
+}
+
+// StatObject implements Blobstore.
+func (s *Filesystem) StatObject(_ context.Context, bucket, name string) (*Object, error) {
+	if err := validate(bucket, name); err != nil {
+		return nil, err
+	}
+
+	f, o, err := s.open(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return o, nil
+}
+
+// DeleteObject implements Blobstore. The directories left empty are deleted
+// too.
+func (s *Filesystem) DeleteObject(_ context.Context, bucket, name string) error {
+	if err := validate(bucket, name); err != nil {
+		return err
+	}
+
+	objectPath := s.objectPath(bucket, name)
+	s.mu.Lock()
+	err := os.Remove(objectPath)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		err = os.Remove(s.metadataPath(bucket, name))
+	}
+	s.mu.Unlock()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	// Removing a directory that is not empty fails, which ends the cleanup.
+	bucketDir := filepath.Join(s.root, bucket)
+	for dir := filepath.Dir(objectPath); dir != bucketDir; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// ListObjects implements Blobstore. The objects of a bucket that does not
+// exist are none.
+func (s *Filesystem) ListObjects(_ context.Context, bucket, prefix string) iter.Seq2[*Object, error] {
+	return func(yield func(*Object, error) bool) {
+		if err := validateBucket(bucket); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		// Only the directory of the prefix can have matching objects.
+		bucketDir := filepath.Join(s.root, bucket)
+		start := bucketDir
+		if dir, _ := path.Split(prefix); dir != "" && fs.ValidPath(strings.TrimSuffix(dir, "/")) {
+			start = filepath.Join(bucketDir, filepath.FromSlash(dir))
+		}
+
+		var list []*Object
+		err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return fs.SkipAll
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(bucketDir, p)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if !strings.HasPrefix(name, prefix) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			list = append(list, &Object{Bucket: bucket, Name: name, Size: info.Size(), Updated: info.ModTime().UTC()})
+			return nil
+		})
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to list objects: %w", err))
+			return
+		}
+
+		// Walks are in the order of each directory, not of whole names.
+		slices.SortFunc(list, func(a, b *Object) int { return strings.Compare(a.Name, b.Name) })
+		for _, o := range list {
+			if !yield(o, nil) {
+				return
+			}
+		}
+	}
+}
+
+// open opens the contents of an object, and reads it.
+func (s *Filesystem) open(bucket, name string) (*os.File, *Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, err := os.Open(s.objectPath(bucket, name))
+	if err != nil {
+		return nil, nil, s.fileError(bucket, name, err)
+	}
+	o, err := s.stat(f, bucket, name)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, o, nil
+}
+
+// stat returns the object of the open file f.
+func (s *Filesystem) stat(f *os.File, bucket, name string) (*Object, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, name)
+	}
+
+	o := &Object{
+		Bucket:      bucket,
+		Name:        name,
+		Size:        info.Size(),
+		ContentType: defaultContentType,
+		Updated:     info.ModTime().UTC(),
+	}
+	// Objects copied into the root have no metadata.
+	b, err := os.ReadFile(s.metadataPath(bucket, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return o, nil
+		}
+		return nil, fmt.Errorf("failed to read object metadata: %w", err)
+	}
+	var meta fileMetadata
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("failed to decode object metadata: %w", err)
+	}
+	o.ContentType, o.Metadata, o.SHA256 = meta.ContentType, meta.Metadata, meta.SHA256
+	return o, nil
+}
+
+func (s *Filesystem) objectPath(bucket, name string) string {
+	return filepath.Join(s.root, bucket, filepath.FromSlash(name))
+}
+
+// metadataPath returns the path of the metadata file of an object, named
+// after the hash of its name so that it can't clash with other objects.
+func (s *Filesystem) metadataPath(bucket, name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return filepath.Join(s.root, metadataDir, bucket, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *Filesystem) fileError(bucket, name string, err error) error {
+	// A file in the path of the name means the object does not exist either.
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, name)
+	}
+	return fmt.Errorf("failed to open object: %w", err)
+}
+
+// contextReader fails reads once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterBlobstore("IN_MEMORY", NewInMemory)
+}
+
+// Compile-time check to verify implements interface.
+var _ Blobstore = (*InMemory)(nil)
+
+// InMemory is a blobstore that keeps objects in memory. It is intended for
+// local development and testing.
+type InMemory struct {
+	mu      sync.RWMutex
+	objects map[string]*memoryObject
+}
+
+type memoryObject struct {
+	object   Object
+	contents []byte
+}
+
+// NewInMemory creates a new, empty in-memory blobstore.
+func NewInMemory(_ context.Context, _ *Config) (Blobstore, error) {
+	return &InMemory{objects: make(map[string]*memoryObject)}, nil
+}
+
+// CreateObject implements Blobstore.
+func (s *InMemory) CreateObject(_ context.Context, bucket, name string, contents io.Reader, opts *CreateOptions) (*Object, error) {
+	if err := validate(bucket, name); err != nil {
+		return nil, err
+	}
+	c := newChecksummer(contents)
+	b, err := io.ReadAll(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contents: %w", err)
+	}
+
+	o := &memoryObject{
+		object: Object{
+			Bucket:      bucket,
+			Name:        name,
+			Size:        c.size,
+			ContentType: opts.contentType(),
+			Metadata:    opts.metadata(),
+			SHA256:      c.sum(),
+			Updated:     time.Now().UTC(),
+		},
+		contents: b,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[bucket+"/"+name] = o
+	return o.copy(), nil
+}
+
+// GetObject implements Blobstore.
+func (s *InMemory) GetObject(_ context.Context, bucket, name string) (io.ReadCloser, *Object, error) {
+	o, err := s.get(bucket, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return verify(io.NopCloser(bytes.NewReader(o.contents)), o.object.SHA256), o.copy(), nil
+}
+
+// StatObject implements Blobstore.
+func (s *InMemory) StatObject(_ context.Context, bucket, name string) (*Object, error) {
+	o, err := s.get(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	return o.copy(), nil
+}
+
+// DeleteObject implements Blobstore.
+func (s *InMemory) DeleteObject(_ context.Context, bucket, name string) error {
+	if err := validate(bucket, name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, bucket+"/"+name)
+	return nil
+}
+
+// ListObjects implements Blobstore.
+func (s *InMemory) ListObjects(_ context.Context, bucket, prefix string) iter.Seq2[*Object, error] {
+	return func(yield func(*Object, error) bool) {
+		if err := validateBucket(bucket); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		s.mu.RLock()
+		var list []*Object
+		for _, key := range slices.Sorted(maps.Keys(s.objects)) {
+			if strings.HasPrefix(key, bucket+"/"+prefix) {
+				list = append(list, s.objects[key].copy())
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, o := range list {
+			if !yield(o, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *InMemory) get(bucket, name string) (*memoryObject, error) {
+	if err := validate(bucket, name); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.objects[bucket+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, name)
+	}
+	return o, nil
+}
+
+// copy returns a copy of the object, that callers may modify.
+func (o *memoryObject) copy() *Object {
+	c := o.object
+	c.Metadata = maps.Clone(o.object.Metadata)
+	return &c
+}
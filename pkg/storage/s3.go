@@ -0,0 +1,515 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+func init() {
+	RegisterBlobstore("S3", NewS3)
+}
+
+// Compile-time check to verify implements interface.
+var _ Blobstore = (*S3)(nil)
+
+// minPartSize is the minimum size of the parts of S3 multipart uploads, but
+// the last.
+const minPartSize = 5 << 20
+
+// checksumKey is the user metadata key of the checksum of S3 objects.
+const checksumKey = "content-sha256"
+
+// metaPrefix prefixes the headers of the user metadata of S3 objects.
+const metaPrefix = "X-Amz-Meta-"
+
+// abortTimeout bounds the abort of a failed multipart upload, which happens
+// even if the upload failed because its context is done.
+const abortTimeout = 30 * time.Second
+
+// S3 is a blobstore on the S3 API, of AWS or any compatible service such as
+// MinIO. Requests are signed with AWS Signature Version 4. Objects are
+// uploaded in a single request if they fit in a part, and with a multipart
+// upload otherwise, after which their metadata is replaced to add their
+// checksum.
+type S3 struct {
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	partSize  int64
+
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3 creates a blobstore on the S3 API at S3Endpoint.
+func NewS3(_ context.Context, cfg *Config) (Blobstore, error) {
+	if cfg.S3Endpoint == "" {
+		return nil, fmt.Errorf("missing BLOBSTORE_S3_ENDPOINT")
+	}
+	endpoint, err := url.Parse(cfg.S3Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid BLOBSTORE_S3_ENDPOINT %q", cfg.S3Endpoint)
+	}
+	if cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+		return nil, fmt.Errorf("missing BLOBSTORE_S3_ACCESS_KEY_ID or BLOBSTORE_S3_SECRET_ACCESS_KEY")
+	}
+	if cfg.S3PartSize < minPartSize {
+		return nil, fmt.Errorf("BLOBSTORE_S3_PART_SIZE must be at least %d", minPartSize)
+	}
+
+	return &S3{
+		endpoint:  endpoint,
+		region:    cfg.S3Region,
+		accessKey: cfg.S3AccessKeyID,
+		secretKey: cfg.S3SecretAccessKey,
+		pathStyle: cfg.S3PathStyle,
+		partSize:  cfg.S3PartSize,
+		client:    &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		now:       time.Now,
+	}, nil
+}
+
+// CreateObject implements Blobstore.
+func (s *S3) CreateObject(ctx context.Context, bucket, name string, contents io.Reader, opts *CreateOptions) (*Object, error) {
+	if err := validate(bucket, name); err != nil {
+		return nil, err
+	}
+
+	c := newChecksummer(contents)
+	var part bytes.Buffer
+	if _, err := io.CopyN(&part, c, s.partSize); errors.Is(err, io.EOF) {
+		header := s.objectHeader(opts)
+		header.Set(metaPrefix+checksumKey, c.sum())
+		resp, err := s.do(ctx, http.MethodPut, s.url(bucket, name, nil), header, part.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload object: %w", err)
+		}
+		resp.Body.Close()
+		return s.StatObject(ctx, bucket, name)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read contents: %w", err)
+	}
+
+	if err := s.multipartUpload(ctx, bucket, name, c, &part, opts); err != nil {
+		return nil, err
+	}
+
+	// The checksum is only known now, so the metadata of the object is
+	// replaced with a copy of the object onto itself.
+	header := s.objectHeader(opts)
+	header.Set(metaPrefix+checksumKey, c.sum())
+	header.Set("X-Amz-Copy-Source", "/"+bucket+"/"+uriEncode(name, false))
+	header.Set("X-Amz-Metadata-Directive", "REPLACE")
+	if err := s.doXML(ctx, http.MethodPut, s.url(bucket, name, nil), header, nil, nil); err != nil {
+		return nil, fmt.Errorf("failed to set object checksum: %w", err)
+	}
+	return s.StatObject(ctx, bucket, name)
+}
+
+// multipartUpload uploads first and then the rest of c, in parts.
+func (s *S3) multipartUpload(ctx context.Context, bucket, name string, c io.Reader, first *bytes.Buffer, opts *CreateOptions) (err error) {
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.doXML(ctx, http.MethodPost, s.url(bucket, name, url.Values{"uploads": {""}}), s.objectHeader(opts), nil, &initiated); err != nil {
+		return fmt.Errorf("failed to start upload: %w", err)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+		defer cancel()
+		if resp, abortErr := s.do(abortCtx, http.MethodDelete, s.url(bucket, name, url.Values{"uploadId": {initiated.UploadID}}), nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	type completedPart struct {
+		PartNumber int
+		ETag       string
+	}
+	var complete struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+	part := first
+	for number := 1; ; number++ {
+		resp, err := s.do(ctx, http.MethodPut, s.url(bucket, name, url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {initiated.UploadID},
+		}), nil, part.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d: %w", number, err)
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		part.Reset()
+		n, err := io.CopyN(part, c, s.partSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read contents: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload: %w", err)
+	}
+	if err := s.doXML(ctx, http.MethodPost, s.url(bucket, name, url.Values{"uploadId": {initiated.UploadID}}), nil, body, nil); err != nil {
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+	return nil
+}
+
+// GetObject implements Blobstore.
+func (s *S3) GetObject(ctx context.Context, bucket, name string) (io.ReadCloser, *Object, error) {
+	if err := validate(bucket, name); err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, s.url(bucket, name, nil), nil, nil)
+	if err != nil {
+		return nil, nil, s.objectError(bucket, name, err)
+	}
+	o := objectFromResponse(bucket, name, resp)
+	return verify(resp.Body, o.SHA256), o, nil
+}
+
+// StatObject implements Blobstore.
+func (s *S3) StatObject(ctx context.Context, bucket, name string) (*Object, error) {
+	if err := validate(bucket, name); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(ctx, http.MethodHead, s.url(bucket, name, nil), nil, nil)
+	if err != nil {
+		return nil, s.objectError(bucket, name, err)
+	}
+	resp.Body.Close()
+	return objectFromResponse(bucket, name, resp), nil
+}
+
+// DeleteObject implements Blobstore.
+func (s *S3) DeleteObject(ctx context.Context, bucket, name string) error {
+	if err := validate(bucket, name); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, s.url(bucket, name, nil), nil, nil)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListObjects implements Blobstore. Objects are listed a page at a time, as
+// they are iterated.
+func (s *S3) ListObjects(ctx context.Context, bucket, prefix string) iter.Seq2[*Object, error] {
+	return func(yield func(*Object, error) bool) {
+		if err := validateBucket(bucket); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		var token string
+		for {
+			query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+			if token != "" {
+				query.Set("continuation-token", token)
+			}
+			var page struct {
+				IsTruncated           bool
+				NextContinuationToken string
+				Contents              []struct {
+					Key          string
+					Size         int64
+					LastModified time.Time
+				}
+			}
+			if err := s.doXML(ctx, http.MethodGet, s.url(bucket, "", query), nil, nil, &page); err != nil {
+				yield(nil, fmt.Errorf("failed to list objects: %w", err))
+				return
+			}
+
+			for _, c := range page.Contents {
+				if !yield(&Object{Bucket: bucket, Name: c.Key, Size: c.Size, Updated: c.LastModified.UTC()}, nil) {
+					return
+				}
+			}
+			if !page.IsTruncated || page.NextContinuationToken == "" {
+				return
+			}
+			token = page.NextContinuationToken
+		}
+	}
+}
+
+// objectHeader returns the headers of the content type and user metadata of
+// a new object.
+func (s *S3) objectHeader(opts *CreateOptions) http.Header {
+	header := http.Header{}
+	header.Set("Content-Type", opts.contentType())
+	for k, v := range opts.metadata() {
+		header.Set(metaPrefix+k, v)
+	}
+	return header
+}
+
+// objectFromResponse returns the object described by the headers of a GET or
+// HEAD response.
+func objectFromResponse(bucket, name string, resp *http.Response) *Object {
+	header := resp.Header
+	o := &Object{Bucket: bucket, Name: name, Size: resp.ContentLength, ContentType: header.Get("Content-Type")}
+	if t, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		o.Updated = t.UTC()
+	}
+
+	for k, v := range header {
+		if !strings.HasPrefix(k, metaPrefix) || len(v) == 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(k, metaPrefix))
+		if key == checksumKey {
+			o.SHA256 = v[0]
+			continue
+		}
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]string)
+		}
+		o.Metadata[key] = v[0]
+	}
+	return o
+}
+
+func (s *S3) objectError(bucket, name string, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %s/%s", ErrNotFound, bucket, name)
+	}
+	return fmt.Errorf("failed to read object: %w", err)
+}
+
+// url returns the URL of the object name of bucket, or of bucket if name is
+// empty.
+func (s *S3) url(bucket, name string, query url.Values) *url.URL {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		p += "/" + bucket
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	if name != "" || !s.pathStyle {
+		p += "/" + name
+	}
+	u.Path, u.RawPath = p, uriEncode(p, false)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do sends a signed request with body, and returns its response if it
+// succeeded, or its error.
+func (s *S3) do(ctx context.Context, method string, u *url.URL, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		return nil, readError(resp.StatusCode, resp.Body)
+	}
+	return resp, nil
+}
+
+// doXML sends a signed request with body, and decodes its XML response into
+// v, unless v is nil. Some requests of S3 fail with an error in the response
+// of a success.
+func (s *S3) doXML(ctx context.Context, method string, u *url.URL, header http.Header, body []byte, v any) error {
+	resp, err := s.do(ctx, method, u, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if bytes.Contains(b, []byte("<Error>")) {
+		return readError(resp.StatusCode, bytes.NewReader(b))
+	}
+	if v == nil {
+		return nil
+	}
+	if err := xml.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// apiError is an error response of the S3 API.
+type apiError struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func readError(status int, r io.Reader) error {
+	e := &apiError{StatusCode: status}
+	// Responses to HEAD requests have no body.
+	_ = xml.NewDecoder(io.LimitReader(r, 64<<10)).Decode(e)
+	return e
+}
+
+func (e *apiError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is makes missing objects and buckets ErrNotFound.
+func (e *apiError) Is(target error) bool {
+	return target == ErrNotFound && (e.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey" || e.Code == "NoSuchBucket")
+}
+
+// sign signs req with AWS Signature Version 4, for a payload of the given
+// SHA-256. The host, content type, range and x-amz-* headers are signed.
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + s.region + "/s3/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if k == "content-type" || k == "range" || strings.HasPrefix(k, "x-amz-") {
+			trimmed := make([]string, len(v))
+			for i := range v {
+				trimmed[i] = strings.Join(strings.Fields(v[i]), " ")
+			}
+			values[k] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, k := range names {
+		headers.WriteString(k + ":" + values[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, v := range []string{amzDate[:8], s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns query sorted and encoded as signatures expect.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters of
+// RFC 3986, and slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
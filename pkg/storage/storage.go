@@ -0,0 +1,234 @@
+// Package storage is an interface over object storage, such as the
+// filesystem, memory or any S3-compatible service.
+//
+// Objects are streamed in and out, and carry a content type, user metadata
+// and the SHA-256 checksum of their contents, computed as they are created
+// and verified as they are read.
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"iter"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound indicates that the object or its bucket does not exist.
+	ErrNotFound = errors.New("object not found")
+
+	// ErrChecksumMismatch indicates that the contents read from an object are
+	// not the ones it was created with.
+	ErrChecksumMismatch = errors.New("object checksum mismatch")
+
+	// ErrInvalidName indicates that a bucket or object name is not valid.
+	ErrInvalidName = errors.New("invalid bucket or object name")
+)
+
+// Blobstore defines the minimum interface for a blob storage system.
+type Blobstore interface {
+	// CreateObject streams contents into the object name of bucket,
+	// replacing any object with that name. The object exists once
+	// CreateObject returns it without error; opts may be nil.
+	CreateObject(ctx context.Context, bucket, name string, contents io.Reader, opts *CreateOptions) (*Object, error)
+
+	// GetObject returns the object name of bucket and a reader of its
+	// contents, which the caller must close. If the contents don't match the
+	// checksum of the object, the reader fails with ErrChecksumMismatch at
+	// their end.
+	GetObject(ctx context.Context, bucket, name string) (io.ReadCloser, *Object, error)
+
+	// StatObject returns the object name of bucket.
+	StatObject(ctx context.Context, bucket, name string) (*Object, error)
+
+	// DeleteObject deletes the object name of bucket. Deleting an object that
+	// does not exist is not an error.
+	DeleteObject(ctx context.Context, bucket, name string) error
+
+	// ListObjects returns the objects of bucket whose names start with
+	// prefix, in the order of their names. The content type, metadata and
+	// checksum of listed objects may be missing, StatObject returns them.
+	ListObjects(ctx context.Context, bucket, prefix string) iter.Seq2[*Object, error]
+}
+
+// Object describes a stored object.
+type Object struct {
+	Bucket string
+	Name   string
+
+	// Size is the size of the contents, in bytes.
+	Size int64
+
+	ContentType string
+
+	// Metadata is the user metadata of the object.
+	Metadata map[string]string
+
+	// SHA256 is the hex encoded SHA-256 of the contents.
+	SHA256 string
+
+	// Updated is when the object was last created.
+	Updated time.Time
+}
+
+// CreateOptions are the options of a new object.
+type CreateOptions struct {
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+
+	// Metadata is the user metadata of the object. Keys are case
+	// insensitive, and stored in lower case.
+	Metadata map[string]string
+}
+
+// defaultContentType is the content type of objects created without one.
+const defaultContentType = "application/octet-stream"
+
+// BlobstoreFunc is a func that returns a blobstore or error.
+type BlobstoreFunc func(context.Context, *Config) (Blobstore, error)
+
+// blobstores is the list of registered blobstores.
+var (
+	blobstores     = make(map[string]BlobstoreFunc)
+	blobstoresLock sync.RWMutex
+)
+
+// RegisterBlobstore registers a new blobstore with the given name. If a
+// blobstore is already registered with the given name, it panics. Blobstores
+// are usually registered via an init function.
+func RegisterBlobstore(name string, fn BlobstoreFunc) {
+	blobstoresLock.Lock()
+	defer blobstoresLock.Unlock()
+
+	if _, ok := blobstores[name]; ok {
+		panic(fmt.Sprintf("blobstore %q is already registered", name))
+	}
+	blobstores[name] = fn
+}
+
+// RegisteredBlobstores returns the list of the names of the registered
+// blobstores.
+func RegisteredBlobstores() []string {
+	blobstoresLock.RLock()
+	defer blobstoresLock.RUnlock()
+
+	list := make([]string, 0, len(blobstores))
+	for k := range blobstores {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// BlobstoreFor returns the blobstore of the type of cfg, or an error if one
+// does not exist.
+func BlobstoreFor(ctx context.Context, cfg *Config) (Blobstore, error) {
+	blobstoresLock.RLock()
+	defer blobstoresLock.RUnlock()
+
+	name := cfg.Type
+	fn, ok := blobstores[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown or uncompiled blobstore %q", name)
+	}
+	return fn(ctx, cfg)
+}
+
+// contentType returns the content type of opts.
+func (opts *CreateOptions) contentType() string {
+	if opts == nil || opts.ContentType == "" {
+		return defaultContentType
+	}
+	return opts.ContentType
+}
+
+// metadata returns a copy of the metadata of opts, with lower case keys.
+func (opts *CreateOptions) metadata() map[string]string {
+	if opts == nil || len(opts.Metadata) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(opts.Metadata))
+	for k, v := range opts.Metadata {
+		m[strings.ToLower(k)] = v
+	}
+	return m
+}
+
+// checksummer computes the size and checksum of what is read through it.
+type checksummer struct {
+	r    io.Reader
+	h    hash.Hash
+	size int64
+}
+
+func newChecksummer(r io.Reader) *checksummer {
+	return &checksummer{r: r, h: sha256.New()}
+}
+
+func (c *checksummer) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	c.size += int64(n)
+	return n, err
+}
+
+func (c *checksummer) sum() string {
+	return hex.EncodeToString(c.h.Sum(nil))
+}
+
+// verifier fails with ErrChecksumMismatch at the end of contents that don't
+// have the expected checksum.
+type verifier struct {
+	checksummer
+	closer io.Closer
+	want   string
+}
+
+// verify returns rc, checked against want if it is set.
+func verify(rc io.ReadCloser, want string) io.ReadCloser {
+	if want == "" {
+		return rc
+	}
+	return &verifier{checksummer: checksummer{r: rc, h: sha256.New()}, closer: rc, want: want}
+}
+
+func (v *verifier) Read(p []byte) (int, error) {
+	n, err := v.checksummer.Read(p)
+	if err == io.EOF && v.sum() != v.want {
+		return n, fmt.Errorf("%w: got sha256 %s, want %s", ErrChecksumMismatch, v.sum(), v.want)
+	}
+	return n, err
+}
+
+func (v *verifier) Close() error {
+	return v.closer.Close()
+}
+
+// validate checks that bucket and name are valid in every blobstore: buckets
+// are single path elements not starting with a dot, and names are slash
+// separated paths without empty, "." or ".." elements.
+func validate(bucket, name string) error {
+	if err := validateBucket(bucket); err != nil {
+		return err
+	}
+	if name == "." || !fs.ValidPath(name) {
+		return fmt.Errorf("%w: object %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+func validateBucket(bucket string) error {
+	if bucket == "" || strings.HasPrefix(bucket, ".") || strings.Contains(bucket, "/") {
+		return fmt.Errorf("%w: bucket %q", ErrInvalidName, bucket)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// conformance tests a blobstore against the contract of Blobstore.
+type conformance struct {
+	store  Blobstore
+	bucket string
+
+	// bigSize is the size of an object that the blobstore creates in
+	// several steps, e.g. parts.
+	bigSize int
+
+	// tamper changes the contents of an object behind the blobstore, if it
+	// can be done.
+	tamper func(t *testing.T, bucket, name string)
+}
+
+func (c *conformance) run(t *testing.T) {
+	ctx := context.Background()
+	bucket := c.bucket
+
+	get := func(t *testing.T, name string) ([]byte, *Object) {
+		t.Helper()
+
+		rc, o, err := c.store.GetObject(ctx, bucket, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		b, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b, o
+	}
+
+	t.Run("create_get", func(t *testing.T) {
+		contents := []byte("hello, world")
+		created, err := c.store.CreateObject(ctx, bucket, "greeting.txt", bytes.NewReader(contents), &CreateOptions{
+			ContentType: "text/plain",
+			Metadata:    map[string]string{"Author": "me"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(contents)
+		want := &Object{
+			Bucket:      bucket,
+			Name:        "greeting.txt",
+			Size:        int64(len(contents)),
+			ContentType: "text/plain",
+			Metadata:    map[string]string{"author": "me"},
+			SHA256:      hex.EncodeToString(sum[:]),
+		}
+		checkObject(t, created, want)
+
+		got, o := get(t, "greeting.txt")
+		if !bytes.Equal(got, contents) {
+			t.Errorf("expected %q, got %q", contents, got)
+		}
+		checkObject(t, o, want)
+
+		stat, err := c.store.StatObject(ctx, bucket, "greeting.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkObject(t, stat, want)
+	})
+
+	t.Run("big", func(t *testing.T) {
+		contents := bytes.Repeat([]byte("0123456789abcdef"), c.bigSize/16+1)
+		created, err := c.store.CreateObject(ctx, bucket, "big.bin", bytes.NewReader(contents), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(contents)
+		checkObject(t, created, &Object{
+			Bucket:      bucket,
+			Name:        "big.bin",
+			Size:        int64(len(contents)),
+			ContentType: defaultContentType,
+			SHA256:      hex.EncodeToString(sum[:]),
+		})
+		if got, _ := get(t, "big.bin"); !bytes.Equal(got, contents) {
+			t.Errorf("expected the %d bytes written, got %d different ones", len(contents), len(got))
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		for _, s := range []string{"first", "second"} {
+			if _, err := c.store.CreateObject(ctx, bucket, "replaced", strings.NewReader(s), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got, _ := get(t, "replaced"); string(got) != "second" {
+			t.Errorf("expected second, got %q", got)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		for _, name := range []string{"dir/b/c", "dir/a.txt", "dir/a", "other"} {
+			if _, err := c.store.CreateObject(ctx, bucket, "list/"+name, strings.NewReader(name), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		list := func(prefix string, limit int) []string {
+			var names []string
+			for o, err := range c.store.ListObjects(ctx, bucket, prefix) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if o.Bucket != bucket || o.Size != int64(len(strings.TrimPrefix(o.Name, "list/"))) {
+					t.Errorf("unexpected object %+v", o)
+				}
+				if names = append(names, o.Name); len(names) == limit {
+					break
+				}
+			}
+			return names
+		}
+		if got, want := list("list/dir/", -1), []string{"list/dir/a", "list/dir/a.txt", "list/dir/b/c"}; !slices.Equal(got, want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+		if got, want := list("list/dir/a", -1), []string{"list/dir/a", "list/dir/a.txt"}; !slices.Equal(got, want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+		if got, want := list("list/", 3), []string{"list/dir/a", "list/dir/a.txt", "list/dir/b/c"}; !slices.Equal(got, want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+		if got := list("list/nothing", -1); len(got) != 0 {
+			t.Errorf("expected no objects, got %q", got)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if _, err := c.store.CreateObject(ctx, bucket, "deleted/object", strings.NewReader("x"), nil); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := c.store.DeleteObject(ctx, bucket, "deleted/object"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := c.store.StatObject(ctx, bucket, "deleted/object"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if _, _, err := c.store.GetObject(ctx, bucket, "deleted/object"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("invalid_names", func(t *testing.T) {
+		for _, name := range []string{"", "/abs", "a//b", "../up", "a/./b", "dir/"} {
+			if _, err := c.store.CreateObject(ctx, bucket, name, strings.NewReader("x"), nil); !errors.Is(err, ErrInvalidName) {
+				t.Errorf("%q: expected ErrInvalidName, got %v", name, err)
+			}
+		}
+		if _, err := c.store.CreateObject(ctx, ".hidden", "a", strings.NewReader("x"), nil); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("expected ErrInvalidName for the bucket, got %v", err)
+		}
+	})
+
+	t.Run("checksum_mismatch", func(t *testing.T) {
+		if c.tamper == nil {
+			t.Skip("the contents of objects can't be tampered with")
+		}
+		if _, err := c.store.CreateObject(ctx, bucket, "tampered", strings.NewReader("original"), nil); err != nil {
+			t.Fatal(err)
+		}
+		c.tamper(t, bucket, "tampered")
+
+		rc, _, err := c.store.GetObject(ctx, bucket, "tampered")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		if _, err := io.ReadAll(rc); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("expected ErrChecksumMismatch, got %v", err)
+		}
+	})
+}
+
+func checkObject(t *testing.T, got, want *Object) {
+	t.Helper()
+
+	if got.Updated.IsZero() {
+		t.Errorf("expected an update time")
+	}
+	g := *got
+	g.Updated = want.Updated
+	if g.Bucket != want.Bucket || g.Name != want.Name || g.Size != want.Size ||
+		g.ContentType != want.ContentType || g.SHA256 != want.SHA256 || len(g.Metadata) != len(want.Metadata) {
+		t.Errorf("expected %+v, got %+v", want, got)
+		return
+	}
+	for k, v := range want.Metadata {
+		if g.Metadata[k] != v {
+			t.Errorf("expected metadata %q, got %q", want.Metadata, g.Metadata)
+		}
+	}
+}
+
+func TestInMemory(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewInMemory(context.Background(), &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &conformance{
+		store:   store,
+		bucket:  "test",
+		bigSize: 1 << 20,
+		tamper: func(t *testing.T, bucket, name string) {
+			m := store.(*InMemory)
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.objects[bucket+"/"+name].contents = []byte("tampered")
+		},
+	}
+	c.run(t)
+}
+
+func TestFilesystem(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	store, err := NewFilesystem(context.Background(), &Config{FilesystemRoot: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &conformance{
+		store:   store,
+		bucket:  "test",
+		bigSize: 1 << 20,
+		tamper: func(t *testing.T, bucket, name string) {
+			if err := os.WriteFile(filepath.Join(root, bucket, name), []byte("tampered"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	c.run(t)
+
+	// Temporary files and the directories of deleted objects are cleaned up.
+	if entries, _ := os.ReadDir(filepath.Join(root, tmpDir)); len(entries) != 0 {
+		t.Errorf("expected no temporary files, got %d", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(root, "test", "deleted")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the directory of the deleted object to be removed, got %v", err)
+	}
+}
+
+func TestBlobstoreFor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cases := []struct {
+		name   string
+		config *Config
+		err    string
+	}{
+		{"in_memory", &Config{Type: "IN_MEMORY"}, ""},
+		{"filesystem", &Config{Type: "FILESYSTEM", FilesystemRoot: t.TempDir()}, ""},
+		{"filesystem_without_root", &Config{Type: "FILESYSTEM"}, "missing BLOBSTORE_FILESYSTEM_ROOT"},
+		{"s3", &Config{Type: "S3", S3Endpoint: "http://localhost:9000", S3AccessKeyID: "a", S3SecretAccessKey: "b", S3PartSize: minPartSize}, ""},
+		{"s3_small_parts", &Config{Type: "S3", S3Endpoint: "http://localhost:9000", S3AccessKeyID: "a", S3SecretAccessKey: "b", S3PartSize: 1024}, "must be at least"},
+		{"s3_invalid_endpoint", &Config{Type: "S3", S3Endpoint: "localhost:9000"}, "invalid BLOBSTORE_S3_ENDPOINT"},
+		{"unknown", &Config{Type: "GCS"}, "unknown or uncompiled blobstore"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store, err := BlobstoreFor(ctx, tc.config)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil || store == nil {
+				t.Errorf("expected a blobstore, got %v", err)
+			}
+		})
+	}
+
+	if got, want := RegisteredBlobstores(), []string{"FILESYSTEM", "IN_MEMORY", "S3"}; !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}